@@ -0,0 +1,226 @@
+package srtp
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	ariaBlockSize = 16
+	ariaMaxRounds = 16
+	ariaFieldPoly = 0x1b // x^8 + x^4 + x^3 + x + 1
+)
+
+// ariaCipher implements the ARIA block cipher https://tools.ietf.org/html/rfc5794
+type ariaCipher struct {
+	rounds   int
+	sbox     *ariaSBoxes
+	enc, dec [ariaMaxRounds + 1][ariaBlockSize]byte
+}
+
+// ariaSBoxes holds SB1 to SB4, SB1 being the AES S-box and SB3, SB4 the
+// inverses of SB1, SB2
+type ariaSBoxes [4][256]byte
+
+func newAriaCipher(key []byte) (cipher.Block, error) {
+	// Constants of the key schedule, each key size starts at a different one
+	c := [3][ariaBlockSize]byte{
+		{0x51, 0x7c, 0xc1, 0xb7, 0x27, 0x22, 0x0a, 0x94, 0xfe, 0x13, 0xab, 0xe8, 0xfa, 0x9a, 0x6e, 0xe0},
+		{0x6d, 0xb1, 0x4a, 0xcc, 0x9e, 0x21, 0xc8, 0x20, 0xff, 0x28, 0xb1, 0xd5, 0xef, 0x5d, 0xe2, 0xb0},
+		{0xdb, 0x92, 0x37, 0x1d, 0x21, 0x26, 0xe9, 0x70, 0x03, 0x24, 0x97, 0x75, 0x04, 0xe8, 0xc9, 0x0e},
+	}
+
+	a := &ariaCipher{sbox: newAriaSBoxes()}
+	var first int
+	switch len(key) {
+	case 16:
+		a.rounds, first = 12, 0
+	case 24:
+		a.rounds, first = 14, 1
+	case 32:
+		a.rounds, first = 16, 2
+	default:
+		return nil, fmt.Errorf("%w: %d", errInvalidARIAKeySize, len(key))
+	}
+
+	var kl, kr [ariaBlockSize]byte
+	copy(kl[:], key)
+	copy(kr[:], key[ariaBlockSize:])
+
+	var w [4][ariaBlockSize]byte
+	w[0] = kl
+	w[1] = xorBlock(a.fo(w[0], c[first]), kr)
+	w[2] = xorBlock(a.fe(w[1], c[(first+1)%3]), w[0])
+	w[3] = xorBlock(a.fo(w[2], c[(first+2)%3]), w[1])
+
+	for i, rot := range []int{19, 31, 128 - 61, 128 - 31, 128 - 19} {
+		for j := 0; j < 4 && i*4+j <= a.rounds; j++ {
+			a.enc[i*4+j] = xorBlock(w[j], rotateRight128(w[(j+1)%4], rot))
+		}
+	}
+
+	a.dec[0] = a.enc[a.rounds]
+	for i := 1; i < a.rounds; i++ {
+		a.dec[i] = ariaDiffuse(a.enc[a.rounds-i])
+	}
+	a.dec[a.rounds] = a.enc[0]
+
+	return a, nil
+}
+
+func (a *ariaCipher) BlockSize() int {
+	return ariaBlockSize
+}
+
+func (a *ariaCipher) Encrypt(dst, src []byte) {
+	a.crypt(&a.enc, dst, src)
+}
+
+func (a *ariaCipher) Decrypt(dst, src []byte) {
+	a.crypt(&a.dec, dst, src)
+}
+
+func (a *ariaCipher) wipe() {
+	a.enc = [ariaMaxRounds + 1][ariaBlockSize]byte{}
+	a.dec = [ariaMaxRounds + 1][ariaBlockSize]byte{}
+}
+
+func (a *ariaCipher) crypt(keys *[ariaMaxRounds + 1][ariaBlockSize]byte, dst, src []byte) {
+	var p [ariaBlockSize]byte
+	copy(p[:], src)
+
+	for i := 0; i < a.rounds-1; i++ {
+		if i%2 == 0 {
+			p = a.fo(p, keys[i])
+		} else {
+			p = a.fe(p, keys[i])
+		}
+	}
+
+	p = xorBlock(a.substitute(xorBlock(p, keys[a.rounds-1]), 2), keys[a.rounds])
+	copy(dst, p[:])
+}
+
+// fo is the odd round function
+func (a *ariaCipher) fo(d, rk [ariaBlockSize]byte) [ariaBlockSize]byte {
+	return ariaDiffuse(a.substitute(xorBlock(d, rk), 0))
+}
+
+// fe is the even round function
+func (a *ariaCipher) fe(d, rk [ariaBlockSize]byte) [ariaBlockSize]byte {
+	return ariaDiffuse(a.substitute(xorBlock(d, rk), 2))
+}
+
+// substitute applies SL1 with an offset of 0 and SL2 with an offset of 2
+func (a *ariaCipher) substitute(x [ariaBlockSize]byte, offset int) [ariaBlockSize]byte {
+	order := [4]int{0, 1, 2, 3}
+	if offset != 0 {
+		order = [4]int{2, 3, 0, 1}
+	}
+	for i := range x {
+		x[i] = a.sbox[order[i%4]][x[i]]
+	}
+	return x
+}
+
+// ariaDiffuse is the involutive diffusion layer A
+func ariaDiffuse(x [ariaBlockSize]byte) [ariaBlockSize]byte {
+	return [ariaBlockSize]byte{
+		x[3] ^ x[4] ^ x[6] ^ x[8] ^ x[9] ^ x[13] ^ x[14],
+		x[2] ^ x[5] ^ x[7] ^ x[8] ^ x[9] ^ x[12] ^ x[15],
+		x[1] ^ x[4] ^ x[6] ^ x[10] ^ x[11] ^ x[12] ^ x[15],
+		x[0] ^ x[5] ^ x[7] ^ x[10] ^ x[11] ^ x[13] ^ x[14],
+		x[0] ^ x[2] ^ x[5] ^ x[8] ^ x[11] ^ x[14] ^ x[15],
+		x[1] ^ x[3] ^ x[4] ^ x[9] ^ x[10] ^ x[14] ^ x[15],
+		x[0] ^ x[2] ^ x[7] ^ x[9] ^ x[10] ^ x[12] ^ x[13],
+		x[1] ^ x[3] ^ x[6] ^ x[8] ^ x[11] ^ x[12] ^ x[13],
+		x[0] ^ x[1] ^ x[4] ^ x[7] ^ x[10] ^ x[13] ^ x[15],
+		x[0] ^ x[1] ^ x[5] ^ x[6] ^ x[11] ^ x[12] ^ x[14],
+		x[2] ^ x[3] ^ x[5] ^ x[6] ^ x[8] ^ x[13] ^ x[15],
+		x[2] ^ x[3] ^ x[4] ^ x[7] ^ x[9] ^ x[12] ^ x[14],
+		x[1] ^ x[2] ^ x[6] ^ x[7] ^ x[9] ^ x[11] ^ x[12],
+		x[0] ^ x[3] ^ x[6] ^ x[7] ^ x[8] ^ x[10] ^ x[13],
+		x[0] ^ x[3] ^ x[4] ^ x[5] ^ x[9] ^ x[11] ^ x[14],
+		x[1] ^ x[2] ^ x[4] ^ x[5] ^ x[8] ^ x[10] ^ x[15],
+	}
+}
+
+func xorBlock(a, b [ariaBlockSize]byte) [ariaBlockSize]byte {
+	for i := range a {
+		a[i] ^= b[i]
+	}
+	return a
+}
+
+func rotateRight128(x [ariaBlockSize]byte, n int) [ariaBlockSize]byte {
+	hi, lo := binary.BigEndian.Uint64(x[:8]), binary.BigEndian.Uint64(x[8:])
+	if n >= 64 {
+		hi, lo, n = lo, hi, n-64
+	}
+	if n > 0 {
+		hi, lo = hi>>n|lo<<(64-n), lo>>n|hi<<(64-n)
+	}
+
+	var out [ariaBlockSize]byte
+	binary.BigEndian.PutUint64(out[:8], hi)
+	binary.BigEndian.PutUint64(out[8:], lo)
+	return out
+}
+
+// newAriaSBoxes computes the S-boxes from their algebraic definition: SB1 is
+// an affine transform of x^-1 and SB2 one of x^247 in GF(2^8)
+func newAriaSBoxes() *ariaSBoxes {
+	sb2Matrix := [8]byte{0xac, 0xc5, 0x12, 0xcf, 0x5b, 0x5f, 0x85, 0xee}
+
+	s := &ariaSBoxes{}
+	for x := 0; x < 256; x++ {
+		inv := gfPow(byte(x), 254, ariaFieldPoly)
+		sb1 := inv ^ bits.RotateLeft8(inv, 1) ^ bits.RotateLeft8(inv, 2) ^
+			bits.RotateLeft8(inv, 3) ^ bits.RotateLeft8(inv, 4) ^ 0x63
+
+		sb2 := gfAffine(sb2Matrix, gfPow(byte(x), 247, ariaFieldPoly), 0xe2)
+
+		s[0][x], s[1][x] = sb1, sb2
+		s[2][sb1], s[3][sb2] = byte(x), byte(x)
+	}
+	return s
+}
+
+// gfMul multiplies in GF(2^8), poly holds the low byte of the field polynomial
+func gfMul(a, b, poly byte) byte {
+	var r byte
+	for ; b != 0; b >>= 1 {
+		if b&1 != 0 {
+			r ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= poly
+		}
+	}
+	return r
+}
+
+func gfPow(x byte, e int, poly byte) byte {
+	r := byte(1)
+	for ; e > 0; e >>= 1 {
+		if e&1 != 0 {
+			r = gfMul(r, x, poly)
+		}
+		x = gfMul(x, x, poly)
+	}
+	return r
+}
+
+// gfAffine returns M*x + c over GF(2), cols holding the columns of M
+func gfAffine(cols [8]byte, x, c byte) byte {
+	for b := 0; b < 8; b++ {
+		if x&(1<<b) != 0 {
+			c ^= cols[b]
+		}
+	}
+	return c
+}
@@ -0,0 +1,38 @@
+package srtp
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// https://tools.ietf.org/html/rfc5794#appendix-A
+func TestAriaCipher(t *testing.T) {
+	plaintext, err := hex.DecodeString("00112233445566778899aabbccddeeff")
+	assert.NoError(t, err)
+
+	for keyLen, expected := range map[int]string{
+		16: "d718fbd6ab644c739da95f3be6451778",
+		24: "26449c1805dbe7aa25a468ce263a9e79",
+		32: "f92bd7c79fb72e2f2b8f80c1972d24fc",
+	} {
+		key := make([]byte, keyLen)
+		for i := range key {
+			key[i] = byte(i)
+		}
+
+		block, err := newAriaCipher(key)
+		assert.NoError(t, err)
+
+		ciphertext := make([]byte, ariaBlockSize)
+		block.Encrypt(ciphertext, plaintext)
+		assert.Equal(t, expected, hex.EncodeToString(ciphertext), "ARIA-%d", keyLen*8)
+
+		block.Decrypt(ciphertext, ciphertext)
+		assert.Equal(t, plaintext, ciphertext)
+	}
+
+	_, err = newAriaCipher(make([]byte, 8))
+	assert.ErrorIs(t, err, errInvalidARIAKeySize)
+}
@@ -0,0 +1,50 @@
+package srtp
+
+const defaultMaxAuthFailures = 64
+
+// AuthFailurePolicy decides what a session does with received packets that
+// fail authentication. They are dropped and counted in any case, see
+// SessionSRTP.AuthFailures.
+type AuthFailurePolicy int
+
+const (
+	// AuthFailureReport logs them and hands them to Config.OnDecryptError
+	AuthFailureReport AuthFailurePolicy = iota
+	// AuthFailureDrop drops them silently
+	AuthFailureDrop
+	// AuthFailureClose reports them, and closes the session after
+	// Config.MaxAuthFailures consecutive ones, such as when the peer changed
+	// keys without telling
+	AuthFailureClose
+)
+
+// authFailed applies the AuthFailurePolicy to a packet failing authentication,
+// it is called with decryptMutex held. It returns whether to report the packet.
+func (s *session) authFailed() bool {
+	s.authFailures++
+	s.consecutiveAuthFailures++
+
+	switch s.authFailurePolicy {
+	case AuthFailureDrop:
+		return false
+	case AuthFailureClose:
+		if s.consecutiveAuthFailures == s.maxAuthFailures {
+			s.log.Warnf("closing session after %d consecutive authentication failures", s.maxAuthFailures)
+			// The read loop holding decryptMutex must return for close to complete
+			go func() {
+				if err := s.child.Close(); err != nil {
+					s.log.Warnf("failed to close session: %v", err)
+				}
+			}()
+		}
+	}
+	return true
+}
+
+// authFailureCount returns how many received packets failed authentication
+func (s *session) authFailureCount() uint64 {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	return s.authFailures
+}
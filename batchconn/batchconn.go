@@ -0,0 +1,19 @@
+// Package batchconn reads the datagrams of a UDP conn in batches, with a
+// single recvmmsg call on Linux, so readers of high packet rate streams make
+// fewer syscalls. SRTP and SRTCP sessions use it for Config.ReadBatchSize,
+// other code reading RTP or RTCP from UDP can use it as well.
+package batchconn
+
+import "net"
+
+// New wraps conn to read batchSize packets of up to packetSize bytes at once,
+// if it is a *net.UDPConn and batching is supported. Other conns are returned
+// as is. The returned conn is also a net.PacketConn when conn is one. Only
+// one goroutine may read from it.
+func New(conn net.Conn, batchSize, packetSize int) net.Conn {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok || batchSize <= 1 {
+		return conn
+	}
+	return newConn(udpConn, batchSize, packetSize)
+}
@@ -0,0 +1,53 @@
+//go:build linux && !purego
+// +build linux,!purego
+
+package batchconn
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+// batchConn reads the packets of a UDP conn in batches
+type batchConn struct {
+	*net.UDPConn
+
+	packetConn  *ipv4.PacketConn
+	messages    []ipv4.Message
+	next, count int // of the read messages not returned yet
+}
+
+// newConn reads batches of conn with recvmmsg
+func newConn(conn *net.UDPConn, batchSize, packetSize int) net.Conn {
+	messages := make([]ipv4.Message, batchSize)
+	for i := range messages {
+		messages[i].Buffers = [][]byte{make([]byte, packetSize)}
+	}
+	return &batchConn{
+		UDPConn:    conn,
+		packetConn: ipv4.NewPacketConn(conn),
+		messages:   messages,
+	}
+}
+
+func (c *batchConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadFrom(b)
+	return n, err
+}
+
+// ReadFrom returns the next packet of the batch, reading another batch when
+// all were returned
+func (c *batchConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for c.next == c.count {
+		n, err := c.packetConn.ReadBatch(c.messages, 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		c.next, c.count = 0, n
+	}
+
+	m := &c.messages[c.next]
+	c.next++
+	return copy(b, m.Buffers[0][:m.N]), m.Addr, nil
+}
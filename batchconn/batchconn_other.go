@@ -0,0 +1,14 @@
+//go:build !linux || purego
+// +build !linux purego
+
+package batchconn
+
+import "net"
+
+// newConn returns conn as is: off Linux, ReadBatch of x/net falls back
+// to reading a single message, or is not implemented at all on Windows, js
+// and plan9, so packets are read one at a time. The purego build tag selects
+// this on Linux too, leaving out the platform-specific socket code.
+func newConn(conn *net.UDPConn, _, _ int) net.Conn {
+	return conn
+}
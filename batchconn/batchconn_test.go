@@ -0,0 +1,52 @@
+package batchconn
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBatchConn(t *testing.T) {
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	aConn, bConn := listen(), listen()
+	defer func() {
+		_ = aConn.Close()
+		_ = bConn.Close()
+	}()
+
+	if conn := New(aConn, 1, 1500); conn != aConn {
+		t.Fatal("Expected conn to be returned as is without batching")
+	}
+	conn := New(bConn, 2, 1500)
+	packetConn, ok := conn.(net.PacketConn)
+	if !ok {
+		t.Fatal("Expected a net.PacketConn")
+	}
+
+	// More packets than fit a batch
+	for i := byte(0); i < 5; i++ {
+		if _, err := aConn.WriteTo([]byte{i, i}, bConn.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1500)
+	for i := byte(0); i < 5; i++ {
+		n, addr, err := packetConn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 2 || b[0] != i {
+			t.Fatalf("Expected packet %d, got %v", i, b[:n])
+		} else if addr.String() != aConn.LocalAddr().String() {
+			t.Fatalf("Expected packet from %s, got %s", aConn.LocalAddr(), addr)
+		}
+	}
+}
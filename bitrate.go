@@ -0,0 +1,78 @@
+package srtp
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBitrateWindow = time.Second
+	bitrateBuckets       = 10
+)
+
+// bitrateEstimator averages the bytes it is given over a rolling window,
+// split in buckets so old traffic expires without keeping every sample
+type bitrateEstimator struct {
+	mu             sync.Mutex
+	bucketDuration time.Duration
+	buckets        [bitrateBuckets]uint64
+	lastBucket     int64
+	start          time.Time
+}
+
+func newBitrateEstimator(window time.Duration, now time.Time) *bitrateEstimator {
+	bucketDuration := window / bitrateBuckets
+	if bucketDuration <= 0 {
+		bucketDuration = 1
+	}
+
+	return &bitrateEstimator{
+		bucketDuration: bucketDuration,
+		lastBucket:     now.UnixNano() / int64(bucketDuration),
+		start:          now,
+	}
+}
+
+// advance clears the buckets that expired since the last call
+func (e *bitrateEstimator) advance(now time.Time) int64 {
+	bucket := now.UnixNano() / int64(e.bucketDuration)
+	for i := e.lastBucket + 1; i <= bucket && i <= e.lastBucket+bitrateBuckets; i++ {
+		e.buckets[i%bitrateBuckets] = 0
+	}
+	if bucket > e.lastBucket {
+		e.lastBucket = bucket
+	}
+	return e.lastBucket
+}
+
+func (e *bitrateEstimator) add(n int, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.buckets[e.advance(now)%bitrateBuckets] += uint64(n)
+}
+
+// bitrate returns the average bits per second over the window
+func (e *bitrateEstimator) bitrate(now time.Time) uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	bucket := e.advance(now)
+
+	var total uint64
+	for _, b := range e.buckets {
+		total += b
+	}
+
+	// The current bucket is only partially elapsed, and young estimators
+	// have not seen a full window yet
+	span := time.Duration(bitrateBuckets-1)*e.bucketDuration + time.Duration(now.UnixNano()-bucket*int64(e.bucketDuration))
+	if elapsed := now.Sub(e.start); elapsed < span {
+		span = elapsed
+	}
+	if span <= 0 {
+		return 0
+	}
+
+	return uint64(float64(total*8) / span.Seconds())
+}
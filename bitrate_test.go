@@ -0,0 +1,61 @@
+package srtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitrateEstimator(t *testing.T) {
+	start := time.Unix(0, 0)
+	e := newBitrateEstimator(time.Second, start)
+
+	assert.Equal(t, uint64(0), e.bitrate(start))
+
+	// 1250 bytes every 10ms for a full window is 1Mbps
+	for i := 0; i < 100; i++ {
+		e.add(1250, start.Add(time.Duration(i)*10*time.Millisecond))
+	}
+	assert.InDelta(t, 1000000, e.bitrate(start.Add(time.Second)), 20000)
+
+	// Young estimators average over their lifetime
+	young := newBitrateEstimator(time.Second, start)
+	young.add(1250, start)
+	assert.Equal(t, uint64(100000), young.bitrate(start.Add(100*time.Millisecond)))
+
+	// Traffic expires once out of the window
+	assert.Equal(t, uint64(0), e.bitrate(start.Add(3*time.Second)))
+}
+
+func TestSessionSRTPBitrate(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	aSession, bSession := buildSessionSRTPPair(t)
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	assert.NoError(t, err)
+	aWriteStream, err := aSession.OpenWriteStream()
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(0), aWriteStream.Bitrate())
+	assert.Equal(t, uint64(0), bReadStream.Bitrate())
+
+	_, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 1}, []byte{0x00, 0x01, 0x03, 0x04})
+	assert.NoError(t, err)
+	_, err = assertPayloadSRTP(t, bReadStream, 12, []byte{0x00, 0x01, 0x03, 0x04})
+	assert.NoError(t, err)
+
+	assert.NotZero(t, aWriteStream.Bitrate())
+	assert.NotZero(t, bReadStream.Bitrate())
+	assert.NotZero(t, bSession.ListStreams()[0].Bitrate)
+
+	assert.NoError(t, aSession.Close())
+	assert.NoError(t, bSession.Close())
+}
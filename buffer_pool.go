@@ -0,0 +1,54 @@
+package srtp
+
+import "fmt"
+
+const (
+	readBufferSize = 8192
+	// maxPacketSize is the largest packet packetio buffers hold
+	maxPacketSize = 65535
+)
+
+// packetSize returns the size of the buffers packets are read from the conn
+// into, see Config.MaxPacketSize
+func (c *Config) packetSize() (int, error) {
+	switch {
+	case c.MaxPacketSize == 0:
+		return readBufferSize, nil
+	case c.MaxPacketSize < 0 || c.MaxPacketSize > maxPacketSize:
+		return 0, fmt.Errorf("%w: %d", errInvalidMaxPacketSize, c.MaxPacketSize)
+	}
+	return c.MaxPacketSize, nil
+}
+
+// BufferPool supplies the scratch buffers sessions read packets from their
+// conn into and protect sent packets in, so servers running many sessions can
+// reuse that memory. A *sync.Pool whose New returns a *[]byte satisfies it,
+// other values it holds are ignored. The buffers of read streams come from
+// Config.BufferFactory instead.
+type BufferPool interface {
+	Get() interface{}
+	Put(interface{})
+}
+
+// getBuffer takes a buffer from Config.BufferPool, returning it along its
+// contents. Both are nil without a pool.
+func (s *session) getBuffer() (*[]byte, []byte) {
+	if s.bufferPool == nil {
+		return nil, nil
+	}
+	pooled, ok := s.bufferPool.Get().(*[]byte)
+	if !ok || pooled == nil {
+		return nil, nil
+	}
+	return pooled, *pooled
+}
+
+// putBuffer returns a buffer of getBuffer to the pool, holding used which
+// may have outgrown it
+func (s *session) putBuffer(pooled *[]byte, used []byte) {
+	if pooled == nil {
+		return
+	}
+	*pooled = used[:0]
+	s.bufferPool.Put(pooled)
+}
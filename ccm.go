@@ -0,0 +1,161 @@
+package srtp
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+const ccmBlockSize = 16
+
+// ccm implements the CCM mode of RFC 3610, which the standard library lacks
+// https://tools.ietf.org/html/rfc3610
+type ccm struct {
+	block              cipher.Block
+	nonceSize, tagSize int
+}
+
+func newCCM(block cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	switch {
+	case block.BlockSize() != ccmBlockSize:
+		return nil, errInvalidCCMParameters
+	case nonceSize < 7 || nonceSize > 13:
+		return nil, errInvalidCCMParameters
+	case tagSize < 4 || tagSize > 16 || tagSize%2 != 0:
+		return nil, errInvalidCCMParameters
+	}
+	return &ccm{block: block, nonceSize: nonceSize, tagSize: tagSize}, nil
+}
+
+func (c *ccm) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *ccm) Overhead() int {
+	return c.tagSize
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("srtp: incorrect CCM nonce length")
+	}
+	if uint64(len(plaintext)) >= 1<<(8*c.lengthSize()) {
+		panic("srtp: CCM message too large")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+c.tagSize)
+	tag := c.mac(nonce, plaintext, additionalData)
+	c.xorKeyStream(nonce, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], tag)
+	return ret
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		panic("srtp: incorrect CCM nonce length")
+	}
+	if len(ciphertext) < c.tagSize {
+		return nil, ErrAuthenticationFailure
+	}
+
+	n := len(ciphertext) - c.tagSize
+	tag := append([]byte{}, ciphertext[n:]...)
+	ret, out := sliceForAppend(dst, n)
+	c.xorKeyStream(nonce, out, ciphertext[:n])
+
+	if !authTagsEqual(tag, c.mac(nonce, out, additionalData)) {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, ErrAuthenticationFailure
+	}
+	return ret, nil
+}
+
+// lengthSize is L, the size of the length and counter fields
+func (c *ccm) lengthSize() int {
+	return 15 - c.nonceSize
+}
+
+// counterBlock returns A_i = flags || nonce || i
+func (c *ccm) counterBlock(nonce []byte, i uint64) []byte {
+	a := make([]byte, ccmBlockSize)
+	a[0] = byte(c.lengthSize() - 1)
+	copy(a[1:], nonce)
+	c.putLength(a, i)
+	return a
+}
+
+func (c *ccm) putLength(b []byte, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	copy(b[ccmBlockSize-c.lengthSize():], buf[8-c.lengthSize():])
+}
+
+// xorKeyStream encrypts src with the counter blocks starting at A_1
+func (c *ccm) xorKeyStream(nonce, dst, src []byte) {
+	cipher.NewCTR(c.block, c.counterBlock(nonce, 1)).XORKeyStream(dst, src)
+}
+
+// mac computes the CBC-MAC over B_0, the encoded additional data and the
+// message, encrypted with S_0
+func (c *ccm) mac(nonce, plaintext, additionalData []byte) []byte {
+	b0 := make([]byte, ccmBlockSize)
+	b0[0] = byte((c.tagSize-2)/2)<<3 | byte(c.lengthSize()-1)
+	if len(additionalData) > 0 {
+		b0[0] |= 0x40
+	}
+	copy(b0[1:], nonce)
+	c.putLength(b0, uint64(len(plaintext)))
+
+	x := make([]byte, ccmBlockSize)
+	c.cbcMAC(x, b0)
+
+	if len(additionalData) > 0 {
+		var encoded []byte
+		if len(additionalData) < 0xff00 {
+			encoded = make([]byte, 2, 2+len(additionalData))
+			binary.BigEndian.PutUint16(encoded, uint16(len(additionalData)))
+		} else {
+			encoded = make([]byte, 6, 6+len(additionalData))
+			encoded[0], encoded[1] = 0xff, 0xfe
+			binary.BigEndian.PutUint32(encoded[2:], uint32(len(additionalData)))
+		}
+		c.cbcMAC(x, append(encoded, additionalData...))
+	}
+	c.cbcMAC(x, plaintext)
+
+	s0 := make([]byte, ccmBlockSize)
+	c.block.Encrypt(s0, c.counterBlock(nonce, 0))
+	for i := range x {
+		x[i] ^= s0[i]
+	}
+	return x[:c.tagSize]
+}
+
+// cbcMAC chains data into x, padding the last block with zeroes
+func (c *ccm) cbcMAC(x, data []byte) {
+	for len(data) > 0 {
+		n := len(data)
+		if n > ccmBlockSize {
+			n = ccmBlockSize
+		}
+		for i := 0; i < n; i++ {
+			x[i] ^= data[i]
+		}
+		c.block.Encrypt(x, x)
+		data = data[n:]
+	}
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the
+// extension, as done by the standard library AEADs
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
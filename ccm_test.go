@@ -0,0 +1,44 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	return b
+}
+
+// Packet Vector #1 https://tools.ietf.org/html/rfc3610#section-8
+func TestCCM(t *testing.T) {
+	block, err := aes.NewCipher(decodeHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf"))
+	assert.NoError(t, err)
+
+	aead, err := newCCM(block, 13, 8)
+	assert.NoError(t, err)
+
+	nonce := decodeHex(t, "00000003020100a0a1a2a3a4a5")
+	aad := decodeHex(t, "0001020304050607")
+	plaintext := decodeHex(t, "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e")
+	expected := decodeHex(t, "588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0")
+
+	sealed := aead.Seal(nil, nonce, plaintext, aad)
+	assert.Equal(t, expected, sealed)
+
+	opened, err := aead.Open(nil, nonce, sealed, aad)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+
+	sealed[0] ^= 0xff
+	_, err = aead.Open(nil, nonce, sealed, aad)
+	assert.ErrorIs(t, err, ErrAuthenticationFailure)
+
+	_, err = newCCM(block, 12, 5)
+	assert.ErrorIs(t, err, errInvalidCCMParameters)
+}
@@ -0,0 +1,106 @@
+package srtp
+
+import "github.com/pion/rtp/v2"
+
+// Cipher protects packets for a custom protection profile. Its methods follow
+// the layout of RFC 3711: the rollover counter is passed for SRTP packets and
+// the SRTCP index, which the cipher appends to protected RTCP, for SRTCP ones.
+type Cipher interface {
+	// AuthTagLen is the length of the authentication tag appended to
+	// packets, it is placed after the SRTCP index
+	AuthTagLen() int
+	// AEADAuthTagLen is the length of the tag embedded in the ciphertext by
+	// AEAD ciphers, it is placed before the SRTCP index
+	AEADAuthTagLen() int
+	// RTCPIndex returns the SRTCP index of a protected RTCP packet
+	RTCPIndex(encrypted []byte) uint32
+
+	EncryptRTP(dst []byte, header *rtp.Header, payload []byte, roc uint32) ([]byte, error)
+	DecryptRTP(dst, ciphertext []byte, header *rtp.Header, headerLen int, roc uint32) ([]byte, error)
+	EncryptRTCP(dst, decrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error)
+	DecryptRTCP(dst, encrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error)
+}
+
+// CipherWiper is implemented by ciphers able to overwrite their keys, it is
+// called by Context.Wipe
+type CipherWiper interface {
+	Wipe()
+}
+
+// CipherFactory describes a protection profile that is not built in, see
+// CreateContextWithCipherFactory and Config.CipherFactory.
+type CipherFactory interface {
+	KeyLen() int
+	SaltLen() int
+	AuthTagLen() int
+	AEADAuthTagLen() int
+	NewCipher(masterKey, masterSalt []byte) (Cipher, error)
+}
+
+func cipherFactoryParams(f CipherFactory) profileParams {
+	return profileParams{
+		keyLen:         f.KeyLen(),
+		saltLen:        f.SaltLen(),
+		authTagLen:     f.AuthTagLen(),
+		aeadAuthTagLen: f.AEADAuthTagLen(),
+		newCipher: func(masterKey, masterSalt []byte) (srtpCipher, error) {
+			c, err := f.NewCipher(masterKey, masterSalt)
+			if err != nil {
+				return nil, err
+			}
+			return &customCipher{c}, nil
+		},
+	}
+}
+
+// customCipher adapts a Cipher to the internal cipher interface
+type customCipher struct {
+	Cipher
+}
+
+func (c *customCipher) wipe() {
+	if w, ok := c.Cipher.(CipherWiper); ok {
+		w.Wipe()
+	}
+}
+
+func (c *customCipher) authTagLen() int {
+	return c.AuthTagLen()
+}
+
+func (c *customCipher) aeadAuthTagLen() int {
+	return c.AEADAuthTagLen()
+}
+
+func (c *customCipher) rtpOverhead() int {
+	return c.AuthTagLen() + c.AEADAuthTagLen()
+}
+
+func (c *customCipher) getRTCPIndex(encrypted []byte) uint32 {
+	return c.RTCPIndex(encrypted)
+}
+
+func (c *customCipher) encryptRTP(dst []byte, header *rtp.Header, payload []byte, roc uint32) ([]byte, error) {
+	return c.EncryptRTP(dst, header, payload, roc)
+}
+
+// encryptRTPRaw marshals the header again, Cipher only takes parsed headers
+func (c *customCipher) encryptRTPRaw(dst, headerRaw, payload []byte, roc uint32) ([]byte, error) {
+	header := &rtp.Header{}
+	if _, err := header.Unmarshal(headerRaw); err != nil {
+		return nil, err
+	}
+	return c.EncryptRTP(dst, header, payload, roc)
+}
+
+func (c *customCipher) encryptRTCP(dst, decrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error) {
+	return c.EncryptRTCP(dst, decrypted, srtcpIndex, ssrc)
+}
+
+func (c *customCipher) decryptRTP(dst, ciphertext []byte, header *rtp.Header, headerLen int, roc uint32) ([]byte, error) {
+	return c.DecryptRTP(dst, ciphertext, header, headerLen, roc)
+}
+
+func (c *customCipher) decryptRTCP(dst, encrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error) {
+	return c.DecryptRTCP(dst, encrypted, srtcpIndex, ssrc)
+}
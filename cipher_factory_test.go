@@ -0,0 +1,132 @@
+package srtp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// xorCipher is a toy cipher XORing payloads with the first key byte
+type xorCipher struct {
+	key byte
+}
+
+type xorCipherFactory struct{}
+
+func (xorCipherFactory) KeyLen() int         { return 4 }
+func (xorCipherFactory) SaltLen() int        { return 2 }
+func (xorCipherFactory) AuthTagLen() int     { return 0 }
+func (xorCipherFactory) AEADAuthTagLen() int { return 0 }
+
+func (xorCipherFactory) NewCipher(masterKey, _ []byte) (Cipher, error) {
+	return &xorCipher{key: masterKey[0]}, nil
+}
+
+func (c *xorCipher) AuthTagLen() int     { return 0 }
+func (c *xorCipher) AEADAuthTagLen() int { return 0 }
+
+func (c *xorCipher) RTCPIndex(encrypted []byte) uint32 {
+	return binary.BigEndian.Uint32(encrypted[len(encrypted)-srtcpIndexSize:]) &^ (1 << 31)
+}
+
+func (c *xorCipher) xor(b []byte) {
+	for i := range b {
+		b[i] ^= c.key
+	}
+}
+
+func (c *xorCipher) EncryptRTP(dst []byte, header *rtp.Header, payload []byte, _ uint32) ([]byte, error) {
+	dst = growBufferSize(dst, header.MarshalSize()+len(payload))
+	n, err := header.MarshalTo(dst)
+	if err != nil {
+		return nil, err
+	}
+	copy(dst[n:], payload)
+	c.xor(dst[n:])
+	return dst, nil
+}
+
+func (c *xorCipher) DecryptRTP(dst, ciphertext []byte, _ *rtp.Header, headerLen int, _ uint32) ([]byte, error) {
+	copy(dst, ciphertext)
+	c.xor(dst[headerLen:])
+	return dst, nil
+}
+
+func (c *xorCipher) EncryptRTCP(dst, decrypted []byte, srtcpIndex, _ uint32) ([]byte, error) {
+	dst = allocateIfMismatch(dst, decrypted)
+	c.xor(dst[8:])
+	dst = append(dst, make([]byte, srtcpIndexSize)...)
+	binary.BigEndian.PutUint32(dst[len(dst)-srtcpIndexSize:], srtcpIndex|(1<<31))
+	return dst, nil
+}
+
+func (c *xorCipher) DecryptRTCP(dst, encrypted []byte, _, _ uint32) ([]byte, error) {
+	dst = dst[:len(encrypted)-srtcpIndexSize]
+	c.xor(dst[8:])
+	return dst, nil
+}
+
+func TestCipherFactory(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	key, salt := []byte{0xAA, 0, 0, 0}, []byte{0, 0}
+
+	encryptContext, err := CreateContextWithCipherFactory(key, salt, xorCipherFactory{})
+	assert.NoError(t, err)
+	decryptContext, err := CreateContextWithCipherFactory(key, salt, xorCipherFactory{})
+	assert.NoError(t, err)
+	_, err = CreateContextWithCipherFactory(key[:1], salt, xorCipherFactory{})
+	assert.Error(t, err)
+
+	pkt := &rtp.Packet{Header: rtp.Header{SSRC: 1}, Payload: []byte{0x01, 0x02}}
+	raw, err := pkt.Marshal()
+	assert.NoError(t, err)
+
+	encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xAB, 0xA8}, encrypted[len(raw)-2:])
+
+	decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, decrypted)
+
+	rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04}
+	encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+	assert.NoError(t, err)
+	decryptedRTCP, err := decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, rtcpPacket, decryptedRTCP)
+
+	// Sessions pick the factory up from their Config
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		CipherFactory: xorCipherFactory{},
+		Keys:          SessionKeys{key, salt, key, salt},
+	}
+	aSession, err := NewSessionSRTP(aPipe, config)
+	assert.NoError(t, err)
+	bSession, err := NewSessionSRTP(bPipe, config)
+	assert.NoError(t, err)
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	assert.NoError(t, err)
+	bReadStream, err := bSession.OpenReadStream(1)
+	assert.NoError(t, err)
+
+	_, err = aWriteStream.WriteRTP(&pkt.Header, pkt.Payload)
+	assert.NoError(t, err)
+	_, err = assertPayloadSRTP(t, bReadStream, 12, pkt.Payload)
+	assert.NoError(t, err)
+
+	assert.NoError(t, aSession.Close())
+	assert.NoError(t, bSession.Close())
+}
@@ -2,7 +2,9 @@ package srtp
 
 import (
 	"fmt"
+	"sort"
 
+	"github.com/pion/rtp/v2"
 	"github.com/pion/transport/replaydetector"
 )
 
@@ -15,7 +17,6 @@ const (
 	labelSRTCPAuthenticationTag = 0x04
 	labelSRTCPSalt              = 0x05
 
-	maxROCDisorder    = 100
 	maxSequenceNumber = 65535
 
 	srtcpIndexSize = 4
@@ -28,6 +29,7 @@ type srtpSSRCState struct {
 	rolloverHasProcessed bool
 	lastSequenceNumber   uint16
 	replayDetector       replaydetector.ReplayDetector
+	stats                CryptoStats
 }
 
 // Encrypt/Decrypt state for a single SRTCP SSRC
@@ -35,19 +37,70 @@ type srtcpSSRCState struct {
 	srtcpIndex     uint32
 	ssrc           uint32
 	replayDetector replaydetector.ReplayDetector
+	stats          CryptoStats
 }
 
 // Context represents a SRTP cryptographic context.
 // Context can only be used for one-way operations.
 // it must either used ONLY for encryption or ONLY for decryption.
+//
+// Packets are written to the dst buffer passed to EncryptRTP, DecryptRTP,
+// EncryptRTCP and DecryptRTCP, which may be the input itself. Once a SSRC
+// has been seen, no memory is allocated when dst has the capacity for the
+// result, except by the AES-F8 and double encryption profiles, custom
+// ciphers and rollover counter probing.
 type Context struct {
-	cipher srtpCipher
+	params      profileParams
+	cipher      srtpCipher
+	ssrcCiphers map[uint32]srtpCipher // keys installed with SetSSRCKeys
 
 	srtpSSRCStates  map[uint32]*srtpSSRCState
 	srtcpSSRCStates map[uint32]*srtcpSSRCState
 
 	newSRTCPReplayDetector func() replaydetector.ReplayDetector
 	newSRTPReplayDetector  func() replaydetector.ReplayDetector
+
+	// rocProbing retries failed decryptions with the neighbouring rollover counters
+	rocProbing bool
+
+	// header is used by EncryptRTP and DecryptRTP when not given one, so
+	// they do not allocate
+	header rtp.Header
+
+	// onDuplicate decides what decrypting a replayed packet returns, nil
+	// returns the error
+	onDuplicate func(*DuplicatedError) error
+
+	// hopByHop applies only the outer transform of a double encryption profile
+	hopByHop bool
+	// authenticationOnly leaves payloads in the clear, see AuthenticationOnly
+	authenticationOnly bool
+
+	// sendMKI identifies the master key of cipher, it is empty when packets
+	// carry no MKI. mkiCiphers holds every installed master key.
+	sendMKI    []byte
+	mkiCiphers map[string]srtpCipher
+	pendingMKI *pendingMKI
+
+	// keyUsage counts the packets each master key encrypted
+	keyUsage                    map[srtpCipher]*keyUsage
+	srtpLifetime, srtcpLifetime uint64
+	keyExpiringMargin           uint64
+	onKeyExpiring               func(*KeyExpiring)
+
+	// initialRolloverStates are applied once every option is, so their
+	// states get the replay detector configured
+	initialRolloverStates []func()
+
+	// wiped is set by Wipe, the context cannot protect packets anymore
+	wiped bool
+
+	// maxSSRCStates bounds the SSRCs tracked per protocol, zero is unbounded.
+	// The LRUs are only kept with a bound.
+	maxSSRCStates     int
+	ssrcLimitPolicy   SSRCLimitPolicy
+	srtpLRU, srtcpLRU *ssrcLRU
+	onSRTPEvicted     func(ssrc uint32)
 }
 
 // CreateContext creates a new SRTP Context.
@@ -59,39 +112,30 @@ type Context struct {
 //   decCtx, err := srtp.CreateContext(key, salt, profile, srtp.SRTPReplayProtection(256))
 //
 func CreateContext(masterKey, masterSalt []byte, profile ProtectionProfile, opts ...ContextOption) (c *Context, err error) {
-	keyLen, err := profile.keyLen()
+	params, err := profile.params()
 	if err != nil {
 		return nil, err
 	}
 
-	saltLen, err := profile.saltLen()
-	if err != nil {
-		return nil, err
-	}
+	return createContext(masterKey, masterSalt, params, opts...)
+}
 
-	if masterKeyLen := len(masterKey); masterKeyLen != keyLen {
-		return c, fmt.Errorf("%w expected(%d) actual(%d)", errShortSrtpMasterKey, masterKey, keyLen)
-	} else if masterSaltLen := len(masterSalt); masterSaltLen != saltLen {
-		return c, fmt.Errorf("%w expected(%d) actual(%d)", errShortSrtpMasterSalt, saltLen, masterSaltLen)
-	}
+// CreateContextWithCipherFactory creates a new SRTP Context for a protection
+// profile that is not built in, described by factory.
+func CreateContextWithCipherFactory(masterKey, masterSalt []byte, factory CipherFactory, opts ...ContextOption) (*Context, error) {
+	return createContext(masterKey, masterSalt, cipherFactoryParams(factory), opts...)
+}
 
-	c = &Context{
+func createContext(masterKey, masterSalt []byte, params profileParams, opts ...ContextOption) (*Context, error) {
+	c := &Context{
+		ssrcCiphers:     map[uint32]srtpCipher{},
+		keyUsage:        map[srtpCipher]*keyUsage{},
+		srtpLifetime:    maxSRTPLifetime,
+		srtcpLifetime:   maxSRTCPLifetime,
 		srtpSSRCStates:  map[uint32]*srtpSSRCState{},
 		srtcpSSRCStates: map[uint32]*srtcpSSRCState{},
 	}
 
-	switch profile {
-	case ProtectionProfileAeadAes128Gcm:
-		c.cipher, err = newSrtpCipherAeadAesGcm(masterKey, masterSalt)
-	case ProtectionProfileAes128CmHmacSha1_80:
-		c.cipher, err = newSrtpCipherAesCmHmacSha1(masterKey, masterSalt)
-	default:
-		return nil, fmt.Errorf("%w: %#v", errNoSuchSRTPProfile, profile)
-	}
-	if err != nil {
-		return nil, err
-	}
-
 	for _, o := range append(
 		[]ContextOption{ // Default options
 			SRTPNoReplayProtection(),
@@ -103,37 +147,157 @@ func CreateContext(masterKey, masterSalt []byte, profile ProtectionProfile, opts
 			return nil, errOpt
 		}
 	}
+	for _, apply := range c.initialRolloverStates {
+		apply()
+	}
+
+	if c.hopByHop {
+		if params.hopByHop == nil {
+			return nil, errHopByHopNotDouble
+		}
+		params = *params.hopByHop
+	}
+	if c.authenticationOnly {
+		var err error
+		if params, err = params.withNullCipher(); err != nil {
+			return nil, err
+		}
+	}
+
+	cipher, err := newSrtpCipher(masterKey, masterSalt, params)
+	if err != nil {
+		return nil, err
+	}
+	c.params, c.cipher = params, cipher
+	if len(c.sendMKI) > 0 {
+		c.mkiCiphers = map[string]srtpCipher{string(c.sendMKI): cipher}
+	}
 
 	return c, nil
 }
 
-// https://tools.ietf.org/html/rfc3550#appendix-A.1
-func (s *srtpSSRCState) nextRolloverCount(sequenceNumber uint16) (uint32, func()) {
+func newSrtpCipher(masterKey, masterSalt []byte, params profileParams) (srtpCipher, error) {
+	if masterKeyLen := len(masterKey); masterKeyLen != params.keyLen {
+		return nil, fmt.Errorf("%w expected(%d) actual(%d)", errShortSrtpMasterKey, params.keyLen, masterKeyLen)
+	} else if masterSaltLen := len(masterSalt); masterSaltLen != params.saltLen {
+		return nil, fmt.Errorf("%w expected(%d) actual(%d)", errShortSrtpMasterSalt, params.saltLen, masterSaltLen)
+	}
+
+	return params.newCipher(masterKey, masterSalt)
+}
+
+// UpdateKeys replaces the master key and salt of the context, e.g. after a
+// DTLS renegotiation. Rollover and replay state of every SSRC are kept, keys
+// installed with SetSSRCKeys stay in use for their SSRC. With an MKI, the
+// key of SendMKI is replaced.
+func (c *Context) UpdateKeys(masterKey, masterSalt []byte) error {
+	cipher, err := newSrtpCipher(masterKey, masterSalt, c.params)
+	if err != nil {
+		return err
+	}
+
+	c.setCipher(cipher)
+	return nil
+}
+
+func (c *Context) setCipher(cipher srtpCipher) {
+	c.retireCipher(c.cipher)
+	c.cipher = cipher
+	if len(c.sendMKI) > 0 {
+		c.mkiCiphers[string(c.sendMKI)] = cipher
+	}
+}
+
+// SetSSRCKeys installs a master key and salt used instead of the context's
+// for the SRTP and SRTCP packets of ssrc, e.g. to rotate the keys of a single
+// sender. Rollover and replay state of the SSRC are kept.
+func (c *Context) SetSSRCKeys(ssrc uint32, masterKey, masterSalt []byte) error {
+	cipher, err := newSrtpCipher(masterKey, masterSalt, c.params)
+	if err != nil {
+		return err
+	}
+
+	c.retireCipher(c.ssrcCiphers[ssrc])
+	c.ssrcCiphers[ssrc] = cipher
+	return nil
+}
+
+// retireCipher forgets a cipher that was replaced and wipes its keys
+func (c *Context) retireCipher(cipher srtpCipher) {
+	if cipher == nil {
+		return
+	}
+	delete(c.keyUsage, cipher)
+	cipher.wipe()
+}
+
+// Wipe overwrites the session keys and salts derived from every master key of
+// the context, then drops them. Encryption and decryption fail afterwards.
+// Master keys passed to the context are not retained by it, they belong to
+// the caller. Key schedules kept by crypto/aes and crypto/hmac cannot be
+// overwritten, they are released to the garbage collector.
+func (c *Context) Wipe() {
+	ciphers := []srtpCipher{c.cipher}
+	for _, cipher := range c.ssrcCiphers {
+		ciphers = append(ciphers, cipher)
+	}
+	for _, cipher := range c.mkiCiphers {
+		ciphers = append(ciphers, cipher)
+	}
+
+	// With an MKI, cipher is one of mkiCiphers
+	wiped := map[srtpCipher]bool{}
+	for _, cipher := range ciphers {
+		if cipher != nil && !wiped[cipher] {
+			wiped[cipher] = true
+			cipher.wipe()
+		}
+	}
+
+	c.cipher, c.ssrcCiphers, c.mkiCiphers, c.pendingMKI = nil, map[uint32]srtpCipher{}, map[string]srtpCipher{}, nil
+	c.keyUsage = map[srtpCipher]*keyUsage{}
+	c.wiped = true
+}
+
+// cipherFor returns the cipher protecting the packets of ssrc
+func (c *Context) cipherFor(ssrc uint32) srtpCipher {
+	if cipher, ok := c.ssrcCiphers[ssrc]; ok {
+		return cipher
+	}
+	return c.cipher
+}
+
+// nextRolloverCount estimates the rollover counter of a packet from the ROC
+// and s_l, the highest sequence number authenticated with it
+// https://tools.ietf.org/html/rfc3711#appendix-A
+func (s *srtpSSRCState) nextRolloverCount(sequenceNumber uint16) uint32 {
 	roc := s.rolloverCounter
+	if !s.rolloverHasProcessed {
+		return roc
+	}
 
-	switch {
-	case !s.rolloverHasProcessed:
-	case sequenceNumber == 0: // We exactly hit the rollover count
-		// Only update rolloverCounter if lastSequenceNumber is greater then maxROCDisorder
-		// otherwise we already incremented for disorder
-		if s.lastSequenceNumber > maxROCDisorder {
-			roc++
+	// No packet precedes the first rollover counter, so it is never decremented
+	seq, sl := int32(sequenceNumber), int32(s.lastSequenceNumber)
+	if sl < 1<<15 {
+		if seq-sl > 1<<15 && roc > 0 {
+			roc--
 		}
-	case s.lastSequenceNumber < maxROCDisorder &&
-		sequenceNumber > (maxSequenceNumber-maxROCDisorder):
-		// Our last sequence number incremented because we crossed 0, but then our current number was within maxROCDisorder of the max
-		// So we fell behind, drop to account for jitter
-		roc--
-	case sequenceNumber < maxROCDisorder &&
-		s.lastSequenceNumber > (maxSequenceNumber-maxROCDisorder):
-		// our current is within a maxROCDisorder of 0
-		// and our last sequence number was a high sequence number, increment to account for jitter
+	} else if sl-1<<15 > seq {
 		roc++
 	}
-	return roc, func() {
+	return roc
+}
+
+// updateRolloverCount records that a packet with the rollover counter roc
+// authenticated, following the update rules of RFC 3711
+// https://tools.ietf.org/html/rfc3711#section-3.3.1
+func (s *srtpSSRCState) updateRolloverCount(sequenceNumber uint16, roc uint32) {
+	switch {
+	case !s.rolloverHasProcessed || int32(roc-s.rolloverCounter) > 0:
 		s.rolloverHasProcessed = true
+		s.rolloverCounter, s.lastSequenceNumber = roc, sequenceNumber
+	case roc == s.rolloverCounter && sequenceNumber > s.lastSequenceNumber:
 		s.lastSequenceNumber = sequenceNumber
-		s.rolloverCounter = roc
 	}
 }
 
@@ -148,6 +312,9 @@ func (c *Context) getSRTPSSRCState(ssrc uint32) *srtpSSRCState {
 		replayDetector: c.newSRTPReplayDetector(),
 	}
 	c.srtpSSRCStates[ssrc] = s
+	if c.srtpLRU != nil {
+		c.srtpLRU.touch(ssrc)
+	}
 	return s
 }
 
@@ -162,6 +329,9 @@ func (c *Context) getSRTCPSSRCState(ssrc uint32) *srtcpSSRCState {
 		replayDetector: c.newSRTCPReplayDetector(),
 	}
 	c.srtcpSSRCStates[ssrc] = s
+	if c.srtcpLRU != nil {
+		c.srtcpLRU.touch(ssrc)
+	}
 	return s
 }
 
@@ -175,12 +345,39 @@ func (c *Context) ROC(ssrc uint32) (uint32, bool) {
 }
 
 // SetROC sets SRTP rollover counter value of specified SSRC.
+// Set before the first packet of the SSRC, e.g. by late joiners learning it
+// out of band, that packet is decrypted with it.
 func (c *Context) SetROC(ssrc uint32, roc uint32) {
 	s := c.getSRTPSSRCState(ssrc)
 	s.rolloverCounter = roc
 }
 
-// Index returns SRTCP index value of specified SSRC.
+// SetRolloverState sets the rollover counter of ssrc along with s_l, the
+// highest sequence number seen with it. Unlike SetROC, the first packet is
+// then decrypted with the rollover counter estimated from both, so a late
+// joiner whose first packet follows a wrap of the sequence number still
+// decrypts it.
+func (c *Context) SetRolloverState(ssrc, roc uint32, sequenceNumber uint16) {
+	s := c.getSRTPSSRCState(ssrc)
+	s.rolloverHasProcessed = true
+	s.rolloverCounter, s.lastSequenceNumber = roc, sequenceNumber
+}
+
+// SRTPIndex returns the 48-bit index, ROC * 2^16 + SEQ, a SRTP packet of
+// ssrc with sequenceNumber is protected with next, as estimated following
+// RFC 3711 Appendix A. It is false if the context has no state for ssrc.
+// Called right before DecryptRTP it gives the index the packet is decrypted
+// with, unless rollover counter probing picks another one.
+func (c *Context) SRTPIndex(ssrc uint32, sequenceNumber uint16) (uint64, bool) {
+	s, ok := c.srtpSSRCStates[ssrc]
+	if !ok {
+		return 0, false
+	}
+	return uint64(s.nextRolloverCount(sequenceNumber))<<16 | uint64(sequenceNumber), true
+}
+
+// Index returns SRTCP index value of specified SSRC, that of the last packet
+// sent or authenticated.
 func (c *Context) Index(ssrc uint32) (uint32, bool) {
 	s, ok := c.srtcpSSRCStates[ssrc]
 	if !ok {
@@ -194,3 +391,69 @@ func (c *Context) SetIndex(ssrc uint32, index uint32) {
 	s := c.getSRTCPSSRCState(ssrc)
 	s.srtcpIndex = index % (maxSRTCPIndex + 1)
 }
+
+// SSRCState is the state a Context tracks for a SSRC, see Context.SSRCStates
+type SSRCState struct {
+	SSRC uint32
+
+	// HasSRTP is set once a SRTP packet of the SSRC was seen. ROC is its
+	// rollover counter and LastIndex the highest SRTP index,
+	// ROC * 2^16 + SEQ, sent or authenticated.
+	HasSRTP   bool
+	ROC       uint32
+	LastIndex uint64
+
+	// HasSRTCP is set once a SRTCP packet of the SSRC was seen, SRTCPIndex
+	// is the index of the last one sent or authenticated.
+	HasSRTCP   bool
+	SRTCPIndex uint32
+}
+
+// SSRCStates returns the state of every SSRC the context tracks, ordered by
+// SSRC, for debugging and monitoring.
+func (c *Context) SSRCStates() []SSRCState {
+	states := make(map[uint32]*SSRCState, len(c.srtpSSRCStates))
+	get := func(ssrc uint32) *SSRCState {
+		if state, ok := states[ssrc]; ok {
+			return state
+		}
+		state := &SSRCState{SSRC: ssrc}
+		states[ssrc] = state
+		return state
+	}
+
+	for ssrc, s := range c.srtpSSRCStates {
+		state := get(ssrc)
+		state.HasSRTP = true
+		state.ROC = s.rolloverCounter
+		state.LastIndex = uint64(s.rolloverCounter)<<16 | uint64(s.lastSequenceNumber)
+	}
+	for ssrc, s := range c.srtcpSSRCStates {
+		state := get(ssrc)
+		state.HasSRTCP = true
+		state.SRTCPIndex = s.srtcpIndex
+	}
+
+	sorted := make([]SSRCState, 0, len(states))
+	for _, state := range states {
+		sorted = append(sorted, *state)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].SSRC < sorted[j].SSRC })
+	return sorted
+}
+
+// RemoveStream forgets the rollover counter, SRTCP index and replay state of
+// ssrc, e.g. once its sender left. Keys installed with SetSSRCKeys are kept. A
+// later packet of ssrc starts from a fresh state.
+func (c *Context) RemoveStream(ssrc uint32) {
+	c.forgetSRTPSSRC(ssrc)
+	c.forgetSRTCPSSRC(ssrc)
+}
+
+// duplicated reports a replayed packet, a nil error means it is silently dropped
+func (c *Context) duplicated(err *DuplicatedError) error {
+	if c.onDuplicate == nil {
+		return err
+	}
+	return c.onDuplicate(err)
+}
@@ -1,7 +1,12 @@
 package srtp
 
 import (
+	"bytes"
+	"errors"
+	"reflect"
 	"testing"
+
+	"github.com/pion/rtp/v2"
 )
 
 func TestContextROC(t *testing.T) {
@@ -41,3 +46,356 @@ func TestContextIndex(t *testing.T) {
 		t.Errorf("Index is set to 100, but returned %d", index)
 	}
 }
+
+func TestContextRemoveStream(t *testing.T) {
+	c, err := CreateContext(make([]byte, 16), make([]byte, 14), cipherContextAlgo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetROC(123, 100)
+	c.SetIndex(123, 100)
+	c.RemoveStream(123)
+	if _, ok := c.ROC(123); ok {
+		t.Error("ROC must return false for a removed SSRC")
+	}
+	if _, ok := c.Index(123); ok {
+		t.Error("Index must return false for a removed SSRC")
+	}
+}
+
+func TestContextInitialRolloverState(t *testing.T) {
+	encryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sender wraps right after the state was learned out of band
+	encryptContext.SetRolloverState(1, 5, 65530)
+	raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 2}, Payload: rtpTestCaseDecrypted()}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rocOnly, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rocOnly.SetROC(1, 5)
+	if _, err = rocOnly.DecryptRTP(nil, encrypted, nil); !errors.Is(err, ErrAuthenticationFailure) {
+		t.Fatalf("Expected %v, got %v", ErrAuthenticationFailure, err)
+	}
+
+	decryptContext, err := buildTestContext(SRTPReplayProtection(64), InitialRolloverState(1, 5, 65530))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(decrypted, raw) {
+		t.Fatalf("Expected %v, got %v", raw, decrypted)
+	}
+	if roc, _ := decryptContext.ROC(1); roc != 6 {
+		t.Fatalf("Expected ROC 6, got %d", roc)
+	}
+}
+
+func TestContextSSRCStates(t *testing.T) {
+	encryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if states := decryptContext.SSRCStates(); len(states) != 0 {
+		t.Fatalf("Expected no states, got %v", states)
+	}
+
+	// SSRC 2 wraps right after its state was learned out of band
+	encryptContext.SetRolloverState(2, 3, 65535)
+	decryptContext.SetRolloverState(2, 3, 65535)
+	for _, ssrc := range []uint32{2, 1} {
+		raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: ssrc, SequenceNumber: 7}, Payload: rtpTestCaseDecrypted()}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = decryptContext.DecryptRTP(nil, encrypted, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receiverReport := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02}
+	encrypted, err := encryptContext.EncryptRTCP(nil, receiverReport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decryptContext.DecryptRTCP(nil, encrypted, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []SSRCState{
+		{SSRC: 1, HasSRTP: true, LastIndex: 7},
+		{SSRC: 2, HasSRTP: true, ROC: 4, LastIndex: 4<<16 | 7, HasSRTCP: true, SRTCPIndex: 1},
+	}
+	if states := decryptContext.SSRCStates(); !reflect.DeepEqual(states, expected) {
+		t.Fatalf("Expected %v, got %v", expected, states)
+	}
+}
+
+func TestContextSRTPIndex(t *testing.T) {
+	encryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := decryptContext.SRTPIndex(1, 0); ok {
+		t.Fatal("Expected no index for an unknown SSRC")
+	}
+
+	// Packets of both sides of the wrap arrive reordered
+	encrypted := map[uint16][]byte{}
+	for _, seq := range []uint16{65534, 65535, 0, 1} {
+		raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: seq}, Payload: rtpTestCaseDecrypted()}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encrypted[seq], err = encryptContext.EncryptRTP(nil, raw, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		seq   uint16
+		index uint64
+	}{
+		{65534, 65534},
+		{0, 1 << 16},
+		{65535, 65535},
+		{1, 1<<16 | 1},
+	} {
+		if index, ok := decryptContext.SRTPIndex(1, c.seq); ok && index != c.index {
+			t.Fatalf("Expected index %d for %d, got %d", c.index, c.seq, index)
+		}
+		if _, err = decryptContext.DecryptRTP(nil, encrypted[c.seq], nil); err != nil {
+			t.Fatalf("Failed to decrypt %d: %v", c.seq, err)
+		}
+	}
+
+	// A late packet of the previous rollover must not move s_l back
+	if index, _ := decryptContext.SRTPIndex(1, 65000); index != 65000 {
+		t.Fatalf("Expected index 65000, got %d", index)
+	}
+	if index, _ := decryptContext.SRTPIndex(1, 2); index != 1<<16|2 {
+		t.Fatalf("Expected index %d, got %d", 1<<16|2, index)
+	}
+	if roc, _ := decryptContext.ROC(1); roc != 1 {
+		t.Fatalf("Expected ROC 1, got %d", roc)
+	}
+}
+
+func TestContextMaxSSRCStates(t *testing.T) {
+	encryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(ssrc uint32) []byte {
+		raw, marshalErr := (&rtp.Packet{Header: rtp.Header{SSRC: ssrc, SequenceNumber: 1}, Payload: rtpTestCaseDecrypted()}).Marshal()
+		if marshalErr != nil {
+			t.Fatal(marshalErr)
+		}
+		encrypted, encryptErr := encryptContext.EncryptRTP(nil, raw, nil)
+		if encryptErr != nil {
+			t.Fatal(encryptErr)
+		}
+		return encrypted
+	}
+
+	t.Run("Evict", func(t *testing.T) {
+		c, err := buildTestContext(MaxSSRCStates(2, SSRCLimitEvict))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var evicted []uint32
+		c.onSRTPEvicted = func(ssrc uint32) { evicted = append(evicted, ssrc) }
+
+		for _, ssrc := range []uint32{1, 2, 3} {
+			if _, err = c.DecryptRTP(nil, encrypt(ssrc), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(evicted) != 1 || evicted[0] != 1 {
+			t.Fatalf("Expected SSRC 1 to be evicted, got %v", evicted)
+		}
+		if _, ok := c.ROC(1); ok {
+			t.Fatal("Expected the state of SSRC 1 to be evicted")
+		}
+		if _, ok := c.ROC(3); !ok {
+			t.Fatal("Expected the state of SSRC 3 to be kept")
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		c, err := buildTestContext(MaxSSRCStates(2, SSRCLimitReject))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ssrc := range []uint32{1, 2} {
+			if _, err = c.DecryptRTP(nil, encrypt(ssrc), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err = c.DecryptRTP(nil, encrypt(3), nil); !errors.Is(err, errTooManySSRCs) {
+			t.Fatalf("Expected %v, got %v", errTooManySSRCs, err)
+		}
+		if _, err = c.EncryptRTP(nil, []byte{0x80, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 3}, nil); !errors.Is(err, errTooManySSRCs) {
+			t.Fatalf("Expected %v, got %v", errTooManySSRCs, err)
+		}
+	})
+
+	t.Run("EncryptNeverEvicts", func(t *testing.T) {
+		c, err := buildTestContext(MaxSSRCStates(2, SSRCLimitEvict))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// SSRC 1 wraps its sequence number, were its state evicted by SSRC 3
+		// it would restart with ROC 0 and reuse the IV of its first packet
+		type iv struct {
+			ssrc  uint32
+			index uint64
+		}
+		used := map[iv]bool{}
+		for _, p := range []struct {
+			ssrc uint32
+			seq  uint16
+		}{{1, 1}, {1, 30000}, {1, 60000}, {1, 65535}, {1, 0}, {2, 0}, {3, 0}, {1, 1}} {
+			raw, marshalErr := (&rtp.Packet{Header: rtp.Header{SSRC: p.ssrc, SequenceNumber: p.seq}, Payload: rtpTestCaseDecrypted()}).Marshal()
+			if marshalErr != nil {
+				t.Fatal(marshalErr)
+			}
+			if _, err = c.EncryptRTP(nil, raw, nil); p.ssrc == 3 {
+				if !errors.Is(err, errTooManySSRCs) {
+					t.Fatalf("Expected %v, got %v", errTooManySSRCs, err)
+				}
+				continue
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			roc, _ := c.ROC(p.ssrc)
+			key := iv{p.ssrc, uint64(roc)<<16 | uint64(p.seq)}
+			if used[key] {
+				t.Fatalf("SSRC %d reused index %d", key.ssrc, key.index)
+			}
+			used[key] = true
+		}
+
+		if _, err = c.EncryptRTCP(nil, []byte{0x81, 0xc8, 0, 1, 0, 0, 0, 3}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = c.EncryptRTCP(nil, []byte{0x81, 0xc8, 0, 1, 0, 0, 0, 4}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = c.EncryptRTCP(nil, []byte{0x81, 0xc8, 0, 1, 0, 0, 0, 5}, nil); !errors.Is(err, errTooManySSRCs) {
+			t.Fatalf("Expected %v, got %v", errTooManySSRCs, err)
+		}
+		if index, ok := c.Index(3); !ok || index != 1 {
+			t.Fatalf("Expected the SRTCP index of SSRC 3 to be kept, got %d", index)
+		}
+	})
+
+	t.Run("ForgedPacket", func(t *testing.T) {
+		c, err := buildTestContext(MaxSSRCStates(1, SSRCLimitReject))
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged := encrypt(1)
+		forged[len(forged)-1] ^= 0xFF
+		if _, err = c.DecryptRTP(nil, forged, nil); !errors.Is(err, ErrAuthenticationFailure) {
+			t.Fatalf("Expected %v, got %v", ErrAuthenticationFailure, err)
+		}
+		if _, ok := c.ROC(1); ok {
+			t.Fatal("Expected no state for a SSRC that never authenticated")
+		}
+		if _, err = c.DecryptRTP(nil, encrypt(2), nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestContextStats(t *testing.T) {
+	encryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptContext, err := buildTestContext(SRTPReplayProtection(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := decryptContext.Stats(1); ok {
+		t.Fatal("Stats must return false for unused SSRC")
+	}
+
+	raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 1}, Payload: rtpTestCaseDecrypted()}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decrypted, replayed, then tampered with
+	if _, err = decryptContext.DecryptRTP(nil, encrypted, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decryptContext.DecryptRTP(nil, encrypted, nil); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("Expected %v, got %v", ErrReplayed, err)
+	}
+	encrypted[len(encrypted)-1] ^= 0xFF
+	encrypted[3]++
+	if _, err = decryptContext.DecryptRTP(nil, encrypted, nil); !errors.Is(err, ErrAuthenticationFailure) {
+		t.Fatalf("Expected %v, got %v", ErrAuthenticationFailure, err)
+	}
+
+	if _, err = encryptContext.EncryptRTCP(nil, []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, ok := encryptContext.Stats(1)
+	if !ok {
+		t.Fatal("Stats must return true for used SSRC")
+	}
+	expected := StreamStats{
+		SRTP:  CryptoStats{Protected: 1, ProtectedBytes: uint64(len(encrypted))},
+		SRTCP: CryptoStats{Protected: 1, ProtectedBytes: 8 + 4 + 10},
+	}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+
+	stats, _ = decryptContext.Stats(1)
+	expected = StreamStats{
+		SRTP: CryptoStats{Unprotected: 1, UnprotectedBytes: uint64(len(encrypted)), AuthFailures: 1, ReplayDrops: 1},
+	}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
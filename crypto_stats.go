@@ -0,0 +1,47 @@
+package srtp
+
+// CryptoStats counts the packets of a SSRC a Context processed in one protocol
+type CryptoStats struct {
+	// Protected and ProtectedBytes count the packets encrypted and their
+	// size once protected
+	Protected, ProtectedBytes uint64
+	// Unprotected and UnprotectedBytes count the packets decrypted and their
+	// size while still protected
+	Unprotected, UnprotectedBytes uint64
+
+	// AuthFailures counts the packets that failed authentication, a burst of
+	// them hints at tampering or mismatched keys
+	AuthFailures uint64
+	// ReplayDrops counts the packets rejected by replay protection
+	ReplayDrops uint64
+}
+
+// StreamStats are the counters of a SSRC, see Context.Stats
+type StreamStats struct {
+	SRTP, SRTCP CryptoStats
+}
+
+// Stats returns the counters of ssrc, false if the context has no state for
+// it. They are reset by RemoveStream.
+func (c *Context) Stats(ssrc uint32) (StreamStats, bool) {
+	var stats StreamStats
+	srtpState, hasSRTP := c.srtpSSRCStates[ssrc]
+	if hasSRTP {
+		stats.SRTP = srtpState.stats
+	}
+	srtcpState, hasSRTCP := c.srtcpSSRCStates[ssrc]
+	if hasSRTCP {
+		stats.SRTCP = srtcpState.stats
+	}
+	return stats, hasSRTP || hasSRTCP
+}
+
+func (s *CryptoStats) protected(n int) {
+	s.Protected++
+	s.ProtectedBytes += uint64(n)
+}
+
+func (s *CryptoStats) unprotected(n int) {
+	s.Unprotected++
+	s.UnprotectedBytes += uint64(n)
+}
@@ -0,0 +1,222 @@
+package srtp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/pion/rtp/v2"
+)
+
+// EKT message types ending every SRTP packet of a session using EKT
+// https://tools.ietf.org/html/rfc8870#section-4.1
+const (
+	ektMsgTypeShort = 0x00
+	ektMsgTypeFull  = 0x02
+
+	// ektFullTrailerLen is SPI, EKTLen and the message type
+	ektFullTrailerLen = 5
+
+	defaultEKTFullFieldInterval = 16
+)
+
+// EKTKey protects the EKT fields carrying SRTP master keys, see RFC 8870.
+// Conferences distribute it with DTLS-SRTP along with the master salt every
+// sender uses.
+type EKTKey struct {
+	SPI        uint16
+	Key        []byte // 16 or 32 bytes, for AESKW128 or AESKW256
+	MasterSalt []byte
+}
+
+// EKTField is the content of a FullEKTField: the SRTP master key of a sender
+// and its rollover counter
+type EKTField struct {
+	SPI       uint16
+	MasterKey []byte
+	SSRC      uint32
+	ROC       uint32
+
+	// MasterSalt comes from the EKTKey of SPI, it is not sent
+	MasterSalt []byte
+}
+
+// EKTKeyManager holds the EKT keys of a conference. It appends EKT fields to
+// sent SRTP packets and splits them from received ones, see Config.EKT.
+type EKTKeyManager struct {
+	mu      sync.RWMutex
+	keys    map[uint16]EKTKey
+	sendSPI uint16
+}
+
+// NewEKTKeyManager creates a manager protecting sent fields with sendKey
+func NewEKTKeyManager(sendKey EKTKey) (*EKTKeyManager, error) {
+	m := &EKTKeyManager{keys: map[uint16]EKTKey{}, sendSPI: sendKey.SPI}
+	if err := m.AddKey(sendKey); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AddKey installs another EKT key, e.g. one of a new conference member
+func (m *EKTKeyManager) AddKey(key EKTKey) error {
+	if len(key.Key) != 16 && len(key.Key) != 32 {
+		return fmt.Errorf("%w: %d", errInvalidEKTKey, len(key.Key))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key.SPI] = key
+	return nil
+}
+
+// RemoveKey uninstalls the EKT key of spi, the sending one cannot be removed
+func (m *EKTKeyManager) RemoveKey(spi uint16) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if spi == m.sendSPI {
+		return fmt.Errorf("%w: %d is used for sending", errInvalidEKTKey, spi)
+	}
+	delete(m.keys, spi)
+	return nil
+}
+
+// SetSendSPI protects sent fields with the installed key of spi
+func (m *EKTKeyManager) SetSendSPI(spi uint16) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.keys[spi]; !ok {
+		return fmt.Errorf("%w: %d", errUnknownEKTSPI, spi)
+	}
+	m.sendSPI = spi
+	return nil
+}
+
+// AppendField appends a FullEKTField carrying field to a protected SRTP
+// packet, or a ShortEKTField if field is nil. field.SPI is ignored, the
+// sending key is used.
+func (m *EKTKeyManager) AppendField(packet []byte, field *EKTField) ([]byte, error) {
+	if field == nil {
+		return append(packet, ektMsgTypeShort), nil
+	}
+
+	m.mu.RLock()
+	key := m.keys[m.sendSPI]
+	m.mu.RUnlock()
+
+	plaintext := make([]byte, 1+len(field.MasterKey)+8)
+	plaintext[0] = byte(len(field.MasterKey))
+	n := 1 + copy(plaintext[1:], field.MasterKey)
+	binary.BigEndian.PutUint32(plaintext[n:], field.SSRC)
+	binary.BigEndian.PutUint32(plaintext[n+4:], field.ROC)
+
+	ciphertext, err := aesKeyWrapPad(key.Key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	trailer := make([]byte, ektFullTrailerLen)
+	binary.BigEndian.PutUint16(trailer, key.SPI)
+	binary.BigEndian.PutUint16(trailer[2:], uint16(len(ciphertext)+ektFullTrailerLen))
+	trailer[4] = ektMsgTypeFull
+
+	return append(append(packet, ciphertext...), trailer...), nil
+}
+
+// SplitField removes the EKT field ending a SRTP packet, returning its
+// content for a FullEKTField and nil for a ShortEKTField
+func (m *EKTKeyManager) SplitField(packet []byte) ([]byte, *EKTField, error) {
+	if len(packet) == 0 {
+		return nil, nil, fmt.Errorf("%w: empty packet", errInvalidEKTField)
+	}
+
+	switch msgType := packet[len(packet)-1]; msgType {
+	case ektMsgTypeShort:
+		return packet[:len(packet)-1], nil, nil
+	case ektMsgTypeFull:
+	default:
+		return nil, nil, fmt.Errorf("%w: message type %d", errInvalidEKTField, msgType)
+	}
+
+	if len(packet) < ektFullTrailerLen {
+		return nil, nil, fmt.Errorf("%w: too short", errInvalidEKTField)
+	}
+	trailer := packet[len(packet)-ektFullTrailerLen:]
+	spi, fieldLen := binary.BigEndian.Uint16(trailer), int(binary.BigEndian.Uint16(trailer[2:]))
+	if fieldLen < ektFullTrailerLen || fieldLen > len(packet) {
+		return nil, nil, fmt.Errorf("%w: length %d", errInvalidEKTField, fieldLen)
+	}
+
+	m.mu.RLock()
+	key, ok := m.keys[spi]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %d", errUnknownEKTSPI, spi)
+	}
+
+	plaintext, err := aesKeyUnwrapPad(key.Key, packet[len(packet)-fieldLen:len(packet)-ektFullTrailerLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(plaintext) == 0 || len(plaintext) != 1+int(plaintext[0])+8 {
+		return nil, nil, fmt.Errorf("%w: plaintext of %d bytes", errInvalidEKTField, len(plaintext))
+	}
+
+	n := 1 + int(plaintext[0])
+	return packet[:len(packet)-fieldLen], &EKTField{
+		SPI:        spi,
+		MasterKey:  plaintext[1:n],
+		SSRC:       binary.BigEndian.Uint32(plaintext[n:]),
+		ROC:        binary.BigEndian.Uint32(plaintext[n+4:]),
+		MasterSalt: key.MasterSalt,
+	}, nil
+}
+
+// fieldLen is the size of a FullEKTField carrying a master key of keyLen
+func (m *EKTKeyManager) fieldLen(keyLen int) int {
+	return 8 + (1+keyLen+8+7)/8*8 + ektFullTrailerLen
+}
+
+// trySSRCKeys decrypts a packet with keys learned for its SSRC, e.g. from an
+// EKT field, and installs them only if the packet authenticates. roc seeds the
+// rollover counter of a SSRC seen for the first time.
+func (c *Context) trySSRCKeys(dst, ciphertext []byte, header *rtp.Header, headerLen int, masterKey, masterSalt []byte, roc uint32) ([]byte, error) {
+	cipher, err := newSrtpCipher(masterKey, masterSalt, c.params)
+	if err != nil {
+		return nil, err
+	}
+
+	_, known := c.srtpSSRCStates[header.SSRC]
+	s := c.getSRTPSSRCState(header.SSRC)
+	previousState := *s
+	previousCipher, hadCipher := c.ssrcCiphers[header.SSRC]
+
+	c.ssrcCiphers[header.SSRC] = cipher
+	if !s.rolloverHasProcessed {
+		s.rolloverCounter = roc
+	}
+
+	// A dropped duplicate was not authenticated either
+	decrypted, err := c.decryptRTP(dst, ciphertext, header, headerLen)
+	if err != nil || decrypted == nil {
+		stats := s.stats
+		*s = previousState
+		s.stats = stats
+		if hadCipher {
+			c.ssrcCiphers[header.SSRC] = previousCipher
+		} else {
+			delete(c.ssrcCiphers, header.SSRC)
+		}
+		cipher.wipe()
+		if !known {
+			c.forgetSRTPSSRC(header.SSRC)
+		}
+		return nil, err
+	}
+
+	c.retireCipher(previousCipher)
+	return decrypted, nil
+}
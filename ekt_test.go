@@ -0,0 +1,111 @@
+package srtp
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEKTKey(spi uint16) EKTKey {
+	return EKTKey{
+		SPI:        spi,
+		Key:        bytes.Repeat([]byte{byte(spi)}, 16),
+		MasterSalt: []byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6},
+	}
+}
+
+func TestEKTField(t *testing.T) {
+	m, err := NewEKTKeyManager(testEKTKey(1))
+	assert.NoError(t, err)
+
+	packet := []byte{0x80, 0x00, 0x00, 0x01}
+	field := &EKTField{MasterKey: bytes.Repeat([]byte{0xAA}, 16), SSRC: 5000, ROC: 7}
+
+	full, err := m.AppendField(append([]byte{}, packet...), field)
+	assert.NoError(t, err)
+	assert.Len(t, full, len(packet)+m.fieldLen(16))
+
+	srtp, parsed, err := m.SplitField(full)
+	assert.NoError(t, err)
+	assert.Equal(t, packet, srtp)
+	assert.Equal(t, &EKTField{SPI: 1, MasterKey: field.MasterKey, SSRC: 5000, ROC: 7, MasterSalt: testEKTKey(1).MasterSalt}, parsed)
+
+	short, err := m.AppendField(append([]byte{}, packet...), nil)
+	assert.NoError(t, err)
+	srtp, parsed, err = m.SplitField(short)
+	assert.NoError(t, err)
+	assert.Equal(t, packet, srtp)
+	assert.Nil(t, parsed)
+
+	// Fields of unknown SPIs, tampered ones and unknown types are rejected
+	other, err := NewEKTKeyManager(testEKTKey(2))
+	assert.NoError(t, err)
+	_, _, err = other.SplitField(full)
+	assert.True(t, errors.Is(err, errUnknownEKTSPI))
+
+	full[len(packet)] ^= 0xFF
+	_, _, err = m.SplitField(full)
+	assert.True(t, errors.Is(err, errKeyUnwrap))
+
+	_, _, err = m.SplitField(append(packet, 0x01))
+	assert.True(t, errors.Is(err, errInvalidEKTField))
+
+	assert.True(t, errors.Is(m.RemoveKey(1), errInvalidEKTKey))
+	assert.True(t, errors.Is(m.SetSendSPI(2), errUnknownEKTSPI))
+	_, err = NewEKTKeyManager(EKTKey{SPI: 3, Key: []byte{1}})
+	assert.True(t, errors.Is(err, errInvalidEKTKey))
+}
+
+func TestSessionSRTPEKT(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+
+	// The receiver does not know the sender's key up front
+	senderKeys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+	receiverKeys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+	senderKeys.LocalMasterSalt = testEKTKey(1).MasterSalt
+
+	newSession := func(conn net.Conn, keys SessionKeys) *SessionSRTP {
+		ekt, ektErr := NewEKTKeyManager(testEKTKey(1))
+		assert.NoError(t, ektErr)
+		s, sessionErr := NewSessionSRTP(conn, &Config{
+			Profile:              ProtectionProfileAes128CmHmacSha1_80,
+			Keys:                 keys,
+			EKT:                  ekt,
+			EKTFullFieldInterval: 2,
+		})
+		assert.NoError(t, sessionErr)
+		return s
+	}
+	aPipe, bPipe := net.Pipe()
+	aSession, bSession := newSession(aPipe, senderKeys), newSession(bPipe, receiverKeys)
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	assert.NoError(t, err)
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	assert.NoError(t, err)
+
+	// Every other packet carries a ShortEKTField
+	for seq := uint16(1); seq <= 3; seq++ {
+		_, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, []byte{byte(seq)})
+		assert.NoError(t, err)
+		_, err = assertPayloadSRTP(t, bReadStream, 12, []byte{byte(seq)})
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, aSession.Close())
+	assert.NoError(t, bSession.Close())
+}
@@ -5,36 +5,139 @@ import (
 	"fmt"
 )
 
+// Errors of the failure classes applications may handle separately, tested
+// with errors.Is
 var (
-	errDuplicated                    = errors.New("duplicated packet")
+	// ErrAuthenticationFailure is returned for packets whose authentication
+	// tag does not verify, due to tampering or mismatched keys
+	ErrAuthenticationFailure = errors.New("failed to verify auth tag")
+	// ErrReplayed is wrapped by the *DuplicatedError of replayed packets
+	ErrReplayed = errors.New("duplicated packet")
+	// ErrShortBuffer is returned when a buffer lacks the capacity for the
+	// protected packet, see EncryptRTPInPlace
+	ErrShortBuffer = errors.New("buffer has not enough capacity for the protected packet")
+	// ErrSessionClosed is returned when writing to a closed session, or
+	// after CloseSend
+	ErrSessionClosed = errors.New("session is closed")
+	// ErrUnsupportedProfile is returned for protection profiles that are not
+	// implemented
+	ErrUnsupportedProfile = errors.New("no such SRTP Profile")
+)
+
+var (
+	errKeyExpired                    = errors.New("master key lifetime exceeded")
+	errKeyUnwrap                     = errors.New("failed to unwrap key")
+	errInvalidEKTKey                 = errors.New("invalid EKT key")
+	errUnknownEKTSPI                 = errors.New("no EKT key for SPI")
+	errInvalidEKTField               = errors.New("invalid EKT field")
 	errShortSrtpMasterKey            = errors.New("SRTP master key is not long enough")
 	errShortSrtpMasterSalt           = errors.New("SRTP master salt is not long enough")
-	errNoSuchSRTPProfile             = errors.New("no such SRTP Profile")
 	errNonZeroKDRNotSupported        = errors.New("indexOverKdr > 0 is not supported yet")
 	errExporterWrongLabel            = errors.New("exporter called with wrong label")
 	errNoConfig                      = errors.New("no config provided")
 	errNoConn                        = errors.New("no conn provided")
-	errFailedToVerifyAuthTag         = errors.New("failed to verify auth tag")
 	errTooShortRTCP                  = errors.New("packet is too short to be rtcp packet")
+	errTooShortRTPHeader             = errors.New("header is too short to be rtp header")
+	errTooShortSRTP                  = errors.New("packet is too short to be srtp packet")
+	errInvalidRTPDump                = errors.New("invalid rtpdump file")
+	errAcceptDeadlineExceeded        = errors.New("accept deadline exceeded")
+	errNotPacketConn                 = errors.New("conn must be a net.PacketConn when RemoteAddr is set")
+	errNoRemoteAddr                  = errors.New("session was not created with a RemoteAddr")
+	errConnDeadlineNotSupported      = errors.New("conn does not support deadlines")
+	errTransportShared               = errors.New("session shares its conn with another, see NewSessionPairMux")
+	errNullCipherNotAllowed          = errors.New("NULL cipher profiles require Config.AllowNullCipher")
+	errInvalidMaxPacketSize          = errors.New("Config.MaxPacketSize must be between 0 and 65535")
+	errFramedPacketTooLarge          = errors.New("packet too large for RFC 4571 framing")
+	errInvalidARIAKeySize            = errors.New("invalid ARIA key size")
+	errInvalidSEEDKeySize            = errors.New("invalid SEED key size")
+	errInvalidCCMParameters          = errors.New("invalid CCM block, nonce or tag size")
+	errHopByHopNotDouble             = errors.New("hop-by-hop mode requires a double encryption profile")
+	errAuthenticationOnlyNotHMAC     = errors.New("authentication only mode requires a HMAC-SHA1 profile")
+	errInvalidOHB                    = errors.New("invalid original header block")
+	errTooManySSRCs                  = errors.New("too many SSRCs tracked")
+	errContextWiped                  = errors.New("context keys were wiped")
+	errMKINotEnabled                 = errors.New("context was not created with a MKI")
+	errMKILength                     = errors.New("MKI length differs from the context's")
+	errUnknownMKI                    = errors.New("no master key for MKI")
+	errRemoveSendMKI                 = errors.New("cannot remove the master key used for sending")
+	errInvalidCryptoAttribute        = errors.New("invalid SDES crypto attribute")
+	errUnknownCryptoSuite            = errors.New("unknown SDES crypto suite")
+	errCryptoSuiteMismatch           = errors.New("local and remote crypto suites differ")
+	errUnsupportedSessionParam       = errors.New("unsupported SDES session parameter")
 	errPayloadDiffers                = errors.New("payload differs")
 	errStartedChannelUsedIncorrectly = errors.New("started channel used incorrectly, should only be closed")
+	errRTCPPacketExceedsMTU          = errors.New("rtcp packet does not fit in MTU")
+	errSendClosed                    = fmt.Errorf("%w for sending", ErrSessionClosed)
+	errSessionAlreadyStarted         = errors.New("session is already started")
+	errSessionNotStarted             = fmt.Errorf("%w before it was started", ErrSessionClosed)
+	errRemoteKeysInstalled           = errors.New("session already has remote keys")
+	errPausedWriteQueueFull          = errors.New("writes are paused and the queue is full")
+	errWritesPaused                  = errors.New("writes are paused")
+	errNoRetransmitCache             = errors.New("retransmit cache is not enabled")
+	errNotInRetransmitCache          = errors.New("packet is not in the retransmit cache")
+	errZeroKeepaliveSSRC             = errors.New("keepalives need a non-zero KeepaliveSSRC")
+	errKeepaliveSSRC                 = errors.New("SSRC is reserved for keepalives")
 
-	errStreamNotInited     = errors.New("stream has not been inited, unable to close")
-	errStreamAlreadyClosed = errors.New("stream is already closed")
-	errStreamAlreadyInited = errors.New("stream is already inited")
-	errFailedTypeAssertion = errors.New("failed to cast child")
+	errStreamNotInited          = errors.New("stream has not been inited, unable to close")
+	errStreamAlreadyClosed      = errors.New("stream is already closed")
+	errStreamAlreadyInited      = errors.New("stream is already inited")
+	errStreamNotDetached        = errors.New("stream is not detached")
+	errReadDeadlineNotSupported = errors.New("stream buffer does not support read deadlines")
+	errStreamExists             = errors.New("session already has a stream for the SSRC")
+	errSSRCIgnored              = errors.New("SSRC is ignored by the session")
+	errSSRCNotAccepted          = errors.New("SSRC is not in Config.AcceptedSSRCs")
+	errFailedTypeAssertion      = errors.New("failed to cast child")
 )
 
-type errorDuplicated struct {
+// DuplicatedError is returned when decrypting a packet the replay protection
+// has already seen, unless DropDuplicates or OnDuplicate is used
+type DuplicatedError struct {
 	Proto string // srtp or srtcp
 	SSRC  uint32
 	Index uint32 // sequence number or index
 }
 
-func (e *errorDuplicated) Error() string {
-	return fmt.Sprintf("%s ssrc=%d index=%d: %v", e.Proto, e.SSRC, e.Index, errDuplicated)
+func (e *DuplicatedError) Error() string {
+	return fmt.Sprintf("%s ssrc=%d index=%d: %v", e.Proto, e.SSRC, e.Index, ErrReplayed)
+}
+
+func (e *DuplicatedError) Unwrap() error {
+	return ErrReplayed
+}
+
+// KeyExpiredError is returned when encrypting a packet with a master key that
+// already protected the maximum number of packets, see OnKeyExpiring
+type KeyExpiredError struct {
+	Proto   string // srtp or srtcp
+	SSRC    uint32
+	Packets uint64 // lifetime of the key
+}
+
+func (e *KeyExpiredError) Error() string {
+	return fmt.Sprintf("%s ssrc=%d after %d packets: %v", e.Proto, e.SSRC, e.Packets, errKeyExpired)
+}
+
+func (e *KeyExpiredError) Unwrap() error {
+	return errKeyExpired
+}
+
+// timeoutError is returned when a deadline is exceeded, it implements net.Error
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return e.err.Error()
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e *timeoutError) Timeout() bool {
+	return true
 }
 
-func (e *errorDuplicated) Unwrap() error {
-	return errDuplicated
+func (e *timeoutError) Temporary() bool {
+	return true
 }
@@ -0,0 +1,83 @@
+package srtp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+)
+
+// framedHeaderSize is the size of the length prefix of RFC 4571
+const framedHeaderSize = 2
+
+// FramedConn carries packets over a stream transport, such as TCP or TLS, by
+// prefixing each with its 2 byte length as RFC 4571 specifies. Frames split
+// over several reads of the transport are reassembled, and those coalesced in
+// one read are returned one at a time.
+type FramedConn struct {
+	net.Conn
+
+	readMu sync.Mutex
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	frame   []byte
+}
+
+// NewFramedConn returns a conn framing the packets written to and read from
+// stream. A read deadline hit in the middle of a frame breaks the framing,
+// stream should be closed then.
+func NewFramedConn(stream io.ReadWriter) *FramedConn {
+	conn := newReadWriterConn(stream)
+	return &FramedConn{Conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// Read reads the next frame into b. Like a datagram, a frame larger than b
+// is truncated to it and its remainder discarded. Empty frames are skipped.
+func (c *FramedConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	var header [framedHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return 0, err
+		}
+		size := int(binary.BigEndian.Uint16(header[:]))
+		if size == 0 {
+			continue
+		}
+
+		n := size
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := io.ReadFull(c.reader, b[:n]); err != nil {
+			return 0, err
+		}
+		if _, err := c.reader.Discard(size - n); err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+}
+
+// Write writes b as one frame, b must not be larger than 65535 bytes
+func (c *FramedConn) Write(b []byte) (int, error) {
+	if len(b) > maxPacketSize {
+		return 0, errFramedPacketTooLarge
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// Header and packet are written at once, not to send the header in a
+	// segment of its own
+	c.frame = append(c.frame[:0], byte(len(b)>>8), byte(len(b)))
+	c.frame = append(c.frame, b...)
+	if _, err := c.Conn.Write(c.frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -8,4 +8,5 @@ require (
 	github.com/pion/rtp/v2 v2.0.0
 	github.com/pion/transport v0.12.3
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/net v0.0.0-20210119194325-5f4716e94777
 )
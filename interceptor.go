@@ -0,0 +1,103 @@
+package srtp
+
+import (
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp/v2"
+)
+
+// Attributes carries metadata alongside packets through a chain of readers
+// and writers, in the style of interceptor chains of WebRTC stacks.
+type Attributes map[interface{}]interface{}
+
+// RTPWriter is used by chains to write RTP packets
+type RTPWriter interface {
+	Write(header *rtp.Header, payload []byte, attributes Attributes) (int, error)
+}
+
+// RTPReader is used by chains to read RTP packets
+type RTPReader interface {
+	Read(b []byte, attributes Attributes) (int, Attributes, error)
+}
+
+// RTCPWriter is used by chains to write RTCP packets
+type RTCPWriter interface {
+	Write(pkts []rtcp.Packet, attributes Attributes) (int, error)
+}
+
+// RTCPReader is used by chains to read RTCP packets
+type RTCPReader interface {
+	Read(b []byte, attributes Attributes) (int, Attributes, error)
+}
+
+// RTPWriterFunc is an adapter for RTPWriter
+type RTPWriterFunc func(header *rtp.Header, payload []byte, attributes Attributes) (int, error)
+
+// Write calls f
+func (f RTPWriterFunc) Write(header *rtp.Header, payload []byte, attributes Attributes) (int, error) {
+	return f(header, payload, attributes)
+}
+
+// RTPReaderFunc is an adapter for RTPReader
+type RTPReaderFunc func(b []byte, attributes Attributes) (int, Attributes, error)
+
+// Read calls f
+func (f RTPReaderFunc) Read(b []byte, attributes Attributes) (int, Attributes, error) {
+	return f(b, attributes)
+}
+
+// RTCPWriterFunc is an adapter for RTCPWriter
+type RTCPWriterFunc func(pkts []rtcp.Packet, attributes Attributes) (int, error)
+
+// Write calls f
+func (f RTCPWriterFunc) Write(pkts []rtcp.Packet, attributes Attributes) (int, error) {
+	return f(pkts, attributes)
+}
+
+// RTCPReaderFunc is an adapter for RTCPReader
+type RTCPReaderFunc func(b []byte, attributes Attributes) (int, Attributes, error)
+
+// Read calls f
+func (f RTCPReaderFunc) Read(b []byte, attributes Attributes) (int, Attributes, error) {
+	return f(b, attributes)
+}
+
+// NewRTPWriter returns a RTPWriter protecting packets with the session of w
+func NewRTPWriter(w *WriteStreamSRTP) RTPWriter {
+	return RTPWriterFunc(func(header *rtp.Header, payload []byte, _ Attributes) (int, error) {
+		return w.WriteRTP(header, payload)
+	})
+}
+
+// NewRTPReader returns a RTPReader reading the decrypted packets of r
+func NewRTPReader(r *ReadStreamSRTP) RTPReader {
+	return RTPReaderFunc(func(b []byte, attributes Attributes) (int, Attributes, error) {
+		if attributes == nil {
+			attributes = Attributes{}
+		}
+		n, err := r.Read(b)
+		return n, attributes, err
+	})
+}
+
+// NewRTCPWriter returns a RTCPWriter sending packets as one compound with the
+// session of w
+func NewRTCPWriter(w *WriteStreamSRTCP) RTCPWriter {
+	return RTCPWriterFunc(func(pkts []rtcp.Packet, _ Attributes) (int, error) {
+		raw, err := rtcp.Marshal(pkts)
+		if err != nil {
+			return 0, err
+		}
+		return w.Write(raw)
+	})
+}
+
+// NewRTCPReader returns a RTCPReader reading the decrypted packets of r
+func NewRTCPReader(r *ReadStreamSRTCP) RTCPReader {
+	return RTCPReaderFunc(func(b []byte, attributes Attributes) (int, Attributes, error) {
+		if attributes == nil {
+			attributes = Attributes{}
+		}
+		n, err := r.Read(b)
+		return n, attributes, err
+	})
+}
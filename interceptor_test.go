@@ -0,0 +1,64 @@
+package srtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptorAdapters(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSRTP, bSRTP := buildSessionSRTPPair(t)
+	aSRTCP, bSRTCP := buildSessionSRTCPPair(t)
+
+	aWriteStream, err := aSRTP.OpenWriteStream()
+	assert.NoError(t, err)
+	bReadStream, err := bSRTP.OpenReadStream(testSSRC)
+	assert.NoError(t, err)
+
+	_, err = NewRTPWriter(aWriteStream).Write(&rtp.Header{SSRC: testSSRC}, testPayload, nil)
+	assert.NoError(t, err)
+
+	b := make([]byte, 1500)
+	n, attributes, err := NewRTPReader(bReadStream).Read(b, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, attributes)
+
+	pkt := &rtp.Packet{}
+	assert.NoError(t, pkt.Unmarshal(b[:n]))
+	assert.Equal(t, testPayload, pkt.Payload)
+
+	aRTCPWriteStream, err := aSRTCP.OpenWriteStream()
+	assert.NoError(t, err)
+	bRTCPReadStream, err := bSRTCP.OpenReadStream(testSSRC)
+	assert.NoError(t, err)
+
+	pli := &rtcp.PictureLossIndication{SenderSSRC: 1, MediaSSRC: testSSRC}
+	_, err = NewRTCPWriter(aRTCPWriteStream).Write([]rtcp.Packet{pli}, nil)
+	assert.NoError(t, err)
+
+	in := Attributes{"key": "value"}
+	n, attributes, err = NewRTCPReader(bRTCPReadStream).Read(b, in)
+	assert.NoError(t, err)
+	assert.Equal(t, in, attributes)
+
+	pkts, err := rtcp.Unmarshal(b[:n])
+	assert.NoError(t, err)
+	assert.Equal(t, []rtcp.Packet{pli}, pkts)
+
+	for _, s := range []interface{ Close() error }{aSRTP, bSRTP, aSRTCP, bSRTCP} {
+		assert.NoError(t, s.Close())
+	}
+}
@@ -2,10 +2,20 @@ package srtp
 
 import (
 	"crypto/aes"
+	"crypto/cipher"
 	"encoding/binary"
 )
 
+// blockFactory creates the block cipher of a profile, such as aes.NewCipher
+type blockFactory func(key []byte) (cipher.Block, error)
+
 func aesCmKeyDerivation(label byte, masterKey, masterSalt []byte, indexOverKdr int, outLen int) ([]byte, error) {
+	return ctrKeyDerivation(aes.NewCipher, label, masterKey, masterSalt, indexOverKdr, outLen)
+}
+
+// ctrKeyDerivation is the counter mode PRF of RFC 3711 with the block cipher
+// of the profile, RFC 8269 uses it with ARIA
+func ctrKeyDerivation(newBlock blockFactory, label byte, masterKey, masterSalt []byte, indexOverKdr int, outLen int) ([]byte, error) {
 	if indexOverKdr != 0 {
 		// 24-bit "index DIV kdr" must be xored to prf input.
 		return nil, errNonZeroKDRNotSupported
@@ -16,27 +26,31 @@ func aesCmKeyDerivation(label byte, masterKey, masterSalt []byte, indexOverKdr i
 	// concatenation of the encryption key label 0x00 with (index DIV kdr),
 	// - index is 'rollover count' and DIV is 'divided by'
 
-	nMasterKey := len(masterKey)
+	// The PRF input is a single AES block whatever the key size, see
+	// https://tools.ietf.org/html/rfc6188#section-3
 	nMasterSalt := len(masterSalt)
 
-	prfIn := make([]byte, nMasterKey)
+	prfIn := make([]byte, aes.BlockSize)
+	defer zeroBytes(prfIn)
 	copy(prfIn[:nMasterSalt], masterSalt)
 
 	prfIn[7] ^= label
 
 	// The resulting value is then AES encrypted using the master key to get the cipher key.
-	block, err := aes.NewCipher(masterKey)
+	block, err := newBlock(masterKey)
 	if err != nil {
 		return nil, err
 	}
+	defer wipeBlock(block)
 
-	out := make([]byte, ((outLen+nMasterKey)/nMasterKey)*nMasterKey)
+	out := make([]byte, ((outLen+aes.BlockSize)/aes.BlockSize)*aes.BlockSize)
 	var i uint16
-	for n := 0; n < outLen; n += nMasterKey {
-		binary.BigEndian.PutUint16(prfIn[nMasterKey-2:], i)
-		block.Encrypt(out[n:n+nMasterKey], prfIn)
+	for n := 0; n < outLen; n += aes.BlockSize {
+		binary.BigEndian.PutUint16(prfIn[aes.BlockSize-2:], i)
+		block.Encrypt(out[n:n+aes.BlockSize], prfIn)
 		i++
 	}
+	zeroBytes(out[outLen:])
 	return out[:outLen], nil
 }
 
@@ -48,8 +62,8 @@ func aesCmKeyDerivation(label byte, masterKey, masterSalt []byte, indexOverKdr i
 // -       passing through 65,535
 // i = 2^16 * ROC + SEQ
 // IV = (salt*2 ^ 16) | (ssrc*2 ^ 64) | (i*2 ^ 16)
-func generateCounter(sequenceNumber uint16, rolloverCounter uint32, ssrc uint32, sessionSalt []byte) []byte {
-	counter := make([]byte, 16)
+func generateCounter(sequenceNumber uint16, rolloverCounter uint32, ssrc uint32, sessionSalt []byte) [16]byte {
+	var counter [16]byte
 
 	binary.BigEndian.PutUint32(counter[4:], ssrc)
 	binary.BigEndian.PutUint32(counter[8:], rolloverCounter)
@@ -0,0 +1,46 @@
+package srtp
+
+// Maximum number of packets a master key may protect
+// https://tools.ietf.org/html/rfc3711#section-9.2
+const (
+	maxSRTPLifetime  = 1 << 48
+	maxSRTCPLifetime = 1 << 31
+)
+
+// KeyExpiring is passed to the OnKeyExpiring handler
+type KeyExpiring struct {
+	Proto     string // srtp or srtcp
+	SSRC      uint32 // of the packet that reached the margin
+	Remaining uint64 // packets the key can still encrypt
+}
+
+type keyUsage struct {
+	srtp, srtcp             uint64
+	srtpWarned, srtcpWarned bool
+}
+
+// countPacket accounts a packet about to be encrypted with cipher, failing
+// once the key exhausted its lifetime
+func (c *Context) countPacket(cipher srtpCipher, proto string, ssrc uint32) error {
+	u, ok := c.keyUsage[cipher]
+	if !ok {
+		u = &keyUsage{}
+		c.keyUsage[cipher] = u
+	}
+
+	count, warned, lifetime := &u.srtp, &u.srtpWarned, c.srtpLifetime
+	if proto == "srtcp" {
+		count, warned, lifetime = &u.srtcp, &u.srtcpWarned, c.srtcpLifetime
+	}
+
+	if *count >= lifetime {
+		return &KeyExpiredError{Proto: proto, SSRC: ssrc, Packets: lifetime}
+	}
+	*count++
+
+	if remaining := lifetime - *count; c.onKeyExpiring != nil && !*warned && remaining <= c.keyExpiringMargin {
+		*warned = true
+		c.onKeyExpiring(&KeyExpiring{Proto: proto, SSRC: ssrc, Remaining: remaining})
+	}
+	return nil
+}
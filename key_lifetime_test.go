@@ -0,0 +1,61 @@
+package srtp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/rtp/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyLifetime(t *testing.T) {
+	keys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+
+	var expiring []*KeyExpiring
+	c, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80,
+		OnKeyExpiring(2, func(e *KeyExpiring) { expiring = append(expiring, e) }))
+	assert.NoError(t, err)
+	c.srtpLifetime, c.srtcpLifetime = 5, 3
+
+	for seq := uint16(1); seq <= 5; seq++ {
+		raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: seq}, Payload: []byte{byte(seq)}}).Marshal()
+		assert.NoError(t, err)
+		_, err = c.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []*KeyExpiring{{Proto: "srtp", SSRC: 1, Remaining: 2}}, expiring)
+
+	raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 6}}).Marshal()
+	assert.NoError(t, err)
+	_, err = c.EncryptRTP(nil, raw, nil)
+	var expired *KeyExpiredError
+	assert.True(t, errors.As(err, &expired))
+	assert.Equal(t, &KeyExpiredError{Proto: "srtp", SSRC: 1, Packets: 5}, expired)
+
+	rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+	for i := 0; i < 3; i++ {
+		_, err = c.EncryptRTCP(nil, rtcpPacket, nil)
+		assert.NoError(t, err)
+	}
+	_, err = c.EncryptRTCP(nil, rtcpPacket, nil)
+	assert.True(t, errors.Is(err, errKeyExpired))
+	index, _ := c.Index(1)
+	assert.Equal(t, uint32(3), index)
+	assert.Len(t, expiring, 2)
+
+	// A new key starts a new lifetime
+	assert.NoError(t, c.SetSSRCKeys(1, keys.LocalMasterKey, keys.LocalMasterSalt))
+	_, err = c.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+}
+
+func TestMasterKeyLifetime(t *testing.T) {
+	keys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+
+	c, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80, MasterKeyLifetime(1<<40))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1<<40), c.srtpLifetime)
+	assert.Equal(t, uint64(maxSRTCPLifetime), c.srtcpLifetime)
+}
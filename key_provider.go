@@ -0,0 +1,125 @@
+package srtp
+
+import (
+	"context"
+	"time"
+)
+
+const defaultKeyingMaterialTimeout = 5 * time.Second
+
+// KeyingMaterialProvider fetches the keys of SSRCs as they appear, e.g. from
+// a key management service, see Config.KeyingMaterialProvider.
+type KeyingMaterialProvider interface {
+	// StreamKeys returns the keys of ssrc like Config.StreamKeys holds them,
+	// directions left empty use Config.Keys. ctx is done once the session
+	// gives up waiting.
+	StreamKeys(ctx context.Context, ssrc uint32) (SessionKeys, error)
+}
+
+// maxKeyFetches bounds how many SSRCs a session fetches the keys of at once,
+// so packets forged with random SSRCs cannot pile up fetches
+const maxKeyFetches = 64
+
+// keyFetch is the state of the keys of a SSRC being fetched by a session
+// with a KeyingMaterialProvider
+type keyFetch struct {
+	pending [][]byte // packets received while fetching
+}
+
+// decryptOrQueue decrypts buf, or queues it until the keys of its SSRC are
+// fetched. It must be called with decryptMutex held.
+func (s *session) decryptOrQueue(buf []byte) {
+	if s.keyProvider != nil {
+		if ssrc, ok := s.child.packetSSRC(buf); ok && s.needsKeys(ssrc) {
+			f, ok := s.keyFetches[ssrc]
+			if !ok {
+				if !s.child.admitsKeyFetch(ssrc) {
+					return
+				} else if len(s.keyFetches) >= s.maxKeyFetches() {
+					s.log.Debugf("dropping packet of ssrc %d, too many keys are being fetched", ssrc)
+					s.streamsLimited++
+					return
+				}
+				f = &keyFetch{}
+				s.keyFetches[ssrc] = f
+				go s.fetchKeys(ssrc, f)
+			}
+
+			if len(f.pending) < s.earlyPacketQueueSize {
+				f.pending = append(f.pending, append([]byte{}, buf...))
+			} else {
+				s.log.Debugf("dropping packet of ssrc %d received before its keys, queue is full", ssrc)
+			}
+			return
+		}
+	}
+
+	s.decrypt(buf)
+}
+
+// needsKeys tells whether the keys of ssrc are to be fetched before its
+// packets are decrypted: it has no keys of its own, and none of its packets
+// authenticated. It must be called with decryptMutex held.
+func (s *session) needsKeys(ssrc uint32) bool {
+	if _, ok := s.remoteContext.ssrcCiphers[ssrc]; ok {
+		return false
+	}
+	_, knownSRTP := s.remoteContext.srtpSSRCStates[ssrc]
+	_, knownSRTCP := s.remoteContext.srtcpSSRCStates[ssrc]
+	return !knownSRTP && !knownSRTCP
+}
+
+// maxKeyFetches returns how many SSRCs keys may be fetched for at once, no
+// more than Config.MaxSSRCStates lets the remote context track
+func (s *session) maxKeyFetches() int {
+	if max := s.remoteContext.maxSSRCStates; max > 0 && max < maxKeyFetches {
+		return max
+	}
+	return maxKeyFetches
+}
+
+// fetchKeys asks the KeyingMaterialProvider for the keys of ssrc, then
+// decrypts the packets queued meanwhile. Without keys in time they are
+// decrypted with the session-wide ones.
+func (s *session) fetchKeys(ssrc uint32, f *keyFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.keyTimeout)
+	defer cancel()
+
+	type result struct {
+		keys SessionKeys
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		keys, err := s.keyProvider.StreamKeys(ctx, ssrc)
+		results <- result{keys, err}
+	}()
+
+	var err error
+	select {
+	case r := <-results:
+		err = r.err
+		if err == nil {
+			err = s.installStreamKeys(ssrc, r.keys)
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-s.closed:
+		return
+	}
+	if err != nil {
+		s.log.Warnf("failed to get keys of ssrc %d: %v", ssrc, err)
+	}
+
+	s.decryptMutex.Lock()
+	defer s.unlockDecrypt()
+
+	// The packets of a SSRC removed meanwhile are dropped
+	if s.keyFetches[ssrc] != f {
+		return
+	}
+	delete(s.keyFetches, ssrc)
+	for _, buf := range f.pending {
+		s.decrypt(buf)
+	}
+}
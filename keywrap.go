@@ -0,0 +1,87 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// keyWrapAIV is the alternative initial value of AES key wrap with padding
+const keyWrapAIV = 0xa65959a6
+
+// aesKeyWrapPad wraps plaintext with kek using AES key wrap with padding
+// https://tools.ietf.org/html/rfc5649
+func aesKeyWrapPad(kek, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := (len(plaintext) + 7) / 8
+	out := make([]byte, 8+8*n)
+	binary.BigEndian.PutUint32(out, keyWrapAIV)
+	binary.BigEndian.PutUint32(out[4:], uint32(len(plaintext)))
+	copy(out[8:], plaintext)
+
+	if n == 1 {
+		block.Encrypt(out, out)
+		return out, nil
+	}
+
+	b := make([]byte, aes.BlockSize)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, out[:8])
+			copy(b[8:], out[8*i:8*i+8])
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out, binary.BigEndian.Uint64(b)^t)
+			copy(out[8*i:], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// aesKeyUnwrapPad reverses aesKeyWrapPad, failing if the integrity check does
+func aesKeyUnwrapPad(kek, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 16 || len(ciphertext)%8 != 0 {
+		return nil, errKeyUnwrap
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(ciphertext)/8 - 1
+	out := append([]byte{}, ciphertext...)
+
+	if n == 1 {
+		block.Decrypt(out, out)
+	} else {
+		b := make([]byte, aes.BlockSize)
+		for j := 5; j >= 0; j-- {
+			for i := n; i >= 1; i-- {
+				t := uint64(n*j + i)
+				binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(out)^t)
+				copy(b[8:], out[8*i:8*i+8])
+				block.Decrypt(b, b)
+
+				copy(out, b[:8])
+				copy(out[8*i:], b[8:])
+			}
+		}
+	}
+
+	mli := int(binary.BigEndian.Uint32(out[4:]))
+	var aiv [4]byte
+	binary.BigEndian.PutUint32(aiv[:], keyWrapAIV)
+	if !authTagsEqual(out[:4], aiv[:]) || mli <= 8*(n-1) || mli > 8*n {
+		return nil, errKeyUnwrap
+	}
+	if subtle.ConstantTimeCompare(out[8+mli:], make([]byte, 8*n-mli)) != 1 {
+		return nil, errKeyUnwrap
+	}
+	return out[8 : 8+mli], nil
+}
@@ -0,0 +1,40 @@
+package srtp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// https://tools.ietf.org/html/rfc5649#section-6
+func TestAESKeyWrapPad(t *testing.T) {
+	kek := decodeHex(t, "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+
+	for _, test := range []struct {
+		key, wrapped string
+	}{
+		{
+			key:     "c37b7e6492584340bed12207808941155068f738",
+			wrapped: "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a",
+		},
+		{
+			key:     "466f7250617369",
+			wrapped: "afbeb0f07dfbf5419200f2ccb50bb24f",
+		},
+	} {
+		key, wrapped := decodeHex(t, test.key), decodeHex(t, test.wrapped)
+
+		actual, err := aesKeyWrapPad(kek, key)
+		assert.NoError(t, err)
+		assert.Equal(t, wrapped, actual)
+
+		unwrapped, err := aesKeyUnwrapPad(kek, wrapped)
+		assert.NoError(t, err)
+		assert.Equal(t, key, unwrapped)
+
+		wrapped[0] ^= 0xff
+		_, err = aesKeyUnwrapPad(kek, wrapped)
+		assert.True(t, errors.Is(err, errKeyUnwrap))
+	}
+}
@@ -0,0 +1,70 @@
+package srtp
+
+import (
+	"crypto/rand"
+	"net"
+)
+
+// NewLoopback returns two session pairs connected to each other over
+// in-memory pipes, keyed with freshly generated keys for profile. It lets
+// applications test their media pipelines against real SRTP without sockets
+// or DTLS. Both pairs must be closed.
+func NewLoopback(profile ProtectionProfile) (*SessionPair, *SessionPair, error) {
+	aKeys, err := generateLoopbackKeys(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	bKeys := SessionKeys{
+		LocalMasterKey:   aKeys.RemoteMasterKey,
+		LocalMasterSalt:  aKeys.RemoteMasterSalt,
+		RemoteMasterKey:  aKeys.LocalMasterKey,
+		RemoteMasterSalt: aKeys.LocalMasterSalt,
+	}
+
+	aRTP, bRTP := net.Pipe()
+	aRTCP, bRTCP := net.Pipe()
+	closePipes := func() {
+		for _, c := range []net.Conn{aRTP, bRTP, aRTCP, bRTCP} {
+			_ = c.Close()
+		}
+	}
+
+	a, err := NewSessionPair(aRTP, aRTCP, &Config{Profile: profile, Keys: aKeys})
+	if err != nil {
+		closePipes()
+		return nil, nil, err
+	}
+
+	b, err := NewSessionPair(bRTP, bRTCP, &Config{Profile: profile, Keys: bKeys})
+	if err != nil {
+		_ = a.Close()
+		closePipes()
+		return nil, nil, err
+	}
+
+	return a, b, nil
+}
+
+func generateLoopbackKeys(profile ProtectionProfile) (SessionKeys, error) {
+	keyLen, err := profile.keyLen()
+	if err != nil {
+		return SessionKeys{}, err
+	}
+	saltLen, err := profile.saltLen()
+	if err != nil {
+		return SessionKeys{}, err
+	}
+
+	keys := SessionKeys{
+		LocalMasterKey:   make([]byte, keyLen),
+		LocalMasterSalt:  make([]byte, saltLen),
+		RemoteMasterKey:  make([]byte, keyLen),
+		RemoteMasterSalt: make([]byte, saltLen),
+	}
+	for _, b := range [][]byte{keys.LocalMasterKey, keys.LocalMasterSalt, keys.RemoteMasterKey, keys.RemoteMasterSalt} {
+		if _, err := rand.Read(b); err != nil {
+			return SessionKeys{}, err
+		}
+	}
+	return keys, nil
+}
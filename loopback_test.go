@@ -0,0 +1,57 @@
+package srtp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopback(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	if _, _, err := NewLoopback(0); !errors.Is(err, ErrUnsupportedProfile) {
+		t.Fatalf("Expected %v, got %v", ErrUnsupportedProfile, err)
+	}
+
+	for _, profile := range []ProtectionProfile{ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAeadAes128Gcm} {
+		a, b, err := NewLoopback(profile)
+		assert.NoError(t, err)
+
+		writeStream, err := a.SRTP.OpenWriteStream()
+		assert.NoError(t, err)
+		_, err = writeStream.WriteRTP(&rtp.Header{SSRC: 1}, []byte{0x01, 0x02})
+		assert.NoError(t, err)
+
+		readStream, ssrc, err := b.SRTP.AcceptStream()
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(1), ssrc)
+		_, header, err := readStream.ReadRTP(make([]byte, 1500))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(1), header.SSRC)
+
+		rtcpWriteStream, err := b.SRTCP.OpenWriteStream()
+		assert.NoError(t, err)
+		raw, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{SenderSSRC: 2, MediaSSRC: 1}})
+		assert.NoError(t, err)
+		_, err = rtcpWriteStream.Write(raw)
+		assert.NoError(t, err)
+
+		rtcpReadStream, ssrc, err := a.SRTCP.AcceptStream()
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(1), ssrc)
+		_, err = rtcpReadStream.Read(make([]byte, 1500))
+		assert.NoError(t, err)
+
+		assert.NoError(t, a.Close())
+		assert.NoError(t, b.Close())
+	}
+}
@@ -0,0 +1,119 @@
+package srtp
+
+import "fmt"
+
+// pendingMKI is a switch of the outbound master key waiting for its index
+type pendingMKI struct {
+	mki       []byte
+	fromIndex uint64
+}
+
+// AddMasterKey installs another master key, identified by mki, for a context
+// created with the MasterKeyIdentifier option. Inbound packets are accepted
+// under any installed key; SetSendMKI selects the one protecting outbound
+// packets.
+func (c *Context) AddMasterKey(mki, masterKey, masterSalt []byte) error {
+	if len(c.sendMKI) == 0 {
+		return errMKINotEnabled
+	} else if len(mki) != len(c.sendMKI) {
+		return fmt.Errorf("%w: %d != %d", errMKILength, len(mki), len(c.sendMKI))
+	}
+
+	cipher, err := newSrtpCipher(masterKey, masterSalt, c.params)
+	if err != nil {
+		return err
+	}
+
+	c.mkiCiphers[string(mki)] = cipher
+	return nil
+}
+
+// RemoveMasterKey uninstalls the master key identified by mki, e.g. once a
+// rotation is over. The key selected by SetSendMKI, initially the one the
+// context was created with, cannot be removed, decrypting contexts included.
+func (c *Context) RemoveMasterKey(mki []byte) error {
+	if _, ok := c.mkiCiphers[string(mki)]; !ok {
+		return fmt.Errorf("%w: %x", errUnknownMKI, mki)
+	} else if string(mki) == string(c.sendMKI) {
+		return errRemoveSendMKI
+	}
+
+	c.retireCipher(c.mkiCiphers[string(mki)])
+	delete(c.mkiCiphers, string(mki))
+	if c.pendingMKI != nil && string(c.pendingMKI.mki) == string(mki) {
+		c.pendingMKI = nil
+	}
+	return nil
+}
+
+// SetSendMKI protects outbound packets with the master key identified by mki
+// once a SRTP packet of index fromIndex or more, ROC << 16 | SEQ, is
+// encrypted. SRTCP packets switch at the same time. A fromIndex of 0 switches
+// right away.
+func (c *Context) SetSendMKI(mki []byte, fromIndex uint64) error {
+	if _, ok := c.mkiCiphers[string(mki)]; !ok {
+		return fmt.Errorf("%w: %x", errUnknownMKI, mki)
+	}
+
+	c.pendingMKI = &pendingMKI{mki: append([]byte{}, mki...), fromIndex: fromIndex}
+	if fromIndex == 0 {
+		c.switchMKI(0)
+	}
+	return nil
+}
+
+// SendMKI returns the MKI of the master key protecting outbound packets
+func (c *Context) SendMKI() []byte {
+	return append([]byte{}, c.sendMKI...)
+}
+
+// switchMKI applies the pending switch of the outbound key if index reached it
+func (c *Context) switchMKI(index uint64) {
+	if c.pendingMKI == nil || index < c.pendingMKI.fromIndex {
+		return
+	}
+
+	c.sendMKI = c.pendingMKI.mki
+	c.cipher = c.mkiCiphers[string(c.sendMKI)]
+	c.pendingMKI = nil
+}
+
+// appendMKI inserts the MKI of the outbound key into a protected packet. It
+// precedes the authentication tag, or ends AEAD packets which have none.
+// https://tools.ietf.org/html/rfc3711#section-3.1
+func (c *Context) appendMKI(packet []byte) []byte {
+	if len(c.sendMKI) == 0 {
+		return packet
+	}
+
+	tagPos := len(packet) - c.cipher.authTagLen()
+	packet = append(packet, c.sendMKI...)
+	copy(packet[tagPos+len(c.sendMKI):], packet[tagPos:len(packet)-len(c.sendMKI)])
+	copy(packet[tagPos:], c.sendMKI)
+	return packet
+}
+
+// decryptionCipher returns the cipher a protected packet of ssrc must be
+// decrypted with, and the packet without its MKI. That copy is made in dst.
+func (c *Context) decryptionCipher(ssrc uint32, dst, packet []byte) (srtpCipher, []byte, error) {
+	if len(c.sendMKI) == 0 {
+		return c.cipherFor(ssrc), packet, nil
+	}
+
+	mkiLen, tagLen := len(c.sendMKI), c.cipher.authTagLen()
+	mkiPos := len(packet) - tagLen - mkiLen
+	if mkiPos < 0 {
+		return nil, nil, fmt.Errorf("%w: %d", errTooShortSRTP, len(packet))
+	}
+
+	mki := packet[mkiPos : mkiPos+mkiLen]
+	cipher, ok := c.mkiCiphers[string(mki)]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %x", errUnknownMKI, mki)
+	}
+
+	stripped := growBufferSize(dst, len(packet)-mkiLen)
+	copy(stripped, packet[:mkiPos])
+	copy(stripped[mkiPos:], packet[mkiPos+mkiLen:])
+	return cipher, stripped, nil
+}
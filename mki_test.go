@@ -0,0 +1,89 @@
+package srtp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/rtp/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMasterKeyRotation(t *testing.T) {
+	for _, profile := range []ProtectionProfile{ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAeadAes128Gcm} {
+		oldKeys, err := generateLoopbackKeys(profile)
+		assert.NoError(t, err)
+		newKeys, err := generateLoopbackKeys(profile)
+		assert.NoError(t, err)
+		oldMKI, newMKI := []byte{0x01, 0x00}, []byte{0x02, 0x00}
+
+		encryptContext, err := CreateContext(oldKeys.LocalMasterKey, oldKeys.LocalMasterSalt, profile, MasterKeyIdentifier(oldMKI))
+		assert.NoError(t, err)
+		decryptContext, err := CreateContext(oldKeys.LocalMasterKey, oldKeys.LocalMasterSalt, profile, MasterKeyIdentifier(oldMKI))
+		assert.NoError(t, err)
+
+		assert.NoError(t, encryptContext.AddMasterKey(newMKI, newKeys.LocalMasterKey, newKeys.LocalMasterSalt))
+		assert.NoError(t, decryptContext.AddMasterKey(newMKI, newKeys.LocalMasterKey, newKeys.LocalMasterSalt))
+		assert.NoError(t, encryptContext.SetSendMKI(newMKI, 10))
+
+		for seq := uint16(1); seq < 20; seq++ {
+			pkt := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: seq}, Payload: rtpTestCaseDecrypted()}
+			raw, err := pkt.Marshal()
+			assert.NoError(t, err)
+
+			encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+			assert.NoError(t, err)
+
+			parsed, err := ParseProtected(encrypted, profile, len(oldMKI))
+			assert.NoError(t, err)
+			if seq < 10 {
+				assert.Equal(t, oldMKI, parsed.MKI)
+			} else {
+				assert.Equal(t, newMKI, parsed.MKI)
+			}
+
+			decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, raw, decrypted)
+		}
+		assert.Equal(t, newMKI, encryptContext.SendMKI())
+
+		rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+		encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+		assert.NoError(t, err)
+		decryptedRTCP, err := decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, rtcpPacket, decryptedRTCP)
+
+		// Packets under the old key are rejected once it is removed
+		assert.True(t, errors.Is(encryptContext.RemoveMasterKey(newMKI), errRemoveSendMKI))
+		assert.NoError(t, encryptContext.SetSendMKI(oldMKI, 0))
+		assert.True(t, errors.Is(decryptContext.RemoveMasterKey(oldMKI), errRemoveSendMKI))
+		assert.NoError(t, decryptContext.SetSendMKI(newMKI, 0))
+		assert.NoError(t, decryptContext.RemoveMasterKey(oldMKI))
+
+		pkt := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 20}, Payload: rtpTestCaseDecrypted()}
+		raw, err := pkt.Marshal()
+		assert.NoError(t, err)
+		encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, err)
+		_, err = decryptContext.DecryptRTP(nil, encrypted, nil)
+		assert.True(t, errors.Is(err, errUnknownMKI))
+	}
+}
+
+func TestMasterKeyIdentifierErrors(t *testing.T) {
+	keys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+
+	c, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(c.AddMasterKey([]byte{1}, keys.LocalMasterKey, keys.LocalMasterSalt), errMKINotEnabled))
+
+	c, err = CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80, MasterKeyIdentifier([]byte{1}))
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(c.AddMasterKey([]byte{1, 2}, keys.LocalMasterKey, keys.LocalMasterSalt), errMKILength))
+	assert.True(t, errors.Is(c.SetSendMKI([]byte{2}, 0), errUnknownMKI))
+
+	_, err = CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80, MasterKeyIdentifier(nil))
+	assert.True(t, errors.Is(err, errMKILength))
+}
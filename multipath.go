@@ -0,0 +1,206 @@
+package srtp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/transport/packetio"
+)
+
+const multipathBufferSize = 1000 * 1000
+
+// PathScheduler decides which paths of a MultipathConn a written packet
+// takes. It is called concurrently by the writers of a session.
+type PathScheduler interface {
+	// Schedule returns the order the paths, indexes out of pathCount, are
+	// tried in and how many of them at most take the packet. A path failing
+	// the write is skipped for the next one.
+	Schedule(pathCount int) (order []int, copies int)
+}
+
+// PathDuplicate returns a scheduler writing every packet to all paths, the
+// receiver keeping the first copy to arrive
+func PathDuplicate() PathScheduler {
+	return duplicateScheduler{}
+}
+
+// PathRoundRobin returns a scheduler writing each packet to the path after
+// the one of the previous packet
+func PathRoundRobin() PathScheduler {
+	return &roundRobinScheduler{}
+}
+
+// PathPrimaryBackup returns a scheduler writing every packet to the first
+// path, and to the next ones only while those before fail
+func PathPrimaryBackup() PathScheduler {
+	return primaryBackupScheduler{}
+}
+
+type duplicateScheduler struct{}
+
+func (duplicateScheduler) Schedule(pathCount int) ([]int, int) {
+	return pathOrder(pathCount, 0), pathCount
+}
+
+type roundRobinScheduler struct {
+	next uint32
+}
+
+func (s *roundRobinScheduler) Schedule(pathCount int) ([]int, int) {
+	first := (atomic.AddUint32(&s.next, 1) - 1) % uint32(pathCount)
+	return pathOrder(pathCount, int(first)), 1
+}
+
+type primaryBackupScheduler struct{}
+
+func (primaryBackupScheduler) Schedule(pathCount int) ([]int, int) {
+	return pathOrder(pathCount, 0), 1
+}
+
+// pathOrder returns the indexes of pathCount paths starting at first
+func pathOrder(pathCount, first int) []int {
+	order := make([]int, pathCount)
+	for i := range order {
+		order[i] = (first + i) % pathCount
+	}
+	return order
+}
+
+// MultipathConn bonds several paths, such as the links of a bonded cellular
+// encoder, in the net.Conn of a session. Written packets are spread over the
+// paths by a PathScheduler. Packets read from any path are merged, the replay
+// protection of the session dropping the copies of duplicated packets.
+type MultipathConn struct {
+	paths     []net.Conn
+	scheduler PathScheduler
+	buffer    *packetio.Buffer
+
+	openPaths int32 // still read from, the buffer is closed after the last
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewMultipathConn reads from and writes to paths, scheduling writes with
+// scheduler. A nil scheduler duplicates packets on all paths, see
+// PathDuplicate. Closing the conn closes every path.
+func NewMultipathConn(scheduler PathScheduler, paths ...io.ReadWriter) (*MultipathConn, error) {
+	if len(paths) == 0 {
+		return nil, errNoConn
+	} else if scheduler == nil {
+		scheduler = PathDuplicate()
+	}
+
+	c := &MultipathConn{
+		paths:     make([]net.Conn, len(paths)),
+		scheduler: scheduler,
+		buffer:    packetio.NewBuffer(),
+		openPaths: int32(len(paths)),
+	}
+	c.buffer.SetLimitSize(multipathBufferSize)
+	for i, path := range paths {
+		if path == nil {
+			return nil, errNoConn
+		}
+		c.paths[i] = newReadWriterConn(path)
+	}
+	for _, path := range c.paths {
+		go c.readLoop(path)
+	}
+	return c, nil
+}
+
+func (c *MultipathConn) readLoop(path net.Conn) {
+	defer func() {
+		if atomic.AddInt32(&c.openPaths, -1) == 0 {
+			_ = c.buffer.Close()
+		}
+	}()
+
+	b := make([]byte, maxPacketSize)
+	for {
+		n, err := path.Read(b)
+		if err != nil {
+			return
+		}
+		if _, err = c.buffer.Write(b[:n]); err != nil && !errors.Is(err, packetio.ErrFull) {
+			return
+		}
+	}
+}
+
+// Read reads the next packet received on any path
+func (c *MultipathConn) Read(b []byte) (int, error) {
+	return c.buffer.Read(b)
+}
+
+// Write writes b to the paths its PathScheduler picks. It succeeds if any
+// of them took b, and returns the error of the last failing path otherwise.
+func (c *MultipathConn) Write(b []byte) (int, error) {
+	order, copies := c.scheduler.Schedule(len(c.paths))
+
+	var err error
+	written := 0
+	for _, i := range order {
+		if written == copies {
+			break
+		}
+		if _, err = c.paths[i].Write(b); err == nil {
+			written++
+		}
+	}
+	if written == 0 {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes every path, returning the first error encountered
+func (c *MultipathConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.buffer.Close()
+		for _, path := range c.paths {
+			if err := path.Close(); err != nil && c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+	})
+	return c.closeErr
+}
+
+// LocalAddr returns the local address of the first path
+func (c *MultipathConn) LocalAddr() net.Addr {
+	return c.paths[0].LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the first path
+func (c *MultipathConn) RemoteAddr() net.Addr {
+	return c.paths[0].RemoteAddr()
+}
+
+// SetDeadline sets the read deadline of the conn and the write deadline of
+// every path
+func (c *MultipathConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for the Read operation
+func (c *MultipathConn) SetReadDeadline(t time.Time) error {
+	return c.buffer.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of every path
+func (c *MultipathConn) SetWriteDeadline(t time.Time) error {
+	for _, path := range c.paths {
+		if err := path.SetWriteDeadline(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package srtp
 
 import (
+	"fmt"
+
 	"github.com/pion/transport/replaydetector"
 )
 
@@ -11,7 +13,7 @@ type ContextOption func(*Context) error
 func SRTPReplayProtection(windowSize uint) ContextOption { // nolint:golint
 	return func(c *Context) error {
 		c.newSRTPReplayDetector = func() replaydetector.ReplayDetector {
-			return replaydetector.WithWrap(windowSize, maxSequenceNumber)
+			return newReplayWindow(windowSize, maxSequenceNumber)
 		}
 		return nil
 	}
@@ -21,7 +23,7 @@ func SRTPReplayProtection(windowSize uint) ContextOption { // nolint:golint
 func SRTCPReplayProtection(windowSize uint) ContextOption {
 	return func(c *Context) error {
 		c.newSRTCPReplayDetector = func() replaydetector.ReplayDetector {
-			return replaydetector.WithWrap(windowSize, maxSRTCPIndex)
+			return newReplayWindow(windowSize, maxSRTCPIndex)
 		}
 		return nil
 	}
@@ -47,6 +49,135 @@ func SRTCPNoReplayProtection() ContextOption {
 	}
 }
 
+// DropDuplicates silently drops replayed packets: DecryptRTP and DecryptRTCP
+// return a nil packet and no error instead of a *DuplicatedError.
+func DropDuplicates() ContextOption {
+	return func(c *Context) error {
+		c.onDuplicate = func(*DuplicatedError) error {
+			return nil
+		}
+		return nil
+	}
+}
+
+// OnDuplicate calls handler for every replayed packet, which is then dropped
+// like with DropDuplicates.
+func OnDuplicate(handler func(*DuplicatedError)) ContextOption {
+	return func(c *Context) error {
+		c.onDuplicate = func(err *DuplicatedError) error {
+			handler(err)
+			return nil
+		}
+		return nil
+	}
+}
+
+// SRTPROCProbing retries the decryption of a SRTP packet failing authentication
+// with the rollover counter off by one in both directions, recovering streams
+// whose ROC was lost after long packet loss or a sender restart. It costs a copy
+// of every packet and two more authentications of packets that fail.
+func SRTPROCProbing() ContextOption { // nolint:golint
+	return func(c *Context) error {
+		c.rocProbing = true
+		return nil
+	}
+}
+
+// HopByHop makes a Context of a double encryption profile apply and strip
+// only the outer, hop-by-hop transform of RFC 8723, as done by a media
+// distributor. The master key and salt are then the outer ones. Payloads of
+// decrypted packets still hold the inner ciphertext and the OHB, which
+// encryption sends on unchanged.
+func HopByHop() ContextOption {
+	return func(c *Context) error {
+		c.hopByHop = true
+		return nil
+	}
+}
+
+// AuthenticationOnly leaves the payloads of SRTP and SRTCP packets in the
+// clear, as RFC 3711 permits, while packets are still authenticated and
+// replay protected. It behaves like the NULL cipher profiles with the key
+// derivation of the HMAC-SHA1 profile the Context is created with, which both
+// sides must agree on. AEAD profiles always encrypt SRTP and are rejected.
+func AuthenticationOnly() ContextOption {
+	return func(c *Context) error {
+		c.authenticationOnly = true
+		return nil
+	}
+}
+
+// MasterKeyIdentifier sets the MKI of the master key passed to CreateContext.
+// Packets then carry the MKI of the key protecting them, and more keys can be
+// installed with Context.AddMasterKey.
+func MasterKeyIdentifier(mki []byte) ContextOption {
+	return func(c *Context) error {
+		if len(mki) == 0 {
+			return fmt.Errorf("%w: empty MKI", errMKILength)
+		}
+		c.sendMKI = append([]byte{}, mki...)
+		return nil
+	}
+}
+
+// OnKeyExpiring calls handler once per master key and protocol when the key
+// can encrypt only margin more packets. RFC 3711 limits a master key to 2^48
+// SRTP and 2^31 SRTCP packets, encryption then fails with a *KeyExpiredError
+// until the key is replaced.
+func OnKeyExpiring(margin uint64, handler func(*KeyExpiring)) ContextOption {
+	return func(c *Context) error {
+		c.keyExpiringMargin = margin
+		c.onKeyExpiring = handler
+		return nil
+	}
+}
+
+// MasterKeyLifetime lowers the number of packets a master key may protect
+// below the maximum of RFC 3711, such as to the lifetime signaled with SDES.
+// It applies to SRTP and SRTCP packets separately.
+func MasterKeyLifetime(packets uint64) ContextOption {
+	return func(c *Context) error {
+		if packets < c.srtpLifetime {
+			c.srtpLifetime = packets
+		}
+		if packets < c.srtcpLifetime {
+			c.srtcpLifetime = packets
+		}
+		return nil
+	}
+}
+
+// InitialRolloverState seeds the rollover counter and s_l, the highest
+// sequence number seen, of ssrc, see Context.SetRolloverState. Passed in
+// Config.RemoteOptions it lets a session join a stream in progress.
+func InitialRolloverState(ssrc, roc uint32, sequenceNumber uint16) ContextOption {
+	return func(c *Context) error {
+		c.initialRolloverStates = append(c.initialRolloverStates, func() {
+			c.SetRolloverState(ssrc, roc, sequenceNumber)
+		})
+		return nil
+	}
+}
+
+// MaxSSRCStates bounds how many SSRCs the context tracks the rollover,
+// index and replay state of, per protocol, so a peer spraying random SSRCs
+// cannot grow it forever. Beyond max, policy either evicts the least recently
+// used SSRC or fails the packets of new ones. States of SSRCs whose first
+// packet fails decryption are not kept. Encryption fails for new SSRCs beyond
+// max whatever the policy, as forgetting the index of a sender would reuse
+// keystream. SetROC and SetIndex may go over max with SSRCLimitReject.
+func MaxSSRCStates(max int, policy SSRCLimitPolicy) ContextOption {
+	return func(c *Context) error {
+		c.maxSSRCStates, c.ssrcLimitPolicy = max, policy
+		if max > 0 {
+			c.srtpLRU, c.srtcpLRU = newSSRCLRU(), newSSRCLRU()
+		} else {
+			c.srtpLRU, c.srtcpLRU = nil, nil
+		}
+		return nil
+	}
+}
+
 type nopReplayDetector struct{}
 
 func (s *nopReplayDetector) Check(uint64) (func(), bool) {
@@ -0,0 +1,69 @@
+package srtp
+
+import (
+	"fmt"
+
+	"github.com/pion/rtp/v2"
+)
+
+// ProtectedPacket is the layout of a SRTP packet as parsed by ParseProtected.
+// Its slices point into the parsed buffer.
+type ProtectedPacket struct {
+	Header rtp.Header
+
+	// HeaderRaw is the unencrypted header, CSRCs and extension included
+	HeaderRaw []byte
+
+	// Ciphertext is the encrypted payload, without MKI nor auth tag
+	Ciphertext []byte
+
+	// MKI is the master key identifier, empty if mkiLen was 0
+	MKI []byte
+
+	// AuthTag is the HMAC tag, or the AEAD tag for AEAD profiles
+	AuthTag []byte
+}
+
+// ParseProtected splits a SRTP packet protected with profile into its parts
+// without decrypting nor authenticating it, e.g. for diagnostics, routing or
+// capture tooling. mkiLen is the MKI length negotiated out of band, usually 0.
+func ParseProtected(buf []byte, profile ProtectionProfile, mkiLen int) (*ProtectedPacket, error) {
+	authTagLen, err := profile.authTagLen()
+	if err != nil {
+		return nil, err
+	}
+	aeadAuthTagLen, err := profile.aeadAuthTagLen()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ProtectedPacket{}
+	headerLen, err := p.Header.Unmarshal(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	trailerLen := mkiLen + authTagLen + aeadAuthTagLen
+	if mkiLen < 0 || len(buf)-headerLen < trailerLen {
+		return nil, fmt.Errorf("%w: %d bytes", errTooShortSRTP, len(buf))
+	}
+
+	p.HeaderRaw = buf[:headerLen]
+	end := len(buf)
+	if aeadAuthTagLen > 0 {
+		// https://tools.ietf.org/html/rfc7714#section-8: the MKI follows the AEAD tag
+		p.MKI = buf[end-mkiLen : end]
+		end -= mkiLen
+		p.AuthTag = buf[end-aeadAuthTagLen : end]
+		end -= aeadAuthTagLen
+	} else {
+		// https://tools.ietf.org/html/rfc3711#section-3.1: the MKI precedes the auth tag
+		p.AuthTag = buf[end-authTagLen : end]
+		end -= authTagLen
+		p.MKI = buf[end-mkiLen : end]
+		end -= mkiLen
+	}
+	p.Ciphertext = buf[headerLen:end]
+
+	return p, nil
+}
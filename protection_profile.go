@@ -1,6 +1,10 @@
 package srtp
 
-import "fmt"
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
 
 // ProtectionProfile specifies Cipher and AuthTag details, similar to TLS cipher suite
 type ProtectionProfile uint16
@@ -9,59 +13,234 @@ type ProtectionProfile uint16
 const (
 	ProtectionProfileAes128CmHmacSha1_80 ProtectionProfile = 0x0001
 	ProtectionProfileAeadAes128Gcm       ProtectionProfile = 0x0007
+
+	// AES-256 counter mode profiles of RFC 6188, used with SDES. They have no
+	// DTLS-SRTP identifier, the values follow libsrtp.
+	ProtectionProfileAes256CmHmacSha1_80 ProtectionProfile = 0x0003
+	ProtectionProfileAes256CmHmacSha1_32 ProtectionProfile = 0x0004
+
+	// AES-192 counter mode profiles of RFC 6188, offered by legacy SIP
+	// equipment. They have no DTLS-SRTP identifier either, the values are
+	// outside of the registered range.
+	ProtectionProfileAes192CmHmacSha1_80 ProtectionProfile = 0x8001
+	ProtectionProfileAes192CmHmacSha1_32 ProtectionProfile = 0x8002
+
+	// NULL cipher profiles leave payloads in the clear, for debugging media
+	// with packet captures. ProtectionProfileNull does not authenticate either.
+	// Sessions only accept them with Config.AllowNullCipher.
+	ProtectionProfileNullHmacSha1_80 ProtectionProfile = 0x0005
+	ProtectionProfileNullHmacSha1_32 ProtectionProfile = 0x0006
+	ProtectionProfileNull            ProtectionProfile = 0x8003
+
+	// AES-f8 profile of RFC 3711, required by some 3GPP/IMS deployments. It
+	// has no DTLS-SRTP identifier.
+	ProtectionProfileAes128F8HmacSha1_80 ProtectionProfile = 0x8004
+
+	// ARIA profiles of RFC 8269, required by Korean regulations
+	ProtectionProfileAria128CtrHmacSha1_80 ProtectionProfile = 0x000b
+	ProtectionProfileAria128CtrHmacSha1_32 ProtectionProfile = 0x000c
+	ProtectionProfileAria256CtrHmacSha1_80 ProtectionProfile = 0x000d
+	ProtectionProfileAria256CtrHmacSha1_32 ProtectionProfile = 0x000e
+	ProtectionProfileAeadAria128Gcm        ProtectionProfile = 0x000f
+	ProtectionProfileAeadAria256Gcm        ProtectionProfile = 0x0010
+
+	// SEED profiles of RFC 5669 for legacy Korean VoIP equipment. They have no
+	// DTLS-SRTP identifier. The CCM profile uses an 80-bit tag and the GCM
+	// profile a 96-bit one.
+	ProtectionProfileSeed128CtrHmacSha1_80 ProtectionProfile = 0x8005
+	ProtectionProfileAeadSeed128Ccm        ProtectionProfile = 0x8006
+	ProtectionProfileAeadSeed128Gcm        ProtectionProfile = 0x8007
+
+	// Double encryption profiles of RFC 8723. Master keys and salts are the
+	// inner, end-to-end ones followed by the outer, hop-by-hop ones.
+	ProtectionProfileDoubleAeadAes128Gcm ProtectionProfile = 0x0009
+	ProtectionProfileDoubleAeadAes256Gcm ProtectionProfile = 0x000a
 )
 
-func (p ProtectionProfile) keyLen() (int, error) {
+// profileParams describes the key sizes of a profile and how to create its cipher
+type profileParams struct {
+	keyLen, saltLen            int
+	authTagLen, aeadAuthTagLen int
+	authKeyLen                 int
+	null                       bool // payloads are sent in the clear
+
+	// innerLen is what double encryption adds inside the outer transform,
+	// the inner tag and the OHB
+	innerLen int
+	// hopByHop are the params of the outer transform alone, set for double
+	// encryption profiles
+	hopByHop *profileParams
+
+	newCipher func(masterKey, masterSalt []byte) (srtpCipher, error)
+}
+
+func (p ProtectionProfile) params() (profileParams, error) {
+	hmacSha1 := func(newBlock blockFactory, keyLen, authTagLen int) profileParams {
+		authKeyLen := 20
+		if authTagLen == 0 {
+			authKeyLen = 0
+		}
+		return profileParams{
+			keyLen: keyLen, saltLen: 14,
+			authTagLen: authTagLen, authKeyLen: authKeyLen,
+			null: p.isNull(),
+			newCipher: func(masterKey, masterSalt []byte) (srtpCipher, error) {
+				c, err := newSrtpCipherAesCmHmacSha1(p, newBlock, masterKey, masterSalt)
+				if err != nil {
+					return nil, err
+				}
+				return c, nil
+			},
+		}
+	}
+	aead := func(newBlock blockFactory, newAEAD aeadFactory, keyLen, aeadAuthTagLen int) profileParams {
+		return profileParams{
+			keyLen: keyLen, saltLen: 12,
+			aeadAuthTagLen: aeadAuthTagLen,
+			newCipher: func(masterKey, masterSalt []byte) (srtpCipher, error) {
+				c, err := newSrtpCipherAeadAesGcm(newBlock, newAEAD, masterKey, masterSalt)
+				if err != nil {
+					return nil, err
+				}
+				return c, nil
+			},
+		}
+	}
+	double := func(keyLen int) profileParams {
+		half := aead(aes.NewCipher, cipher.NewGCM, keyLen, 16)
+		return profileParams{
+			keyLen: 2 * half.keyLen, saltLen: 2 * half.saltLen,
+			aeadAuthTagLen: half.aeadAuthTagLen,
+			innerLen:       half.aeadAuthTagLen + 1,
+			hopByHop:       &half,
+			newCipher: func(masterKey, masterSalt []byte) (srtpCipher, error) {
+				c, err := newSrtpCipherDouble(half, masterKey, masterSalt)
+				if err != nil {
+					return nil, err
+				}
+				return c, nil
+			},
+		}
+	}
+
 	switch p {
-	case ProtectionProfileAes128CmHmacSha1_80:
-		fallthrough
+	case ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileNullHmacSha1_80, ProtectionProfileAes128F8HmacSha1_80:
+		return hmacSha1(aes.NewCipher, 16, 10), nil
+	case ProtectionProfileNullHmacSha1_32:
+		return hmacSha1(aes.NewCipher, 16, 4), nil
+	case ProtectionProfileNull:
+		return hmacSha1(aes.NewCipher, 16, 0), nil
+	case ProtectionProfileAes192CmHmacSha1_80:
+		return hmacSha1(aes.NewCipher, 24, 10), nil
+	case ProtectionProfileAes192CmHmacSha1_32:
+		return hmacSha1(aes.NewCipher, 24, 4), nil
+	case ProtectionProfileAes256CmHmacSha1_80:
+		return hmacSha1(aes.NewCipher, 32, 10), nil
+	case ProtectionProfileAes256CmHmacSha1_32:
+		return hmacSha1(aes.NewCipher, 32, 4), nil
+	case ProtectionProfileAria128CtrHmacSha1_80:
+		return hmacSha1(newAriaCipher, 16, 10), nil
+	case ProtectionProfileAria128CtrHmacSha1_32:
+		return hmacSha1(newAriaCipher, 16, 4), nil
+	case ProtectionProfileAria256CtrHmacSha1_80:
+		return hmacSha1(newAriaCipher, 32, 10), nil
+	case ProtectionProfileAria256CtrHmacSha1_32:
+		return hmacSha1(newAriaCipher, 32, 4), nil
+	case ProtectionProfileSeed128CtrHmacSha1_80:
+		return hmacSha1(newSeedCipher, 16, 10), nil
 	case ProtectionProfileAeadAes128Gcm:
-		return 16, nil
+		return aead(aes.NewCipher, cipher.NewGCM, 16, 16), nil
+	case ProtectionProfileAeadAria128Gcm:
+		return aead(newAriaCipher, cipher.NewGCM, 16, 16), nil
+	case ProtectionProfileAeadAria256Gcm:
+		return aead(newAriaCipher, cipher.NewGCM, 32, 16), nil
+	case ProtectionProfileAeadSeed128Ccm:
+		return aead(newSeedCipher, func(block cipher.Block) (cipher.AEAD, error) {
+			return newCCM(block, 12, 10)
+		}, 16, 10), nil
+	case ProtectionProfileAeadSeed128Gcm:
+		return aead(newSeedCipher, func(block cipher.Block) (cipher.AEAD, error) {
+			return cipher.NewGCMWithTagSize(block, 12)
+		}, 16, 12), nil
+	case ProtectionProfileDoubleAeadAes128Gcm:
+		return double(16), nil
+	case ProtectionProfileDoubleAeadAes256Gcm:
+		return double(32), nil
 	default:
-		return 0, fmt.Errorf("%w: %#v", errNoSuchSRTPProfile, p)
+		return profileParams{}, fmt.Errorf("%w: %#v", ErrUnsupportedProfile, p)
 	}
 }
 
-func (p ProtectionProfile) saltLen() (int, error) {
-	switch p {
-	case ProtectionProfileAes128CmHmacSha1_80:
-		return 14, nil
-	case ProtectionProfileAeadAes128Gcm:
-		return 12, nil
-	default:
-		return 0, fmt.Errorf("%w: %#v", errNoSuchSRTPProfile, p)
+// withNullCipher returns p with ciphers that leave payloads in the clear but
+// still authenticate, like those of ProtectionProfileNullHmacSha1_80
+func (p profileParams) withNullCipher() (profileParams, error) {
+	if p.authTagLen == 0 {
+		return p, errAuthenticationOnlyNotHMAC
+	}
+
+	newCipher := p.newCipher
+	p.null = true
+	p.newCipher = func(masterKey, masterSalt []byte) (srtpCipher, error) {
+		c, err := newCipher(masterKey, masterSalt)
+		if err != nil {
+			return nil, err
+		}
+		hmac, ok := c.(*srtpCipherAesCmHmacSha1)
+		if !ok {
+			c.wipe()
+			return nil, errAuthenticationOnlyNotHMAC
+		}
+		hmac.mode = payloadModeNull
+		return hmac, nil
 	}
+	return p, nil
 }
 
-func (p ProtectionProfile) authTagLen() (int, error) {
+// isNull reports whether p leaves payloads unencrypted
+func (p ProtectionProfile) isNull() bool {
 	switch p {
-	case ProtectionProfileAes128CmHmacSha1_80:
-		return (&srtpCipherAesCmHmacSha1{}).authTagLen(), nil
-	case ProtectionProfileAeadAes128Gcm:
-		return (&srtpCipherAeadAesGcm{}).authTagLen(), nil
+	case ProtectionProfileNullHmacSha1_80, ProtectionProfileNullHmacSha1_32, ProtectionProfileNull:
+		return true
 	default:
-		return 0, fmt.Errorf("%w: %#v", errNoSuchSRTPProfile, p)
+		return false
 	}
 }
 
+func (p ProtectionProfile) keyLen() (int, error) {
+	params, err := p.params()
+	return params.keyLen, err
+}
+
+func (p ProtectionProfile) saltLen() (int, error) {
+	params, err := p.params()
+	return params.saltLen, err
+}
+
+// AuthTagLen returns the length of the HMAC authentication tag of p, zero for
+// AEAD profiles.
+func (p ProtectionProfile) AuthTagLen() (int, error) {
+	return p.authTagLen()
+}
+
+// AEADOverhead returns how many bytes the AEAD transform of p adds to a SRTP
+// packet, zero for HMAC profiles. Double encryption profiles count the inner
+// tag and the OHB as well.
+func (p ProtectionProfile) AEADOverhead() (int, error) {
+	params, err := p.params()
+	return params.aeadAuthTagLen + params.innerLen, err
+}
+
+func (p ProtectionProfile) authTagLen() (int, error) {
+	params, err := p.params()
+	return params.authTagLen, err
+}
+
 func (p ProtectionProfile) aeadAuthTagLen() (int, error) {
-	switch p {
-	case ProtectionProfileAes128CmHmacSha1_80:
-		return (&srtpCipherAesCmHmacSha1{}).aeadAuthTagLen(), nil
-	case ProtectionProfileAeadAes128Gcm:
-		return (&srtpCipherAeadAesGcm{}).aeadAuthTagLen(), nil
-	default:
-		return 0, fmt.Errorf("%w: %#v", errNoSuchSRTPProfile, p)
-	}
+	params, err := p.params()
+	return params.aeadAuthTagLen, err
 }
 
 func (p ProtectionProfile) authKeyLen() (int, error) {
-	switch p {
-	case ProtectionProfileAes128CmHmacSha1_80:
-		return 20, nil
-	case ProtectionProfileAeadAes128Gcm:
-		return 0, nil
-	default:
-		return 0, fmt.Errorf("%w: %#v", errNoSuchSRTPProfile, p)
-	}
+	params, err := p.params()
+	return params.authKeyLen, err
 }
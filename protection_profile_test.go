@@ -3,6 +3,7 @@ package srtp
 import (
 	"testing"
 
+	"github.com/pion/rtp/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,3 +16,55 @@ func TestInvalidProtectionProfile(t *testing.T) {
 	_, err = invalidProtectionProfile.saltLen()
 	assert.Error(t, err)
 }
+
+// TestProfileRoundTrip protects and unprotects a SRTP and a SRTCP packet with
+// the profiles whose ciphers are only tested against block test vectors
+func TestProfileRoundTrip(t *testing.T) {
+	for _, profile := range []ProtectionProfile{
+		// RFC 8269
+		ProtectionProfileAria128CtrHmacSha1_80, ProtectionProfileAria128CtrHmacSha1_32,
+		ProtectionProfileAria256CtrHmacSha1_80, ProtectionProfileAria256CtrHmacSha1_32,
+		ProtectionProfileAeadAria128Gcm, ProtectionProfileAeadAria256Gcm,
+		// RFC 5669
+		ProtectionProfileSeed128CtrHmacSha1_80, ProtectionProfileAeadSeed128Ccm, ProtectionProfileAeadSeed128Gcm,
+	} {
+		keys, err := generateLoopbackKeys(profile)
+		assert.NoError(t, err)
+
+		encryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+		decryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+
+		params, err := profile.params()
+		assert.NoError(t, err)
+		overhead := params.authTagLen + params.aeadAuthTagLen
+
+		pkt := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 5000}, Payload: rtpTestCaseDecrypted()}
+		raw, err := pkt.Marshal()
+		assert.NoError(t, err)
+
+		encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, err)
+		assert.Len(t, encrypted, len(raw)+overhead)
+		assert.NotEqual(t, raw[pkt.Header.MarshalSize():], encrypted[pkt.Header.MarshalSize():len(raw)])
+
+		tampered := append([]byte{}, encrypted...)
+		tampered[len(tampered)-1] ^= 0xFF
+		_, err = decryptContext.DecryptRTP(nil, tampered, nil)
+		assert.Error(t, err, profile)
+
+		decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+		assert.NoError(t, err, profile)
+		assert.Equal(t, raw, decrypted)
+
+		rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+		encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+		assert.NoError(t, err)
+		assert.Len(t, encryptedRTCP, len(rtcpPacket)+srtcpIndexSize+overhead)
+
+		decryptedRTCP, err := decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+		assert.NoError(t, err, profile)
+		assert.Equal(t, rtcpPacket, decryptedRTCP)
+	}
+}
@@ -0,0 +1,125 @@
+package srtp
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/pion/transport/packetio"
+)
+
+// queueBudget bounds the bytes queued in all read streams of a session, see
+// Config.ReadQueueBudget
+type queueBudget struct {
+	mu          sync.Mutex
+	limit, used int
+	drops       uint64
+}
+
+// newQueueBudget returns a budget of limit bytes, or nil if limit is not positive
+func newQueueBudget(limit int) *queueBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &queueBudget{limit: limit}
+}
+
+// reserve takes n bytes of the budget, returning false and counting a drop
+// if they are not left
+func (b *queueBudget) reserve(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.used+n > b.limit {
+		b.drops++
+		return false
+	}
+	b.used += n
+	return true
+}
+
+func (b *queueBudget) release(n int) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+}
+
+func (b *queueBudget) stats() (used int, drops uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.used, b.drops
+}
+
+// budgetBuffer is the default buffer of a read stream, accounting its packets
+// in the queueBudget of the session. Packets that do not fit are refused with
+// packetio.ErrFull, like those of a full buffer.
+type budgetBuffer struct {
+	*packetio.Buffer
+	budget *queueBudget
+
+	mu     sync.Mutex
+	sizes  []int // of the queued packets, in order
+	closed bool
+}
+
+func newBudgetBuffer(buffer *packetio.Buffer, budget *queueBudget) io.ReadWriteCloser {
+	if budget == nil {
+		return buffer
+	}
+	return &budgetBuffer{Buffer: buffer, budget: budget}
+}
+
+func (b *budgetBuffer) Write(packet []byte) (int, error) {
+	if !b.budget.reserve(len(packet)) {
+		return 0, packetio.ErrFull
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		b.budget.release(len(packet))
+		return 0, io.ErrClosedPipe
+	}
+	b.sizes = append(b.sizes, len(packet))
+	b.mu.Unlock()
+
+	n, err := b.Buffer.Write(packet)
+	if err != nil {
+		// Writes are serialized, the last size is the one of packet unless
+		// Close released them all
+		b.mu.Lock()
+		if len(b.sizes) > 0 {
+			b.sizes = b.sizes[:len(b.sizes)-1]
+			b.budget.release(len(packet))
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *budgetBuffer) Read(packet []byte) (int, error) {
+	n, err := b.Buffer.Read(packet)
+	if err == nil || errors.Is(err, io.ErrShortBuffer) {
+		b.mu.Lock()
+		if len(b.sizes) > 0 {
+			b.budget.release(b.sizes[0])
+			b.sizes = b.sizes[1:]
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+// Close releases the budget of the packets left unread
+func (b *budgetBuffer) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	for _, size := range b.sizes {
+		b.budget.release(size)
+	}
+	b.sizes = nil
+	b.mu.Unlock()
+
+	return b.Buffer.Close()
+}
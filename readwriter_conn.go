@@ -0,0 +1,68 @@
+package srtp
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// readWriterConn adapts a transport that is not a net.Conn, such as a QUIC
+// stream, to the net.Conn sessions use. Close and deadlines are passed on
+// when the transport supports them.
+type readWriterConn struct {
+	io.ReadWriter
+}
+
+// newReadWriterConn returns rw as a net.Conn, wrapping it if needed
+func newReadWriterConn(rw io.ReadWriter) net.Conn {
+	if conn, ok := rw.(net.Conn); ok {
+		return conn
+	}
+	return &readWriterConn{ReadWriter: rw}
+}
+
+// Close closes the transport if it is an io.Closer. Otherwise the session
+// only finishes closing once a pending Read of the transport returns.
+func (c *readWriterConn) Close() error {
+	if closer, ok := c.ReadWriter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *readWriterConn) LocalAddr() net.Addr {
+	if conn, ok := c.ReadWriter.(interface{ LocalAddr() net.Addr }); ok {
+		return conn.LocalAddr()
+	}
+	return nil
+}
+
+func (c *readWriterConn) RemoteAddr() net.Addr {
+	if conn, ok := c.ReadWriter.(interface{ RemoteAddr() net.Addr }); ok {
+		return conn.RemoteAddr()
+	}
+	return nil
+}
+
+func (c *readWriterConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *readWriterConn) SetReadDeadline(t time.Time) error {
+	conn, ok := c.ReadWriter.(interface{ SetReadDeadline(time.Time) error })
+	if !ok {
+		return errConnDeadlineNotSupported
+	}
+	return conn.SetReadDeadline(t)
+}
+
+func (c *readWriterConn) SetWriteDeadline(t time.Time) error {
+	conn, ok := c.ReadWriter.(interface{ SetWriteDeadline(time.Time) error })
+	if !ok {
+		return errConnDeadlineNotSupported
+	}
+	return conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,107 @@
+package srtp
+
+import (
+	"net"
+	"sync"
+)
+
+// remoteAddrConn adapts an unconnected net.PacketConn to the net.Conn sessions
+// use, writing to a remote address that can be changed. Packets are read from
+// any address acceptSource allows, SRTP authentication rejects those not from
+// the peer.
+type remoteAddrConn struct {
+	net.PacketConn
+	acceptSource func(net.Addr) bool
+
+	mu     sync.RWMutex
+	remote net.Addr
+}
+
+func newRemoteAddrConn(conn net.Conn, remote net.Addr, acceptSource func(net.Addr) bool) (net.Conn, error) {
+	packetConn, ok := conn.(net.PacketConn)
+	if !ok {
+		return nil, errNotPacketConn
+	}
+	return &remoteAddrConn{PacketConn: packetConn, acceptSource: acceptSource, remote: remote}, nil
+}
+
+func (c *remoteAddrConn) Read(b []byte) (int, error) {
+	n, _, err := c.readSource(b)
+	return n, err
+}
+
+// readSource reads the next packet from an accepted source, dropping the others
+func (c *remoteAddrConn) readSource(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil || c.acceptSource == nil || c.acceptSource(addr) {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *remoteAddrConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.RemoteAddr())
+}
+
+func (c *remoteAddrConn) RemoteAddr() net.Addr {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.remote
+}
+
+func (c *remoteAddrConn) setRemoteAddr(remote net.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remote = remote
+}
+
+// sourceReader is a conn telling the source address of the packets it reads
+type sourceReader interface {
+	readSource(b []byte) (int, net.Addr, error)
+}
+
+// readSource reads a packet from conn, along its source address if known
+func readSource(conn net.Conn, b []byte) (int, net.Addr, error) {
+	if r, ok := conn.(sourceReader); ok {
+		return r.readSource(b)
+	}
+	n, err := conn.Read(b)
+	return n, nil, err
+}
+
+// sameAddr tells if a and b are the same address
+func sameAddr(a, b net.Addr) bool {
+	if a, ok := a.(*net.UDPAddr); ok {
+		if b, ok := b.(*net.UDPAddr); ok {
+			return a.Port == b.Port && a.IP.Equal(b.IP) && a.Zone == b.Zone
+		}
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
+
+// checkRemoteAddr tracks the source address of an authenticated packet of
+// ssrc, see Config.OnRemoteAddrChange. It must be called with decryptMutex held.
+func (s *session) checkRemoteAddr(ssrc uint32) {
+	if s.remoteSources == nil || s.source == nil {
+		return
+	}
+
+	source := s.source
+	prev, known := s.remoteSources[ssrc]
+	s.remoteSources[ssrc] = source
+	if !known || sameAddr(prev, source) {
+		return
+	}
+
+	if s.followRemoteAddr {
+		if err := s.setRemoteAddr(source); err != nil {
+			s.log.Warnf("failed to follow ssrc %d to %s: %v", ssrc, source, err)
+		}
+	}
+	if s.onRemoteAddrChange != nil {
+		s.queueEvent(func() { s.onRemoteAddrChange(ssrc, source) })
+	}
+}
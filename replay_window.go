@@ -0,0 +1,103 @@
+package srtp
+
+// replayWindow is the sliding window of replaydetector.WithWrap without its
+// per packet allocation: the function Check returns is built once, and
+// accepts the sequence number of the last Check.
+type replayWindow struct {
+	latestSeq  uint64
+	maxSeq     uint64
+	windowSize uint
+	mask       []uint64 // bit i is set if latestSeq-i was accepted
+	init       bool
+
+	// diff is latestSeq minus the last checked sequence number, wrapped
+	seq    uint64
+	diff   int64
+	accept func()
+}
+
+func newReplayWindow(windowSize uint, maxSeq uint64) *replayWindow {
+	words := (windowSize + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+
+	w := &replayWindow{
+		maxSeq:     maxSeq,
+		windowSize: windowSize,
+		mask:       make([]uint64, words),
+	}
+	w.accept = w.acceptLast
+	return w
+}
+
+func nopAccept() {}
+
+func (w *replayWindow) Check(seq uint64) (func(), bool) {
+	if seq > w.maxSeq {
+		return nopAccept, false
+	}
+	if !w.init {
+		if seq != 0 {
+			w.latestSeq = seq - 1
+		} else {
+			w.latestSeq = w.maxSeq
+		}
+		w.init = true
+	}
+
+	diff := int64(w.latestSeq) - int64(seq)
+	if diff > int64(w.maxSeq)/2 {
+		diff -= int64(w.maxSeq + 1)
+	} else if diff <= -int64(w.maxSeq)/2 {
+		diff += int64(w.maxSeq + 1)
+	}
+
+	if diff >= int64(w.windowSize) {
+		return nopAccept, false // Too old
+	} else if diff >= 0 && w.bit(uint(diff)) {
+		return nopAccept, false // Duplicated
+	}
+
+	w.seq, w.diff = seq, diff
+	return w.accept, true
+}
+
+func (w *replayWindow) acceptLast() {
+	if w.diff < 0 {
+		w.shift(uint(-w.diff))
+		w.latestSeq = w.seq
+		w.setBit(0)
+		return
+	}
+	// latestSeq-seq would not be the distance across the wrap
+	w.setBit(uint(w.diff))
+}
+
+func (w *replayWindow) bit(i uint) bool {
+	return i < w.windowSize && w.mask[i/64]&(1<<(i%64)) != 0
+}
+
+func (w *replayWindow) setBit(i uint) {
+	if i < w.windowSize {
+		w.mask[i/64] |= 1 << (i % 64)
+	}
+}
+
+// shift moves the window n sequence numbers ahead
+func (w *replayWindow) shift(n uint) {
+	words, bits := int(n/64), n%64
+	for i := len(w.mask) - 1; i >= 0; i-- {
+		var shifted uint64
+		if i-words >= 0 {
+			shifted = w.mask[i-words] << bits
+			if i-words-1 >= 0 && bits != 0 {
+				shifted |= w.mask[i-words-1] >> (64 - bits)
+			}
+		}
+		w.mask[i] = shifted
+	}
+	if rem := w.windowSize % 64; rem != 0 {
+		w.mask[len(w.mask)-1] &= 1<<rem - 1
+	}
+}
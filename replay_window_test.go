@@ -0,0 +1,79 @@
+package srtp
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/pion/transport/replaydetector"
+	"github.com/stretchr/testify/assert"
+)
+
+// replaydetector.WithWrap forgets the oldest packets of windows that are not
+// a multiple of 64, see TestReplayWindowSize
+func TestReplayWindowMatchesWithWrap(t *testing.T) {
+	r := rand.New(rand.NewSource(1)) //nolint:gosec
+	for _, windowSize := range []uint{1, 64, 128, 256} {
+		for _, maxSeq := range []uint64{maxSequenceNumber, maxSRTCPIndex} {
+			expected := replaydetector.WithWrap(windowSize, maxSeq)
+			actual := newReplayWindow(windowSize, maxSeq)
+
+			seq := uint64(r.Intn(int(maxSeq)))
+			for i := 0; i < 10000; i++ {
+				// Mostly in order, with reordering, replays and jumps
+				seq = (seq + uint64(r.Intn(2*int(windowSize)+8)) - uint64(windowSize)) & maxSeq
+				expectedAccept, expectedOK := expected.Check(seq)
+				actualAccept, actualOK := actual.Check(seq)
+				assert.Equal(t, expectedOK, actualOK, "window %d, seq %d", windowSize, seq)
+
+				if r.Intn(4) != 0 {
+					expectedAccept()
+					actualAccept()
+				}
+			}
+		}
+	}
+}
+
+func TestReplayWindowSize(t *testing.T) {
+	w := newReplayWindow(100, maxSequenceNumber)
+	for seq := uint64(1); seq <= 100; seq++ {
+		accept, ok := w.Check(seq)
+		assert.True(t, ok)
+		accept()
+	}
+
+	_, ok := w.Check(1)
+	assert.False(t, ok, "the oldest packet of the window must be a replay")
+	accept, ok := w.Check(101)
+	assert.True(t, ok)
+	accept()
+	_, ok = w.Check(1)
+	assert.False(t, ok, "packets older than the window must be rejected")
+}
+
+func TestReplayWindowWrapReplay(t *testing.T) {
+	w := newReplayWindow(64, maxSequenceNumber)
+	for _, seq := range []uint64{65530, 3, 65532} {
+		accept, ok := w.Check(seq)
+		assert.True(t, ok, "seq %d", seq)
+		accept()
+	}
+
+	// 65532 was accepted late, after the latest sequence number wrapped
+	_, ok := w.Check(65532)
+	assert.False(t, ok, "a packet accepted across the wrap must be a replay")
+	_, ok = w.Check(3)
+	assert.False(t, ok)
+}
+
+func TestReplayWindowAllocs(t *testing.T) {
+	w := newReplayWindow(64, maxSequenceNumber)
+	seq := uint64(0)
+	allocs := testing.AllocsPerRun(100, func() {
+		seq++
+		if accept, ok := w.Check(seq); ok {
+			accept()
+		}
+	})
+	assert.Zero(t, allocs)
+}
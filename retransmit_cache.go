@@ -0,0 +1,59 @@
+package srtp
+
+import "sync"
+
+// retransmitCache keeps the most recently protected packets of every SSRC,
+// so they can be sent again without keeping the plaintext around
+type retransmitCache struct {
+	mu      sync.Mutex
+	size    int
+	packets map[uint32][]cachedPacket
+}
+
+type cachedPacket struct {
+	sequenceNumber uint16
+	encrypted      []byte
+}
+
+func newRetransmitCache(size int) *retransmitCache {
+	return &retransmitCache{
+		size:    size,
+		packets: map[uint32][]cachedPacket{},
+	}
+}
+
+// add stores encrypted, which must not be modified afterwards
+func (c *retransmitCache) add(ssrc uint32, sequenceNumber uint16, encrypted []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ring, ok := c.packets[ssrc]
+	if !ok {
+		ring = make([]cachedPacket, c.size)
+		c.packets[ssrc] = ring
+	}
+	ring[int(sequenceNumber)%c.size] = cachedPacket{sequenceNumber, encrypted}
+}
+
+func (c *retransmitCache) remove(ssrc uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.packets, ssrc)
+}
+
+func (c *retransmitCache) get(ssrc uint32, sequenceNumber uint16) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ring, ok := c.packets[ssrc]
+	if !ok {
+		return nil, false
+	}
+
+	p := ring[int(sequenceNumber)%c.size]
+	if p.encrypted == nil || p.sequenceNumber != sequenceNumber {
+		return nil, false
+	}
+	return p.encrypted, true
+}
@@ -0,0 +1,202 @@
+package srtp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/srtp/v2/batchconn"
+	"github.com/pion/transport/packetio"
+)
+
+// Limit the buffers of each demultiplexed endpoint to 1MB
+const muxBufferSize = 1000 * 1000
+
+// NewSessionPairMux creates a SRTP and a SRTCP session sharing conn, with RTP
+// and RTCP multiplexed on it as done by WebRTC, RFC 5761. Received packets are
+// routed to either session by their payload type. Config.RemoteAddr applies to
+// conn, which is closed along the pair.
+func NewSessionPairMux(conn net.Conn, config *Config) (*SessionPair, error) {
+	if config == nil {
+		return nil, errNoConfig
+	}
+
+	packetSize, err := config.packetSize()
+	if err != nil {
+		return nil, err
+	}
+
+	muxConfig := *config
+	conn = batchconn.New(conn, config.ReadBatchSize, packetSize)
+	if config.RemoteAddr != nil {
+		if conn, err = newRemoteAddrConn(conn, config.RemoteAddr, config.AcceptSource); err != nil {
+			return nil, err
+		}
+		muxConfig.RemoteAddr, muxConfig.AcceptSource = nil, nil
+	}
+
+	m := newRTCPMux(conn, packetSize)
+	p, err := NewSessionPair(m.rtp, m.rtcp, &muxConfig)
+	if err != nil {
+		_ = m.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// isRTCP tells RTCP from RTP packets multiplexed on one conn by the packet
+// type of RTCP, whose range RTP payload types must not use, RFC 5761 Section 4
+func isRTCP(buf []byte) bool {
+	return len(buf) >= 2 && buf[1] >= 192 && buf[1] <= 223
+}
+
+// rtcpMux splits the packets read from conn between a RTP and a RTCP
+// endpoint, both writing to conn. Conn is closed once both endpoints are.
+type rtcpMux struct {
+	conn      net.Conn
+	rtp, rtcp *muxEndpoint
+
+	mu         sync.Mutex
+	openedEnds int
+}
+
+func newRTCPMux(conn net.Conn, packetSize int) *rtcpMux {
+	m := &rtcpMux{conn: conn, openedEnds: 2}
+	m.rtp, m.rtcp = newMuxEndpoint(m), newMuxEndpoint(m)
+	go m.readLoop(packetSize)
+	return m
+}
+
+func (m *rtcpMux) readLoop(packetSize int) {
+	defer func() {
+		_ = m.rtp.buffer.Close()
+		_ = m.rtcp.buffer.Close()
+	}()
+
+	b := make([]byte, packetSize)
+	for {
+		n, source, err := readSource(m.conn, b)
+		if err != nil {
+			return
+		}
+
+		endpoint := m.rtp
+		if isRTCP(b[:n]) {
+			endpoint = m.rtcp
+		}
+		if err = endpoint.write(b[:n], source); err != nil && !errors.Is(err, packetio.ErrFull) {
+			return
+		}
+	}
+}
+
+// endpointClosed closes conn once both endpoints are closed
+func (m *rtcpMux) endpointClosed() error {
+	m.mu.Lock()
+	m.openedEnds--
+	last := m.openedEnds == 0
+	m.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return m.conn.Close()
+}
+
+func (m *rtcpMux) close() error {
+	_ = m.rtp.buffer.Close()
+	_ = m.rtcp.buffer.Close()
+	return m.conn.Close()
+}
+
+// muxEndpoint is the net.Conn of one of the sessions sharing a rtcpMux
+type muxEndpoint struct {
+	mux       *rtcpMux
+	buffer    *packetio.Buffer
+	closeOnce sync.Once
+
+	sourcesMu sync.Mutex
+	sources   []net.Addr // of the buffered packets, if the mux conn tells them
+}
+
+func newMuxEndpoint(m *rtcpMux) *muxEndpoint {
+	buffer := packetio.NewBuffer()
+	buffer.SetLimitSize(muxBufferSize)
+	return &muxEndpoint{mux: m, buffer: buffer}
+}
+
+// write buffers packet, keeping its source address for readSource
+func (e *muxEndpoint) write(packet []byte, source net.Addr) error {
+	e.sourcesMu.Lock()
+	defer e.sourcesMu.Unlock()
+
+	if _, err := e.buffer.Write(packet); err != nil {
+		return err
+	}
+	if source != nil {
+		e.sources = append(e.sources, source)
+	}
+	return nil
+}
+
+func (e *muxEndpoint) Read(b []byte) (int, error) {
+	n, _, err := e.readSource(b)
+	return n, err
+}
+
+func (e *muxEndpoint) readSource(b []byte) (int, net.Addr, error) {
+	n, err := e.buffer.Read(b)
+	if err != nil && !errors.Is(err, io.ErrShortBuffer) {
+		return n, nil, err
+	}
+
+	var source net.Addr
+	e.sourcesMu.Lock()
+	if len(e.sources) > 0 {
+		source = e.sources[0]
+		e.sources[0] = nil
+		e.sources = e.sources[1:]
+	}
+	e.sourcesMu.Unlock()
+	return n, source, err
+}
+
+func (e *muxEndpoint) Write(b []byte) (int, error) {
+	return e.mux.conn.Write(b)
+}
+
+func (e *muxEndpoint) Close() (err error) {
+	e.closeOnce.Do(func() {
+		if err = e.buffer.Close(); err != nil {
+			return
+		}
+		err = e.mux.endpointClosed()
+	})
+	return err
+}
+
+func (e *muxEndpoint) LocalAddr() net.Addr {
+	return e.mux.conn.LocalAddr()
+}
+
+func (e *muxEndpoint) RemoteAddr() net.Addr {
+	return e.mux.conn.RemoteAddr()
+}
+
+func (e *muxEndpoint) SetDeadline(t time.Time) error {
+	if err := e.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return e.SetWriteDeadline(t)
+}
+
+func (e *muxEndpoint) SetReadDeadline(t time.Time) error {
+	return e.buffer.SetReadDeadline(t)
+}
+
+// SetWriteDeadline applies to conn, shared by both endpoints
+func (e *muxEndpoint) SetWriteDeadline(t time.Time) error {
+	return e.mux.conn.SetWriteDeadline(t)
+}
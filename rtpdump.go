@@ -0,0 +1,213 @@
+package srtp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rtpdump file format, as written by rtpdump and read by rtpplay from rtptools
+// https://github.com/irtlab/rtptools/blob/master/rtpdump.h
+const (
+	rtpdumpFileHeaderSize   = 16
+	rtpdumpPacketHeaderSize = 8
+	rtpdumpMagic            = "#!rtpplay1.0 "
+)
+
+// RTPDumpWriter writes packets in rtpdump format. Set it as Config.RTPDump to
+// record the decrypted packets a session receives. It is safe for
+// concurrent use, so a SRTP and a SRTCP session may share it.
+type RTPDumpWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	source *net.UDPAddr
+	start  time.Time
+}
+
+// NewRTPDumpWriter creates a RTPDumpWriter writing to w. source is recorded as
+// the address the packets came from and may be nil.
+func NewRTPDumpWriter(w io.Writer, source *net.UDPAddr) *RTPDumpWriter {
+	if source == nil {
+		source = &net.UDPAddr{IP: net.IPv4zero}
+	}
+	return &RTPDumpWriter{w: w, source: source}
+}
+
+// WriteRTP records a RTP packet received at t
+func (d *RTPDumpWriter) WriteRTP(t time.Time, packet []byte) error {
+	return d.writePacket(t, packet, len(packet))
+}
+
+// WriteRTCP records a RTCP packet received at t
+func (d *RTPDumpWriter) WriteRTCP(t time.Time, packet []byte) error {
+	// plen is 0 for RTCP
+	return d.writePacket(t, packet, 0)
+}
+
+func (d *RTPDumpWriter) writePacket(t time.Time, packet []byte, plen int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.start.IsZero() {
+		if err := d.writeFileHeader(t); err != nil {
+			return err
+		}
+	}
+
+	b := make([]byte, rtpdumpPacketHeaderSize+len(packet))
+	binary.BigEndian.PutUint16(b[0:], uint16(len(b)))
+	binary.BigEndian.PutUint16(b[2:], uint16(plen))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Sub(d.start)/time.Millisecond))
+	copy(b[rtpdumpPacketHeaderSize:], packet)
+
+	_, err := d.w.Write(b)
+	return err
+}
+
+// writeFileHeader starts the file, the first packet sets the start time
+func (d *RTPDumpWriter) writeFileHeader(start time.Time) error {
+	if _, err := fmt.Fprintf(d.w, "%s%s/%d\n", rtpdumpMagic, d.source.IP, d.source.Port); err != nil {
+		return err
+	}
+
+	b := make([]byte, rtpdumpFileHeaderSize)
+	binary.BigEndian.PutUint32(b[0:], uint32(start.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(start.Nanosecond()/int(time.Microsecond)))
+	if ip4 := d.source.IP.To4(); ip4 != nil {
+		copy(b[8:], ip4)
+	}
+	binary.BigEndian.PutUint16(b[12:], uint16(d.source.Port))
+
+	if _, err := d.w.Write(b); err != nil {
+		return err
+	}
+	d.start = start
+	return nil
+}
+
+// RTPDumpPacket is a packet read from a rtpdump file
+type RTPDumpPacket struct {
+	// Offset is the time the packet was recorded at, relative to RTPDumpReader.Start
+	Offset time.Duration
+	IsRTCP bool
+	Data   []byte
+}
+
+// RTPDumpReader reads packets from a rtpdump file, e.g. to replay a captured
+// session for load testing.
+type RTPDumpReader struct {
+	r *bufio.Reader
+
+	// Source is the address recorded in the file
+	Source *net.UDPAddr
+	// Start is the time recording started
+	Start time.Time
+}
+
+// NewRTPDumpReader reads the rtpdump file header from r
+func NewRTPDumpReader(r io.Reader) (*RTPDumpReader, error) {
+	d := &RTPDumpReader{r: bufio.NewReader(r)}
+
+	line, err := d.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRTPDump, err)
+	} else if len(line) < len(rtpdumpMagic) || line[:len(rtpdumpMagic)] != rtpdumpMagic {
+		return nil, fmt.Errorf("%w: missing %q", errInvalidRTPDump, rtpdumpMagic)
+	}
+
+	b := make([]byte, rtpdumpFileHeaderSize)
+	if _, err = io.ReadFull(d.r, b); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRTPDump, err)
+	}
+	d.Start = time.Unix(int64(binary.BigEndian.Uint32(b[0:])), int64(binary.BigEndian.Uint32(b[4:]))*int64(time.Microsecond))
+	d.Source = parseRTPDumpSource(line[len(rtpdumpMagic):])
+
+	return d, nil
+}
+
+// parseRTPDumpSource parses the "address/port" of the first line, the
+// binary header only has room for IPv4
+func parseRTPDumpSource(s string) *net.UDPAddr {
+	addr := &net.UDPAddr{IP: net.IPv4zero}
+
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		if ip := net.ParseIP(s[:i]); ip != nil {
+			addr.IP = ip
+		}
+		addr.Port, _ = strconv.Atoi(s[i+1:])
+	}
+	return addr
+}
+
+// Next returns the next packet of the file, or io.EOF at its end
+func (d *RTPDumpReader) Next() (*RTPDumpPacket, error) {
+	h := make([]byte, rtpdumpPacketHeaderSize)
+	if _, err := io.ReadFull(d.r, h); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: %v", errInvalidRTPDump, err)
+		}
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(h[0:]))
+	if length < rtpdumpPacketHeaderSize {
+		return nil, fmt.Errorf("%w: packet length %d", errInvalidRTPDump, length)
+	}
+
+	p := &RTPDumpPacket{
+		Offset: time.Duration(binary.BigEndian.Uint32(h[4:])) * time.Millisecond,
+		IsRTCP: binary.BigEndian.Uint16(h[2:]) == 0,
+		Data:   make([]byte, length-rtpdumpPacketHeaderSize),
+	}
+	if _, err := io.ReadFull(d.r, p.Data); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRTPDump, err)
+	}
+	return p, nil
+}
+
+// Replay calls handle for every remaining packet, waiting in between so that
+// packets keep the spacing they were recorded with. To re-send through a
+// session, handle can write them to its write streams.
+func (d *RTPDumpReader) Replay(handle func(*RTPDumpPacket) error) error {
+	start := time.Now()
+	for {
+		p, err := d.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if wait := time.Until(start.Add(p.Offset)); wait > 0 {
+			time.Sleep(wait)
+		}
+		if err = handle(p); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayContext replays the remaining packets like Replay, protecting them
+// with c before passing them to send
+func (d *RTPDumpReader) ReplayContext(c *Context, send func([]byte) error) error {
+	return d.Replay(func(p *RTPDumpPacket) error {
+		var encrypted []byte
+		var err error
+		if p.IsRTCP {
+			encrypted, err = c.EncryptRTCP(nil, p.Data, nil)
+		} else {
+			encrypted, err = c.EncryptRTP(nil, p.Data, nil)
+		}
+		if err != nil {
+			return err
+		}
+		return send(encrypted)
+	})
+}
@@ -0,0 +1,111 @@
+package srtp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTPDumpWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	d := NewRTPDumpWriter(buf, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5004})
+
+	start := time.Unix(1000, 5000)
+	assert.NoError(t, d.WriteRTP(start, []byte{0x80, 0x00}))
+	assert.NoError(t, d.WriteRTCP(start.Add(1500*time.Millisecond), []byte{0x81, 0xc8}))
+
+	assert.Equal(t, append([]byte("#!rtpplay1.0 192.0.2.1/5004\n"),
+		0x00, 0x00, 0x03, 0xe8, // start seconds
+		0x00, 0x00, 0x00, 0x05, // start microseconds
+		0xc0, 0x00, 0x02, 0x01, // source
+		0x13, 0x8c, 0x00, 0x00, // port, padding
+		0x00, 0x0a, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x80, 0x00, // RTP at 0ms
+		0x00, 0x0a, 0x00, 0x00, 0x00, 0x00, 0x05, 0xdc, 0x81, 0xc8, // RTCP at 1500ms
+	), buf.Bytes())
+}
+
+func TestSessionSRTPRTPDump(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+	aSession, bPipe, config := buildSessionSRTP(t)
+
+	dump := &bytes.Buffer{}
+	config.RTPDump = NewRTPDumpWriter(dump, nil)
+	bSession, err := NewSessionSRTP(bPipe, config)
+	assert.NoError(t, err)
+
+	bReadStream, err := bSession.OpenReadStream(5000)
+	assert.NoError(t, err)
+	aWriteStream, err := aSession.OpenWriteStream()
+	assert.NoError(t, err)
+
+	_, err = aWriteStream.WriteRTP(&rtp.Header{Version: 2, SSRC: 5000, SequenceNumber: 1}, testPayload)
+	assert.NoError(t, err)
+	_, err = assertPayloadSRTP(t, bReadStream, 12, testPayload)
+	assert.NoError(t, err)
+
+	assert.NoError(t, aSession.Close())
+	assert.NoError(t, bSession.Close())
+
+	// The recorded packet is the decrypted one
+	assert.True(t, bytes.HasPrefix(dump.Bytes(), []byte("#!rtpplay1.0 0.0.0.0/0\n")))
+	assert.True(t, bytes.HasSuffix(dump.Bytes(), testPayload))
+}
+
+func TestRTPDumpReader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewRTPDumpWriter(buf, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5004})
+
+	start := time.Unix(1000, 5000)
+	rtpPacket, err := (&rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 5000}, Payload: []byte{0x01}}).Marshal()
+	assert.NoError(t, err)
+	rtcpPacket := []byte{0x81, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x13, 0x88}
+	assert.NoError(t, w.WriteRTP(start, rtpPacket))
+	assert.NoError(t, w.WriteRTCP(start.Add(20*time.Millisecond), rtcpPacket))
+
+	r, err := NewRTPDumpReader(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1:5004", r.Source.String())
+	assert.True(t, r.Start.Equal(start))
+
+	// Replaying re-protects packets with the original spacing
+	encryptContext, err := buildTestContext()
+	assert.NoError(t, err)
+	decryptContext, err := buildTestContext()
+	assert.NoError(t, err)
+
+	var sent [][]byte
+	before := time.Now()
+	assert.NoError(t, r.ReplayContext(encryptContext, func(b []byte) error {
+		sent = append(sent, b)
+		return nil
+	}))
+	assert.True(t, time.Since(before) >= 20*time.Millisecond)
+
+	assert.Len(t, sent, 2)
+	decrypted, err := decryptContext.DecryptRTP(nil, sent[0], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, rtpPacket, decrypted)
+	decrypted, err = decryptContext.DecryptRTCP(nil, sent[1], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, rtcpPacket, decrypted)
+
+	_, err = NewRTPDumpReader(bytes.NewReader([]byte("not a dump\n")))
+	assert.ErrorIs(t, err, errInvalidRTPDump)
+	r, err = NewRTPDumpReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	assert.NoError(t, err)
+	_, err = r.Next()
+	assert.NoError(t, err)
+	_, err = r.Next()
+	assert.ErrorIs(t, err, errInvalidRTPDump)
+}
@@ -0,0 +1,334 @@
+package srtp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// CryptoAttribute is a SDES crypto attribute of RFC 4568, the
+// "a=crypto:<tag> <crypto-suite> inline:<key||salt>[|<lifetime>][|<MKI>:<length>]"
+// line offering or answering the keys a side sends with.
+// https://tools.ietf.org/html/rfc4568
+type CryptoAttribute struct {
+	Tag        int
+	Profile    ProtectionProfile
+	MasterKey  []byte
+	MasterSalt []byte
+
+	// Lifetime is how many packets the master key may protect, zero if the
+	// attribute does not say
+	Lifetime uint64
+	// MKI is the master key identifier, nil if packets carry none. Its length
+	// is the MKI length signaled.
+	MKI []byte
+
+	// SessionParams are the parameters following the key, such as
+	// UNENCRYPTED_SRTCP, left as they are. See SetCryptoAttributes for those
+	// supported.
+	SessionParams []string
+}
+
+// NewCryptoAttribute returns an attribute with a freshly generated master key
+// and salt for profile, to be offered with tag.
+func NewCryptoAttribute(tag int, profile ProtectionProfile) (*CryptoAttribute, error) {
+	if _, ok := profile.sdesSuite(); !ok {
+		return nil, fmt.Errorf("%w: %#v", errUnknownCryptoSuite, profile)
+	}
+	params, err := profile.params()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &CryptoAttribute{
+		Tag:        tag,
+		Profile:    profile,
+		MasterKey:  make([]byte, params.keyLen),
+		MasterSalt: make([]byte, params.saltLen),
+	}
+	if _, err := rand.Read(a.MasterKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(a.MasterSalt); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ParseCryptoAttribute parses a crypto attribute, with or without its "a="
+// prefix. Only a single key parameter is supported.
+func ParseCryptoAttribute(line string) (*CryptoAttribute, error) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "a=")
+	if !strings.HasPrefix(line, "crypto:") {
+		return nil, fmt.Errorf("%w: not a crypto attribute", errInvalidCryptoAttribute)
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "crypto:"))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("%w: missing fields", errInvalidCryptoAttribute)
+	}
+
+	tag, err := strconv.Atoi(fields[0])
+	if err != nil || tag < 0 || tag > 999999999 {
+		return nil, fmt.Errorf("%w: tag %q", errInvalidCryptoAttribute, fields[0])
+	}
+
+	profile, ok := profileFromSDESSuite(fields[1])
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownCryptoSuite, fields[1])
+	}
+	params, err := profile.params()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &CryptoAttribute{Tag: tag, Profile: profile, SessionParams: fields[3:]}
+	if err := a.parseKeyParams(fields[2], params.keyLen, params.saltLen); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *CryptoAttribute) parseKeyParams(keyParams string, keyLen, saltLen int) error {
+	if strings.Contains(keyParams, ";") {
+		return fmt.Errorf("%w: multiple key parameters are not supported", errInvalidCryptoAttribute)
+	}
+	if !strings.HasPrefix(keyParams, "inline:") {
+		return fmt.Errorf("%w: key method must be inline", errInvalidCryptoAttribute)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(keyParams, "inline:"), "|")
+	keySalt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		// Some implementations leave the padding out
+		if keySalt, err = base64.RawStdEncoding.DecodeString(parts[0]); err != nil {
+			return fmt.Errorf("%w: key: %v", errInvalidCryptoAttribute, err) //nolint:errorlint
+		}
+	}
+	if len(keySalt) != keyLen+saltLen {
+		return fmt.Errorf("%w: key and salt are %d bytes, want %d", errInvalidCryptoAttribute, len(keySalt), keyLen+saltLen)
+	}
+	a.MasterKey, a.MasterSalt = keySalt[:keyLen], keySalt[keyLen:]
+
+	// The lifetime is optional even when a MKI follows, the MKI has a colon
+	for _, part := range parts[1:] {
+		switch {
+		case strings.Contains(part, ":") && a.MKI == nil:
+			if a.MKI, err = parseSDESMKI(part); err != nil {
+				return err
+			}
+		case !strings.Contains(part, ":") && a.Lifetime == 0 && a.MKI == nil:
+			if a.Lifetime, err = parseSDESLifetime(part); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: key parameter %q", errInvalidCryptoAttribute, part)
+		}
+	}
+	return nil
+}
+
+func parseSDESLifetime(s string) (uint64, error) {
+	if exp := strings.TrimPrefix(s, "2^"); exp != s {
+		n, err := strconv.ParseUint(exp, 10, 6)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("%w: lifetime %q", errInvalidCryptoAttribute, s)
+		}
+		return 1 << n, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("%w: lifetime %q", errInvalidCryptoAttribute, s)
+	}
+	return n, nil
+}
+
+func parseSDESMKI(s string) ([]byte, error) {
+	i := strings.IndexByte(s, ':')
+	length, err := strconv.Atoi(s[i+1:])
+	if err != nil || length < 1 || length > 128 {
+		return nil, fmt.Errorf("%w: MKI length %q", errInvalidCryptoAttribute, s[i+1:])
+	}
+	value, ok := new(big.Int).SetString(s[:i], 10)
+	if !ok || value.Sign() < 0 || len(value.Bytes()) > length {
+		return nil, fmt.Errorf("%w: MKI value %q", errInvalidCryptoAttribute, s[:i])
+	}
+	return value.FillBytes(make([]byte, length)), nil
+}
+
+// Marshal returns the attribute as an SDP line without its "a=" prefix
+func (a *CryptoAttribute) Marshal() (string, error) {
+	suite, ok := a.Profile.sdesSuite()
+	if !ok {
+		return "", fmt.Errorf("%w: %#v", errUnknownCryptoSuite, a.Profile)
+	}
+	params, err := a.Profile.params()
+	if err != nil {
+		return "", err
+	}
+	if len(a.MasterKey) != params.keyLen || len(a.MasterSalt) != params.saltLen {
+		return "", fmt.Errorf("%w: key and salt are %d and %d bytes, want %d and %d",
+			errInvalidCryptoAttribute, len(a.MasterKey), len(a.MasterSalt), params.keyLen, params.saltLen)
+	}
+	if len(a.MKI) > 128 {
+		return "", fmt.Errorf("%w: MKI is %d bytes", errInvalidCryptoAttribute, len(a.MKI))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "crypto:%d %s inline:%s", a.Tag, suite,
+		base64.StdEncoding.EncodeToString(append(append([]byte{}, a.MasterKey...), a.MasterSalt...)))
+	switch {
+	case a.Lifetime == 0:
+	case bits.OnesCount64(a.Lifetime) == 1:
+		fmt.Fprintf(&b, "|2^%d", bits.TrailingZeros64(a.Lifetime))
+	default:
+		fmt.Fprintf(&b, "|%d", a.Lifetime)
+	}
+	if a.MKI != nil {
+		fmt.Fprintf(&b, "|%s:%d", new(big.Int).SetBytes(a.MKI), len(a.MKI))
+	}
+	for _, param := range a.SessionParams {
+		b.WriteString(" " + param)
+	}
+	return b.String(), nil
+}
+
+// SetCryptoAttributes configures the profile and keys of c from the crypto
+// attributes negotiated with SDES: local is the one this side sent, remote
+// the one of the peer. Their MKIs and lifetimes are set with LocalOptions and
+// RemoteOptions.
+//
+// The only session parameters supported are KDR=0 and UNENCRYPTED_SRTP
+// together with UNENCRYPTED_SRTCP, which sets AuthenticationOnly and must
+// then be declared by both attributes. Any other fails, rather than being
+// ignored while the peer relies on it.
+func (c *Config) SetCryptoAttributes(local, remote *CryptoAttribute) error {
+	if local.Profile != remote.Profile {
+		return fmt.Errorf("%w: %#v and %#v", errCryptoSuiteMismatch, local.Profile, remote.Profile)
+	}
+	localUnencrypted, err := local.unencrypted()
+	if err != nil {
+		return err
+	}
+	remoteUnencrypted, err := remote.unencrypted()
+	if err != nil {
+		return err
+	}
+	if localUnencrypted != remoteUnencrypted {
+		return fmt.Errorf("%w: payloads in the clear in one direction only", errUnsupportedSessionParam)
+	}
+
+	c.Profile = local.Profile
+	if localUnencrypted {
+		c.AuthenticationOnly = true
+	}
+	c.Keys = SessionKeys{
+		LocalMasterKey:   local.MasterKey,
+		LocalMasterSalt:  local.MasterSalt,
+		RemoteMasterKey:  remote.MasterKey,
+		RemoteMasterSalt: remote.MasterSalt,
+	}
+	c.LocalOptions = append(c.LocalOptions, local.options()...)
+	c.RemoteOptions = append(c.RemoteOptions, remote.options()...)
+	return nil
+}
+
+// unencrypted checks that the session parameters of a are supported and
+// tells whether they leave SRTP and SRTCP payloads in the clear. Both are or
+// neither, as AuthenticationOnly covers both.
+func (a *CryptoAttribute) unencrypted() (bool, error) {
+	var srtp, srtcp bool
+	for _, param := range a.SessionParams {
+		switch {
+		case param == "UNENCRYPTED_SRTP":
+			srtp = true
+		case param == "UNENCRYPTED_SRTCP":
+			srtcp = true
+		case strings.HasPrefix(param, "KDR="):
+			if param != "KDR=0" {
+				return false, errNonZeroKDRNotSupported
+			}
+		default:
+			return false, fmt.Errorf("%w: %s", errUnsupportedSessionParam, param)
+		}
+	}
+	if srtp != srtcp {
+		return false, fmt.Errorf("%w: only one of UNENCRYPTED_SRTP and UNENCRYPTED_SRTCP", errUnsupportedSessionParam)
+	}
+	return srtp, nil
+}
+
+func (a *CryptoAttribute) options() []ContextOption {
+	var opts []ContextOption
+	if a.MKI != nil {
+		opts = append(opts, MasterKeyIdentifier(a.MKI))
+	}
+	if a.Lifetime != 0 {
+		opts = append(opts, MasterKeyLifetime(a.Lifetime))
+	}
+	return opts
+}
+
+// sdesSuite returns the SDES crypto-suite name of p
+func (p ProtectionProfile) sdesSuite() (string, bool) {
+	switch p {
+	case ProtectionProfileAes128CmHmacSha1_80:
+		return "AES_CM_128_HMAC_SHA1_80", true
+	case ProtectionProfileAes192CmHmacSha1_80:
+		return "AES_192_CM_HMAC_SHA1_80", true
+	case ProtectionProfileAes192CmHmacSha1_32:
+		return "AES_192_CM_HMAC_SHA1_32", true
+	case ProtectionProfileAes256CmHmacSha1_80:
+		return "AES_256_CM_HMAC_SHA1_80", true
+	case ProtectionProfileAes256CmHmacSha1_32:
+		return "AES_256_CM_HMAC_SHA1_32", true
+	case ProtectionProfileAes128F8HmacSha1_80:
+		return "F8_128_HMAC_SHA1_80", true
+	case ProtectionProfileAeadAes128Gcm:
+		return "AEAD_AES_128_GCM", true
+	case ProtectionProfileAria128CtrHmacSha1_80:
+		return "ARIA_128_CTR_HMAC_SHA1_80", true
+	case ProtectionProfileAria128CtrHmacSha1_32:
+		return "ARIA_128_CTR_HMAC_SHA1_32", true
+	case ProtectionProfileAria256CtrHmacSha1_80:
+		return "ARIA_256_CTR_HMAC_SHA1_80", true
+	case ProtectionProfileAria256CtrHmacSha1_32:
+		return "ARIA_256_CTR_HMAC_SHA1_32", true
+	case ProtectionProfileAeadAria128Gcm:
+		return "AEAD_ARIA_128_GCM", true
+	case ProtectionProfileAeadAria256Gcm:
+		return "AEAD_ARIA_256_GCM", true
+	case ProtectionProfileSeed128CtrHmacSha1_80:
+		return "SEED_CTR_128_HMAC_SHA1_80", true
+	case ProtectionProfileAeadSeed128Ccm:
+		return "SEED_128_CCM_80", true
+	case ProtectionProfileAeadSeed128Gcm:
+		return "SEED_128_GCM_96", true
+	default:
+		return "", false
+	}
+}
+
+func profileFromSDESSuite(suite string) (ProtectionProfile, bool) {
+	for _, p := range []ProtectionProfile{
+		ProtectionProfileAes128CmHmacSha1_80,
+		ProtectionProfileAes192CmHmacSha1_80, ProtectionProfileAes192CmHmacSha1_32,
+		ProtectionProfileAes256CmHmacSha1_80, ProtectionProfileAes256CmHmacSha1_32,
+		ProtectionProfileAes128F8HmacSha1_80,
+		ProtectionProfileAeadAes128Gcm,
+		ProtectionProfileAria128CtrHmacSha1_80, ProtectionProfileAria128CtrHmacSha1_32,
+		ProtectionProfileAria256CtrHmacSha1_80, ProtectionProfileAria256CtrHmacSha1_32,
+		ProtectionProfileAeadAria128Gcm, ProtectionProfileAeadAria256Gcm,
+		ProtectionProfileSeed128CtrHmacSha1_80,
+		ProtectionProfileAeadSeed128Ccm, ProtectionProfileAeadSeed128Gcm,
+	} {
+		if name, _ := p.sdesSuite(); name == suite {
+			return p, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,145 @@
+package srtp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/rtp/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCryptoAttribute(t *testing.T) {
+	// https://tools.ietf.org/html/rfc4568#section-4
+	const line = "a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR|2^20|1:4"
+
+	a, err := ParseCryptoAttribute(line)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, a.Tag)
+	assert.Equal(t, ProtectionProfileAes128CmHmacSha1_80, a.Profile)
+	assert.Len(t, a.MasterKey, 16)
+	assert.Len(t, a.MasterSalt, 14)
+	assert.Equal(t, uint64(1<<20), a.Lifetime)
+	assert.Equal(t, []byte{0, 0, 0, 1}, a.MKI)
+
+	marshaled, err := a.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, line[len("a="):], marshaled)
+
+	for _, tc := range []struct {
+		line  string
+		key   string
+		value interface{}
+	}{
+		{"crypto:2 AES_256_CM_HMAC_SHA1_32 inline:YUJDZGVmZ2hpSktMbW9QUXJzVHVWd1l6MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMg==|7:1 UNENCRYPTED_SRTCP", "mki", []byte{7}},
+		{"crypto:3 AEAD_AES_128_GCM inline:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGw==|1000", "lifetime", uint64(1000)},
+	} {
+		a, err := ParseCryptoAttribute(tc.line)
+		assert.NoError(t, err, tc.line)
+		switch tc.key {
+		case "mki":
+			assert.Equal(t, tc.value, a.MKI)
+			assert.Equal(t, []string{"UNENCRYPTED_SRTCP"}, a.SessionParams)
+		case "lifetime":
+			assert.Equal(t, tc.value, a.Lifetime)
+		}
+		marshaled, err := a.Marshal()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.line, marshaled)
+	}
+
+	for _, tc := range []struct {
+		line string
+		err  error
+	}{
+		{"a=fingerprint:sha-256 00", errInvalidCryptoAttribute},
+		{"a=crypto:1 AES_CM_128_HMAC_SHA1_80", errInvalidCryptoAttribute},
+		{"a=crypto:1 UNKNOWN_SUITE inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR", errUnknownCryptoSuite},
+		{"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0m", errInvalidCryptoAttribute},
+		{"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR|1:4|2^20", errInvalidCryptoAttribute},
+		{"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR|256:1", errInvalidCryptoAttribute},
+		{"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR;inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR", errInvalidCryptoAttribute},
+	} {
+		_, err := ParseCryptoAttribute(tc.line)
+		assert.True(t, errors.Is(err, tc.err), tc.line)
+	}
+}
+
+func TestConfigSetCryptoAttributes(t *testing.T) {
+	offer, err := NewCryptoAttribute(1, ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+	offer.MKI = []byte{0x01, 0x02}
+	answer, err := NewCryptoAttribute(1, ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+
+	_, err = NewCryptoAttribute(1, ProtectionProfileDoubleAeadAes128Gcm)
+	assert.True(t, errors.Is(err, errUnknownCryptoSuite))
+
+	// The answerer parses the offer off the wire
+	offerLine, err := offer.Marshal()
+	assert.NoError(t, err)
+	remoteOffer, err := ParseCryptoAttribute(offerLine)
+	assert.NoError(t, err)
+
+	offerer, answerer := &Config{}, &Config{}
+	assert.NoError(t, offerer.SetCryptoAttributes(offer, answer))
+	assert.NoError(t, answerer.SetCryptoAttributes(answer, remoteOffer))
+	assert.Equal(t, ProtectionProfileAes128CmHmacSha1_80, answerer.Profile)
+	assert.Equal(t, offer.MasterKey, answerer.Keys.RemoteMasterKey)
+	assert.Equal(t, offer.MasterSalt, answerer.Keys.RemoteMasterSalt)
+
+	encryptContext, err := CreateContext(offerer.Keys.LocalMasterKey, offerer.Keys.LocalMasterSalt, offerer.Profile, offerer.LocalOptions...)
+	assert.NoError(t, err)
+	decryptContext, err := CreateContext(answerer.Keys.RemoteMasterKey, answerer.Keys.RemoteMasterSalt, answerer.Profile, answerer.RemoteOptions...)
+	assert.NoError(t, err)
+
+	pkt := &rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1, SequenceNumber: 1}, Payload: []byte{0x01, 0x02}}
+	raw, err := pkt.Marshal()
+	assert.NoError(t, err)
+	encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+	decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, decrypted)
+
+	answer.Profile = ProtectionProfileAes256CmHmacSha1_80
+	assert.True(t, errors.Is(answerer.SetCryptoAttributes(answer, remoteOffer), errCryptoSuiteMismatch))
+}
+
+func TestConfigSetCryptoAttributesSessionParams(t *testing.T) {
+	parse := func(params string) *CryptoAttribute {
+		a, err := ParseCryptoAttribute("crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR " + params)
+		assert.NoError(t, err)
+		return a
+	}
+
+	const unencrypted = "UNENCRYPTED_SRTP UNENCRYPTED_SRTCP"
+	config := &Config{}
+	assert.NoError(t, config.SetCryptoAttributes(parse(unencrypted+" KDR=0"), parse(unencrypted)))
+	assert.True(t, config.AuthenticationOnly)
+
+	encryptContext, err := CreateContext(config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt, config.Profile, AuthenticationOnly())
+	assert.NoError(t, err)
+	pkt := &rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1, SequenceNumber: 1}, Payload: []byte{0x01, 0x02}}
+	raw, err := pkt.Marshal()
+	assert.NoError(t, err)
+	encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, encrypted[:len(raw)])
+
+	for _, tc := range []struct {
+		local, remote string
+		err           error
+	}{
+		{"UNENCRYPTED_SRTCP", "UNENCRYPTED_SRTCP", errUnsupportedSessionParam},
+		{"UNENCRYPTED_SRTP", "UNENCRYPTED_SRTP", errUnsupportedSessionParam},
+		{unencrypted, "KDR=0", errUnsupportedSessionParam},
+		{"UNAUTHENTICATED_SRTP", "", errUnsupportedSessionParam},
+		{"", "WSH=64", errUnsupportedSessionParam},
+		{"FEC_ORDER=FEC_SRTP", "", errUnsupportedSessionParam},
+		{"", "KDR=1", errNonZeroKDRNotSupported},
+	} {
+		config := &Config{}
+		err := config.SetCryptoAttributes(parse(tc.local), parse(tc.remote))
+		assert.True(t, errors.Is(err, tc.err), "%q %q: %v", tc.local, tc.remote, err)
+	}
+}
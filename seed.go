@@ -0,0 +1,122 @@
+package srtp
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	seedBlockSize = 16
+	seedRounds    = 16
+	seedFieldPoly = 0x63 // x^8 + x^6 + x^5 + x + 1
+)
+
+// seedCipher implements the SEED block cipher https://tools.ietf.org/html/rfc4269
+type seedCipher struct {
+	sbox *seedSBoxes
+	keys [seedRounds][2]uint32
+}
+
+// seedSBoxes holds S1 and S2
+type seedSBoxes [2][256]byte
+
+func newSeedCipher(key []byte) (cipher.Block, error) {
+	if len(key) != seedBlockSize {
+		return nil, fmt.Errorf("%w: %d", errInvalidSEEDKeySize, len(key))
+	}
+
+	s := &seedCipher{sbox: newSeedSBoxes()}
+	k0, k1 := binary.BigEndian.Uint32(key[0:]), binary.BigEndian.Uint32(key[4:])
+	k2, k3 := binary.BigEndian.Uint32(key[8:]), binary.BigEndian.Uint32(key[12:])
+
+	kc := uint32(0x9e3779b9)
+	for i := range s.keys {
+		s.keys[i] = [2]uint32{s.g(k0 + k2 - kc), s.g(k1 - k3 + kc)}
+
+		// Rotate Key0||Key1 right and Key2||Key3 left by 8 bits in turns
+		if i%2 == 0 {
+			k0, k1 = k0>>8|k1<<24, k1>>8|k0<<24
+		} else {
+			k2, k3 = k2<<8|k3>>24, k3<<8|k2>>24
+		}
+		kc = bits.RotateLeft32(kc, 1)
+	}
+
+	return s, nil
+}
+
+func (s *seedCipher) BlockSize() int {
+	return seedBlockSize
+}
+
+func (s *seedCipher) Encrypt(dst, src []byte) {
+	s.crypt(dst, src, false)
+}
+
+func (s *seedCipher) Decrypt(dst, src []byte) {
+	s.crypt(dst, src, true)
+}
+
+func (s *seedCipher) wipe() {
+	s.keys = [seedRounds][2]uint32{}
+}
+
+func (s *seedCipher) crypt(dst, src []byte, decrypt bool) {
+	l0, l1 := binary.BigEndian.Uint32(src[0:]), binary.BigEndian.Uint32(src[4:])
+	r0, r1 := binary.BigEndian.Uint32(src[8:]), binary.BigEndian.Uint32(src[12:])
+
+	for i := 0; i < seedRounds; i++ {
+		k := s.keys[i]
+		if decrypt {
+			k = s.keys[seedRounds-1-i]
+		}
+		f0, f1 := s.f(r0, r1, k)
+		l0, l1, r0, r1 = r0, r1, l0^f0, l1^f1
+	}
+
+	binary.BigEndian.PutUint32(dst[0:], r0)
+	binary.BigEndian.PutUint32(dst[4:], r1)
+	binary.BigEndian.PutUint32(dst[8:], l0)
+	binary.BigEndian.PutUint32(dst[12:], l1)
+}
+
+// f is the round function, mixing the right half with the round key
+func (s *seedCipher) f(c, d uint32, k [2]uint32) (uint32, uint32) {
+	t0, t1 := c^k[0], d^k[1]
+	t1 = s.g(t1 ^ t0)
+	t0 = s.g(t0 + t1)
+	t1 = s.g(t1 + t0)
+	return t0 + t1, t1
+}
+
+// g applies the S-boxes to each byte of x, then mixes the bytes with masks
+func (s *seedCipher) g(x uint32) uint32 {
+	masks := [4]byte{0xfc, 0xf3, 0xcf, 0x3f}
+	y := [4]byte{
+		s.sbox[0][byte(x)], s.sbox[1][byte(x>>8)],
+		s.sbox[0][byte(x>>16)], s.sbox[1][byte(x>>24)],
+	}
+
+	var z uint32
+	for j := 0; j < 4; j++ {
+		zj := y[0]&masks[j] ^ y[1]&masks[(j+1)%4] ^ y[2]&masks[(j+2)%4] ^ y[3]&masks[(j+3)%4]
+		z |= uint32(zj) << (8 * j)
+	}
+	return z
+}
+
+// newSeedSBoxes computes the S-boxes from their algebraic definition: S1 is
+// an affine transform of x^247 and S2 one of x^251 in GF(2^8)
+func newSeedSBoxes() *seedSBoxes {
+	s1Matrix := [8]byte{0x2c, 0xd0, 0x69, 0xc2, 0x41, 0x44, 0x58, 0xe2}
+	s2Matrix := [8]byte{0xd0, 0x2a, 0xe1, 0x2c, 0x21, 0x30, 0xa2, 0x6c}
+
+	s := &seedSBoxes{}
+	for x := 0; x < 256; x++ {
+		s[0][x] = gfAffine(s1Matrix, gfPow(byte(x), 247, seedFieldPoly), 0xa9)
+		s[1][x] = gfAffine(s2Matrix, gfPow(byte(x), 251, seedFieldPoly), 0x38)
+	}
+	return s
+}
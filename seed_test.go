@@ -0,0 +1,44 @@
+package srtp
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// https://tools.ietf.org/html/rfc4269#appendix-B
+func TestSeedCipher(t *testing.T) {
+	for _, test := range []struct {
+		key, plaintext, ciphertext string
+	}{
+		{
+			key:        "00000000000000000000000000000000",
+			plaintext:  "000102030405060708090a0b0c0d0e0f",
+			ciphertext: "5ebac6e0054e166819aff1cc6d346cdb",
+		},
+		{
+			key:        "000102030405060708090a0b0c0d0e0f",
+			plaintext:  "00000000000000000000000000000000",
+			ciphertext: "c11f22f20140505084483597e4370f43",
+		},
+	} {
+		key, err := hex.DecodeString(test.key)
+		assert.NoError(t, err)
+		plaintext, err := hex.DecodeString(test.plaintext)
+		assert.NoError(t, err)
+
+		block, err := newSeedCipher(key)
+		assert.NoError(t, err)
+
+		ciphertext := make([]byte, seedBlockSize)
+		block.Encrypt(ciphertext, plaintext)
+		assert.Equal(t, test.ciphertext, hex.EncodeToString(ciphertext))
+
+		block.Decrypt(ciphertext, ciphertext)
+		assert.Equal(t, plaintext, ciphertext)
+	}
+
+	_, err := newSeedCipher(make([]byte, 32))
+	assert.ErrorIs(t, err, errInvalidSEEDKeySize)
+}
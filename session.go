@@ -1,38 +1,146 @@
 package srtp
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/deadline"
 	"github.com/pion/transport/packetio"
 )
 
+const (
+	defaultEarlyPacketQueueSize = 128
+	defaultPausedWriteQueueSize = 128
+)
+
 type streamSession interface {
 	Close() error
 	write([]byte) (int, error)
+	writeUnpaused([]byte) (int, error)
 	decrypt([]byte) error
+	packetSSRC([]byte) (uint32, bool)
+	admitsKeyFetch(ssrc uint32) bool
 }
 
 type session struct {
 	localContextMutex           sync.Mutex
 	localContext, remoteContext *Context
 	localOptions, remoteOptions []ContextOption
+	lastWrite                   time.Time
+
+	// Master keys sent packets are protected with, those of SetStreamKeys
+	// by SSRC, guarded by localContextMutex
+	localMasterKey        []byte
+	localStreamMasterKeys map[uint32][]byte
+
+	// streamKeys are installed by start, see Config.StreamKeys
+	streamKeys map[uint32]SessionKeys
+
+	keyProvider KeyingMaterialProvider
+	keyTimeout  time.Duration
+	keyFetches  map[uint32]*keyFetch // guarded by decryptMutex
+
+	startMutex           sync.Mutex
+	decryptMutex         sync.Mutex
+	earlyPackets         [][]byte
+	earlyPacketQueueSize int
+	remoteKeysPending    bool // started without remote keys, guarded by decryptMutex
+
+	writePauseMutex      sync.RWMutex
+	writesPaused         bool
+	pausedWritesMutex    sync.Mutex
+	pausedWrites         [][]byte
+	pausedWriteQueueSize int
 
-	newStream chan readStream
+	readPauseMutex sync.Mutex
+	readsResumed   chan interface{} // non-nil while reads are paused
+	readsClosing   bool
+
+	newStream      chan struct{} // signaled when a stream becomes pending, closed with the session
+	acceptDeadline *deadline.Deadline
 
 	started chan interface{}
 	closed  chan interface{}
 
 	readStreamsClosed bool
 	readStreams       map[uint32]readStream
+	pendingStreams    []readStream // created by incoming packets, not yet accepted nor opened
+	ignoredSSRCs      map[uint32]struct{}
+	anyStream         *ReadStreamAny
+	acceptedSSRCs     map[uint32]struct{} // nil accepts all, see Config.AcceptedSSRCs
+	streamFilter      func(ssrc uint32, firstHeader *rtp.Header) bool
+	newStreamLimit    *tokenBucket // nil unless Config.MaxNewStreamsPerSecond is set
+	openedStreamsOnly bool
 	readStreamsLock   sync.Mutex
 
-	log           logging.LeveledLogger
-	bufferFactory func(packetType packetio.BufferPacketType, ssrc uint32) io.ReadWriteCloser
+	directionLock          sync.Mutex
+	sendClosed, recvClosed bool
+
+	log            logging.LeveledLogger
+	bufferFactory  func(packetType packetio.BufferPacketType, ssrc uint32) io.ReadWriteCloser
+	bufferPool     BufferPool
+	readQueueSize  int
+	queueBudget    *queueBudget // nil unless Config.ReadQueueBudget is set
+	onStreamClosed func(ssrc uint32, reason StreamCloseReason)
+	onSSRCConflict func(ssrc uint32)
+	onDecryptError func(ssrc uint32, err error)
+	onNewStream    func(r readStream) // replaces the pending streams if set
+
+	// Packets failing authentication, guarded by decryptMutex
+	authFailurePolicy       AuthFailurePolicy
+	maxAuthFailures         int
+	authFailures            uint64
+	consecutiveAuthFailures int
+
+	// Counters of SessionStats, those of dropped packets are guarded by
+	// decryptMutex
+	trafficMu                      sync.Mutex
+	packetsSent, bytesSent         uint64
+	packetsReceived, bytesReceived uint64
+	replayDrops, decryptErrors     uint64
+	queueDrops, rejected           uint64
+	streamsLimited                 uint64
+
+	// Source addresses of authenticated packets, guarded by decryptMutex,
+	// see Config.OnRemoteAddrChange
+	source             net.Addr // of the packet being decrypted, nil if unknown
+	remoteSources      map[uint32]net.Addr
+	onRemoteAddrChange func(ssrc uint32, addr net.Addr)
+	followRemoteAddr   bool
+
+	// Calls of Config callbacks queued while decryptMutex is held, see
+	// queueEvent
+	events []func()
+
+	// onRemoteSRTPEvicted is called with decryptMutex held when the remote
+	// context evicts the state of a SSRC, see Config.MaxSSRCStates
+	onRemoteSRTPEvicted func(ssrc uint32)
 
-	nextConn net.Conn
+	params profileParams
+	mtu    int
+
+	bitrateWindow time.Duration
+	writeBitrate  *bitrateEstimator
+
+	rtpDump *RTPDumpWriter
+
+	child streamSession
+
+	// nextConn is replaced by setTransport until the session is closed
+	connMu        sync.RWMutex
+	nextConn      net.Conn
+	connClosed    bool
+	readBatchSize int
+	packetSize    int // of the buffers packets are read into, see Config.MaxPacketSize
 }
 
 // Config is used to configure a session.
@@ -40,11 +148,240 @@ type session struct {
 // or directly pass the keys themselves.
 // After a Config is passed to a session it must not be modified.
 type Config struct {
-	Keys          SessionKeys
+	// Keys may be left empty to create the session before keys are known,
+	// they are then provided to Start. Packets received until then are queued,
+	// see EarlyPacketQueueSize. The remote keys alone may be left empty to
+	// send before the peer's keys are known, they are then provided to
+	// SetRemoteKeys and received packets are queued until then.
+	Keys SessionKeys
+
+	// StreamKeys are keys used instead of Keys for the packets of a SSRC, for
+	// topologies where every sender has its own master key. Either direction
+	// may be left empty to use Keys for it. They are installed along Keys,
+	// more can be set later with SetStreamKeys.
+	StreamKeys map[uint32]SessionKeys
+
+	// KeyingMaterialProvider, if set, is asked for the keys of every SSRC
+	// received that has none in StreamKeys. Packets of the SSRC are queued
+	// until they arrive, up to EarlyPacketQueueSize of them, or until
+	// KeyingMaterialTimeout passes. Those still without keys then use Keys.
+	// SRTP packets of SSRCs AcceptedSSRCs, OpenedStreamsOnly or IgnoreSSRC
+	// refuse are dropped first. The keys of at most 64 SSRCs, or
+	// MaxSSRCStates if lower, are fetched at once, packets of other new SSRCs
+	// are dropped meanwhile and counted in SessionStats.StreamsLimited.
+	// When a Config is shared by a SRTP and a SRTCP session both ask for the
+	// keys.
+	KeyingMaterialProvider KeyingMaterialProvider
+
+	// KeyingMaterialTimeout bounds how long the KeyingMaterialProvider is
+	// waited for. Zero uses a default of five seconds.
+	KeyingMaterialTimeout time.Duration
+
 	Profile       ProtectionProfile
 	BufferFactory func(packetType packetio.BufferPacketType, ssrc uint32) io.ReadWriteCloser
 	LoggerFactory logging.LoggerFactory
 
+	// AcceptedSSRCs, if set, are the only SSRCs read streams are created for.
+	// Packets of other SSRCs are dropped, SRTP ones before being decrypted,
+	// and counted in SessionStats.Rejected. It protects public servers from
+	// peers spraying random SSRCs.
+	AcceptedSSRCs []uint32
+
+	// OpenedStreamsOnly drops the packets of SSRCs without a read stream
+	// opened by OpenReadStream, SRTP ones before being decrypted, rather than
+	// creating streams for them, as tightly provisioned gateways require.
+	// They are counted in SessionStats.Rejected and AcceptStream never
+	// returns. ReadStreamAny does not receive them either.
+	OpenedStreamsOnly bool
+
+	// StreamFilter, if set, is asked whether to create a read stream for a
+	// SSRC that has none when one of its packets authenticates, such as to
+	// look the sender up in signaling. Packets it refuses are dropped and
+	// counted in SessionStats.Rejected, the next one asks again. firstHeader
+	// is the header of the packet, nil in SRTCP sessions, and must not be
+	// modified. It is called while the packet is decrypted, so it must return
+	// quickly and must not call the session, such as Stats, which would wait
+	// for the packet forever.
+	StreamFilter func(ssrc uint32, firstHeader *rtp.Header) bool
+
+	// MaxNewStreamsPerSecond, if set, bounds how many read streams packets of
+	// SSRCs without one create per second, allowing bursts of up to
+	// NewStreamBurst, which defaults to MaxNewStreamsPerSecond. Packets over
+	// the limit are dropped and counted in SessionStats.StreamsLimited, so a
+	// flood of bogus SSRCs cannot exhaust memory or AcceptStream callers.
+	// Streams opened with OpenReadStream are not limited.
+	MaxNewStreamsPerSecond int
+	NewStreamBurst         int
+
+	// ReadStreamQueueSize bounds how many packets each read stream holds
+	// until they are read, so a slow reader loses its own packets rather than
+	// growing its queue up to the default limit of 1MB for SRTP and 100KB for
+	// SRTCP streams. Dropped packets are counted in StreamInfo.Dropped. It
+	// does not apply to buffers of BufferFactory.
+	ReadStreamQueueSize int
+
+	// ReadQueueBudget, if set, bounds the bytes queued in all read streams of
+	// the session together, so one stalled reader cannot grow memory beyond
+	// it. Packets arriving once it is used up are dropped, counted in
+	// SessionStats.BudgetDrops as well as in the queue drops of their
+	// stream. Like ReadStreamQueueSize, it does not apply to buffers of
+	// BufferFactory.
+	ReadQueueBudget int
+
+	// BufferPool, if set, supplies the buffers packets are read from the conn
+	// into and protected in before being sent. Packets kept for
+	// retransmission, see RetransmitCacheSize, are not protected in them.
+	BufferPool BufferPool
+
+	// ReadBatchSize, if above one, is how many packets are read at once from
+	// a *net.UDPConn on Linux, with a single recvmmsg call. Other conns, and
+	// all conns on other platforms or built with the purego tag, are read one
+	// packet at a time, see package batchconn.
+	ReadBatchSize int
+
+	// CipherFactory, if set, is used instead of Profile to protect packets
+	// with a profile that is not built in.
+	CipherFactory CipherFactory
+
+	// AllowNullCipher must be set to use the NULL cipher profiles, such as
+	// ProtectionProfileNullHmacSha1_80, which send media in the clear. They
+	// are meant for debugging only.
+	AllowNullCipher bool
+
+	// AuthenticationOnly sends and expects payloads in the clear with the
+	// keys of Profile, see the AuthenticationOnly option. Like the NULL
+	// cipher profiles it requires AllowNullCipher.
+	AuthenticationOnly bool
+
+	// RemoteAddr lets the session run over an unconnected net.PacketConn,
+	// such as a listening *net.UDPConn: packets are written to it and read
+	// from any address. It can be changed later with SetRemoteAddr.
+	RemoteAddr net.Addr
+
+	// AcceptSource is called with the source address of every packet read
+	// when RemoteAddr is set. Packets it returns false for are dropped before
+	// being decrypted, sparing the work of authenticating packets from
+	// unexpected peers.
+	AcceptSource func(addr net.Addr) bool
+
+	// OnRemoteAddrChange is called when an authenticated packet of a remote
+	// SSRC arrives from another address than the previous one, such as a
+	// peer roaming between networks. With FollowRemoteAddr, packets are
+	// written to that address from then on, see SetRemoteAddr. Both only
+	// apply with RemoteAddr. Like OnSSRCConflict, OnRemoteAddrChange must
+	// return quickly.
+	OnRemoteAddrChange func(ssrc uint32, addr net.Addr)
+	FollowRemoteAddr   bool
+
+	// MTU is the maximum size of a datagram written to the underlying conn.
+	// RTCP compound packets that would exceed it once protected are split
+	// into several smaller compounds. Zero disables splitting.
+	MTU int
+
+	// MaxPacketSize is the size of the largest packet read from the conn,
+	// larger ones are cut short and fail authentication. Zero uses a default
+	// of 8192, it may be raised up to 65535 for jumbo frames or media
+	// tunneled over TCP.
+	MaxPacketSize int
+
+	// KeepaliveInterval enables keepalive packets whenever nothing has been
+	// written for that long, so NAT bindings do not expire. SRTP sessions send
+	// an RTP packet carrying only padding and SRTCP sessions an empty RR, both
+	// from KeepaliveSSRC. Zero disables keepalives. The SRTP keepalives number
+	// their own packets, so KeepaliveSSRC must be non-zero and is then
+	// reserved: writing media from it fails, as reusing its sequence numbers
+	// would reuse keystream.
+	KeepaliveInterval    time.Duration
+	KeepaliveSSRC        uint32
+	KeepalivePayloadType uint8
+
+	// EarlyPacketQueueSize bounds how many packets received before Start are
+	// kept to be decrypted once keys are installed, later ones are dropped.
+	// Zero uses a default of 128.
+	EarlyPacketQueueSize int
+
+	// PausedWriteQueueSize bounds how many packets are queued while writes
+	// are paused, further writes fail. Zero uses a default of 128.
+	PausedWriteQueueSize int
+
+	// RetransmitCacheSize is how many protected packets per SSRC a SRTP
+	// session keeps for WriteStreamSRTP.Retransmit. Zero disables the cache.
+	RetransmitCacheSize int
+
+	// BitrateWindow is the period over which the Bitrate of streams is
+	// averaged. Zero uses a default of one second.
+	BitrateWindow time.Duration
+
+	// RTCPFilter, if set, is called by SRTCP sessions for every packet of a
+	// decrypted compound. Packets it returns false for are dropped before
+	// delivery, it may handle them itself to divert them.
+	RTCPFilter func(rtcp.Packet) bool
+
+	// RTPTransform, if set, is called by SRTP sessions on every packet written
+	// with Write or WriteRTP right before it is protected. It may rewrite the
+	// packet in place, e.g. to set header extensions such as abs-send-time.
+	// It works on a copy of the header, the payload must be replaced rather
+	// than modified in place.
+	RTPTransform func(*rtp.Packet)
+
+	// LinkSenderReports makes a SessionPair hand the RTCP sender reports it
+	// receives to the SRTP read stream of the same SSRC, see
+	// ReadStreamSRTP.LastSenderReport.
+	LinkSenderReports bool
+
+	// RTPDump, if set, records every packet the session decrypts
+	RTPDump *RTPDumpWriter
+
+	// OnStreamClosed is called once for every read stream that gets closed.
+	// When a Config is shared by a SRTP and a SRTCP session it is called for
+	// the streams of both.
+	OnStreamClosed func(ssrc uint32, reason StreamCloseReason)
+
+	// OnNewStream, if set, is called with the streams created by incoming
+	// SRTP packets instead of queueing them for AcceptStream, before the
+	// first packet is delivered. It is called while incoming packets are
+	// handled, so it must return quickly, e.g. by reading the stream from a
+	// new goroutine. OnNewStreamSRTCP is its counterpart for SRTCP sessions.
+	OnNewStream      func(stream *ReadStreamSRTP, ssrc uint32)
+	OnNewStreamSRTCP func(stream *ReadStreamSRTCP, ssrc uint32)
+
+	// OnSSRCConflict is called when the first packet of a remote SSRC
+	// authenticates while this side already sends on the same SSRC, the
+	// collision RFC 3550 section 8.2 resolves by picking a new SSRC. It is
+	// called from the read loop once the packet is handled, so it must return
+	// quickly.
+	OnSSRCConflict func(ssrc uint32)
+
+	// OnDecryptError is called with the SSRC and the error of every received
+	// packet that is dropped because it fails to parse, authenticate or pass
+	// replay protection. The SSRC is zero if the packet is too short to carry
+	// one. Reading goes on with the next packet, it only stops when the conn
+	// fails. Like OnSSRCConflict, it must return quickly.
+	OnDecryptError func(ssrc uint32, err error)
+
+	// AuthFailurePolicy decides what happens to received packets failing
+	// authentication. With AuthFailureClose, MaxAuthFailures consecutive
+	// ones close the session, zero uses a default of 64.
+	AuthFailurePolicy AuthFailurePolicy
+	MaxAuthFailures   int
+
+	// EKT, if set, makes SRTP sessions send their master keys in EKT fields
+	// ending every packet, and install the keys other senders send for their
+	// SSRC once a packet authenticates under them. SRTCP sessions ignore it.
+	// https://tools.ietf.org/html/rfc8870
+	EKT *EKTKeyManager
+
+	// EKTFullFieldInterval is how many packets of a SSRC are sent per
+	// FullEKTField, the others carry a ShortEKTField. The first packet always
+	// carries a full one. Zero uses a default of 16.
+	EKTFullFieldInterval int
+
+	// MaxSSRCStates bounds how many SSRCs the remote context of a session
+	// tracks, see the MaxSSRCStates option. SRTP sessions close the read
+	// stream of an evicted SSRC with StreamClosedByLimit. Zero is unbounded.
+	MaxSSRCStates   int
+	SSRCLimitPolicy SSRCLimitPolicy
+
 	// List of local/remote context options.
 	// ReplayProtection is enabled on remote context by default.
 	// Default replay protection window size is 64.
@@ -59,12 +396,90 @@ type SessionKeys struct {
 	RemoteMasterSalt []byte
 }
 
+// params returns the parameters of the profile in use, see CipherFactory
+func (c *Config) params() (profileParams, error) {
+	if c.CipherFactory != nil {
+		return cipherFactoryParams(c.CipherFactory), nil
+	}
+	return c.Profile.params()
+}
+
+func (k *SessionKeys) empty() bool {
+	return len(k.LocalMasterKey) == 0 && len(k.LocalMasterSalt) == 0 &&
+		len(k.RemoteMasterKey) == 0 && len(k.RemoteMasterSalt) == 0
+}
+
+// accept waits for a stream created by an incoming packet
+func (s *session) accept(ctx context.Context) (readStream, error) {
+	for {
+		s.readStreamsLock.Lock()
+		if len(s.pendingStreams) > 0 {
+			r := s.pendingStreams[0]
+			s.pendingStreams = s.pendingStreams[1:]
+			s.readStreamsLock.Unlock()
+			return r, nil
+		}
+		s.readStreamsLock.Unlock()
+
+		select {
+		case _, ok := <-s.newStream:
+			if !ok {
+				return nil, errStreamAlreadyClosed
+			}
+		case <-s.acceptDeadline.Done():
+			return nil, &timeoutError{errAcceptDeadlineExceeded}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// addPendingStream queues a stream created by an incoming packet for
+// AcceptStream, or hands it to Config.OnNewStream
+func (s *session) addPendingStream(r readStream) {
+	s.readStreamsLock.Lock()
+	if s.readStreamsClosed {
+		s.readStreamsLock.Unlock()
+		return
+	} else if s.onNewStream != nil {
+		s.readStreamsLock.Unlock()
+		s.onNewStream(r)
+		return
+	}
+	s.pendingStreams = append(s.pendingStreams, r)
+	s.readStreamsLock.Unlock()
+
+	select {
+	case s.newStream <- struct{}{}:
+	default:
+	}
+}
+
+// claimPendingStream removes ssrc from the pending streams once it is opened
+func (s *session) claimPendingStream(ssrc uint32) {
+	s.readStreamsLock.Lock()
+	defer s.readStreamsLock.Unlock()
+
+	s.removePendingStreamLocked(ssrc)
+}
+
+func (s *session) removePendingStreamLocked(ssrc uint32) {
+	for i, r := range s.pendingStreams {
+		if r.GetSSRC() == ssrc {
+			s.pendingStreams = append(s.pendingStreams[:i:i], s.pendingStreams[i+1:]...)
+			return
+		}
+	}
+}
+
 func (s *session) getOrCreateReadStream(ssrc uint32, child streamSession, proto func() readStream) (readStream, bool) {
 	s.readStreamsLock.Lock()
 	defer s.readStreamsLock.Unlock()
 
 	if s.readStreamsClosed {
 		return nil, false
+	} else if _, ignored := s.ignoredSSRCs[ssrc]; ignored {
+		return nil, false
 	}
 
 	r, ok := s.readStreams[ssrc]
@@ -83,6 +498,264 @@ func (s *session) getOrCreateReadStream(ssrc uint32, child streamSession, proto
 	return r, true
 }
 
+func (s *session) listStreams(pendingOnly bool) []StreamInfo {
+	states := s.remoteSSRCStates()
+
+	s.readStreamsLock.Lock()
+	defer s.readStreamsLock.Unlock()
+
+	streams := s.readStreams
+	if pendingOnly {
+		streams = make(map[uint32]readStream, len(s.pendingStreams))
+		for _, r := range s.pendingStreams {
+			streams[r.GetSSRC()] = r
+		}
+	}
+
+	infos := make([]StreamInfo, 0, len(streams))
+	for ssrc, r := range streams {
+		info := StreamInfo{
+			SSRC:    ssrc,
+			Created: r.createdAt(),
+			Bitrate: r.bitrate(),
+			Packets: r.packetCount(),
+			Dropped: r.droppedCount(),
+		}
+		if state, ok := states[ssrc]; ok {
+			info.ROC, info.LastIndex = state.ROC, state.LastIndex
+			if !state.HasSRTP {
+				info.LastIndex = uint64(state.SRTCPIndex)
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].SSRC < infos[j].SSRC })
+	return infos
+}
+
+func (s *session) getReadStream(ssrc uint32) (readStream, bool) {
+	s.readStreamsLock.Lock()
+	defer s.readStreamsLock.Unlock()
+
+	r, ok := s.readStreams[ssrc]
+	return r, ok
+}
+
+// attachReadStream registers a stream detached from another session
+func (s *session) attachReadStream(r readStream) error {
+	s.readStreamsLock.Lock()
+	defer s.readStreamsLock.Unlock()
+
+	if s.readStreamsClosed {
+		return errStreamAlreadyClosed
+	} else if _, ok := s.readStreams[r.GetSSRC()]; ok {
+		return fmt.Errorf("%w: ssrc=%d", errStreamExists, r.GetSSRC())
+	}
+
+	s.readStreams[r.GetSSRC()] = r
+	return nil
+}
+
+// takeRemoteSRTPState removes the decryption state of ssrc, so it can be moved
+// to another session. It returns nil if the session is not started.
+func (s *session) takeRemoteSRTPState(ssrc uint32) *srtpSSRCState {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	select {
+	case <-s.started:
+	default:
+		return nil
+	}
+
+	state, ok := s.remoteContext.srtpSSRCStates[ssrc]
+	if !ok {
+		return nil
+	}
+	s.remoteContext.forgetSRTPSSRC(ssrc)
+	return state
+}
+
+// removeStream closes the read stream of ssrc and forgets the state of ssrc
+// in the remote context. The local one keeps it: under the same master key, a
+// sending ROC or SRTCP index starting over would reuse keystream.
+func (s *session) removeStream(ssrc uint32) error {
+	err := s.closeReadStream(ssrc, StreamClosedByApplication)
+
+	select {
+	case <-s.started:
+	default:
+		return err
+	}
+
+	s.decryptMutex.Lock()
+	s.remoteContext.RemoveStream(ssrc)
+	delete(s.remoteSources, ssrc)
+	delete(s.keyFetches, ssrc)
+	s.decryptMutex.Unlock()
+	return err
+}
+
+// checkSSRCConflict reports a new remote SSRC the local context already
+// protects packets for, it must be called with decryptMutex held
+func (s *session) checkSSRCConflict(ssrc uint32) {
+	if s.onSSRCConflict == nil {
+		return
+	}
+
+	s.localContextMutex.Lock()
+	_, sendsSRTP := s.localContext.srtpSSRCStates[ssrc]
+	_, sendsSRTCP := s.localContext.srtcpSSRCStates[ssrc]
+	s.localContextMutex.Unlock()
+
+	if sendsSRTP || sendsSRTCP {
+		s.queueEvent(func() { s.onSSRCConflict(ssrc) })
+	}
+}
+
+// queueEvent calls event once unlockDecrypt releases decryptMutex, so that
+// Config callbacks may call back into the session. It must be called with
+// decryptMutex held.
+func (s *session) queueEvent(event func()) {
+	s.events = append(s.events, event)
+}
+
+// unlockDecrypt releases decryptMutex, then calls the events queued meanwhile.
+// It replaces decryptMutex.Unlock wherever packets may have been decrypted.
+func (s *session) unlockDecrypt() {
+	events := s.events
+	s.events = nil
+	s.decryptMutex.Unlock()
+
+	for _, event := range events {
+		event()
+	}
+}
+
+// decrypt hands buf to the child session, reporting packets it drops
+func (s *session) decrypt(buf []byte) {
+	err := s.child.decrypt(buf)
+	switch {
+	case err == nil:
+		s.consecutiveAuthFailures = 0
+		return
+	case errors.Is(err, ErrAuthenticationFailure):
+		if !s.authFailed() {
+			return
+		}
+	case errors.Is(err, ErrReplayed):
+		s.replayDrops++
+	default:
+		s.decryptErrors++
+	}
+
+	s.log.Info(err.Error())
+	if s.onDecryptError != nil {
+		ssrc, _ := s.child.packetSSRC(buf)
+		s.queueEvent(func() { s.onDecryptError(ssrc, err) })
+	}
+}
+
+// remoteSSRCStates returns the decryption state of the remote context by SSRC
+func (s *session) remoteSSRCStates() map[uint32]SSRCState {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	select {
+	case <-s.started:
+	default:
+		return nil
+	}
+
+	states := map[uint32]SSRCState{}
+	for _, state := range s.remoteContext.SSRCStates() {
+		states[state.SSRC] = state
+	}
+	return states
+}
+
+// remoteSRTPStats returns the SRTP counters of ssrc and its highest
+// authenticated index in the remote context
+func (s *session) remoteSRTPStats(ssrc uint32) (CryptoStats, uint64) {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	select {
+	case <-s.started:
+	default:
+		return CryptoStats{}, 0
+	}
+
+	state, ok := s.remoteContext.srtpSSRCStates[ssrc]
+	if !ok {
+		return CryptoStats{}, 0
+	}
+	return state.stats, uint64(state.rolloverCounter)<<16 | uint64(state.lastSequenceNumber)
+}
+
+// remoteSRTCPStats returns the SRTCP counters of ssrc and its last index in
+// the remote context
+func (s *session) remoteSRTCPStats(ssrc uint32) (CryptoStats, uint32) {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	select {
+	case <-s.started:
+	default:
+		return CryptoStats{}, 0
+	}
+
+	state, ok := s.remoteContext.srtcpSSRCStates[ssrc]
+	if !ok {
+		return CryptoStats{}, 0
+	}
+	return state.stats, state.srtcpIndex
+}
+
+// remoteROC returns the rollover counter SRTP packets of ssrc are decrypted with
+func (s *session) remoteROC(ssrc uint32) (uint32, bool) {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	select {
+	case <-s.started:
+	default:
+		return 0, false
+	}
+	return s.remoteContext.ROC(ssrc)
+}
+
+func (s *session) setRemoteROC(ssrc, roc uint32) error {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	select {
+	case <-s.started:
+	default:
+		return errSessionNotStarted
+	}
+	s.remoteContext.SetROC(ssrc, roc)
+	return nil
+}
+
+// putRemoteSRTPState installs the decryption state taken from another session,
+// unless the session is not started or already has state for the SSRC
+func (s *session) putRemoteSRTPState(state *srtpSSRCState) {
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	select {
+	case <-s.started:
+	default:
+		return
+	}
+
+	if _, ok := s.remoteContext.srtpSSRCStates[state.ssrc]; !ok {
+		*s.remoteContext.getSRTPSSRCState(state.ssrc) = *state
+	}
+}
+
 func (s *session) removeReadStream(ssrc uint32) {
 	s.readStreamsLock.Lock()
 	defer s.readStreamsLock.Unlock()
@@ -92,59 +765,678 @@ func (s *session) removeReadStream(ssrc uint32) {
 	}
 
 	delete(s.readStreams, ssrc)
+	s.removePendingStreamLocked(ssrc)
+}
+
+// closeReadStreams stops creating read streams and closes the existing ones.
+// Pending reads are unblocked, buffered data can still be drained.
+func (s *session) closeReadStreams() {
+	s.readStreamsLock.Lock()
+	s.readStreamsClosed = true
+	s.pendingStreams = nil
+	readStreams := make([]readStream, 0, len(s.readStreams))
+	for _, r := range s.readStreams {
+		readStreams = append(readStreams, r)
+	}
+	anyStream := s.anyStream
+	s.readStreamsLock.Unlock()
+
+	if anyStream != nil {
+		if err := anyStream.Close(); err != nil {
+			s.log.Warnf("failed to close read stream of every SSRC: %v", err)
+		}
+	}
+
+	for _, r := range readStreams {
+		if err := r.close(StreamClosedBySession); err != nil {
+			s.log.Warnf("failed to close read stream %d: %v", r.GetSSRC(), err)
+		}
+	}
+}
+
+// ignoreSSRC closes the read stream of ssrc, forgets its remote state, and
+// drops the packets of ssrc before decrypting them from then on
+func (s *session) ignoreSSRC(ssrc uint32) error {
+	s.readStreamsLock.Lock()
+	if s.ignoredSSRCs == nil {
+		s.ignoredSSRCs = map[uint32]struct{}{}
+	}
+	s.ignoredSSRCs[ssrc] = struct{}{}
+	s.readStreamsLock.Unlock()
+
+	err := s.closeReadStream(ssrc, StreamClosedByApplication)
+
+	select {
+	case <-s.started:
+	default:
+		return err
+	}
+
+	s.decryptMutex.Lock()
+	s.remoteContext.RemoveStream(ssrc)
+	delete(s.remoteSources, ssrc)
+	delete(s.keyFetches, ssrc)
+	s.decryptMutex.Unlock()
+	return err
+}
+
+// accepts returns whether ssrc is not ignored, is in Config.AcceptedSSRCs
+// and, with Config.OpenedStreamsOnly, has a read stream, counting the packets
+// of those that do not. It must be called with decryptMutex held.
+func (s *session) accepts(ssrc uint32) bool {
+	if !s.isIgnored(ssrc) && s.isAccepted(ssrc) {
+		if !s.openedStreamsOnly {
+			return true
+		} else if _, ok := s.getReadStream(ssrc); ok {
+			return true
+		}
+	}
+	s.rejected++
+	return false
+}
+
+// admitStream asks Config.StreamFilter whether to create a read stream for
+// ssrc if it has none, then applies Config.MaxNewStreamsPerSecond, counting
+// the packets refused. It must be called with decryptMutex held.
+func (s *session) admitStream(ssrc uint32, header *rtp.Header) bool {
+	if s.streamFilter == nil && s.newStreamLimit == nil {
+		return true
+	} else if _, ok := s.getReadStream(ssrc); ok {
+		return true
+	}
+
+	if s.streamFilter != nil && !s.streamFilter(ssrc, header) {
+		s.rejected++
+		return false
+	} else if s.newStreamLimit != nil && !s.newStreamLimit.take(time.Now()) {
+		s.log.Debugf("dropping packet of new SSRC %d, streams are created too fast", ssrc)
+		s.streamsLimited++
+		return false
+	}
+	return true
+}
+
+func (s *session) isAccepted(ssrc uint32) bool {
+	if s.acceptedSSRCs == nil {
+		return true
+	}
+	_, ok := s.acceptedSSRCs[ssrc]
+	return ok
+}
+
+func newSSRCSet(ssrcs []uint32) map[uint32]struct{} {
+	if ssrcs == nil {
+		return nil
+	}
+	set := make(map[uint32]struct{}, len(ssrcs))
+	for _, ssrc := range ssrcs {
+		set[ssrc] = struct{}{}
+	}
+	return set
+}
+
+func (s *session) isIgnored(ssrc uint32) bool {
+	s.readStreamsLock.Lock()
+	defer s.readStreamsLock.Unlock()
+
+	_, ignored := s.ignoredSSRCs[ssrc]
+	return ignored
+}
+
+// closeReadStream closes the read stream for ssrc, if there is one
+func (s *session) closeReadStream(ssrc uint32, reason StreamCloseReason) error {
+	s.readStreamsLock.Lock()
+	r, ok := s.readStreams[ssrc]
+	s.readStreamsLock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return r.close(reason)
+}
+
+func (s *session) streamClosed(ssrc uint32, reason StreamCloseReason) {
+	if s.onStreamClosed != nil {
+		s.onStreamClosed(ssrc, reason)
+	}
+}
+
+func (s *session) closeSend() {
+	s.directionLock.Lock()
+	defer s.directionLock.Unlock()
+
+	s.sendClosed = true
+}
+
+func (s *session) isSendClosed() bool {
+	s.directionLock.Lock()
+	defer s.directionLock.Unlock()
+
+	return s.sendClosed
+}
+
+func (s *session) closeRecv() {
+	s.directionLock.Lock()
+	s.recvClosed = true
+	s.directionLock.Unlock()
+
+	s.closeReadStreams()
+}
+
+func (s *session) isRecvClosed() bool {
+	s.directionLock.Lock()
+	defer s.directionLock.Unlock()
+
+	return s.recvClosed
+}
+
+func (s *session) pauseWrites() {
+	s.writePauseMutex.Lock()
+	defer s.writePauseMutex.Unlock()
+
+	s.writesPaused = true
+}
+
+func (s *session) resumeWrites() error {
+	s.writePauseMutex.Lock()
+	defer s.writePauseMutex.Unlock()
+
+	s.writesPaused = false
+
+	s.pausedWritesMutex.Lock()
+	pausedWrites := s.pausedWrites
+	s.pausedWrites = nil
+	s.pausedWritesMutex.Unlock()
+
+	var firstErr error
+	for _, buf := range pausedWrites {
+		if _, err := s.child.writeUnpaused(buf); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// drain waits for the writes in flight and writes the packets queued while
+// writes are paused followed by final, if any, then closes the outbound
+// direction. Writes check sendClosed with writePauseMutex held, so none can
+// follow. If the conn supports write deadlines, its writes fail once timeout
+// elapsed.
+func (s *session) drain(timeout time.Duration, final []byte) error {
+	if timeout > 0 {
+		_ = s.conn().SetWriteDeadline(time.Now().Add(timeout))
+	}
+
+	s.writePauseMutex.Lock()
+	defer s.writePauseMutex.Unlock()
+
+	if s.isSendClosed() {
+		return nil
+	}
+	s.closeSend()
+
+	s.pausedWritesMutex.Lock()
+	pausedWrites := s.pausedWrites
+	s.pausedWrites = nil
+	s.pausedWritesMutex.Unlock()
+
+	if final != nil {
+		select {
+		case <-s.started:
+			pausedWrites = append(pausedWrites, final)
+		default:
+			return errSessionNotStarted
+		}
+	}
+
+	var firstErr error
+	for _, buf := range pausedWrites {
+		if _, err := s.child.writeUnpaused(buf); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// queueWrite must be called with writePauseMutex read locked while writes are paused
+func (s *session) queueWrite(buf []byte) error {
+	s.pausedWritesMutex.Lock()
+	defer s.pausedWritesMutex.Unlock()
+
+	if len(s.pausedWrites) >= s.pausedWriteQueueSize {
+		return errPausedWriteQueueFull
+	}
+
+	s.pausedWrites = append(s.pausedWrites, buf)
+	return nil
+}
+
+// pauseReads stops the read loop before its next read from nextConn
+func (s *session) pauseReads() {
+	s.readPauseMutex.Lock()
+	defer s.readPauseMutex.Unlock()
+
+	if s.readsClosing || s.readsResumed != nil {
+		return
+	}
+	s.readsResumed = make(chan interface{})
+}
+
+func (s *session) resumeReads() {
+	s.readPauseMutex.Lock()
+	defer s.readPauseMutex.Unlock()
+
+	if s.readsResumed != nil {
+		close(s.readsResumed)
+		s.readsResumed = nil
+	}
+}
+
+// waitReadsResumed blocks the read loop while reads are paused
+func (s *session) waitReadsResumed() {
+	s.readPauseMutex.Lock()
+	resumed := s.readsResumed
+	s.readPauseMutex.Unlock()
+
+	if resumed != nil {
+		<-resumed
+	}
+}
+
+// keepalive calls send every interval in which nothing has been written
+func (s *session) keepalive(interval time.Duration, send func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+
+		s.localContextMutex.Lock()
+		idle := time.Since(s.lastWrite) >= interval
+		s.localContextMutex.Unlock()
+
+		if !idle || s.isSendClosed() {
+			continue
+		}
+
+		if err := send(); err != nil {
+			s.log.Warnf("failed to send keepalive: %v", err)
+		}
+	}
+}
+
+// writeConn writes a protected packet to nextConn, accounting for it in writeBitrate
+func (s *session) writeConn(b []byte) (int, error) {
+	n, err := s.conn().Write(b)
+	if n > 0 {
+		s.writeBitrate.add(n, time.Now())
+		s.sent(n)
+	}
+	return n, err
+}
+
+// setRemoteAddr changes where an unconnected conn writes to, see Config.RemoteAddr
+func (s *session) setRemoteAddr(addr net.Addr) error {
+	nextConn := s.conn()
+	conn, ok := nextConn.(*remoteAddrConn)
+	if endpoint, isMux := nextConn.(*muxEndpoint); isMux {
+		conn, ok = endpoint.mux.conn.(*remoteAddrConn)
+	}
+	if !ok {
+		return errNoRemoteAddr
+	}
+
+	conn.setRemoteAddr(addr)
+	return nil
+}
+
+// maxPayloadSize returns how much of the MTU is left once overhead bytes are reserved
+// mkiLen returns the length of the MKI sent packets carry, zero without one
+// or before the session is started
+func (s *session) mkiLen() int {
+	select {
+	case <-s.started:
+	default:
+		return 0
+	}
+
+	s.localContextMutex.Lock()
+	defer s.localContextMutex.Unlock()
+
+	return len(s.localContext.sendMKI)
+}
+
+func (s *session) maxPayloadSize(overhead int) int {
+	if s.mtu <= overhead {
+		return 0
+	}
+	return s.mtu - overhead
+}
+
+// closeOnDone closes the session once ctx is done
+func (s *session) closeOnDone(ctx context.Context, child streamSession) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := child.Close(); err != nil {
+				s.log.Warnf("failed to close session: %v", err)
+			}
+		case <-s.closed:
+		}
+	}()
 }
 
 func (s *session) close() error {
-	if s.nextConn == nil {
+	s.connMu.Lock()
+	conn := s.nextConn
+	s.connClosed = true
+	s.connMu.Unlock()
+
+	if conn == nil {
 		return nil
-	} else if err := s.nextConn.Close(); err != nil {
+	}
+	s.closeSend()
+
+	// Let a paused read loop observe the closed conn
+	s.readPauseMutex.Lock()
+	s.readsClosing = true
+	s.readPauseMutex.Unlock()
+	s.resumeReads()
+
+	if err := conn.Close(); err != nil {
 		return err
 	}
 
 	<-s.closed
+	s.wipeKeys()
 	return nil
 }
 
-func (s *session) start(localMasterKey, localMasterSalt, remoteMasterKey, remoteMasterSalt []byte, profile ProtectionProfile, child streamSession) error {
-	var err error
-	s.localContext, err = CreateContext(localMasterKey, localMasterSalt, profile, s.localOptions...)
+// wipeKeys overwrites the keys of both contexts and drops the master keys the
+// session references
+func (s *session) wipeKeys() {
+	s.startMutex.Lock()
+	defer s.startMutex.Unlock()
+
+	s.localContextMutex.Lock()
+	if s.localContext != nil {
+		s.localContext.Wipe()
+	}
+	s.localMasterKey, s.localStreamMasterKeys = nil, map[uint32][]byte{}
+	s.localContextMutex.Unlock()
+
+	s.decryptMutex.Lock()
+	if s.remoteContext != nil {
+		s.remoteContext.Wipe()
+	}
+	s.streamKeys = nil
+	s.decryptMutex.Unlock()
+}
+
+// setStreamKeys installs keys for the packets of a single SSRC in both directions
+func (s *session) setStreamKeys(ssrc uint32, keys SessionKeys) error {
+	select {
+	case <-s.started:
+	default:
+		return errSessionNotStarted
+	}
+
+	return s.installStreamKeys(ssrc, keys)
+}
+
+// installStreamKeys sets the keys of ssrc for the directions they are given for
+func (s *session) installStreamKeys(ssrc uint32, keys SessionKeys) error {
+	if len(keys.LocalMasterKey) != 0 || len(keys.LocalMasterSalt) != 0 {
+		s.localContextMutex.Lock()
+		err := s.localContext.SetSSRCKeys(ssrc, keys.LocalMasterKey, keys.LocalMasterSalt)
+		if err == nil {
+			s.localStreamMasterKeys[ssrc] = keys.LocalMasterKey
+		}
+		s.localContextMutex.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(keys.RemoteMasterKey) == 0 && len(keys.RemoteMasterSalt) == 0 {
+		return nil
+	}
+
+	s.decryptMutex.Lock()
+	defer s.decryptMutex.Unlock()
+
+	return s.remoteContext.SetSSRCKeys(ssrc, keys.RemoteMasterKey, keys.RemoteMasterSalt)
+}
+
+// rekey replaces the keys of both directions, failing before any is installed
+// if one of them is invalid
+func (s *session) rekey(keys SessionKeys) error {
+	select {
+	case <-s.started:
+	default:
+		return errSessionNotStarted
+	}
+
+	localCipher, err := newSrtpCipher(keys.LocalMasterKey, keys.LocalMasterSalt, s.localContext.params)
+	if err != nil {
+		return err
+	}
+	remoteCipher, err := newSrtpCipher(keys.RemoteMasterKey, keys.RemoteMasterSalt, s.remoteContext.params)
+	if err != nil {
+		return err
+	}
+
+	s.localContextMutex.Lock()
+	s.localContext.setCipher(localCipher)
+	s.localMasterKey = keys.LocalMasterKey
+	s.localContextMutex.Unlock()
+
+	s.decryptMutex.Lock()
+	s.remoteContext.setCipher(remoteCipher)
+	s.remoteKeysInstalled()
+	s.unlockDecrypt()
+	return nil
+}
+
+// setRemoteKeys installs the remote keys of a session started without them
+func (s *session) setRemoteKeys(masterKey, masterSalt []byte) error {
+	select {
+	case <-s.started:
+	default:
+		return errSessionNotStarted
+	}
+
+	s.decryptMutex.Lock()
+	defer s.unlockDecrypt()
+
+	if !s.remoteKeysPending {
+		return errRemoteKeysInstalled
+	}
+
+	cipher, err := newSrtpCipher(masterKey, masterSalt, s.remoteContext.params)
+	if err != nil {
+		return err
+	}
+	s.remoteContext.setCipher(cipher)
+	s.remoteKeysInstalled()
+	return nil
+}
+
+// remoteKeysInstalled decrypts the packets queued while the session had no
+// remote keys, it must be called with decryptMutex held
+func (s *session) remoteKeysInstalled() {
+	if s.remoteKeysPending {
+		s.remoteKeysPending = false
+		s.decryptEarlyPackets()
+	}
+}
+
+// localMasterKeyFor returns the master key packets of ssrc are sent with, it must
+// be called with localContextMutex held
+func (s *session) localMasterKeyFor(ssrc uint32) []byte {
+	if key, ok := s.localStreamMasterKeys[ssrc]; ok {
+		return key
+	}
+	return s.localMasterKey
+}
+
+// start installs the keys, packets are decrypted from then on
+func (s *session) start(localMasterKey, localMasterSalt, remoteMasterKey, remoteMasterSalt []byte) error {
+	s.startMutex.Lock()
+	defer s.startMutex.Unlock()
+
+	select {
+	case <-s.started:
+		return errSessionAlreadyStarted
+	default:
+	}
+
+	localContext, err := createContext(localMasterKey, localMasterSalt, s.params, s.localOptions...)
 	if err != nil {
 		return err
 	}
 
-	s.remoteContext, err = CreateContext(remoteMasterKey, remoteMasterSalt, profile, s.remoteOptions...)
+	remoteKeysPending := len(remoteMasterKey) == 0 && len(remoteMasterSalt) == 0
+	if remoteKeysPending {
+		// Placeholder keys replaced by setRemoteKeys, received packets are
+		// queued rather than decrypted until then
+		remoteMasterKey = append([]byte{}, localMasterKey...)
+		remoteMasterSalt = append([]byte{}, localMasterSalt...)
+	}
+
+	remoteContext, err := createContext(remoteMasterKey, remoteMasterSalt, s.params, s.remoteOptions...)
 	if err != nil {
 		return err
 	}
 
+	remoteContext.onSRTPEvicted = s.onRemoteSRTPEvicted
+	s.localContext, s.remoteContext = localContext, remoteContext
+	s.localMasterKey, s.localStreamMasterKeys = localMasterKey, map[uint32][]byte{}
+	for ssrc, keys := range s.streamKeys {
+		if err := s.installStreamKeys(ssrc, keys); err != nil {
+			return err
+		}
+	}
+
+	s.decryptMutex.Lock()
+	s.remoteKeysPending = remoteKeysPending
+	close(s.started)
+	hasEarlyPackets := len(s.earlyPackets) != 0 && !remoteKeysPending
+	s.decryptMutex.Unlock()
+
+	// Decrypt what arrived early unless the read loop gets to it first
+	if hasEarlyPackets {
+		go func() {
+			s.decryptMutex.Lock()
+			defer s.unlockDecrypt()
+
+			s.decryptEarlyPackets()
+		}()
+	}
+
+	return nil
+}
+
+// decryptEarlyPackets must be called with decryptMutex held
+func (s *session) decryptEarlyPackets() {
+	for _, buf := range s.earlyPackets {
+		s.decryptOrQueue(buf)
+	}
+	s.earlyPackets = nil
+}
+
+// handle decrypts buf read from source, or queues it if the session has no
+// remote keys yet
+func (s *session) handle(buf []byte, source net.Addr) {
+	s.decryptMutex.Lock()
+	defer s.unlockDecrypt()
+
+	select {
+	case <-s.started:
+	default:
+		s.queueEarlyPacket(buf)
+		return
+	}
+	if s.remoteKeysPending {
+		s.queueEarlyPacket(buf)
+		return
+	}
+
+	s.decryptEarlyPackets()
+	s.source = source
+	s.decryptOrQueue(buf)
+	s.source = nil
+}
+
+// queueEarlyPacket keeps a copy of buf until keys are installed, it must be
+// called with decryptMutex held
+func (s *session) queueEarlyPacket(buf []byte) {
+	if len(s.earlyPackets) < s.earlyPacketQueueSize {
+		s.earlyPackets = append(s.earlyPackets, append([]byte{}, buf...))
+	} else {
+		s.log.Debug("dropping packet received before keys, queue is full")
+	}
+}
+
+// waitStarted blocks until the session has keys, or fails if it was closed before
+func (s *session) waitStarted() error {
+	select {
+	case _, ok := <-s.started:
+		if ok {
+			return errStartedChannelUsedIncorrectly
+		}
+		return nil
+	case <-s.closed:
+	}
+
+	select {
+	case <-s.started:
+		return nil
+	default:
+		return errSessionNotStarted
+	}
+}
+
+// run reads from nextConn until it is closed
+func (s *session) run() {
 	go func() {
+		pooled, b := s.getBuffer()
+		if cap(b) < s.packetSize {
+			b = make([]byte, s.packetSize)
+		}
+		b = b[:cap(b)]
+
 		defer func() {
+			s.putBuffer(pooled, b)
 			close(s.newStream)
-
-			s.readStreamsLock.Lock()
-			s.readStreamsClosed = true
-			s.readStreamsLock.Unlock()
+			s.closeReadStreams()
 			close(s.closed)
 		}()
 
-		b := make([]byte, 8192)
 		for {
-			var i int
-			i, err = s.nextConn.Read(b)
+			s.waitReadsResumed()
+
+			conn := s.conn()
+			i, source, err := readSource(conn, b)
 			if err != nil {
-				if err != io.EOF {
+				if s.conn() != conn {
+					continue // replaced by setTransport
+				} else if err != io.EOF {
 					s.log.Error(err.Error())
 				}
 				return
 			}
 
-			if err = child.decrypt(b[:i]); err != nil {
-				s.log.Info(err.Error())
+			if s.isRecvClosed() {
+				continue
 			}
+
+			s.received(i)
+			s.handle(b[:i], source)
 		}
 	}()
-
-	close(s.started)
-
-	return nil
 }
@@ -0,0 +1,130 @@
+package srtp
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// SessionPair manages a SRTP session and its companion SRTCP session when
+// RTP and RTCP are carried on distinct conns, the classic port pair used
+// without rtcp-mux, see NewSessionPairMux otherwise. Closing either session closes the other, and a RTCP BYE
+// closes the SRTP read stream of the leaving source as well.
+type SessionPair struct {
+	SRTP  *SessionSRTP
+	SRTCP *SessionSRTCP
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewSessionPair creates a SRTP session on rtpConn and a SRTCP session on
+// rtcpConn sharing config. With Config.LinkSenderReports, sender reports are
+// made available on the SRTP read streams.
+func NewSessionPair(rtpConn, rtcpConn io.ReadWriter, config *Config) (*SessionPair, error) {
+	if config == nil {
+		return nil, errNoConfig
+	}
+
+	p := &SessionPair{}
+
+	var err error
+	if p.SRTP, err = NewSessionSRTP(rtpConn, config); err != nil {
+		return nil, err
+	}
+
+	srtcpConfig := *config
+	srtcpConfig.OnStreamClosed = func(ssrc uint32, reason StreamCloseReason) {
+		if reason == StreamClosedByGoodbye {
+			if err := p.SRTP.session.closeReadStream(ssrc, reason); err != nil {
+				p.SRTP.session.log.Warnf("failed to close SRTP stream %d on BYE: %v", ssrc, err)
+			}
+		}
+		if config.OnStreamClosed != nil {
+			config.OnStreamClosed(ssrc, reason)
+		}
+	}
+
+	if config.LinkSenderReports {
+		srtcpConfig.RTCPFilter = func(pkt rtcp.Packet) bool {
+			if sr, ok := pkt.(*rtcp.SenderReport); ok {
+				p.linkSenderReport(sr)
+			}
+			return config.RTCPFilter == nil || config.RTCPFilter(pkt)
+		}
+	}
+
+	if p.SRTCP, err = NewSessionSRTCP(rtcpConn, &srtcpConfig); err != nil {
+		if closeErr := p.SRTP.Close(); closeErr != nil {
+			p.SRTP.session.log.Warnf("failed to close session: %v", closeErr)
+		}
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-p.SRTP.session.closed:
+		case <-p.SRTCP.session.closed:
+		}
+		if err := p.Close(); err != nil {
+			p.SRTP.session.log.Debugf("failed to close session pair: %v", err)
+		}
+	}()
+
+	return p, nil
+}
+
+// linkSenderReport hands sr to the SRTP read stream of its SSRC, if any
+func (p *SessionPair) linkSenderReport(sr *rtcp.SenderReport) {
+	r, ok := p.SRTP.session.getReadStream(sr.SSRC)
+	if !ok {
+		return
+	}
+	if readStream, ok := r.(*ReadStreamSRTP); ok {
+		readStream.setSenderReport(sr, time.Now())
+	}
+}
+
+// Start installs keys on both sessions, see SessionSRTP.Start.
+func (p *SessionPair) Start(keys SessionKeys) error {
+	if err := p.SRTP.Start(keys); err != nil {
+		return err
+	}
+	return p.SRTCP.Start(keys)
+}
+
+// ListStreams returns the read streams of the SRTP and the SRTCP session
+func (p *SessionPair) ListStreams() (rtpStreams, rtcpStreams []StreamInfo) {
+	return p.SRTP.ListStreams(), p.SRTCP.ListStreams()
+}
+
+// Close ends both sessions, returning the first error encountered
+func (p *SessionPair) Close() error {
+	p.closeOnce.Do(func() {
+		srtpErr := p.SRTP.Close()
+		srtcpErr := p.SRTCP.Close()
+
+		p.closeErr = srtpErr
+		if p.closeErr == nil {
+			p.closeErr = srtcpErr
+		}
+	})
+	return p.closeErr
+}
+
+// CloseWithTimeout closes both sessions with their CloseWithTimeout, each
+// given timeout, sending final, such as a BYE, last on the SRTCP session
+func (p *SessionPair) CloseWithTimeout(timeout time.Duration, final ...rtcp.Packet) error {
+	p.closeOnce.Do(func() {
+		srtpErr := p.SRTP.CloseWithTimeout(timeout)
+		srtcpErr := p.SRTCP.CloseWithTimeout(timeout, final...)
+
+		p.closeErr = srtpErr
+		if p.closeErr == nil {
+			p.closeErr = srtcpErr
+		}
+	})
+	return p.closeErr
+}
@@ -0,0 +1,246 @@
+package srtp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp/v2"
+	"github.com/pion/transport/test"
+)
+
+func TestSessionPair(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	closed := make(chan StreamCloseReason, 4)
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+		OnStreamClosed: func(ssrc uint32, reason StreamCloseReason) {
+			if ssrc == 5000 {
+				closed <- reason
+			}
+		},
+	}
+
+	aRTP, bRTP := net.Pipe()
+	aRTCP, bRTCP := net.Pipe()
+	aPair, err := NewSessionPair(aRTP, aRTCP, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bPair, err := NewSessionPair(bRTP, bRTCP, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rtpStream, err := bPair.SRTP.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtcpStream, err := bPair.SRTCP.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rtpStreams, rtcpStreams := bPair.ListStreams(); len(rtpStreams) != 1 || len(rtcpStreams) != 1 {
+		t.Fatalf("Unexpected streams %v %v", rtpStreams, rtcpStreams)
+	}
+
+	bye, err := rtcp.Marshal([]rtcp.Packet{&rtcp.Goodbye{Sources: []uint32{5000}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aPair.SRTCP.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.Write(bye); err != nil {
+		t.Fatal(err)
+	}
+
+	// The BYE on the RTCP conn ends the RTP stream too
+	readBuffer := make([]byte, 1500)
+	if _, err = rtcpStream.Read(readBuffer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rtpStream.Read(readBuffer); !errors.Is(err, io.EOF) {
+		t.Errorf("RTP read after BYE must return EOF, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if reason := <-closed; reason != StreamClosedByGoodbye {
+			t.Errorf("Unexpected close reason %v", reason)
+		}
+	}
+
+	// Closing one session of the pair closes its companion
+	if err = aPair.SRTP.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-aPair.SRTCP.session.closed
+
+	if err = aPair.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bPair.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionPairLinkSenderReports(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+		LinkSenderReports: true,
+	}
+
+	aRTP, bRTP := net.Pipe()
+	aRTCP, bRTCP := net.Pipe()
+	aPair, err := NewSessionPair(aRTP, aRTCP, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bPair, err := NewSessionPair(bRTP, bRTCP, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rtpStream, err := bPair.SRTP.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtcpStream, err := bPair.SRTCP.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := rtpStream.LastSenderReport(); ok {
+		t.Fatal("No sender report received yet")
+	}
+
+	sr := &rtcp.SenderReport{SSRC: 5000, NTPTime: 42, RTPTime: 4242}
+	raw, err := rtcp.Marshal([]rtcp.Packet{sr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aPair.SRTCP.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once delivered on the SRTCP stream, the report is linked
+	if _, err = rtcpStream.Read(make([]byte, 1500)); err != nil {
+		t.Fatal(err)
+	}
+	linked, at, ok := rtpStream.LastSenderReport()
+	if !ok || at.IsZero() || linked.NTPTime != 42 || linked.RTPTime != 4242 {
+		t.Fatalf("Unexpected sender report %v at %v", linked, at)
+	}
+
+	if err = aPair.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bPair.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionPairMux(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+	}
+
+	aConn, bConn := net.Pipe()
+	aPair, err := NewSessionPairMux(aConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bPair, err := NewSessionPairMux(bConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rtpStream, err := bPair.SRTP.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtcpStream, err := bPair.SRTCP.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rtpWriteStream, err := aPair.SRTP.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A marker bit on a low payload type must not be taken for RTCP
+	if _, err = rtpWriteStream.WriteRTP(&rtp.Header{Version: 2, SSRC: 5000, PayloadType: 96, Marker: true}, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	rtcpWriteStream, err := aPair.SRTCP.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pli, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{SenderSSRC: 1, MediaSSRC: 5000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rtcpWriteStream.Write(pli); err != nil {
+		t.Fatal(err)
+	}
+
+	readBuffer := make([]byte, 1500)
+	if _, header, rerr := rtpStream.ReadRTP(readBuffer); rerr != nil {
+		t.Fatal(rerr)
+	} else if header.PayloadType != 96 || !header.Marker {
+		t.Fatalf("Unexpected RTP header %v", header)
+	}
+	if _, header, rerr := rtcpStream.ReadRTCP(readBuffer); rerr != nil {
+		t.Fatal(rerr)
+	} else if header.Type != rtcp.TypePayloadSpecificFeedback {
+		t.Fatalf("Unexpected RTCP header %v", header)
+	}
+
+	if err = aPair.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bPair.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,11 +1,17 @@
 package srtp
 
 import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"net"
 	"time"
 
 	"github.com/pion/logging"
 	"github.com/pion/rtcp"
+	"github.com/pion/srtp/v2/batchconn"
+	"github.com/pion/transport/deadline"
 )
 
 const defaultSessionSRTCPReplayProtectionWindow = 64
@@ -17,21 +23,72 @@ const defaultSessionSRTCPReplayProtectionWindow = 64
 type SessionSRTCP struct {
 	session
 	writeStream *WriteStreamSRTCP
+
+	keepaliveSSRC uint32
+	filter        func(rtcp.Packet) bool
 }
 
 // NewSessionSRTCP creates a SRTCP session using conn as the underlying transport.
-func NewSessionSRTCP(conn net.Conn, config *Config) (*SessionSRTCP, error) { //nolint:dupl
+// conn is usually a net.Conn, other transports are closed and given deadlines
+// when they support it.
+func NewSessionSRTCP(conn io.ReadWriter, config *Config) (*SessionSRTCP, error) { //nolint:dupl
 	if config == nil {
 		return nil, errNoConfig
 	} else if conn == nil {
 		return nil, errNoConn
 	}
 
+	params, err := config.params()
+	if err != nil {
+		return nil, err
+	} else if (params.null || config.AuthenticationOnly) && !config.AllowNullCipher {
+		return nil, errNullCipherNotAllowed
+	}
+
+	packetSize, err := config.packetSize()
+	if err != nil {
+		return nil, err
+	}
+
+	nextConn := batchconn.New(newReadWriterConn(conn), config.ReadBatchSize, packetSize)
+	if config.RemoteAddr != nil {
+		if nextConn, err = newRemoteAddrConn(nextConn, config.RemoteAddr, config.AcceptSource); err != nil {
+			return nil, err
+		}
+	} else if config.AcceptSource != nil {
+		return nil, errNoRemoteAddr
+	}
+
 	loggerFactory := config.LoggerFactory
 	if loggerFactory == nil {
 		loggerFactory = logging.NewDefaultLoggerFactory()
 	}
 
+	earlyPacketQueueSize := config.EarlyPacketQueueSize
+	if earlyPacketQueueSize == 0 {
+		earlyPacketQueueSize = defaultEarlyPacketQueueSize
+	}
+
+	pausedWriteQueueSize := config.PausedWriteQueueSize
+	if pausedWriteQueueSize == 0 {
+		pausedWriteQueueSize = defaultPausedWriteQueueSize
+	}
+
+	keyTimeout := config.KeyingMaterialTimeout
+	if keyTimeout == 0 {
+		keyTimeout = defaultKeyingMaterialTimeout
+	}
+
+	maxAuthFailures := config.MaxAuthFailures
+	if maxAuthFailures == 0 {
+		maxAuthFailures = defaultMaxAuthFailures
+	}
+
+	bitrateWindow := config.BitrateWindow
+	if bitrateWindow == 0 {
+		bitrateWindow = defaultBitrateWindow
+	}
+
 	localOpts := append(
 		[]ContextOption{},
 		config.LocalOptions...,
@@ -40,37 +97,119 @@ func NewSessionSRTCP(conn net.Conn, config *Config) (*SessionSRTCP, error) { //n
 		[]ContextOption{
 			// Default options
 			SRTCPReplayProtection(defaultSessionSRTCPReplayProtectionWindow),
+			MaxSSRCStates(config.MaxSSRCStates, config.SSRCLimitPolicy),
 		},
 		config.RemoteOptions...,
 	)
+	if config.AuthenticationOnly {
+		localOpts = append(localOpts, AuthenticationOnly())
+		remoteOpts = append(remoteOpts, AuthenticationOnly())
+	}
 
 	s := &SessionSRTCP{
 		session: session{
-			nextConn:      conn,
-			localOptions:  localOpts,
-			remoteOptions: remoteOpts,
-			readStreams:   map[uint32]readStream{},
-			newStream:     make(chan readStream),
-			started:       make(chan interface{}),
-			closed:        make(chan interface{}),
-			bufferFactory: config.BufferFactory,
-			log:           loggerFactory.NewLogger("srtp"),
+			nextConn:       nextConn,
+			readBatchSize:  config.ReadBatchSize,
+			packetSize:     packetSize,
+			localOptions:   localOpts,
+			remoteOptions:  remoteOpts,
+			readStreams:    map[uint32]readStream{},
+			newStream:      make(chan struct{}, 1),
+			acceptDeadline: deadline.New(),
+			started:        make(chan interface{}),
+			closed:         make(chan interface{}),
+			bufferFactory:  config.BufferFactory,
+			bufferPool:     config.BufferPool,
+			readQueueSize:  config.ReadStreamQueueSize,
+			queueBudget:    newQueueBudget(config.ReadQueueBudget),
+			acceptedSSRCs:  newSSRCSet(config.AcceptedSSRCs),
+			streamFilter:   config.StreamFilter,
+			newStreamLimit: newTokenBucket(config.MaxNewStreamsPerSecond, config.NewStreamBurst),
+			onStreamClosed: config.OnStreamClosed,
+			onSSRCConflict: config.OnSSRCConflict,
+			onDecryptError: config.OnDecryptError,
+			log:            loggerFactory.NewLogger("srtp"),
+			params:         params,
+			mtu:            config.MTU,
+			bitrateWindow:  bitrateWindow,
+			writeBitrate:   newBitrateEstimator(bitrateWindow, time.Now()),
+			rtpDump:        config.RTPDump,
+			streamKeys:     config.StreamKeys,
+			keyProvider:    config.KeyingMaterialProvider,
+			keyTimeout:     keyTimeout,
+
+			earlyPacketQueueSize: earlyPacketQueueSize,
+			pausedWriteQueueSize: pausedWriteQueueSize,
+			authFailurePolicy:    config.AuthFailurePolicy,
+			maxAuthFailures:      maxAuthFailures,
+			openedStreamsOnly:    config.OpenedStreamsOnly,
+			onRemoteAddrChange:   config.OnRemoteAddrChange,
+			followRemoteAddr:     config.FollowRemoteAddr,
 		},
 	}
+	s.session.child = s
+	if config.OnRemoteAddrChange != nil || config.FollowRemoteAddr {
+		s.remoteSources = map[uint32]net.Addr{}
+	}
+	if onNewStream := config.OnNewStreamSRTCP; onNewStream != nil {
+		s.session.onNewStream = func(r readStream) {
+			if stream, ok := r.(*ReadStreamSRTCP); ok {
+				onNewStream(stream, stream.GetSSRC())
+			}
+		}
+	}
+	if config.KeyingMaterialProvider != nil {
+		s.keyFetches = map[uint32]*keyFetch{}
+	}
 	s.writeStream = &WriteStreamSRTCP{s}
+	s.keepaliveSSRC = config.KeepaliveSSRC
+	s.filter = config.RTCPFilter
 
-	err := s.session.start(
-		config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt,
-		config.Keys.RemoteMasterKey, config.Keys.RemoteMasterSalt,
-		config.Profile,
-		s,
-	)
+	if !config.Keys.empty() {
+		err := s.session.start(
+			config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt,
+			config.Keys.RemoteMasterKey, config.Keys.RemoteMasterSalt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.session.run()
+
+	if config.KeepaliveInterval > 0 {
+		go s.session.keepalive(config.KeepaliveInterval, s.writeKeepalive)
+	}
+	return s, nil
+}
+
+// NewSessionSRTCPContext creates a SRTCP session using conn as the underlying transport.
+// The session is closed once ctx is done, which unblocks pending AcceptStream
+// and Read calls.
+func NewSessionSRTCPContext(ctx context.Context, conn io.ReadWriter, config *Config) (*SessionSRTCP, error) {
+	s, err := NewSessionSRTCP(conn, config)
 	if err != nil {
 		return nil, err
 	}
+
+	s.session.closeOnDone(ctx, s)
 	return s, nil
 }
 
+// Start installs keys on a session created without them, see Config.Keys.
+// Read streams opened before Start receive packets as soon as keys are installed.
+func (s *SessionSRTCP) Start(keys SessionKeys) error {
+	return s.session.start(
+		keys.LocalMasterKey, keys.LocalMasterSalt,
+		keys.RemoteMasterKey, keys.RemoteMasterSalt,
+	)
+}
+
+// SetRemoteKeys installs the keys of received packets on a session started
+// without them, see Config.Keys. Packets queued until then are decrypted.
+func (s *SessionSRTCP) SetRemoteKeys(masterKey, masterSalt []byte) error {
+	return s.session.setRemoteKeys(masterKey, masterSalt)
+}
+
 // OpenWriteStream returns the global write stream for the Session
 func (s *SessionSRTCP) OpenWriteStream() (*WriteStreamSRTCP, error) {
 	return s.writeStream, nil
@@ -79,7 +218,14 @@ func (s *SessionSRTCP) OpenWriteStream() (*WriteStreamSRTCP, error) {
 // OpenReadStream opens a read stream for the given SSRC, it can be used
 // if you want a certain SSRC, but don't want to wait for AcceptStream
 func (s *SessionSRTCP) OpenReadStream(ssrc uint32) (*ReadStreamSRTCP, error) {
+	if s.session.isIgnored(ssrc) {
+		return nil, errSSRCIgnored
+	} else if !s.session.isAccepted(ssrc) {
+		return nil, errSSRCNotAccepted
+	}
+
 	r, _ := s.session.getOrCreateReadStream(ssrc, s, newReadStreamSRTCP)
+	s.session.claimPendingStream(ssrc)
 
 	if readStream, ok := r.(*ReadStreamSRTCP); ok {
 		return readStream, nil
@@ -87,11 +233,35 @@ func (s *SessionSRTCP) OpenReadStream(ssrc uint32) (*ReadStreamSRTCP, error) {
 	return nil, errFailedTypeAssertion
 }
 
+// OpenReadStreamAny returns a stream delivering every decrypted compound
+// packet, see SessionSRTP.OpenReadStreamAny.
+func (s *SessionSRTCP) OpenReadStreamAny() (*ReadStreamAny, error) {
+	return s.session.openReadStreamAny(srtcpBufferSize)
+}
+
+// ListStreams returns the read streams currently known to the session, ordered by SSRC
+func (s *SessionSRTCP) ListStreams() []StreamInfo {
+	return s.session.listStreams(false)
+}
+
+// PendingStreams returns the streams created by incoming packets that have not
+// been returned by AcceptStream nor opened with OpenReadStream yet, ordered by
+// SSRC. Their packet counts help to detect unsignaled senders.
+func (s *SessionSRTCP) PendingStreams() []StreamInfo {
+	return s.session.listStreams(true)
+}
+
 // AcceptStream returns a stream to handle RTCP for a single SSRC
 func (s *SessionSRTCP) AcceptStream() (*ReadStreamSRTCP, uint32, error) {
-	stream, ok := <-s.newStream
-	if !ok {
-		return nil, 0, errStreamAlreadyClosed
+	return s.AcceptStreamContext(context.Background())
+}
+
+// AcceptStreamContext is AcceptStream, returning ctx.Err() once ctx is done
+// so that an accept loop can be stopped without closing the session
+func (s *SessionSRTCP) AcceptStreamContext(ctx context.Context) (*ReadStreamSRTCP, uint32, error) {
+	stream, err := s.session.accept(ctx)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	readStream, ok := stream.(*ReadStreamSRTCP)
@@ -102,30 +272,248 @@ func (s *SessionSRTCP) AcceptStream() (*ReadStreamSRTCP, uint32, error) {
 	return readStream, stream.GetSSRC(), nil
 }
 
-// Close ends the session
+// SetAcceptDeadline sets the deadline for AcceptStream, independently of
+// read deadlines. Setting to zero means no deadline.
+func (s *SessionSRTCP) SetAcceptDeadline(t time.Time) error {
+	s.session.acceptDeadline.Set(t)
+	return nil
+}
+
+// Rekey replaces the keys of the session, e.g. after a DTLS renegotiation,
+// without closing its streams nor losing their rollover and replay state.
+// The session must be started.
+func (s *SessionSRTCP) Rekey(keys SessionKeys) error {
+	return s.session.rekey(keys)
+}
+
+// SetStreamKeys replaces the keys used for the packets of ssrc, sent and
+// received, leaving the other streams of the session untouched. A direction
+// whose keys are left empty is not changed. The session must be started.
+func (s *SessionSRTCP) SetStreamKeys(ssrc uint32, keys SessionKeys) error {
+	return s.session.setStreamKeys(ssrc, keys)
+}
+
+// IgnoreSSRC closes the read stream of ssrc, if any, and drops the packets
+// of ssrc received from then on rather than announcing a new stream through
+// AcceptStream. OpenReadStream fails for ssrc afterwards.
+func (s *SessionSRTCP) IgnoreSSRC(ssrc uint32) error {
+	return s.session.ignoreSSRC(ssrc)
+}
+
+// RemoveStream closes the read stream of ssrc, if any, and forgets the SRTCP
+// index and replay state the session keeps for ssrc as a remote sender, so
+// long-lived sessions do not grow with every sender that left. The SRTCP
+// index of ssrc as a local sender is kept, so its packets never reuse
+// keystream, as are the keys set for ssrc.
+func (s *SessionSRTCP) RemoveStream(ssrc uint32) error {
+	return s.session.removeStream(ssrc)
+}
+
+// AuthFailures returns how many received packets failed authentication, see
+// Config.AuthFailurePolicy.
+func (s *SessionSRTCP) AuthFailures() uint64 {
+	return s.session.authFailureCount()
+}
+
+// Stats returns a snapshot of the counters of the session, for monitoring
+func (s *SessionSRTCP) Stats() SessionStats {
+	return s.session.stats()
+}
+
+// SetRemoteAddr changes the address packets are written to, for sessions
+// created with Config.RemoteAddr.
+func (s *SessionSRTCP) SetRemoteAddr(addr net.Addr) error {
+	return s.session.setRemoteAddr(addr)
+}
+
+// SetTransport replaces the conn of the session, such as after an ICE
+// restart, and closes the previous one. Keys, rollover counters and replay
+// state are kept, so the peer does not have to rekey. With Config.RemoteAddr
+// the current remote address applies to conn. Sessions of NewSessionPairMux
+// share their conn and cannot replace it.
+func (s *SessionSRTCP) SetTransport(conn io.ReadWriter) error {
+	return s.session.setTransport(conn)
+}
+
+// MaxPayloadSize returns the size of the largest RTCP compound packet that
+// fits in the configured MTU once protected. It returns 0 if no MTU is configured.
+func (s *SessionSRTCP) MaxPayloadSize() int {
+	return s.session.maxPayloadSize(s.overhead())
+}
+
+// PauseWrites quiesces the write path, e.g. while keys are swapped. It returns
+// once in-flight writes are done. Later writes are queued, up to
+// Config.PausedWriteQueueSize packets, and return 0 bytes written.
+func (s *SessionSRTCP) PauseWrites() {
+	s.session.pauseWrites()
+}
+
+// ResumeWrites sends the queued packets in order and resumes writing. It
+// returns the first error encountered while sending the queue.
+func (s *SessionSRTCP) ResumeWrites() error {
+	return s.session.resumeWrites()
+}
+
+// PauseReads stops reading from the underlying conn, leaving inbound packets
+// to be buffered or dropped by the transport, e.g. while shedding load. A packet
+// already being read is still delivered. Closing the session ends the pause.
+func (s *SessionSRTCP) PauseReads() {
+	s.session.pauseReads()
+}
+
+// ResumeReads resumes reading from the underlying conn.
+func (s *SessionSRTCP) ResumeReads() {
+	s.session.resumeReads()
+}
+
+// CloseSend shuts down the outbound direction of the session. Subsequent
+// writes fail while inbound SRTCP keeps being decrypted.
+func (s *SessionSRTCP) CloseSend() error {
+	s.session.closeSend()
+	return nil
+}
+
+// CloseRecv shuts down the inbound direction of the session. Incoming packets
+// are discarded and all read streams are closed while outbound SRTCP keeps
+// being encrypted. AcceptStream keeps blocking until the session is closed.
+func (s *SessionSRTCP) CloseRecv() error {
+	s.session.closeRecv()
+	return nil
+}
+
+// Close ends the session. The keys of the session are wiped, see Context.Wipe.
 func (s *SessionSRTCP) Close() error {
 	return s.session.close()
 }
 
+// CloseWithTimeout ends the session like Close once the writes in flight and
+// those queued by PauseWrites are sent, followed by final if given, such as a
+// BYE. Writing to the conn fails after timeout if it supports write
+// deadlines, a zero timeout waits for as long as writes take. The first
+// write error is returned once the session is closed.
+func (s *SessionSRTCP) CloseWithTimeout(timeout time.Duration, final ...rtcp.Packet) error {
+	var raw []byte
+	if len(final) > 0 {
+		var err error
+		if raw, err = rtcp.Marshal(final); err != nil {
+			return err
+		}
+	}
+
+	drainErr := s.session.drain(timeout, raw)
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return drainErr
+}
+
 // Private
 
 func (s *SessionSRTCP) write(buf []byte) (int, error) {
-	if _, ok := <-s.session.started; ok {
-		return 0, errStartedChannelUsedIncorrectly
+	if err := s.session.waitStarted(); err != nil {
+		return 0, err
+	}
+
+	s.session.writePauseMutex.RLock()
+	defer s.session.writePauseMutex.RUnlock()
+
+	if s.session.isSendClosed() {
+		return 0, errSendClosed
+	} else if s.session.writesPaused {
+		return 0, s.session.queueWrite(append([]byte{}, buf...))
+	}
+
+	return s.writeUnpaused(buf)
+}
+
+func (s *SessionSRTCP) writeUnpaused(buf []byte) (int, error) {
+	overhead := s.overhead()
+	if s.session.mtu == 0 || len(buf)+overhead <= s.session.mtu {
+		return s.writeCompound(buf)
+	}
+
+	pkts, err := rtcp.Unmarshal(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	compounds, err := splitCompound(pkts, s.session.mtu-overhead)
+	if err != nil {
+		return 0, err
 	}
 
+	n := 0
+	for _, compound := range compounds {
+		raw, marshalErr := rtcp.Marshal(compound)
+		if marshalErr != nil {
+			return n, marshalErr
+		}
+
+		written, writeErr := s.writeCompound(raw)
+		n += written
+		if writeErr != nil {
+			return n, writeErr
+		}
+	}
+	return n, nil
+}
+
+// overhead returns the number of bytes SRTCP protection adds to a packet
+func (s *SessionSRTCP) overhead() int {
+	return s.session.params.authTagLen + s.session.params.aeadAuthTagLen + srtcpIndexSize + s.session.mkiLen()
+}
+
+func (s *SessionSRTCP) writeCompound(buf []byte) (int, error) {
+	pooled, dst := s.session.getBuffer()
 	s.session.localContextMutex.Lock()
-	encrypted, err := s.localContext.EncryptRTCP(nil, buf, nil)
+	encrypted, err := s.localContext.EncryptRTCP(dst, buf, nil)
+	s.session.lastWrite = time.Now()
 	s.session.localContextMutex.Unlock()
 
 	if err != nil {
+		s.session.putBuffer(pooled, dst)
 		return 0, err
 	}
-	return s.session.nextConn.Write(encrypted)
+	n, err := s.session.writeConn(encrypted)
+	s.session.putBuffer(pooled, encrypted)
+	return n, err
+}
+
+// writeKeepalive sends an empty receiver report
+// https://tools.ietf.org/html/rfc6263#section-4.6
+func (s *SessionSRTCP) writeKeepalive() error {
+	raw, err := rtcp.Marshal([]rtcp.Packet{&rtcp.ReceiverReport{SSRC: s.keepaliveSSRC}})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.write(raw)
+	return err
 }
 
 func (s *SessionSRTCP) setWriteDeadline(t time.Time) error {
-	return s.session.nextConn.SetWriteDeadline(t)
+	return s.session.conn().SetWriteDeadline(t)
+}
+
+// filterCompound drops the packets rejected by Config.RTCPFilter, the compound
+// is only marshaled again if some were
+func (s *SessionSRTCP) filterCompound(pkts []rtcp.Packet, raw []byte) ([]rtcp.Packet, []byte, error) {
+	kept := make([]rtcp.Packet, 0, len(pkts))
+	for _, p := range pkts {
+		if s.filter(p) {
+			kept = append(kept, p)
+		}
+	}
+
+	switch len(kept) {
+	case len(pkts):
+		return pkts, raw, nil
+	case 0:
+		return nil, nil, nil
+	}
+
+	raw, err := rtcp.Marshal(kept)
+	return kept, raw, err
 }
 
 // create a list of Destination SSRCs
@@ -146,35 +534,165 @@ func destinationSSRC(pkts []rtcp.Packet) []uint32 {
 	return out
 }
 
+// splitCompound groups pkts into compound packets that each marshal to at most
+// limit bytes. A compound packet must start with a SR or RR, so when the
+// original compound does every following one is prefixed with an empty RR
+// carrying the same sender SSRC.
+// https://tools.ietf.org/html/rfc3550#section-6.1
+func splitCompound(pkts []rtcp.Packet, limit int) ([][]rtcp.Packet, error) {
+	var prefix rtcp.Packet
+	if len(pkts) != 0 {
+		switch p := pkts[0].(type) {
+		case *rtcp.SenderReport:
+			prefix = &rtcp.ReceiverReport{SSRC: p.SSRC}
+		case *rtcp.ReceiverReport:
+			prefix = &rtcp.ReceiverReport{SSRC: p.SSRC}
+		}
+	}
+
+	prefixSize := 0
+	if prefix != nil {
+		raw, err := prefix.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		prefixSize = len(raw)
+	}
+
+	var (
+		compounds [][]rtcp.Packet
+		current   []rtcp.Packet
+		size      int
+	)
+	for _, p := range pkts {
+		raw, err := p.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(current) != 0 && size+len(raw) > limit {
+			compounds = append(compounds, current)
+			current, size = nil, 0
+			if prefix != nil {
+				current, size = []rtcp.Packet{prefix}, prefixSize
+			}
+		}
+
+		if size+len(raw) > limit {
+			return nil, fmt.Errorf("%w: %d > %d", errRTCPPacketExceedsMTU, size+len(raw), limit)
+		}
+
+		current = append(current, p)
+		size += len(raw)
+	}
+
+	if len(current) != 0 {
+		compounds = append(compounds, current)
+	}
+	return compounds, nil
+}
+
+// admitsKeyFetch tells whether the keys of ssrc may be fetched from the
+// KeyingMaterialProvider. Config.AcceptedSSRCs applies to the SSRCs SRTCP
+// packets are for, not to their sender, so the keys of every sender are.
+func (s *SessionSRTCP) admitsKeyFetch(uint32) bool {
+	return true
+}
+
+// packetSSRC returns the SSRC of the sender of a SRTCP packet
+func (s *SessionSRTCP) packetSSRC(buf []byte) (uint32, bool) {
+	if len(buf) < 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(buf[4:]), true
+}
+
 func (s *SessionSRTCP) decrypt(buf []byte) error {
+	ssrc, _ := s.packetSSRC(buf)
+	_, known := s.remoteContext.srtcpSSRCStates[ssrc]
+
 	decrypted, err := s.remoteContext.DecryptRTCP(buf, buf, nil)
 	if err != nil {
 		return err
+	} else if decrypted == nil {
+		s.session.replayDrops++
+		return nil // Duplicate dropped, see DropDuplicates
+	} else if !known {
+		s.session.checkSSRCConflict(ssrc)
+	}
+	s.session.checkRemoteAddr(ssrc)
+
+	if s.session.rtpDump != nil {
+		if err = s.session.rtpDump.WriteRTCP(time.Now(), decrypted); err != nil {
+			s.session.log.Warnf("failed to write rtpdump: %v", err)
+		}
 	}
 
-	pkt, err := rtcp.Unmarshal(decrypted)
+	// Packets kept for ReadRTCPPackets may alias the bytes they are
+	// unmarshaled from, and buf is reused by the next read
+	parsed := decrypted
+	if s.session.bufferFactory == nil {
+		parsed = append([]byte{}, decrypted...)
+	}
+	pkt, err := rtcp.Unmarshal(parsed)
 	if err != nil {
 		return err
 	}
 
-	for _, ssrc := range destinationSSRC(pkt) {
+	if s.filter != nil {
+		if pkt, decrypted, err = s.filterCompound(pkt, decrypted); err != nil {
+			return err
+		} else if len(pkt) == 0 {
+			return nil
+		}
+	}
+
+	destinations := destinationSSRC(pkt)
+	readStreams := make([]*ReadStreamSRTCP, 0, len(destinations))
+	for _, ssrc := range destinations {
+		if !s.session.accepts(ssrc) || !s.session.admitStream(ssrc, nil) {
+			continue
+		}
+
 		r, isNew := s.session.getOrCreateReadStream(ssrc, s, newReadStreamSRTCP)
 		if r == nil {
-			return nil // Session has been closed
+			continue // Session has been closed, or the SSRC is ignored
 		} else if isNew {
-			s.session.newStream <- r // Notify AcceptStream
+			s.session.addPendingStream(r) // Notify AcceptStream
 		}
 
 		readStream, ok := r.(*ReadStreamSRTCP)
 		if !ok {
 			return errFailedTypeAssertion
 		}
+		readStreams = append(readStreams, readStream)
+	}
 
-		_, err = readStream.write(decrypted)
-		if err != nil {
+	// Compounds of refused SSRCs only, see SessionSRTP.OpenReadStreamAny, do
+	// not reach the stream of every SSRC
+	if len(readStreams) > 0 || len(destinations) == 0 {
+		if err = s.session.writeAny(decrypted); err != nil {
 			return err
 		}
 	}
 
+	for _, readStream := range readStreams {
+		if _, err = readStream.write(decrypted, pkt); err != nil {
+			return err
+		}
+		readStream.received(len(buf))
+	}
+
+	// Sources leaving the session won't send anything more
+	for _, p := range pkt {
+		if bye, ok := p.(*rtcp.Goodbye); ok {
+			for _, ssrc := range bye.Sources {
+				if err = s.session.closeReadStream(ssrc, StreamClosedByGoodbye); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	return nil
 }
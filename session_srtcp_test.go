@@ -2,6 +2,8 @@ package srtp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net"
 	"reflect"
@@ -351,3 +353,543 @@ func errIsTimeout(err error) bool {
 	}
 	return false
 }
+
+func TestSessionSRTCPSplitOversizedCompound(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		mtu        = 100
+		senderSSRC = 1234
+		pliCount   = 20
+	)
+
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+		MTU: mtu,
+	}
+	aSession, err := NewSessionSRTCP(aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkts := []rtcp.Packet{&rtcp.ReceiverReport{SSRC: senderSSRC}}
+	for i := uint32(0); i < pliCount; i++ {
+		pkts = append(pkts, &rtcp.PictureLossIndication{SenderSSRC: senderSSRC, MediaSSRC: i})
+	}
+	compound, err := rtcp.Marshal(pkts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decryptContext, err := CreateContext(make([]byte, 16), make([]byte, 14), ProtectionProfileAes128CmHmacSha1_80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan []rtcp.Packet)
+	go func() {
+		defer close(received)
+		b := make([]byte, 8192)
+		for {
+			n, rerr := bPipe.Read(b)
+			if rerr != nil {
+				return
+			}
+			if n > mtu {
+				t.Errorf("datagram of %d bytes exceeds MTU %d", n, mtu)
+			}
+			decrypted, derr := decryptContext.DecryptRTCP(nil, b[:n], nil)
+			if derr != nil {
+				t.Error(derr)
+				return
+			}
+			out, uerr := rtcp.Unmarshal(decrypted)
+			if uerr != nil {
+				t.Error(uerr)
+				return
+			}
+			received <- out
+		}
+	}()
+
+	writeStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeErr := make(chan error)
+	go func() {
+		_, werr := writeStream.Write(compound)
+		writeErr <- werr
+	}()
+
+	plis := 0
+	for plis < pliCount {
+		out := <-received
+		if rr, ok := out[0].(*rtcp.ReceiverReport); !ok || rr.SSRC != senderSSRC {
+			t.Fatalf("split compound must start with RR from %d, got %v", senderSSRC, out[0])
+		}
+		plis += len(out) - 1
+	}
+	if err = <-writeErr; err != nil {
+		t.Fatal(err)
+	}
+	if plis != pliCount {
+		t.Errorf("expected %d PLIs, got %d", pliCount, plis)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+}
+
+func TestSplitCompoundTooLarge(t *testing.T) {
+	pkts := []rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: 1}}
+	if _, err := splitCompound(pkts, 8); !errors.Is(err, errRTCPPacketExceedsMTU) {
+		t.Errorf("expected %v, got %v", errRTCPPacketExceedsMTU, err)
+	}
+}
+
+func TestSessionSRTCPContextCancel(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session, err := NewSessionSRTCPContext(ctx, aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acceptErr := make(chan error)
+	go func() {
+		_, _, aerr := session.AcceptStream()
+		acceptErr <- aerr
+	}()
+
+	cancel()
+
+	if err = <-acceptErr; !errors.Is(err, errStreamAlreadyClosed) {
+		t.Errorf("AcceptStream must fail once the context is canceled, got %v", err)
+	}
+	if err = bPipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTCPKeepalive(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const keepaliveSSRC = 4321
+
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+		KeepaliveInterval: 10 * time.Millisecond,
+		KeepaliveSSRC:     keepaliveSSRC,
+	}
+	aSession, err := NewSessionSRTCP(aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decryptContext, err := CreateContext(make([]byte, 16), make([]byte, 14), ProtectionProfileAes128CmHmacSha1_80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 1500)
+	n, err := bPipe.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decryptContext.DecryptRTCP(nil, b[:n], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts, err := rtcp.Unmarshal(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr, ok := pkts[0].(*rtcp.ReceiverReport); !ok || rr.SSRC != keepaliveSSRC {
+		t.Fatalf("Unexpected keepalive %v", pkts[0])
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTCPOnStreamClosed(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	type closedStream struct {
+		ssrc   uint32
+		reason StreamCloseReason
+	}
+	closed := make(chan closedStream, 3)
+
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+		OnStreamClosed: func(ssrc uint32, reason StreamCloseReason) {
+			closed <- closedStream{ssrc, reason}
+		},
+	}
+	aSession, err := NewSessionSRTCP(aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTCP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byeStream, err := bSession.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appStream, err := bSession.OpenReadStream(5001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bSession.OpenReadStream(5002); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = appStream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-closed; c.ssrc != 5001 || c.reason != StreamClosedByApplication {
+		t.Errorf("Unexpected close %v", c)
+	}
+
+	bye, err := rtcp.Marshal([]rtcp.Packet{&rtcp.Goodbye{Sources: []uint32{5000}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.Write(bye); err != nil {
+		t.Fatal(err)
+	}
+
+	// The BYE itself is delivered before the stream ends
+	readBuffer := make([]byte, 1500)
+	if _, err = byeStream.Read(readBuffer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = byeStream.Read(readBuffer); !errors.Is(err, io.EOF) {
+		t.Errorf("Read after BYE must return EOF, got %v", err)
+	}
+	if c := <-closed; c.ssrc != 5000 || c.reason != StreamClosedByGoodbye {
+		t.Errorf("Unexpected close %v", c)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-closed; c.ssrc != 5002 || c.reason != StreamClosedBySession {
+		t.Errorf("Unexpected close %v", c)
+	}
+}
+
+func TestSessionSRTCPStart(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: 5000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aSession, bPipe, config := buildSessionSRTCP(t)
+
+	bSession, err := NewSessionSRTCP(bPipe, &Config{Profile: config.Profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Streams can be opened before keys are known
+	bReadStream, err := bSession.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bSession.Start(config.Keys); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Start(config.Keys); !errors.Is(err, errSessionAlreadyStarted) {
+		t.Fatalf("Start must fail on a started session, got %v", err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.Write(testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	readBuffer := make([]byte, len(testPayload))
+	if _, err = bReadStream.Read(readBuffer); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(testPayload, readBuffer) {
+		t.Fatalf("Sent buffer does not match the one received exp(%v) actual(%v)", testPayload, readBuffer)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTCPFilter(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aSession, bPipe, config := buildSessionSRTCP(t)
+
+	diverted := make(chan rtcp.Packet, 2)
+	config.RTCPFilter = func(p rtcp.Packet) bool {
+		if _, ok := p.(*rtcp.PictureLossIndication); ok {
+			diverted <- p
+			return false
+		}
+		return true
+	}
+	bSession, err := NewSessionSRTCP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: 5000}}}
+	pli := &rtcp.PictureLossIndication{SenderSSRC: 1, MediaSSRC: 5000}
+	for _, compound := range [][]rtcp.Packet{{rr, pli}, {pli}, {rr}} {
+		raw, merr := rtcp.Marshal(compound)
+		if merr != nil {
+			t.Fatal(merr)
+		}
+		if _, err = aWriteStream.Write(raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The PLI only compound is dropped entirely, the RR of both others is delivered alone
+	readBuffer := make([]byte, 1500)
+	for i := 0; i < 2; i++ {
+		n, rerr := bReadStream.Read(readBuffer)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		pkts, rerr := rtcp.Unmarshal(readBuffer[:n])
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		if _, ok := pkts[0].(*rtcp.ReceiverReport); len(pkts) != 1 || !ok {
+			t.Fatalf("Unexpected compound %v", pkts)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if p := <-diverted; !reflect.DeepEqual(p, pli) {
+			t.Fatalf("Unexpected diverted packet %v", p)
+		}
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTCPReadRTCPPackets(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aSession, bSession := buildSessionSRTCPPair(t)
+
+	bReadStream, err := bSession.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		rr := &rtcp.ReceiverReport{SSRC: uint32(i), Reports: []rtcp.ReceptionReport{{SSRC: 5000}}}
+		pli := &rtcp.PictureLossIndication{SenderSSRC: uint32(i), MediaSSRC: 5000}
+		raw, merr := rtcp.Marshal([]rtcp.Packet{rr, pli})
+		if merr != nil {
+			t.Fatal(merr)
+		}
+		if _, err = aWriteStream.Write(raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertCompound := func(pkts []rtcp.Packet, header *rtcp.Header, sender uint32) {
+		t.Helper()
+		if header.Type != rtcp.TypeReceiverReport || len(pkts) != 2 {
+			t.Fatalf("Unexpected compound %v", pkts)
+		}
+		rr, ok := pkts[0].(*rtcp.ReceiverReport)
+		if !ok || rr.SSRC != sender {
+			t.Fatalf("Unexpected receiver report %v", pkts[0])
+		}
+		pli, ok := pkts[1].(*rtcp.PictureLossIndication)
+		if !ok || pli.SenderSSRC != sender {
+			t.Fatalf("Unexpected picture loss indication %v", pkts[1])
+		}
+	}
+
+	readBuffer := make([]byte, 1500)
+	pkts, header, err := bReadStream.ReadRTCPPackets(readBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompound(pkts, header, 1)
+
+	// A packet too large for the buffer is consumed with its compound
+	if _, err = bReadStream.Read(make([]byte, 4)); !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("Expected io.ErrShortBuffer, got %v", err)
+	}
+
+	pkts, header, err = bReadStream.ReadRTCPPackets(readBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompound(pkts, header, 3)
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTCPCloseWithTimeout(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aSession, bSession := buildSessionSRTCPPair(t)
+
+	anyStream, err := bSession.OpenReadStreamAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The queued packet is sent before the final BYE
+	pli, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{SenderSSRC: 1, MediaSSRC: 5000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aSession.PauseWrites()
+	if _, err = aWriteStream.Write(pli); err != nil {
+		t.Fatal(err)
+	}
+	closeErr := make(chan error)
+	go func() {
+		closeErr <- aSession.CloseWithTimeout(time.Second, &rtcp.Goodbye{Sources: []uint32{1}})
+	}()
+
+	readBuffer := make([]byte, 1500)
+	for _, expected := range []rtcp.PacketType{rtcp.TypePayloadSpecificFeedback, rtcp.TypeGoodbye} {
+		n, _, rerr := anyStream.Read(readBuffer)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		var header rtcp.Header
+		if err = header.Unmarshal(readBuffer[:n]); err != nil {
+			t.Fatal(err)
+		} else if header.Type != expected {
+			t.Fatalf("Expected packet type %v, got %v", expected, header.Type)
+		}
+	}
+	if err = <-closeErr; err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
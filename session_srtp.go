@@ -1,11 +1,20 @@
 package srtp
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/pion/logging"
 	"github.com/pion/rtp/v2"
+	"github.com/pion/srtp/v2/batchconn"
+	"github.com/pion/transport/deadline"
 )
 
 const defaultSessionSRTPReplayProtectionWindow = 64
@@ -17,21 +26,86 @@ const defaultSessionSRTPReplayProtectionWindow = 64
 type SessionSRTP struct {
 	session
 	writeStream *WriteStreamSRTP
+
+	retransmitCache *retransmitCache // nil unless Config.RetransmitCacheSize is set
+	transform       func(*rtp.Packet)
+
+	ekt                  *EKTKeyManager
+	ektFullFieldInterval int
+	ektSent              map[uint32]int    // packets sent per SSRC, guarded by localContextMutex
+	ektLearned           map[uint32][]byte // master keys installed from EKT, guarded by decryptMutex
+
+	keepaliveSSRC           uint32
+	keepalivePayloadType    uint8
+	keepaliveSequenceNumber uint16
+
+	managedWriteStreamsMu sync.Mutex
+	managedWriteStreams   map[uint32]*ManagedWriteStreamSRTP
 }
 
 // NewSessionSRTP creates a SRTP session using conn as the underlying transport.
-func NewSessionSRTP(conn net.Conn, config *Config) (*SessionSRTP, error) { //nolint:dupl
+// conn is usually a net.Conn, other transports are closed and given deadlines
+// when they support it.
+func NewSessionSRTP(conn io.ReadWriter, config *Config) (*SessionSRTP, error) { //nolint:dupl
 	if config == nil {
 		return nil, errNoConfig
 	} else if conn == nil {
 		return nil, errNoConn
 	}
 
+	params, err := config.params()
+	if err != nil {
+		return nil, err
+	} else if (params.null || config.AuthenticationOnly) && !config.AllowNullCipher {
+		return nil, errNullCipherNotAllowed
+	}
+
+	packetSize, err := config.packetSize()
+	if err != nil {
+		return nil, err
+	} else if config.KeepaliveInterval > 0 && config.KeepaliveSSRC == 0 {
+		return nil, errZeroKeepaliveSSRC
+	}
+
+	nextConn := batchconn.New(newReadWriterConn(conn), config.ReadBatchSize, packetSize)
+	if config.RemoteAddr != nil {
+		if nextConn, err = newRemoteAddrConn(nextConn, config.RemoteAddr, config.AcceptSource); err != nil {
+			return nil, err
+		}
+	} else if config.AcceptSource != nil {
+		return nil, errNoRemoteAddr
+	}
+
 	loggerFactory := config.LoggerFactory
 	if loggerFactory == nil {
 		loggerFactory = logging.NewDefaultLoggerFactory()
 	}
 
+	earlyPacketQueueSize := config.EarlyPacketQueueSize
+	if earlyPacketQueueSize == 0 {
+		earlyPacketQueueSize = defaultEarlyPacketQueueSize
+	}
+
+	pausedWriteQueueSize := config.PausedWriteQueueSize
+	if pausedWriteQueueSize == 0 {
+		pausedWriteQueueSize = defaultPausedWriteQueueSize
+	}
+
+	keyTimeout := config.KeyingMaterialTimeout
+	if keyTimeout == 0 {
+		keyTimeout = defaultKeyingMaterialTimeout
+	}
+
+	maxAuthFailures := config.MaxAuthFailures
+	if maxAuthFailures == 0 {
+		maxAuthFailures = defaultMaxAuthFailures
+	}
+
+	bitrateWindow := config.BitrateWindow
+	if bitrateWindow == 0 {
+		bitrateWindow = defaultBitrateWindow
+	}
+
 	localOpts := append(
 		[]ContextOption{},
 		config.LocalOptions...,
@@ -40,46 +114,185 @@ func NewSessionSRTP(conn net.Conn, config *Config) (*SessionSRTP, error) { //nol
 		[]ContextOption{
 			// Default options
 			SRTPReplayProtection(defaultSessionSRTPReplayProtectionWindow),
+			MaxSSRCStates(config.MaxSSRCStates, config.SSRCLimitPolicy),
 		},
 		config.RemoteOptions...,
 	)
+	if config.AuthenticationOnly {
+		localOpts = append(localOpts, AuthenticationOnly())
+		remoteOpts = append(remoteOpts, AuthenticationOnly())
+	}
 
 	s := &SessionSRTP{
 		session: session{
-			nextConn:      conn,
-			localOptions:  localOpts,
-			remoteOptions: remoteOpts,
-			readStreams:   map[uint32]readStream{},
-			newStream:     make(chan readStream),
-			started:       make(chan interface{}),
-			closed:        make(chan interface{}),
-			bufferFactory: config.BufferFactory,
-			log:           loggerFactory.NewLogger("srtp"),
+			nextConn:       nextConn,
+			readBatchSize:  config.ReadBatchSize,
+			packetSize:     packetSize,
+			localOptions:   localOpts,
+			remoteOptions:  remoteOpts,
+			readStreams:    map[uint32]readStream{},
+			newStream:      make(chan struct{}, 1),
+			acceptDeadline: deadline.New(),
+			started:        make(chan interface{}),
+			closed:         make(chan interface{}),
+			bufferFactory:  config.BufferFactory,
+			bufferPool:     config.BufferPool,
+			readQueueSize:  config.ReadStreamQueueSize,
+			queueBudget:    newQueueBudget(config.ReadQueueBudget),
+			acceptedSSRCs:  newSSRCSet(config.AcceptedSSRCs),
+			streamFilter:   config.StreamFilter,
+			newStreamLimit: newTokenBucket(config.MaxNewStreamsPerSecond, config.NewStreamBurst),
+			onStreamClosed: config.OnStreamClosed,
+			onSSRCConflict: config.OnSSRCConflict,
+			onDecryptError: config.OnDecryptError,
+			log:            loggerFactory.NewLogger("srtp"),
+			params:         params,
+			mtu:            config.MTU,
+			bitrateWindow:  bitrateWindow,
+			writeBitrate:   newBitrateEstimator(bitrateWindow, time.Now()),
+			rtpDump:        config.RTPDump,
+			streamKeys:     config.StreamKeys,
+			keyProvider:    config.KeyingMaterialProvider,
+			keyTimeout:     keyTimeout,
+
+			earlyPacketQueueSize: earlyPacketQueueSize,
+			pausedWriteQueueSize: pausedWriteQueueSize,
+			authFailurePolicy:    config.AuthFailurePolicy,
+			maxAuthFailures:      maxAuthFailures,
+			openedStreamsOnly:    config.OpenedStreamsOnly,
+			onRemoteAddrChange:   config.OnRemoteAddrChange,
+			followRemoteAddr:     config.FollowRemoteAddr,
 		},
 	}
+	s.session.child = s
+	if config.OnRemoteAddrChange != nil || config.FollowRemoteAddr {
+		s.remoteSources = map[uint32]net.Addr{}
+	}
+	s.session.onRemoteSRTPEvicted = s.evicted
+	if onNewStream := config.OnNewStream; onNewStream != nil {
+		s.session.onNewStream = func(r readStream) {
+			if stream, ok := r.(*ReadStreamSRTP); ok {
+				onNewStream(stream, stream.GetSSRC())
+			}
+		}
+	}
+	if config.KeyingMaterialProvider != nil {
+		s.keyFetches = map[uint32]*keyFetch{}
+	}
 	s.writeStream = &WriteStreamSRTP{s}
+	if config.RetransmitCacheSize > 0 {
+		s.retransmitCache = newRetransmitCache(config.RetransmitCacheSize)
+	}
+	s.transform = config.RTPTransform
+	if config.EKT != nil {
+		s.ekt = config.EKT
+		s.ektFullFieldInterval = config.EKTFullFieldInterval
+		if s.ektFullFieldInterval == 0 {
+			s.ektFullFieldInterval = defaultEKTFullFieldInterval
+		}
+		s.ektSent = map[uint32]int{}
+		s.ektLearned = map[uint32][]byte{}
+	}
+	if config.KeepaliveInterval > 0 {
+		s.keepaliveSSRC = config.KeepaliveSSRC
+		s.keepalivePayloadType = config.KeepalivePayloadType
+	}
 
-	err := s.session.start(
-		config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt,
-		config.Keys.RemoteMasterKey, config.Keys.RemoteMasterSalt,
-		config.Profile,
-		s,
-	)
+	if !config.Keys.empty() {
+		err := s.session.start(
+			config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt,
+			config.Keys.RemoteMasterKey, config.Keys.RemoteMasterSalt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.session.run()
+
+	if config.KeepaliveInterval > 0 {
+		go s.session.keepalive(config.KeepaliveInterval, s.writeKeepalive)
+	}
+	return s, nil
+}
+
+// NewSessionSRTPContext creates a SRTP session using conn as the underlying transport.
+// The session is closed once ctx is done, which unblocks pending AcceptStream
+// and Read calls.
+func NewSessionSRTPContext(ctx context.Context, conn io.ReadWriter, config *Config) (*SessionSRTP, error) {
+	s, err := NewSessionSRTP(conn, config)
 	if err != nil {
 		return nil, err
 	}
+
+	s.session.closeOnDone(ctx, s)
 	return s, nil
 }
 
+// Start installs keys on a session created without them, see Config.Keys.
+// Read streams opened before Start receive packets as soon as keys are installed.
+func (s *SessionSRTP) Start(keys SessionKeys) error {
+	return s.session.start(
+		keys.LocalMasterKey, keys.LocalMasterSalt,
+		keys.RemoteMasterKey, keys.RemoteMasterSalt,
+	)
+}
+
+// SetRemoteKeys installs the keys of received packets on a session started
+// without them, see Config.Keys. Packets queued until then are decrypted.
+func (s *SessionSRTP) SetRemoteKeys(masterKey, masterSalt []byte) error {
+	return s.session.setRemoteKeys(masterKey, masterSalt)
+}
+
 // OpenWriteStream returns the global write stream for the Session
 func (s *SessionSRTP) OpenWriteStream() (*WriteStreamSRTP, error) {
 	return s.writeStream, nil
 }
 
+// OpenManagedWriteStream returns a stream writing the packets of ssrc with
+// payloadType, for applications that do not keep RTP header state. The
+// sequence numbers start at a random value. The same stream is returned for
+// the same SSRC, whose packets must not be written by other means.
+func (s *SessionSRTP) OpenManagedWriteStream(ssrc uint32, payloadType uint8) (*ManagedWriteStreamSRTP, error) {
+	s.managedWriteStreamsMu.Lock()
+	defer s.managedWriteStreamsMu.Unlock()
+
+	if w, ok := s.managedWriteStreams[ssrc]; ok {
+		return w, nil
+	} else if s.isKeepaliveSSRC(ssrc) {
+		return nil, errKeepaliveSSRC
+	}
+
+	// Starting in the lower half of the sequence number space keeps the
+	// rollover counter of late joining receivers from being off by one
+	var start [2]byte
+	if _, err := rand.Read(start[:]); err != nil {
+		return nil, err
+	}
+
+	w := &ManagedWriteStreamSRTP{
+		session:        s,
+		ssrc:           ssrc,
+		payloadType:    payloadType,
+		sequenceNumber: binary.BigEndian.Uint16(start[:]) & 0x7FFF,
+	}
+	if s.managedWriteStreams == nil {
+		s.managedWriteStreams = map[uint32]*ManagedWriteStreamSRTP{}
+	}
+	s.managedWriteStreams[ssrc] = w
+	return w, nil
+}
+
 // OpenReadStream opens a read stream for the given SSRC, it can be used
 // if you want a certain SSRC, but don't want to wait for AcceptStream
 func (s *SessionSRTP) OpenReadStream(ssrc uint32) (*ReadStreamSRTP, error) {
+	if s.session.isIgnored(ssrc) {
+		return nil, errSSRCIgnored
+	} else if !s.session.isAccepted(ssrc) {
+		return nil, errSSRCNotAccepted
+	}
+
 	r, _ := s.session.getOrCreateReadStream(ssrc, s, newReadStreamSRTP)
+	s.session.claimPendingStream(ssrc)
 
 	if readStream, ok := r.(*ReadStreamSRTP); ok {
 		return readStream, nil
@@ -88,11 +301,71 @@ func (s *SessionSRTP) OpenReadStream(ssrc uint32) (*ReadStreamSRTP, error) {
 	return nil, errFailedTypeAssertion
 }
 
+// OpenReadStreamAny returns a stream delivering the decrypted packets of
+// every SSRC, for tools that record or monitor a whole session from one
+// goroutine. Packets are still delivered to the stream of their SSRC too.
+// Those of SSRCs refused by Config.StreamFilter, MaxNewStreamsPerSecond,
+// AcceptedSSRCs or IgnoreSSRC are delivered to neither.
+func (s *SessionSRTP) OpenReadStreamAny() (*ReadStreamAny, error) {
+	return s.session.openReadStreamAny(srtpBufferSize)
+}
+
+// AttachReadStream attaches a stream detached from another session with
+// ReadStreamSRTP.Detach. The session must use the same remote keys, the
+// rollover state of the SSRC is carried over once both sessions are started.
+// It fails if the session already has a stream for the SSRC.
+func (s *SessionSRTP) AttachReadStream(r *ReadStreamSRTP) error {
+	r.detachMu.Lock()
+	defer r.detachMu.Unlock()
+
+	r.mu.Lock()
+	detached, closed := r.detached, r.closeReported
+	r.mu.Unlock()
+
+	if !detached {
+		return errStreamNotDetached
+	} else if closed {
+		return errStreamAlreadyClosed
+	}
+
+	if err := s.session.attachReadStream(r); err != nil {
+		return err
+	}
+	if r.detachedState != nil {
+		s.session.putRemoteSRTPState(r.detachedState)
+		r.detachedState = nil
+	}
+
+	r.mu.Lock()
+	r.session = s
+	r.detached = false
+	r.mu.Unlock()
+	return nil
+}
+
+// ListStreams returns the read streams currently known to the session, ordered by SSRC
+func (s *SessionSRTP) ListStreams() []StreamInfo {
+	return s.session.listStreams(false)
+}
+
+// PendingStreams returns the streams created by incoming packets that have not
+// been returned by AcceptStream nor opened with OpenReadStream yet, ordered by
+// SSRC. Their packet counts help to detect unsignaled senders.
+func (s *SessionSRTP) PendingStreams() []StreamInfo {
+	return s.session.listStreams(true)
+}
+
 // AcceptStream returns a stream to handle RTCP for a single SSRC
 func (s *SessionSRTP) AcceptStream() (*ReadStreamSRTP, uint32, error) {
-	stream, ok := <-s.newStream
-	if !ok {
-		return nil, 0, errStreamAlreadyClosed
+	return s.AcceptStreamContext(context.Background())
+}
+
+// AcceptStreamContext is AcceptStream, returning ctx.Err() once ctx is done
+// so that an accept loop can be stopped without closing the session
+func (s *SessionSRTP) AcceptStreamContext(ctx context.Context) (*ReadStreamSRTP, uint32, error) {
+	stream, err := s.session.accept(ctx)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	readStream, ok := stream.(*ReadStreamSRTP)
@@ -103,9 +376,166 @@ func (s *SessionSRTP) AcceptStream() (*ReadStreamSRTP, uint32, error) {
 	return readStream, stream.GetSSRC(), nil
 }
 
-// Close ends the session
+// SetAcceptDeadline sets the deadline for AcceptStream, independently of
+// read deadlines. Setting to zero means no deadline.
+func (s *SessionSRTP) SetAcceptDeadline(t time.Time) error {
+	s.session.acceptDeadline.Set(t)
+	return nil
+}
+
+// Rekey replaces the keys of the session, e.g. after a DTLS renegotiation,
+// without closing its streams nor losing their rollover and replay state.
+// The session must be started.
+func (s *SessionSRTP) Rekey(keys SessionKeys) error {
+	return s.session.rekey(keys)
+}
+
+// SetStreamKeys replaces the keys used for the packets of ssrc, sent and
+// received, leaving the other streams of the session untouched. A direction
+// whose keys are left empty is not changed. The session must be started.
+func (s *SessionSRTP) SetStreamKeys(ssrc uint32, keys SessionKeys) error {
+	return s.session.setStreamKeys(ssrc, keys)
+}
+
+// IgnoreSSRC closes the read stream of ssrc, if any, and drops the packets
+// of ssrc received from then on, before decrypting them, rather than
+// announcing a new stream through AcceptStream. The rollover and replay state
+// of ssrc is forgotten. OpenReadStream fails for ssrc afterwards.
+func (s *SessionSRTP) IgnoreSSRC(ssrc uint32) error {
+	return s.session.ignoreSSRC(ssrc)
+}
+
+// RemoveStream closes the read stream of ssrc, if any, and forgets the
+// rollover and replay state the session keeps for ssrc as a remote sender,
+// so long-lived sessions do not grow with every sender that left. The state
+// of ssrc as a local sender is kept, so its packets never reuse keystream,
+// as are the keys set for ssrc.
+func (s *SessionSRTP) RemoveStream(ssrc uint32) error {
+	err := s.session.removeStream(ssrc)
+
+	if s.retransmitCache != nil {
+		s.retransmitCache.remove(ssrc)
+	}
+	if s.ekt != nil {
+		s.session.localContextMutex.Lock()
+		delete(s.ektSent, ssrc)
+		s.session.localContextMutex.Unlock()
+
+		s.session.decryptMutex.Lock()
+		delete(s.ektLearned, ssrc)
+		s.session.decryptMutex.Unlock()
+	}
+	return err
+}
+
+// AuthFailures returns how many received packets failed authentication, see
+// Config.AuthFailurePolicy.
+func (s *SessionSRTP) AuthFailures() uint64 {
+	return s.session.authFailureCount()
+}
+
+// Stats returns a snapshot of the counters of the session, for monitoring
+func (s *SessionSRTP) Stats() SessionStats {
+	return s.session.stats()
+}
+
+// SetRemoteAddr changes the address packets are written to, for sessions
+// created with Config.RemoteAddr.
+func (s *SessionSRTP) SetRemoteAddr(addr net.Addr) error {
+	return s.session.setRemoteAddr(addr)
+}
+
+// SetTransport replaces the conn of the session, such as after an ICE
+// restart, and closes the previous one. Keys, rollover counters and replay
+// state are kept, so the peer does not have to rekey. With Config.RemoteAddr
+// the current remote address applies to conn. Sessions of NewSessionPairMux
+// share their conn and cannot replace it.
+func (s *SessionSRTP) SetTransport(conn io.ReadWriter) error {
+	return s.session.setTransport(conn)
+}
+
+// MaxPayloadSize returns the size of the largest RTP packet, header included,
+// that fits in the configured MTU once protected. Packetizers should use it as
+// their MTU. It returns 0 if no MTU is configured.
+func (s *SessionSRTP) MaxPayloadSize() int {
+	return s.session.maxPayloadSize(s.overhead())
+}
+
+// PauseWrites quiesces the write path, e.g. while keys are swapped. It returns
+// once in-flight writes are done. Later writes are queued, up to
+// Config.PausedWriteQueueSize packets, and return 0 bytes written.
+func (s *SessionSRTP) PauseWrites() {
+	s.session.pauseWrites()
+}
+
+// ResumeWrites sends the queued packets in order and resumes writing. It
+// returns the first error encountered while sending the queue.
+func (s *SessionSRTP) ResumeWrites() error {
+	return s.session.resumeWrites()
+}
+
+// PauseReads stops reading from the underlying conn, leaving inbound packets
+// to be buffered or dropped by the transport, e.g. while shedding load. A packet
+// already being read is still delivered. Closing the session ends the pause.
+func (s *SessionSRTP) PauseReads() {
+	s.session.pauseReads()
+}
+
+// ResumeReads resumes reading from the underlying conn.
+func (s *SessionSRTP) ResumeReads() {
+	s.session.resumeReads()
+}
+
+// CloseSend shuts down the outbound direction of the session. Subsequent
+// writes fail while inbound SRTP keeps being decrypted.
+func (s *SessionSRTP) CloseSend() error {
+	s.session.closeSend()
+	return nil
+}
+
+// CloseRecv shuts down the inbound direction of the session. Incoming packets
+// are discarded and all read streams are closed while outbound SRTP keeps
+// being encrypted. AcceptStream keeps blocking until the session is closed.
+func (s *SessionSRTP) CloseRecv() error {
+	s.session.closeRecv()
+	return nil
+}
+
+// Close ends the session. The keys of the session are wiped, see Context.Wipe.
 func (s *SessionSRTP) Close() error {
-	return s.session.close()
+	if err := s.session.close(); err != nil {
+		return err
+	}
+
+	// Keys learned from EKT fields are copies owned by the session
+	s.session.decryptMutex.Lock()
+	for _, key := range s.ektLearned {
+		zeroBytes(key)
+	}
+	s.session.decryptMutex.Unlock()
+	return nil
+}
+
+// CloseWithTimeout ends the session like Close once the writes in flight and
+// those queued by PauseWrites are sent. Writing to the conn fails after
+// timeout if it supports write deadlines, a zero timeout waits for as long as
+// writes take. The error of a drained write is returned once the session is
+// closed.
+func (s *SessionSRTP) CloseWithTimeout(timeout time.Duration) error {
+	drainErr := s.session.drain(timeout, nil)
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return drainErr
+}
+
+// overhead returns the number of bytes SRTP protection adds to a packet
+func (s *SessionSRTP) overhead() int {
+	overhead := s.session.params.authTagLen + s.session.params.aeadAuthTagLen + s.session.params.innerLen + s.session.mkiLen()
+	if s.ekt != nil {
+		overhead += s.ekt.fieldLen(s.session.params.keyLen)
+	}
+	return overhead
 }
 
 func (s *SessionSRTP) write(b []byte) (int, error) {
@@ -120,23 +550,244 @@ func (s *SessionSRTP) write(b []byte) (int, error) {
 }
 
 func (s *SessionSRTP) writeRTP(header *rtp.Header, payload []byte) (int, error) {
-	if _, ok := <-s.session.started; ok {
-		return 0, errStartedChannelUsedIncorrectly
+	if s.isKeepaliveSSRC(header.SSRC) {
+		return 0, errKeepaliveSSRC
 	}
 
+	return s.sendRTP(header, payload)
+}
+
+// sendRTP encrypts and writes a RTP packet, or queues it while writes are
+// paused
+func (s *SessionSRTP) sendRTP(header *rtp.Header, payload []byte) (int, error) {
+	if err := s.session.waitStarted(); err != nil {
+		return 0, err
+	}
+
+	s.session.writePauseMutex.RLock()
+	defer s.session.writePauseMutex.RUnlock()
+
+	if s.session.isSendClosed() {
+		return 0, errSendClosed
+	} else if s.session.writesPaused {
+		raw := make([]byte, header.MarshalSize()+len(payload))
+		n, err := header.MarshalTo(raw)
+		if err != nil {
+			return 0, err
+		}
+		copy(raw[n:], payload)
+
+		return 0, s.session.queueWrite(raw)
+	}
+
+	return s.encryptAndWriteRTP(header, payload)
+}
+
+func (s *SessionSRTP) writeRawRTP(header, payload []byte) (int, error) {
+	if len(header) >= rtpFixedHeaderSize && s.isKeepaliveSSRC(rawHeaderSSRC(header)) {
+		return 0, errKeepaliveSSRC
+	}
+
+	if err := s.session.waitStarted(); err != nil {
+		return 0, err
+	}
+
+	s.session.writePauseMutex.RLock()
+	defer s.session.writePauseMutex.RUnlock()
+
+	if s.session.isSendClosed() {
+		return 0, errSendClosed
+	} else if s.session.writesPaused {
+		raw := make([]byte, len(header)+len(payload))
+		copy(raw[copy(raw, header):], payload)
+
+		return 0, s.session.queueWrite(raw)
+	}
+
+	pooled, dst := s.encryptBuffer()
+	s.session.localContextMutex.Lock()
+	encrypted, err := s.localContext.encryptRTPRaw(dst, header, payload)
+	if err == nil {
+		encrypted, err = s.appendEKTField(rawHeaderSSRC(header), encrypted)
+	}
+	s.session.lastWrite = time.Now()
+	s.session.localContextMutex.Unlock()
+
+	if err != nil {
+		s.session.putBuffer(pooled, dst)
+		return 0, err
+	}
+
+	s.cacheEncrypted(rawHeaderSSRC(header), rawHeaderSequenceNumber(header), encrypted)
+	n, err := s.session.writeConn(encrypted)
+	s.session.putBuffer(pooled, encrypted)
+	return n, err
+}
+
+func (s *SessionSRTP) writeUnpaused(buf []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(buf); err != nil {
+		return 0, err
+	}
+
+	return s.encryptAndWriteRTP(&packet.Header, packet.Payload)
+}
+
+func (s *SessionSRTP) encryptAndWriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	if s.transform != nil {
+		header, payload = s.applyTransform(header, payload)
+	}
+
+	pooled, dst := s.encryptBuffer()
 	s.session.localContextMutex.Lock()
-	encrypted, err := s.localContext.encryptRTP(nil, header, payload)
+	encrypted, err := s.localContext.encryptRTP(dst, header, payload)
+	if err == nil {
+		encrypted, err = s.appendEKTField(header.SSRC, encrypted)
+	}
+	s.session.lastWrite = time.Now()
 	s.session.localContextMutex.Unlock()
 
 	if err != nil {
+		s.session.putBuffer(pooled, dst)
 		return 0, err
 	}
 
-	return s.session.nextConn.Write(encrypted)
+	s.cacheEncrypted(header.SSRC, header.SequenceNumber, encrypted)
+	n, err := s.session.writeConn(encrypted)
+	s.session.putBuffer(pooled, encrypted)
+	return n, err
+}
+
+// encryptBuffer returns a pooled buffer to protect a packet in, unless the
+// packet is kept for retransmission
+func (s *SessionSRTP) encryptBuffer() (*[]byte, []byte) {
+	if s.retransmitCache != nil {
+		return nil, nil
+	}
+	return s.session.getBuffer()
+}
+
+// appendEKTField ends a protected packet with its EKT field, see Config.EKT.
+// It must be called with localContextMutex held.
+func (s *SessionSRTP) appendEKTField(ssrc uint32, encrypted []byte) ([]byte, error) {
+	if s.ekt == nil {
+		return encrypted, nil
+	}
+
+	sent := s.ektSent[ssrc]
+	s.ektSent[ssrc] = sent + 1
+	if sent%s.ektFullFieldInterval != 0 {
+		return s.ekt.AppendField(encrypted, nil)
+	}
+
+	roc, _ := s.localContext.ROC(ssrc)
+	return s.ekt.AppendField(encrypted, &EKTField{MasterKey: s.session.localMasterKeyFor(ssrc), SSRC: ssrc, ROC: roc})
+}
+
+// decryptEKT decrypts a packet ending with an EKT field, installing the
+// master key of a FullEKTField for its SSRC if the packet authenticates
+func (s *SessionSRTP) decryptEKT(buf []byte, h *rtp.Header, headerLen int) ([]byte, error) {
+	buf, field, err := s.ekt.SplitField(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if field == nil || field.SSRC != h.SSRC || bytes.Equal(s.ektLearned[h.SSRC], field.MasterKey) {
+		return s.remoteContext.decryptRTP(buf, buf, h, headerLen)
+	}
+
+	decrypted, err := s.remoteContext.trySSRCKeys(buf, buf, h, headerLen, field.MasterKey, field.MasterSalt, field.ROC)
+	if err == nil && decrypted != nil {
+		s.ektLearned[h.SSRC] = append([]byte{}, field.MasterKey...)
+	}
+	return decrypted, err
+}
+
+// applyTransform runs Config.RTPTransform on a copy of the packet
+func (s *SessionSRTP) applyTransform(header *rtp.Header, payload []byte) (*rtp.Header, []byte) {
+	packet := &rtp.Packet{Header: *header, Payload: payload}
+	packet.CSRC = append([]uint32{}, header.CSRC...)
+	packet.Extensions = append([]rtp.Extension{}, header.Extensions...)
+
+	s.transform(packet)
+	return &packet.Header, packet.Payload
+}
+
+func (s *SessionSRTP) cacheEncrypted(ssrc uint32, sequenceNumber uint16, encrypted []byte) {
+	if s.retransmitCache != nil {
+		s.retransmitCache.add(ssrc, sequenceNumber, encrypted)
+	}
+}
+
+// retransmit sends the cached ciphertext of a packet that was written before
+func (s *SessionSRTP) retransmit(ssrc uint32, sequenceNumber uint16) (int, error) {
+	if s.retransmitCache == nil {
+		return 0, errNoRetransmitCache
+	}
+
+	encrypted, ok := s.retransmitCache.get(ssrc, sequenceNumber)
+	if !ok {
+		return 0, fmt.Errorf("%w: ssrc=%d seq=%d", errNotInRetransmitCache, ssrc, sequenceNumber)
+	}
+
+	s.session.writePauseMutex.RLock()
+	defer s.session.writePauseMutex.RUnlock()
+
+	if s.session.isSendClosed() {
+		return 0, errSendClosed
+	} else if s.session.writesPaused {
+		return 0, errWritesPaused
+	}
+
+	return s.session.writeConn(encrypted)
+}
+
+// writeKeepalive sends an RTP packet carrying nothing but a single padding byte
+// https://tools.ietf.org/html/rfc6263#section-4.3
+func (s *SessionSRTP) writeKeepalive() error {
+	s.keepaliveSequenceNumber++
+	_, err := s.sendRTP(&rtp.Header{
+		Version:        2,
+		Padding:        true,
+		PayloadType:    s.keepalivePayloadType,
+		SequenceNumber: s.keepaliveSequenceNumber,
+		SSRC:           s.keepaliveSSRC,
+	}, []byte{0x01})
+	return err
+}
+
+// isKeepaliveSSRC tells whether ssrc is the one keepalives are sent from,
+// whose sequence numbers belong to them alone
+func (s *SessionSRTP) isKeepaliveSSRC(ssrc uint32) bool {
+	return s.keepaliveSSRC != 0 && ssrc == s.keepaliveSSRC
 }
 
 func (s *SessionSRTP) setWriteDeadline(t time.Time) error {
-	return s.session.nextConn.SetWriteDeadline(t)
+	return s.session.conn().SetWriteDeadline(t)
+}
+
+// evicted closes the read stream of a SSRC the remote context stopped tracking
+func (s *SessionSRTP) evicted(ssrc uint32) {
+	delete(s.ektLearned, ssrc)
+	delete(s.remoteSources, ssrc)
+	delete(s.keyFetches, ssrc)
+	if err := s.session.closeReadStream(ssrc, StreamClosedByLimit); err != nil {
+		s.session.log.Warnf("failed to close read stream %d: %v", ssrc, err)
+	}
+}
+
+// admitsKeyFetch tells whether the keys of ssrc may be fetched from the
+// KeyingMaterialProvider, only those of accepted SSRCs are
+func (s *SessionSRTP) admitsKeyFetch(ssrc uint32) bool {
+	return s.session.accepts(ssrc)
+}
+
+// packetSSRC returns the SSRC of a SRTP packet
+func (s *SessionSRTP) packetSSRC(buf []byte) (uint32, bool) {
+	if len(buf) < rtpFixedHeaderSize {
+		return 0, false
+	}
+	return rawHeaderSSRC(buf), true
 }
 
 func (s *SessionSRTP) decrypt(buf []byte) error {
@@ -144,13 +795,44 @@ func (s *SessionSRTP) decrypt(buf []byte) error {
 	headerLen, err := h.Unmarshal(buf)
 	if err != nil {
 		return err
+	} else if !s.session.accepts(h.SSRC) {
+		return nil
+	}
+
+	_, known := s.remoteContext.srtpSSRCStates[h.SSRC]
+
+	var decrypted []byte
+	if s.ekt != nil {
+		decrypted, err = s.decryptEKT(buf, h, headerLen)
+	} else {
+		decrypted, err = s.remoteContext.decryptRTP(buf, buf, h, headerLen)
+	}
+	if err != nil {
+		return err
+	} else if decrypted == nil {
+		s.session.replayDrops++
+		return nil // Duplicate dropped, see DropDuplicates
+	} else if !known {
+		s.session.checkSSRCConflict(h.SSRC)
+	}
+	s.session.checkRemoteAddr(h.SSRC)
+
+	// Streams are only created for packets that authenticate, so forged
+	// SSRCs cannot pile them up
+	if !s.session.admitStream(h.SSRC, h) {
+		return nil
+	}
+
+	// Packets of refused SSRCs do not reach the stream of every SSRC either
+	if err = s.session.writeAny(decrypted); err != nil {
+		return err
 	}
 
 	r, isNew := s.session.getOrCreateReadStream(h.SSRC, s, newReadStreamSRTP)
 	if r == nil {
-		return nil // Session has been closed
+		return nil // Session has been closed, or the SSRC is ignored
 	} else if isNew {
-		s.session.newStream <- r // Notify AcceptStream
+		s.session.addPendingStream(r) // Notify AcceptStream
 	}
 
 	readStream, ok := r.(*ReadStreamSRTP)
@@ -158,15 +840,25 @@ func (s *SessionSRTP) decrypt(buf []byte) error {
 		return errFailedTypeAssertion
 	}
 
-	decrypted, err := s.remoteContext.decryptRTP(buf, buf, h, headerLen)
-	if err != nil {
-		return err
+	if s.session.rtpDump != nil {
+		if err = s.session.rtpDump.WriteRTP(time.Now(), decrypted); err != nil {
+			s.session.log.Warnf("failed to write rtpdump: %v", err)
+		}
+	}
+
+	if readStream.keepHeaders && h.Extension {
+		// The extension payloads alias buf, which is reused by the next read
+		h = &rtp.Header{}
+		if _, err = h.Unmarshal(append([]byte{}, buf[:headerLen]...)); err != nil {
+			return err
+		}
 	}
 
-	_, err = readStream.write(decrypted)
+	_, err = readStream.write(decrypted, h, headerLen)
 	if err != nil {
 		return err
 	}
+	readStream.received(len(buf))
 
 	return nil
 }
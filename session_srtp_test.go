@@ -2,6 +2,8 @@ package srtp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net"
 	"reflect"
@@ -23,15 +25,7 @@ func TestSessionSRTPBadInit(t *testing.T) {
 
 func buildSessionSRTP(t *testing.T) (*SessionSRTP, net.Conn, *Config) {
 	aPipe, bPipe := net.Pipe()
-	config := &Config{
-		Profile: ProtectionProfileAes128CmHmacSha1_80,
-		Keys: SessionKeys{
-			[]byte{0xE1, 0xF9, 0x7A, 0x0D, 0x3E, 0x01, 0x8B, 0xE0, 0xD6, 0x4F, 0xA3, 0x2C, 0x06, 0xDE, 0x41, 0x39},
-			[]byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6},
-			[]byte{0xE1, 0xF9, 0x7A, 0x0D, 0x3E, 0x01, 0x8B, 0xE0, 0xD6, 0x4F, 0xA3, 0x2C, 0x06, 0xDE, 0x41, 0x39},
-			[]byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6},
-		},
-	}
+	config := buildConfigSRTP()
 
 	aSession, err := NewSessionSRTP(aPipe, config)
 	if err != nil {
@@ -43,6 +37,18 @@ func buildSessionSRTP(t *testing.T) (*SessionSRTP, net.Conn, *Config) {
 	return aSession, bPipe, config
 }
 
+func buildConfigSRTP() *Config {
+	return &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			[]byte{0xE1, 0xF9, 0x7A, 0x0D, 0x3E, 0x01, 0x8B, 0xE0, 0xD6, 0x4F, 0xA3, 0x2C, 0x06, 0xDE, 0x41, 0x39},
+			[]byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6},
+			[]byte{0xE1, 0xF9, 0x7A, 0x0D, 0x3E, 0x01, 0x8B, 0xE0, 0xD6, 0x4F, 0xA3, 0x2C, 0x06, 0xDE, 0x41, 0x39},
+			[]byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6},
+		},
+	}
+}
+
 func buildSessionSRTPPair(t *testing.T) (*SessionSRTP, *SessionSRTP) { //nolint:dupl
 	aSession, bPipe, config := buildSessionSRTP(t)
 	bSession, err := NewSessionSRTP(bPipe, config)
@@ -384,3 +390,3332 @@ func encryptSRTP(context *Context, pkt *rtp.Packet) ([]byte, error) {
 	}
 	return encrypted, nil
 }
+
+func TestSessionSRTPMaxPayloadSize(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		profile         ProtectionProfile
+		keyLen, saltLen int
+		mtu             int
+		expectedSRTP    int
+		expectedSRTCP   int
+		mki             []byte
+	}{
+		"NoMTU":                   {ProtectionProfileAes128CmHmacSha1_80, 16, 14, 0, 0, 0, nil},
+		"AES_128_CM_HMAC_SHA1_80": {ProtectionProfileAes128CmHmacSha1_80, 16, 14, 1200, 1190, 1186, nil},
+		"AEAD_AES_128_GCM":        {ProtectionProfileAeadAes128Gcm, 16, 12, 1200, 1184, 1180, nil},
+		"MKI":                     {ProtectionProfileAes128CmHmacSha1_80, 16, 14, 1200, 1186, 1182, []byte{1, 2, 3, 4}},
+	} {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			config := &Config{
+				Profile: testCase.profile,
+				Keys: SessionKeys{
+					LocalMasterKey:   make([]byte, testCase.keyLen),
+					LocalMasterSalt:  make([]byte, testCase.saltLen),
+					RemoteMasterKey:  make([]byte, testCase.keyLen),
+					RemoteMasterSalt: make([]byte, testCase.saltLen),
+				},
+				MTU: testCase.mtu,
+			}
+			if testCase.mki != nil {
+				config.LocalOptions = []ContextOption{MasterKeyIdentifier(testCase.mki)}
+			}
+
+			rtpSession, err := NewSessionSRTP(newNoopConn(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rtcpSession, err := NewSessionSRTCP(newNoopConn(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size := rtpSession.MaxPayloadSize(); size != testCase.expectedSRTP {
+				t.Errorf("SRTP MaxPayloadSize expected %d, got %d", testCase.expectedSRTP, size)
+			}
+			if size := rtcpSession.MaxPayloadSize(); size != testCase.expectedSRTCP {
+				t.Errorf("SRTCP MaxPayloadSize expected %d, got %d", testCase.expectedSRTCP, size)
+			}
+
+			if err = rtpSession.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err = rtcpSession.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSessionSRTPContextCancel(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session, err := NewSessionSRTPContext(ctx, aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readStream, err := session.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readErr := make(chan error)
+	go func() {
+		_, rerr := readStream.Read(make([]byte, 1500))
+		readErr <- rerr
+	}()
+	acceptErr := make(chan error)
+	go func() {
+		_, _, aerr := session.AcceptStream()
+		acceptErr <- aerr
+	}()
+
+	cancel()
+
+	if err = <-readErr; !errors.Is(err, io.EOF) {
+		t.Errorf("Read must return EOF once the context is canceled, got %v", err)
+	}
+	if err = <-acceptErr; !errors.Is(err, errStreamAlreadyClosed) {
+		t.Errorf("AcceptStream must fail once the context is canceled, got %v", err)
+	}
+	if err = bPipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPHalfClose(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	aReadStream, err := aSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stops sending, b stops receiving
+	if err = aSession.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.CloseRecv(); err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("Write after CloseSend must fail with %v, got %v", ErrSessionClosed, err)
+	}
+	if _, err = bReadStream.Read(make([]byte, 1500)); !errors.Is(err, io.EOF) {
+		t.Fatalf("Read after CloseRecv must return EOF, got %v", err)
+	}
+
+	// b -> a is still open
+	bWriteStream, err := bSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, append([]byte{}, testPayload...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, aReadStream, rtpHeaderSize, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("Write after Close must fail with %v, got %v", ErrSessionClosed, err)
+	}
+}
+
+func TestSessionSRTPSSRCConflict(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	conflicts := make(chan uint32, 4)
+	bConfig := *config
+	bConfig.OnSSRCConflict = func(ssrc uint32) {
+		conflicts <- ssrc
+	}
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bWriteStream, err := bSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b already sends on the SSRC a starts to send on
+	if _, err = bWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 1}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	for i, ssrc := range []uint32{testSSRC + 1, testSSRC, testSSRC} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: uint16(i + 1)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected a single conflict, got %d", len(conflicts))
+	} else if ssrc := <-conflicts; ssrc != testSSRC {
+		t.Fatalf("Expected a conflict for %d, got %d", testSSRC, ssrc)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPOnDecryptError(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	config := buildConfigSRTP()
+	type decryptError struct {
+		ssrc uint32
+		err  error
+	}
+	decryptErrors := make(chan decryptError, 4)
+	var bSession *SessionSRTP
+	config.OnDecryptError = func(ssrc uint32, err error) {
+		// Callbacks may call back into the session
+		_ = bSession.Stats()
+		decryptErrors <- decryptError{ssrc, err}
+	}
+
+	aPipe, bPipe := net.Pipe()
+	bSession, err := NewSessionSRTP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptContext, err := CreateContext(config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt, config.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets [][]byte
+	for seq := uint16(1); seq <= 2; seq++ {
+		encrypted, eerr := encryptSRTP(encryptContext, &rtp.Packet{
+			Header:  rtp.Header{Version: 2, SSRC: testSSRC, SequenceNumber: seq},
+			Payload: testPayload,
+		})
+		if eerr != nil {
+			t.Fatal(eerr)
+		}
+		packets = append(packets, encrypted)
+	}
+	packets[0][len(packets[0])-1] ^= 0xFF
+
+	// Neither a tampered nor a truncated packet stops the session
+	for _, packet := range [][]byte{packets[0], {0x80}, packets[1]} {
+		if _, err = aPipe.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq, err := assertPayloadSRTP(t, bReadStream, 12, testPayload)
+	if err != nil {
+		t.Fatal(err)
+	} else if seq != 2 {
+		t.Fatalf("Expected sequence number 2, got %d", seq)
+	}
+
+	if e := <-decryptErrors; e.ssrc != testSSRC || !errors.Is(e.err, ErrAuthenticationFailure) {
+		t.Fatalf("Unexpected error %v for ssrc %d", e.err, e.ssrc)
+	}
+	if e := <-decryptErrors; e.ssrc != 0 || e.err == nil {
+		t.Fatalf("Unexpected error %v for ssrc %d", e.err, e.ssrc)
+	}
+
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = aPipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPAuthFailurePolicy(t *testing.T) {
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	// Packets with odd sequence numbers fail authentication
+	run := func(t *testing.T, policy AuthFailurePolicy, seqs []uint16) (*ReadStreamSRTP, *SessionSRTP, net.Conn) {
+		config := buildConfigSRTP()
+		config.AuthFailurePolicy = policy
+		config.MaxAuthFailures = 2
+		config.OnDecryptError = func(ssrc uint32, err error) {
+			if policy == AuthFailureDrop {
+				t.Errorf("Unexpected error %v with AuthFailureDrop", err)
+			}
+		}
+
+		aPipe, bPipe := net.Pipe()
+		bSession, err := NewSessionSRTP(bPipe, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bReadStream, err := bSession.OpenReadStream(testSSRC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encryptContext, err := CreateContext(config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt, config.Profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, seq := range seqs {
+			encrypted, err := encryptSRTP(encryptContext, &rtp.Packet{
+				Header:  rtp.Header{Version: 2, SSRC: testSSRC, SequenceNumber: seq},
+				Payload: testPayload,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seq%2 == 1 {
+				encrypted[len(encrypted)-1] ^= 0xFF
+			}
+			if _, err = aPipe.Write(encrypted); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return bReadStream, bSession, aPipe
+	}
+
+	t.Run("Drop", func(t *testing.T) {
+		lim := test.TimeOut(time.Second * 5)
+		defer lim.Stop()
+
+		report := test.CheckRoutines(t)
+		defer report()
+
+		bReadStream, bSession, aPipe := run(t, AuthFailureDrop, []uint16{1, 3, 4})
+		if seq, err := assertPayloadSRTP(t, bReadStream, 12, testPayload); err != nil {
+			t.Fatal(err)
+		} else if seq != 4 {
+			t.Fatalf("Expected sequence number 4, got %d", seq)
+		}
+		if n := bSession.AuthFailures(); n != 2 {
+			t.Fatalf("Expected 2 authentication failures, got %d", n)
+		}
+
+		if err := bSession.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := aPipe.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		lim := test.TimeOut(time.Second * 5)
+		defer lim.Stop()
+
+		report := test.CheckRoutines(t)
+		defer report()
+
+		// The valid packet in between resets the consecutive failures
+		bReadStream, bSession, aPipe := run(t, AuthFailureClose, []uint16{1, 2, 3, 5})
+		if _, err := assertPayloadSRTP(t, bReadStream, 12, testPayload); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bReadStream.Read(make([]byte, 1500)); !errors.Is(err, io.EOF) {
+			t.Fatalf("Expected the session to close, got %v", err)
+		}
+		if n := bSession.AuthFailures(); n != 3 {
+			t.Fatalf("Expected 3 authentication failures, got %d", n)
+		}
+
+		if err := aPipe.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+type countingBufferPool struct {
+	sync.Pool
+	mu       sync.Mutex
+	gets     int
+	returned int
+}
+
+func (p *countingBufferPool) Get() interface{} {
+	p.mu.Lock()
+	p.gets++
+	p.mu.Unlock()
+	return p.Pool.Get()
+}
+
+func (p *countingBufferPool) Put(b interface{}) {
+	p.mu.Lock()
+	p.returned++
+	p.mu.Unlock()
+	p.Pool.Put(b)
+}
+
+func TestSessionSRTPBufferPool(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+
+	pool := &countingBufferPool{}
+	pool.New = func() interface{} {
+		b := make([]byte, 0, 64)
+		return &b
+	}
+
+	aPipe, bPipe := net.Pipe()
+	config := buildConfigSRTP()
+	config.BufferPool = pool
+	aSession, err := NewSessionSRTP(aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Buffers are reused by packets of growing sizes
+	for i := 1; i <= 64; i *= 2 {
+		payload := bytes.Repeat([]byte{byte(i)}, i)
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: uint16(i)}, payload); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.gets != 2+7 || pool.returned != pool.gets {
+		t.Fatalf("Expected 9 buffers taken and returned, got %d and %d", pool.gets, pool.returned)
+	}
+}
+
+func TestSessionSRTPKeepalive(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const keepaliveSSRC = 4321
+
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+		KeepaliveInterval:    10 * time.Millisecond,
+		KeepaliveSSRC:        keepaliveSSRC,
+		KeepalivePayloadType: 127,
+	}
+
+	zeroSSRCConfig := *config
+	zeroSSRCConfig.KeepaliveSSRC = 0
+	if _, err := NewSessionSRTP(aPipe, &zeroSSRCConfig); !errors.Is(err, errZeroKeepaliveSSRC) {
+		t.Fatalf("Expected %v, got %v", errZeroKeepaliveSSRC, err)
+	}
+
+	aSession, err := NewSessionSRTP(aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The keepalive SSRC is not for media, its sequence numbers would collide
+	writeStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := &rtp.Header{Version: 2, SSRC: keepaliveSSRC, SequenceNumber: 1}
+	if _, err = writeStream.WriteRTP(header, []byte{0x00}); !errors.Is(err, errKeepaliveSSRC) {
+		t.Fatalf("Expected %v, got %v", errKeepaliveSSRC, err)
+	}
+	rawHeader, err := header.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writeStream.WriteRawRTP(rawHeader, []byte{0x00}); !errors.Is(err, errKeepaliveSSRC) {
+		t.Fatalf("Expected %v, got %v", errKeepaliveSSRC, err)
+	}
+	if _, err = aSession.OpenManagedWriteStream(keepaliveSSRC, 96); !errors.Is(err, errKeepaliveSSRC) {
+		t.Fatalf("Expected %v, got %v", errKeepaliveSSRC, err)
+	}
+
+	decryptContext, err := CreateContext(make([]byte, 16), make([]byte, 14), ProtectionProfileAes128CmHmacSha1_80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 1500)
+	for i := 0; i < 2; i++ {
+		n, rerr := bPipe.Read(b)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+
+		header := &rtp.Header{}
+		if _, err = decryptContext.DecryptRTP(nil, b[:n], header); err != nil {
+			t.Fatal(err)
+		}
+		if header.SSRC != keepaliveSSRC || header.PayloadType != 127 || !header.Padding {
+			t.Fatalf("Unexpected keepalive header %v", header)
+		}
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPListStreams(t *testing.T) {
+	before := time.Now()
+	session, err := NewSessionSRTP(newNoopConn(), &Config{
+		Keys: SessionKeys{
+			LocalMasterKey:   make([]byte, 16),
+			LocalMasterSalt:  make([]byte, 14),
+			RemoteMasterKey:  make([]byte, 16),
+			RemoteMasterSalt: make([]byte, 14),
+		},
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if streams := session.ListStreams(); len(streams) != 0 {
+		t.Fatalf("Expected no streams, got %v", streams)
+	}
+
+	for _, ssrc := range []uint32{5002, 5000} {
+		if _, err = session.OpenReadStream(ssrc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	streams := session.ListStreams()
+	if len(streams) != 2 || streams[0].SSRC != 5000 || streams[1].SSRC != 5002 {
+		t.Fatalf("Unexpected streams %v", streams)
+	}
+	if streams[0].Created.Before(before) {
+		t.Errorf("Stream creation time %v is before the session was created", streams[0].Created)
+	}
+
+	readStream, err := session.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = readStream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if streams = session.ListStreams(); len(streams) != 1 || streams[0].SSRC != 5002 {
+		t.Fatalf("Unexpected streams after close %v", streams)
+	}
+
+	if err = session.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPReadStreamQueueSize(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aPipe, bPipe := net.Pipe()
+	config := buildConfigSRTP()
+	config.ReadStreamQueueSize = 2
+	aSession, err := NewSessionSRTP(aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowStream, err := bSession.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherStream, err := bSession.OpenReadStream(5001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for seq := uint16(1); seq <= 5; seq++ {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: 5000, SequenceNumber: seq}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Other streams are not held up, and once they are read the slow one
+	// has been handed all its packets
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: 5001, SequenceNumber: 1}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, otherStream, 12, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	streams := bSession.ListStreams()
+	if streams[0].Packets != 5 || streams[0].Dropped != 3 {
+		t.Fatalf("Expected 3 of 5 packets dropped, got %d of %d", streams[0].Dropped, streams[0].Packets)
+	}
+	for expected := uint16(1); expected <= 2; expected++ {
+		if seq, rerr := assertPayloadSRTP(t, slowStream, 12, testPayload); rerr != nil {
+			t.Fatal(rerr)
+		} else if seq != expected {
+			t.Fatalf("Expected sequence number %d, got %d", expected, seq)
+		}
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPReadStreamStats(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	config := buildConfigSRTP()
+	aPipe, bPipe := net.Pipe()
+	bSession, err := NewSessionSRTP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptContext, err := CreateContext(config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt, config.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets [][]byte
+	for seq := uint16(1); seq <= 4; seq++ {
+		encrypted, eerr := encryptSRTP(encryptContext, &rtp.Packet{
+			Header:  rtp.Header{Version: 2, SSRC: testSSRC, SequenceNumber: seq},
+			Payload: testPayload,
+		})
+		if eerr != nil {
+			t.Fatal(eerr)
+		}
+		packets = append(packets, encrypted)
+	}
+	packets[2][len(packets[2])-1] ^= 0xFF
+
+	// The second packet is replayed, the third fails authentication
+	for _, packet := range [][]byte{packets[0], packets[1], packets[1], packets[2], packets[3]} {
+		if _, err = aPipe.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := bReadStream.Stats()
+	if stats.Packets != 3 || stats.Bytes != uint64(3*len(packets[0])) || stats.LastPacket.IsZero() {
+		t.Fatalf("Unexpected delivery counters %+v", stats)
+	}
+	if stats.Crypto.Unprotected != 3 || stats.Crypto.ReplayDrops != 1 || stats.Crypto.AuthFailures != 1 {
+		t.Fatalf("Unexpected crypto counters %+v", stats.Crypto)
+	}
+	if stats.LastIndex != 4 || stats.QueueDrops != 0 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if sessionStats := bSession.Stats(); sessionStats.AuthFailures != 1 || sessionStats.ReplayDrops != 1 {
+		t.Fatalf("Unexpected session stats %+v", sessionStats)
+	}
+
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = aPipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPStats(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bSession := buildSessionSRTPPair(t)
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for seq := uint16(1); seq <= 3; seq++ {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent, received := aSession.Stats(), bSession.Stats()
+	if sent.PacketsSent != 3 || sent.PacketsReceived != 0 || sent.Streams != 0 {
+		t.Fatalf("Unexpected sender stats %+v", sent)
+	}
+	if received.PacketsReceived != 3 || received.BytesReceived != sent.BytesSent || received.Streams != 1 {
+		t.Fatalf("Unexpected receiver stats %+v", received)
+	}
+	if received.AuthFailures != 0 || received.ReplayDrops != 0 || received.DecryptErrors != 0 || received.QueueDrops != 0 {
+		t.Fatalf("Unexpected drops %+v", received)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPListStreamsIndex(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	aSession, bSession := buildSessionSRTPPair(t)
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if streams := bSession.ListStreams(); len(streams) != 1 || streams[0].ROC != 0 || streams[0].LastIndex != 0 {
+		t.Fatalf("Unexpected streams before the first packet %v", streams)
+	}
+
+	for _, seq := range []uint16{65535, 1} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, rtpTestCaseDecrypted()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, rtpTestCaseDecrypted()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if streams := bSession.ListStreams(); len(streams) != 1 || streams[0].ROC != 1 || streams[0].LastIndex != 1<<16|1 {
+		t.Fatalf("Unexpected streams after the rollover %v", streams)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPStart(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+	aSession, bPipe, config := buildSessionSRTP(t)
+
+	bSession, err := NewSessionSRTP(bPipe, &Config{Profile: config.Profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Streams can be opened before keys are known
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bSession.Start(config.Keys); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Start(config.Keys); !errors.Is(err, errSessionAlreadyStarted) {
+		t.Fatalf("Start must fail on a started session, got %v", err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, append([]byte{}, testPayload...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPSetRemoteKeys(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+	aSession, bPipe, config := buildSessionSRTP(t)
+
+	bSession, err := NewSessionSRTP(bPipe, &Config{
+		Profile: config.Profile,
+		Keys: SessionKeys{
+			LocalMasterKey:  config.Keys.LocalMasterKey,
+			LocalMasterSalt: config.Keys.LocalMasterSalt,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sending works before the remote keys are known
+	aReadStream, err := aSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bWriteStream, err := bSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, aReadStream, rtpHeaderSize, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	// Packets received until then are queued
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.SetRemoteKeys(config.Keys.RemoteMasterKey, config.Keys.RemoteMasterSalt); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.SetRemoteKeys(config.Keys.RemoteMasterKey, config.Keys.RemoteMasterSalt); !errors.Is(err, errRemoteKeysInstalled) {
+		t.Fatalf("Expected %v, got %v", errRemoteKeysInstalled, err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPCloseBeforeStart(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	session, err := NewSessionSRTP(newNoopConn(), &Config{Profile: ProtectionProfileAes128CmHmacSha1_80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeStream, err := session.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeErr := make(chan error)
+	go func() {
+		_, werr := writeStream.WriteRTP(&rtp.Header{}, []byte{})
+		writeErr <- werr
+	}()
+
+	if err = session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-writeErr; !errors.Is(err, errSessionNotStarted) {
+		t.Errorf("Write pending on an unstarted session must fail on close, got %v", err)
+	}
+	if _, _, err = session.AcceptStream(); !errors.Is(err, errStreamAlreadyClosed) {
+		t.Errorf("AcceptStream must fail on a closed session, got %v", err)
+	}
+}
+
+func TestSessionSRTPEarlyPackets(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+	aSession, bPipe, config := buildSessionSRTP(t)
+
+	bSession, err := NewSessionSRTP(bPipe, &Config{Profile: config.Profile, EarlyPacketQueueSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The third packet exceeds the queue and is dropped
+	for seq := uint16(1); seq <= 3; seq++ {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, append([]byte{}, testPayload...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once this is read the third packet has been handled. It never
+	// authenticates, so whether it is dropped or decrypted does not matter.
+	garbage, err := (&rtp.Packet{Header: rtp.Header{SSRC: testSSRC, SequenceNumber: 4}, Payload: make([]byte, 20)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aSession.session.nextConn.Write(garbage); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bSession.Start(config.Keys); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 5}, append([]byte{}, testPayload...)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []uint16{1, 2, 5} {
+		seq, perr := assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload)
+		if perr != nil {
+			t.Fatal(perr)
+		} else if seq != expected {
+			t.Errorf("Expected sequence number %d, got %d", expected, seq)
+		}
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPPauseWrites(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+	aSession, bPipe, config := buildSessionSRTP(t)
+	aSession.session.pausedWriteQueueSize = 2
+
+	bSession, err := NewSessionSRTP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aSession.PauseWrites()
+	for seq := uint16(1); seq <= 2; seq++ {
+		if n, werr := aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, testPayload); werr != nil {
+			t.Fatal(werr)
+		} else if n != 0 {
+			t.Fatalf("Paused write must not report bytes written, got %d", n)
+		}
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 3}, testPayload); !errors.Is(err, errPausedWriteQueueFull) {
+		t.Fatalf("Write beyond the queue must fail with %v, got %v", errPausedWriteQueueFull, err)
+	}
+
+	resumeErr := make(chan error)
+	go func() {
+		resumeErr <- aSession.ResumeWrites()
+	}()
+
+	for _, expected := range []uint16{1, 2} {
+		seq, perr := assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload)
+		if perr != nil {
+			t.Fatal(perr)
+		} else if seq != expected {
+			t.Errorf("Expected sequence number %d, got %d", expected, seq)
+		}
+	}
+	if err = <-resumeErr; err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPCloseWithTimeout(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, _ := buildSessionSRTP(t)
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody reads the pipe, the queued packet is dropped once timeout elapsed
+	aSession.PauseWrites()
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	var netErr net.Error
+	if err = aSession.CloseWithTimeout(50 * time.Millisecond); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); err == nil {
+		t.Fatal("Expected writes to fail once closed")
+	}
+
+	if err = bPipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPWriteRawRTP(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bSession := buildSessionSRTPPair(t)
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := (&rtp.Header{Version: 2, SSRC: testSSRC, SequenceNumber: 7}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRawRTP(header[:rtpHeaderSize-1], testPayload); !errors.Is(err, errTooShortRTPHeader) {
+		t.Fatalf("Truncated header must fail with %v, got %v", errTooShortRTPHeader, err)
+	}
+	if _, err = aWriteStream.WriteRawRTP(header, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	seq, err := assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload)
+	if err != nil {
+		t.Fatal(err)
+	} else if seq != 7 {
+		t.Errorf("Expected sequence number 7, got %d", seq)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPPauseReads(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bSession := buildSessionSRTPPair(t)
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A read already in progress may still deliver one packet, the second must wait
+	bSession.PauseReads()
+	writeErr := make(chan error)
+	go func() {
+		for seq := uint16(1); seq <= 2; seq++ {
+			if _, werr := aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, testPayload); werr != nil {
+				writeErr <- werr
+				return
+			}
+		}
+		writeErr <- nil
+	}()
+
+	// net.Pipe writes block until the other end reads
+	select {
+	case <-writeErr:
+		t.Fatal("Packets were read while reads are paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	bSession.ResumeReads()
+	for _, expected := range []uint16{1, 2} {
+		seq, perr := assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload)
+		if perr != nil {
+			t.Fatal(perr)
+		} else if seq != expected {
+			t.Errorf("Expected sequence number %d, got %d", expected, seq)
+		}
+	}
+	if err = <-writeErr; err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing a paused session must not hang
+	bSession.PauseReads()
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPRetransmit(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, _ := buildSessionSRTP(t)
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.Retransmit(testSSRC, 1); !errors.Is(err, errNoRetransmitCache) {
+		t.Fatalf("Retransmit without cache must fail with %v, got %v", errNoRetransmitCache, err)
+	}
+	aSession.retransmitCache = newRetransmitCache(2)
+
+	writeErr := make(chan error)
+	go func() {
+		for seq := uint16(1); seq <= 3; seq++ {
+			if _, werr := aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, testPayload); werr != nil {
+				writeErr <- werr
+				return
+			}
+		}
+		_, werr := aWriteStream.Retransmit(testSSRC, 2)
+		writeErr <- werr
+	}()
+
+	var written [][]byte
+	for i := 0; i < 4; i++ {
+		b := make([]byte, 1500)
+		n, rerr := bPipe.Read(b)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		written = append(written, b[:n])
+	}
+	if err = <-writeErr; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written[1], written[3]) {
+		t.Fatal("Retransmitted packet must be the original ciphertext")
+	}
+
+	// Sequence number 1 shares its slot with 3
+	if _, err = aWriteStream.Retransmit(testSSRC, 1); !errors.Is(err, errNotInRetransmitCache) {
+		t.Fatalf("Evicted packet must fail with %v, got %v", errNotInRetransmitCache, err)
+	}
+	if _, err = aWriteStream.Retransmit(testSSRC+1, 2); !errors.Is(err, errNotInRetransmitCache) {
+		t.Fatalf("Unknown SSRC must fail with %v, got %v", errNotInRetransmitCache, err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bPipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPAcceptDeadline(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	if err := bSession.SetAcceptDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bSession.AcceptStream(); !errIsTimeout(err) || !errors.Is(err, errAcceptDeadlineExceeded) {
+		t.Fatalf("AcceptStream must time out, got %v", err)
+	}
+
+	// Clearing the deadline lets AcceptStream wait for the next stream
+	if err := bSession.SetAcceptDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = aWriteStream.WriteRTP(&rtp.Header{SSRC: 5000}, []byte{0x00})
+	}()
+	if _, ssrc, err := bSession.AcceptStream(); err != nil {
+		t.Fatal(err)
+	} else if ssrc != 5000 {
+		t.Fatalf("Unexpected SSRC %d", ssrc)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPOnNewStream(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	newStreams := make(chan *ReadStreamSRTP, 4)
+	bConfig := *config
+	bConfig.OnNewStream = func(stream *ReadStreamSRTP, ssrc uint32) {
+		if stream.GetSSRC() != ssrc {
+			t.Errorf("Stream of %d reported for %d", stream.GetSSRC(), ssrc)
+		}
+		newStreams <- stream
+	}
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ssrc := range []uint32{5000, 5000, 5001} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: uint16(i + 1)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []struct {
+		ssrc    uint32
+		packets int
+	}{{5000, 2}, {5001, 1}} {
+		stream := <-newStreams
+		if stream.GetSSRC() != expected.ssrc {
+			t.Fatalf("Expected a stream for %d, got %d", expected.ssrc, stream.GetSSRC())
+		}
+		for i := 0; i < expected.packets; i++ {
+			if _, err = assertPayloadSRTP(t, stream, 12, testPayload); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(newStreams) != 0 {
+		t.Fatalf("Expected a callback per SSRC, got %d more", len(newStreams))
+	} else if pending := bSession.PendingStreams(); len(pending) != 0 {
+		t.Fatalf("Streams must not be queued for AcceptStream, got %v", pending)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPAcceptStreamContext(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if _, _, err := bSession.AcceptStreamContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("AcceptStreamContext must be canceled, got %v", err)
+	}
+
+	// The session is still usable
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = aWriteStream.WriteRTP(&rtp.Header{SSRC: 5000}, []byte{0x00})
+	}()
+	if _, ssrc, err := bSession.AcceptStreamContext(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if ssrc != 5000 {
+		t.Fatalf("Unexpected SSRC %d", ssrc)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPPendingStreams(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aSession, bSession := buildSessionSRTPPair(t)
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unaccepted streams no longer hold up packets of other SSRCs
+	for _, h := range []rtp.Header{{SSRC: 5000, SequenceNumber: 1}, {SSRC: 5001, SequenceNumber: 1}, {SSRC: 5000, SequenceNumber: 2}} {
+		h := h
+		if _, err = aWriteStream.WriteRTP(&h, []byte{0x00}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pending []StreamInfo
+	for {
+		pending = bSession.PendingStreams()
+		if len(pending) == 2 && pending[0].Packets == 2 && pending[1].Packets == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if pending[0].SSRC != 5000 || pending[1].SSRC != 5001 {
+		t.Fatalf("Unexpected pending streams %v", pending)
+	}
+
+	if _, err = bSession.OpenReadStream(5001); err != nil {
+		t.Fatal(err)
+	}
+	if _, ssrc, err := bSession.AcceptStream(); err != nil {
+		t.Fatal(err)
+	} else if ssrc != 5000 {
+		t.Fatalf("Unexpected SSRC %d", ssrc)
+	}
+	if pending = bSession.PendingStreams(); len(pending) != 0 {
+		t.Fatalf("Unexpected pending streams %v", pending)
+	}
+	if streams := bSession.ListStreams(); len(streams) != 2 {
+		t.Fatalf("Unexpected streams %v", streams)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPDetachReadStream(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	oldSession, oldPipe, config := buildSessionSRTP(t)
+	newConn, newPipe := net.Pipe()
+	newSession, err := NewSessionSRTP(newConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptContext, err := CreateContext(config.Keys.LocalMasterKey, config.Keys.LocalMasterSalt, config.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePacket := func(conn net.Conn, seq uint16) {
+		encrypted, eerr := encryptSRTP(encryptContext, &rtp.Packet{Header: rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, Payload: testPayload})
+		if eerr != nil {
+			t.Fatal(eerr)
+		}
+		if _, eerr = conn.Write(encrypted); eerr != nil {
+			t.Fatal(eerr)
+		}
+	}
+
+	readStream, err := oldSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = newSession.AttachReadStream(readStream); !errors.Is(err, errStreamNotDetached) {
+		t.Fatalf("Attaching an attached stream must fail with %v, got %v", errStreamNotDetached, err)
+	}
+
+	writePacket(oldPipe, 65534)
+	writePacket(oldPipe, 65535)
+	// Once this is read the previous packet has been delivered
+	if _, err = oldPipe.Write([]byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = readStream.Detach(); err != nil {
+		t.Fatal(err)
+	}
+	if streams := oldSession.ListStreams(); len(streams) != 0 {
+		t.Fatalf("Detached stream still listed %v", streams)
+	}
+	if err = newSession.AttachReadStream(readStream); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sequence number wraps on the new conn, the rollover state followed the stream
+	writePacket(newPipe, 0)
+	for _, expected := range []uint16{65534, 65535, 0} {
+		seq, perr := assertPayloadSRTP(t, readStream, rtpHeaderSize, testPayload)
+		if perr != nil {
+			t.Fatal(perr)
+		} else if seq != expected {
+			t.Errorf("Expected sequence number %d, got %d", expected, seq)
+		}
+	}
+
+	for _, c := range []io.Closer{oldSession, newSession, oldPipe, newPipe} {
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionSRTPRemoteAddr(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	aConn, bConn, cConn := listen(), listen(), listen()
+
+	pipeSession, pipe, config := buildSessionSRTP(t)
+	if err := pipeSession.SetRemoteAddr(cConn.LocalAddr()); !errors.Is(err, errNoRemoteAddr) {
+		t.Fatalf("Expected %v, got %v", errNoRemoteAddr, err)
+	}
+	for _, c := range []io.Closer{pipeSession, pipe} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aConfig, bConfig := *config, *config
+	aConfig.RemoteAddr, bConfig.RemoteAddr = bConn.LocalAddr(), aConn.LocalAddr()
+
+	if _, err := NewSessionSRTP(newNoopConn(), &aConfig); !errors.Is(err, errNotPacketConn) {
+		t.Fatalf("Expected %v, got %v", errNotPacketConn, err)
+	}
+	aSession, err := NewSessionSRTP(aConn, &aConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bConn, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	// Packets follow the updated remote address
+	if err = aSession.SetRemoteAddr(cConn.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 1}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if err = cConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cConn.Read(make([]byte, 1500)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []io.Closer{aSession, bSession, cConn} {
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionSRTPAcceptSource(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	aConn, bConn, cConn := listen(), listen(), listen()
+
+	config := buildConfigSRTP()
+	config.AcceptSource = func(net.Addr) bool { return true }
+	if _, err := NewSessionSRTP(newNoopConn(), config); !errors.Is(err, errNoRemoteAddr) {
+		t.Fatalf("Expected %v, got %v", errNoRemoteAddr, err)
+	}
+
+	// b only accepts packets from a, c sends with the same keys
+	aConfig, bConfig, cConfig := *config, *config, *config
+	aConfig.RemoteAddr, cConfig.RemoteAddr = bConn.LocalAddr(), bConn.LocalAddr()
+	bConfig.RemoteAddr = aConn.LocalAddr()
+	bConfig.AcceptSource = func(addr net.Addr) bool {
+		return addr.String() == aConn.LocalAddr().String()
+	}
+
+	aSession, err := NewSessionSRTP(aConn, &aConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bConn, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cSession, err := NewSessionSRTP(cConn, &cConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, session := range []*SessionSRTP{cSession, aSession} {
+		writeStream, openErr := session.OpenWriteStream()
+		if openErr != nil {
+			t.Fatal(openErr)
+		}
+		if _, err = writeStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: uint16(i)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seq, err := assertPayloadSRTP(t, bReadStream, 12, testPayload)
+	if err != nil {
+		t.Fatal(err)
+	} else if seq != 1 {
+		t.Fatalf("Read packet %d, expected the one from the accepted source", seq)
+	}
+
+	for _, c := range []io.Closer{aSession, bSession, cSession} {
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionSRTPRemoteAddrChange(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	aConn, bConn, cConn := listen(), listen(), listen()
+
+	// a roams to c, which sends with the same keys
+	changes := make(chan net.Addr, 1)
+	config := buildConfigSRTP()
+	aConfig, bConfig := *config, *config
+	aConfig.RemoteAddr, bConfig.RemoteAddr = bConn.LocalAddr(), aConn.LocalAddr()
+	bConfig.OnRemoteAddrChange = func(ssrc uint32, addr net.Addr) {
+		if ssrc != testSSRC {
+			t.Errorf("Remote address of unexpected ssrc %d changed", ssrc)
+		}
+		changes <- addr
+	}
+	bConfig.FollowRemoteAddr = true
+
+	aSession, err := NewSessionSRTP(aConn, &aConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bConn, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cSession, err := NewSessionSRTP(cConn, &aConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, session := range []*SessionSRTP{aSession, cSession} {
+		writeStream, openErr := session.OpenWriteStream()
+		if openErr != nil {
+			t.Fatal(openErr)
+		}
+		if _, err = writeStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: uint16(i)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if addr := <-changes; addr.String() != cConn.LocalAddr().String() {
+		t.Fatalf("Remote address changed to %s, expected %s", addr, cConn.LocalAddr())
+	} else if addr = bSession.session.conn().RemoteAddr(); addr.String() != cConn.LocalAddr().String() {
+		t.Fatalf("Writing to %s, expected %s", addr, cConn.LocalAddr())
+	}
+
+	for _, c := range []io.Closer{aSession, bSession, cSession} {
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionSRTPSetTransport(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 1}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	aPipe, bPipe := net.Pipe()
+	if err = aSession.SetTransport(aPipe); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.SetTransport(bPipe); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay state carries over, the replayed packet is dropped
+	for _, seq := range []uint16{1, 2} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq, err := assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload)
+	if err != nil {
+		t.Fatal(err)
+	} else if seq != 2 {
+		t.Fatalf("Expected sequence number 2, got %d", seq)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = aSession.SetTransport(newNoopConn()); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("Expected %v, got %v", ErrSessionClosed, err)
+	}
+}
+
+func TestSessionSRTPMultipath(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	a1, b1 := net.Pipe()
+	a2, b2 := net.Pipe()
+	aConn, err := NewMultipathConn(PathDuplicate(), a1, a2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bConn, err := NewMultipathConn(nil, b1, b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aSession, err := NewSessionSRTP(aConn, buildConfigSRTP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bConn, buildConfigSRTP())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []uint16{1, 2} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: seq}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The copy received on the second path is dropped as a replay
+	for _, expected := range []uint16{1, 2} {
+		seq, rerr := assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload)
+		if rerr != nil {
+			t.Fatal(rerr)
+		} else if seq != expected {
+			t.Fatalf("Expected sequence number %d, got %d", expected, seq)
+		}
+	}
+	if err = bReadStream.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	var netErr net.Error
+	if _, err = bReadStream.Read(make([]byte, 1500)); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected no duplicate, got %v", err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPathScheduler(t *testing.T) {
+	roundRobin := PathRoundRobin()
+	for _, tc := range []struct {
+		name      string
+		scheduler PathScheduler
+		order     []int
+		copies    int
+	}{
+		{"Duplicate", PathDuplicate(), []int{0, 1, 2}, 3},
+		{"RoundRobin", roundRobin, []int{0, 1, 2}, 1},
+		{"RoundRobinNext", roundRobin, []int{1, 2, 0}, 1},
+		{"PrimaryBackup", PathPrimaryBackup(), []int{0, 1, 2}, 1},
+	} {
+		order, copies := tc.scheduler.Schedule(3)
+		if !reflect.DeepEqual(order, tc.order) || copies != tc.copies {
+			t.Errorf("%s: expected %v %d, got %v %d", tc.name, tc.order, tc.copies, order, copies)
+		}
+	}
+}
+
+func TestSessionSRTPReadBatch(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		testSSRC      = 5000
+		rtpHeaderSize = 12
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	aConn, bConn := listen(), listen()
+
+	aConfig, bConfig := buildConfigSRTP(), buildConfigSRTP()
+	aConfig.RemoteAddr, bConfig.RemoteAddr = bConn.LocalAddr(), aConn.LocalAddr()
+	bConfig.ReadBatchSize = 2
+
+	aSession, err := NewSessionSRTP(aConn, aConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bConn, bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// More packets than fit a batch
+	for i := 0; i < 5; i++ {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: uint16(i)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		seq, rerr := assertPayloadSRTP(t, bReadStream, rtpHeaderSize, testPayload)
+		if rerr != nil {
+			t.Fatal(rerr)
+		} else if seq != uint16(i) {
+			t.Fatalf("Expected sequence number %d, got %d", i, seq)
+		}
+	}
+
+	for _, c := range []io.Closer{aSession, bSession} {
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionSRTPTransform(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bSession := buildSessionSRTPPair(t)
+	aSession.transform = func(p *rtp.Packet) {
+		p.Timestamp += 1000
+		if err := p.SetExtension(3, []byte{0xAA, 0xBB, 0xCC}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := &rtp.Header{SSRC: testSSRC, Timestamp: 10}
+	if _, err = aWriteStream.WriteRTP(header, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if header.Timestamp != 10 || header.Extension {
+		t.Fatal("Transform must not modify the caller's header")
+	}
+
+	b := make([]byte, 1500)
+	_, readHeader, err := bReadStream.ReadRTP(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readHeader.Timestamp != 1010 {
+		t.Fatalf("Expected timestamp 1010, got %d", readHeader.Timestamp)
+	}
+	if ext := readHeader.GetExtension(3); !bytes.Equal(ext, []byte{0xAA, 0xBB, 0xCC}) {
+		t.Fatalf("Expected transformed extension, got %v", ext)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPReadRTPPacket(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		header := &rtp.Header{Version: 2, SSRC: testSSRC, SequenceNumber: uint16(i)}
+		if err = header.SetExtension(1, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = aWriteStream.WriteRTP(header, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := make([]byte, 1500)
+	packet, err := bReadStream.ReadRTPPacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.SequenceNumber != 1 || !bytes.Equal(packet.Payload, testPayload) {
+		t.Fatalf("Unexpected packet %v", packet)
+	}
+
+	// A packet too large for the buffer is consumed with its header
+	if _, err = bReadStream.Read(make([]byte, 4)); !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("Expected io.ErrShortBuffer, got %v", err)
+	}
+
+	packet, err = bReadStream.ReadRTPPacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.SequenceNumber != 3 || !bytes.Equal(packet.Payload, testPayload) {
+		t.Fatalf("Unexpected packet %v", packet)
+	}
+	if ext := packet.GetExtension(1); !bytes.Equal(ext, []byte{3}) {
+		t.Fatalf("Expected extension of the third packet, got %v", ext)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPRekey(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 1}, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+
+	bReadStream, _, err := bSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, 12, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = aSession.Rekey(SessionKeys{}); !errors.Is(err, errShortSrtpMasterKey) {
+		t.Fatalf("Expected %v, got %v", errShortSrtpMasterKey, err)
+	}
+	if err = aSession.Rekey(keys); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Rekey(SessionKeys{keys.RemoteMasterKey, keys.RemoteMasterSalt, keys.LocalMasterKey, keys.LocalMasterSalt}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream carries on under the new keys
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 2}, []byte{0x02}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, 12, []byte{0x02}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPStreamKeys(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const streamSSRC, sessionSSRC = 5000, 5001
+
+	streamKeys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the sender of streamSSRC has its own key
+	aPipe, bPipe := net.Pipe()
+	config := &Config{
+		Profile: ProtectionProfileAes128CmHmacSha1_80,
+		Keys: SessionKeys{
+			[]byte{0xE1, 0xF9, 0x7A, 0x0D, 0x3E, 0x01, 0x8B, 0xE0, 0xD6, 0x4F, 0xA3, 0x2C, 0x06, 0xDE, 0x41, 0x39},
+			[]byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6},
+			[]byte{0xE1, 0xF9, 0x7A, 0x0D, 0x3E, 0x01, 0x8B, 0xE0, 0xD6, 0x4F, 0xA3, 0x2C, 0x06, 0xDE, 0x41, 0x39},
+			[]byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6},
+		},
+	}
+	aConfig, bConfig := *config, *config
+	aConfig.StreamKeys = map[uint32]SessionKeys{
+		streamSSRC: {LocalMasterKey: streamKeys.LocalMasterKey, LocalMasterSalt: streamKeys.LocalMasterSalt},
+	}
+	bConfig.StreamKeys = map[uint32]SessionKeys{
+		streamSSRC: {RemoteMasterKey: streamKeys.LocalMasterKey, RemoteMasterSalt: streamKeys.LocalMasterSalt},
+	}
+
+	aSession, err := NewSessionSRTP(aPipe, &aConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ssrc := range []uint32{streamSSRC, sessionSSRC} {
+		bReadStream, err := bSession.OpenReadStream(ssrc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: 1}, []byte{byte(ssrc)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, []byte{byte(ssrc)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Invalid stream keys fail the session creation
+	cPipe, _ := net.Pipe()
+	cConfig := *config
+	cConfig.StreamKeys = map[uint32]SessionKeys{streamSSRC: {RemoteMasterKey: []byte{0x01}, RemoteMasterSalt: []byte{0x01}}}
+	if _, err = NewSessionSRTP(cPipe, &cConfig); !errors.Is(err, errShortSrtpMasterKey) {
+		t.Fatalf("Expected %v, got %v", errShortSrtpMasterKey, err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type mockKeyingMaterialProvider struct {
+	keys    map[uint32]SessionKeys
+	release chan struct{}
+}
+
+func (m *mockKeyingMaterialProvider) StreamKeys(ctx context.Context, ssrc uint32) (SessionKeys, error) {
+	keys, ok := m.keys[ssrc]
+	if !ok {
+		<-ctx.Done()
+		return SessionKeys{}, ctx.Err()
+	}
+	select {
+	case <-m.release:
+		return keys, nil
+	case <-ctx.Done():
+		return SessionKeys{}, ctx.Err()
+	}
+}
+
+func TestSessionSRTPKeyingMaterialProvider(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const fetchedSSRC, unknownSSRC = 5000, 5001
+
+	streamKeys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &mockKeyingMaterialProvider{
+		keys: map[uint32]SessionKeys{
+			fetchedSSRC: {RemoteMasterKey: streamKeys.LocalMasterKey, RemoteMasterSalt: streamKeys.LocalMasterSalt},
+		},
+		release: make(chan struct{}),
+	}
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	if err = aSession.SetStreamKeys(fetchedSSRC, SessionKeys{LocalMasterKey: streamKeys.LocalMasterKey, LocalMasterSalt: streamKeys.LocalMasterSalt}); err != nil {
+		t.Fatal(err)
+	}
+	bConfig := *config
+	bConfig.KeyingMaterialProvider = provider
+	bConfig.KeyingMaterialTimeout = 100 * time.Millisecond
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Packets wait for the keys of their SSRC
+	for seq := uint16(1); seq <= 2; seq++ {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: fetchedSSRC, SequenceNumber: seq}, []byte{byte(seq)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(provider.release)
+
+	bReadStream, _, err := bSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	} else if bReadStream.GetSSRC() != fetchedSSRC {
+		t.Fatalf("Expected SSRC %d, got %d", fetchedSSRC, bReadStream.GetSSRC())
+	}
+	for seq := uint16(1); seq <= 2; seq++ {
+		if _, err = assertPayloadSRTP(t, bReadStream, 12, []byte{byte(seq)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without keys in time the session-wide ones are used
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: unknownSSRC, SequenceNumber: 1}, []byte{0x03}); err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, _, err = bSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, 12, []byte{0x03}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPKeyingMaterialProviderLimits(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	// The provider knows no SSRC, every fetch times out
+	provider := &mockKeyingMaterialProvider{release: make(chan struct{})}
+	aSession, bPipe, config := buildSessionSRTP(t)
+	bConfig := *config
+	bConfig.KeyingMaterialProvider = provider
+	bConfig.KeyingMaterialTimeout = 200 * time.Millisecond
+	bConfig.AcceptedSSRCs = []uint32{1, 2, 3, 4}
+	bConfig.MaxSSRCStates = 2
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are not fetched for refused SSRCs, nor beyond MaxSSRCStates
+	for _, ssrc := range []uint32{1, 2, 3, 4, 5} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: 1}, []byte{0x01}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for stats := bSession.Stats(); stats.StreamsLimited != 2 || stats.Rejected != 1; stats = bSession.Stats() {
+		time.Sleep(time.Millisecond)
+	}
+	fetches := func() int {
+		bSession.session.decryptMutex.Lock()
+		defer bSession.session.decryptMutex.Unlock()
+		return len(bSession.keyFetches)
+	}
+	if n := fetches(); n != 2 {
+		t.Fatalf("Expected 2 keys to be fetched, got %d", n)
+	}
+
+	// The packets of a removed SSRC are dropped, those of the other one use
+	// the session keys once the fetch times out
+	if err = bSession.RemoveStream(1); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches(); n != 1 {
+		t.Fatalf("Expected 1 key to be fetched, got %d", n)
+	}
+	_, ssrc, err := bSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	} else if ssrc != 2 {
+		t.Fatalf("Expected stream 2, got %d", ssrc)
+	}
+	if n := fetches(); n != 0 {
+		t.Fatalf("Expected no key to be fetched, got %d", n)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPCloseWipesKeys(t *testing.T) {
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	if err := aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []*Context{aSession.localContext, aSession.remoteContext} {
+		if !c.wiped || c.cipher != nil {
+			t.Fatal("Expected the keys to be wiped on Close")
+		}
+	}
+	if aSession.localMasterKey != nil {
+		t.Fatal("Expected the master key to be dropped on Close")
+	}
+}
+
+func TestSessionSRTPSetROC(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC, testROC = 5000, 5
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	encryptContext, err := CreateContext(config.Keys.RemoteMasterKey, config.Keys.RemoteMasterSalt, config.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptContext.SetROC(testSSRC, testROC)
+
+	readStream, err := aSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readStream.ROC(); ok {
+		t.Fatal("Expected the ROC to be unknown before any packet")
+	}
+
+	// The stream is joined late, its ROC is learned out of band
+	if err = readStream.SetROC(testROC); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptSRTP(encryptContext, &rtp.Packet{Header: rtp.Header{SSRC: testSSRC, SequenceNumber: 100}, Payload: []byte{0x01}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bPipe.Write(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, readStream, 12, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	if roc, ok := readStream.ROC(); !ok || roc != testROC {
+		t.Fatalf("Expected ROC %d, got %d", testROC, roc)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bPipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPIgnoreSSRC(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bSession := buildSessionSRTPPair(t)
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accept := func(seq uint16, ssrcs ...uint32) uint32 {
+		t.Helper()
+		for _, ssrc := range ssrcs {
+			if _, werr := aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: seq}, testPayload); werr != nil {
+				t.Fatal(werr)
+			}
+		}
+		_, ssrc, aerr := bSession.AcceptStream()
+		if aerr != nil {
+			t.Fatal(aerr)
+		}
+		return ssrc
+	}
+
+	if ssrc := accept(1, 5000); ssrc != 5000 {
+		t.Fatalf("Expected stream 5000, got %d", ssrc)
+	}
+	if err = bSession.IgnoreSSRC(5000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bSession.OpenReadStream(5000); !errors.Is(err, errSSRCIgnored) {
+		t.Fatalf("Expected errSSRCIgnored, got %v", err)
+	}
+
+	// The ignored SSRC is not announced again, unlike a closed one
+	if ssrc := accept(2, 5000, 5001); ssrc != 5001 {
+		t.Fatalf("Expected stream 5001, got %d", ssrc)
+	}
+	readStream, err := bSession.OpenReadStream(5001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = readStream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ssrc := accept(3, 5000, 5001); ssrc != 5001 {
+		t.Fatalf("Expected stream 5001 again, got %d", ssrc)
+	}
+
+	// Packets of the ignored SSRC are dropped before being decrypted
+	if _, tracked := bSession.remoteSSRCStates()[5000]; tracked {
+		t.Fatal("Expected no remote state for the ignored SSRC")
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPAcceptedSSRCs(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	bConfig := *config
+	bConfig.AcceptedSSRCs = []uint32{5000}
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = bSession.OpenReadStream(5001); !errors.Is(err, errSSRCNotAccepted) {
+		t.Fatalf("Expected errSSRCNotAccepted, got %v", err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ssrc := range []uint32{5001, 5002, 5000} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: uint16(i + 1)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ssrc, aerr := bSession.AcceptStream(); aerr != nil {
+		t.Fatal(aerr)
+	} else if ssrc != 5000 {
+		t.Fatalf("Expected stream 5000, got %d", ssrc)
+	}
+	if stats := bSession.Stats(); stats.Rejected != 2 || stats.Streams != 1 {
+		t.Fatalf("Expected 2 rejected packets and a single stream, got %+v", stats)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPOpenedStreamsOnly(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const rtpHeaderSize = 12
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	bConfig := *config
+	bConfig.OpenedStreamsOnly = true
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readStream, err := bSession.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ssrc := range []uint32{5001, 5002, 5000} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: uint16(i + 1)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Packets are handled in order, the others were dropped before this one
+	if _, err = assertPayloadSRTP(t, readStream, rtpHeaderSize, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if stats := bSession.Stats(); stats.Rejected != 2 || stats.Streams != 1 {
+		t.Fatalf("Expected 2 rejected packets and a single stream, got %+v", stats)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPStreamFilter(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	// The sender is only known to signaling after its first packet
+	var mu sync.Mutex
+	var known bool
+	asked := make(chan uint16, 4)
+	aSession, bPipe, config := buildSessionSRTP(t)
+	bConfig := *config
+	bConfig.StreamFilter = func(ssrc uint32, firstHeader *rtp.Header) bool {
+		asked <- firstHeader.SequenceNumber
+		mu.Lock()
+		defer mu.Unlock()
+		return known && ssrc == 5000
+	}
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(seq uint16) {
+		t.Helper()
+		if _, werr := aWriteStream.WriteRTP(&rtp.Header{SSRC: 5000, SequenceNumber: seq}, testPayload); werr != nil {
+			t.Fatal(werr)
+		}
+	}
+	write(1)
+	if seq := <-asked; seq != 1 {
+		t.Fatalf("Expected the filter to be asked for packet 1, got %d", seq)
+	}
+	mu.Lock()
+	known = true
+	mu.Unlock()
+	write(2)
+	write(3)
+
+	readStream, ssrc, err := bSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	} else if ssrc != 5000 {
+		t.Fatalf("Expected stream 5000, got %d", ssrc)
+	}
+	for expected := uint16(2); expected <= 3; expected++ {
+		if seq, rerr := assertPayloadSRTP(t, readStream, 12, testPayload); rerr != nil {
+			t.Fatal(rerr)
+		} else if seq != expected {
+			t.Fatalf("Expected sequence number %d, got %d", expected, seq)
+		}
+	}
+
+	if seq := <-asked; seq != 2 || len(asked) != 0 {
+		t.Errorf("Expected the filter to be asked for packet 2 only once more, got %d", seq)
+	}
+	if stats := bSession.Stats(); stats.Rejected != 1 {
+		t.Errorf("Expected 1 rejected packet, got %d", stats.Rejected)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPMaxNewStreamsPerSecond(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const rtpHeaderSize = 12
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	bConfig := *config
+	bConfig.MaxNewStreamsPerSecond = 1
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second SSRC exceeds the limit, the packets of the first still flow
+	for i, ssrc := range []uint32{5000, 5001, 5000} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: uint16(i)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readStream, ssrc, err := bSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	} else if ssrc != 5000 {
+		t.Fatalf("Expected stream of SSRC 5000, got %d", ssrc)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = assertPayloadSRTP(t, readStream, rtpHeaderSize, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := bSession.Stats(); stats.StreamsLimited != 1 || stats.Streams != 1 {
+		t.Fatalf("Expected one stream and one limited packet, got %+v", stats)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	if newTokenBucket(0, 10) != nil {
+		t.Fatal("Expected no limit without a rate")
+	}
+
+	now := time.Now()
+	bucket := newTokenBucket(2, 3)
+	for i := 0; i < 3; i++ {
+		if !bucket.take(now) {
+			t.Fatalf("Expected token %d of the burst", i)
+		}
+	}
+	if bucket.take(now) {
+		t.Fatal("Expected the burst to be used up")
+	}
+	if !bucket.take(now.Add(500 * time.Millisecond)) {
+		t.Fatal("Expected a token after half a second")
+	} else if bucket.take(now.Add(500 * time.Millisecond)) {
+		t.Fatal("Expected a single token after half a second")
+	}
+}
+
+func TestSessionSRTPReadQueueBudget(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		rtpHeaderSize = 12
+		ignoredSSRC   = 6000
+	)
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bPipe, config := buildSessionSRTP(t)
+	bConfig := *config
+	bConfig.ReadQueueBudget = 2*(rtpHeaderSize+len(testPayload)) + 1
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.IgnoreSSRC(ignoredSSRC); err != nil {
+		t.Fatal(err)
+	}
+
+	readStream, err := bSession.OpenReadStream(5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bSession.OpenReadStream(5001); err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Packets of the ignored SSRC use no budget, once written the packets
+	// before are handled
+	write := func(ssrc uint32, seq uint16) {
+		t.Helper()
+		for _, h := range []*rtp.Header{{SSRC: ssrc, SequenceNumber: seq}, {SSRC: ignoredSSRC, SequenceNumber: seq}} {
+			if _, werr := aWriteStream.WriteRTP(h, testPayload); werr != nil {
+				t.Fatal(werr)
+			}
+		}
+	}
+
+	// The third packet exceeds the budget shared by both streams
+	write(5000, 1)
+	write(5001, 1)
+	write(5000, 2)
+
+	// Reading frees budget for the next one
+	if seq, rerr := assertPayloadSRTP(t, readStream, rtpHeaderSize, testPayload); rerr != nil {
+		t.Fatal(rerr)
+	} else if seq != 1 {
+		t.Fatalf("Expected sequence number 1, got %d", seq)
+	}
+	write(5000, 3)
+	if seq, rerr := assertPayloadSRTP(t, readStream, rtpHeaderSize, testPayload); rerr != nil {
+		t.Fatal(rerr)
+	} else if seq != 3 {
+		t.Fatalf("Expected sequence number 3, got %d", seq)
+	}
+
+	if stats := bSession.Stats(); stats.BudgetDrops != 1 || stats.QueuedBytes != rtpHeaderSize+len(testPayload) {
+		t.Fatalf("Expected a single packet dropped and one queued, got %+v", stats)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := bSession.Stats(); stats.QueuedBytes != 0 {
+		t.Fatalf("Expected closed streams to release their budget, got %d bytes", stats.QueuedBytes)
+	}
+}
+
+func TestSessionSRTPOpenReadStreamAny(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	// Packets of SSRCs the filter refuses are not delivered either
+	aSession, bPipe, config := buildSessionSRTP(t)
+	bConfig := *config
+	bConfig.StreamFilter = func(ssrc uint32, _ *rtp.Header) bool {
+		return ssrc != 5001
+	}
+	bSession, err := NewSessionSRTP(bPipe, &bConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anyStream, err := bSession.OpenReadStreamAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ssrc := range []uint32{5000, 5001, 5002} {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: ssrc, SequenceNumber: uint16(i + 1)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readBuffer := make([]byte, 1500)
+	for _, expected := range []uint32{5000, 5002} {
+		n, ssrc, rerr := anyStream.Read(readBuffer)
+		if rerr != nil {
+			t.Fatal(rerr)
+		} else if ssrc != expected || !bytes.Equal(readBuffer[12:n], testPayload) {
+			t.Fatalf("Unexpected packet of ssrc %d: %v", ssrc, readBuffer[:n])
+		}
+	}
+	if streams := bSession.ListStreams(); len(streams) != 2 {
+		t.Fatalf("Expected the streams of 5000 and 5002, got %v", streams)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = anyStream.Read(readBuffer); !errors.Is(err, io.EOF) {
+		t.Fatalf("Expected io.EOF once the session is closed, got %v", err)
+	}
+}
+
+func TestSessionSRTPManagedWriteStream(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	const testPayloadType = 96
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	managed, err := aSession.OpenManagedWriteStream(testSSRC, testPayloadType)
+	if err != nil {
+		t.Fatal(err)
+	} else if again, _ := aSession.OpenManagedWriteStream(testSSRC, testPayloadType); again != managed {
+		t.Fatal("Expected the same stream for the same SSRC")
+	}
+
+	if _, err = managed.WritePayload(testPayload, 1000, true); err != nil {
+		t.Fatal(err)
+	}
+	// SSRC and sequence number of the header are replaced
+	if _, err = managed.WriteRTP(&rtp.Header{SSRC: 1, SequenceNumber: 1, PayloadType: testPayloadType, Timestamp: 2000}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	readStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBuffer := make([]byte, 1500)
+	var sequenceNumber uint16
+	for i, timestamp := range []uint32{1000, 2000} {
+		packet, rerr := readStream.ReadRTPPacket(readBuffer)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		switch {
+		case packet.SSRC != testSSRC || packet.PayloadType != testPayloadType || packet.Timestamp != timestamp:
+			t.Fatalf("Unexpected header %v", packet.Header)
+		case i > 0 && packet.SequenceNumber != sequenceNumber+1:
+			t.Fatalf("Expected sequence number %d, got %d", sequenceNumber+1, packet.SequenceNumber)
+		case !bytes.Equal(packet.Payload, testPayload):
+			t.Fatalf("Unexpected payload %v", packet.Payload)
+		}
+		sequenceNumber = packet.SequenceNumber
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPReadWriter(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	// Hide the net.Conn methods of the pipe, as a custom transport would
+	type readWriteCloser struct{ io.ReadWriteCloser }
+	aPipe, bPipe := net.Pipe()
+
+	aSession, err := NewSessionSRTP(readWriteCloser{aPipe}, buildConfigSRTP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(readWriteCloser{bPipe}, buildConfigSRTP())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = aWriteStream.SetWriteDeadline(time.Now()); !errors.Is(err, errConnDeadlineNotSupported) {
+		t.Fatalf("Expected errConnDeadlineNotSupported, got %v", err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	readStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, readStream, 12, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPMaxPacketSize(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := bytes.Repeat([]byte{0x01}, 20000)
+
+	config := buildConfigSRTP()
+	config.MaxPacketSize = maxPacketSize + 1
+	if _, err := NewSessionSRTP(newNoopConn(), config); !errors.Is(err, errInvalidMaxPacketSize) {
+		t.Fatalf("Expected errInvalidMaxPacketSize, got %v", err)
+	}
+
+	config.MaxPacketSize = maxPacketSize
+	aPipe, bPipe := net.Pipe()
+	aSession, err := NewSessionSRTP(aPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(bPipe, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC}, testPayload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, readStream, 12, testPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPFramedConn(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	testPayload := []byte{0x00, 0x01, 0x03, 0x04}
+
+	aPipe, bPipe := net.Pipe()
+	aSession, err := NewSessionSRTP(NewFramedConn(aPipe), buildConfigSRTP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := NewSessionSRTP(NewFramedConn(bPipe), buildConfigSRTP())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readStream, err := bSession.OpenReadStream(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: uint16(i)}, testPayload); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = assertPayloadSRTP(t, readStream, 12, testPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = aWriteStream.Write(make([]byte, maxPacketSize+1)); !errors.Is(err, errFramedPacketTooLarge) {
+		t.Fatalf("Expected errFramedPacketTooLarge, got %v", err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFramedConnRead(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	aPipe, bPipe := net.Pipe()
+	conn := NewFramedConn(bPipe)
+
+	go func() {
+		// Two coalesced frames with an empty one between, then a frame
+		// split over three writes
+		_, _ = aPipe.Write([]byte{0x00, 0x02, 0xAA, 0xBB, 0x00, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03})
+		_, _ = aPipe.Write([]byte{0x00})
+		_, _ = aPipe.Write([]byte{0x04, 0x0A, 0x0B})
+		_, _ = aPipe.Write([]byte{0x0C, 0x0D, 0x00, 0x01, 0xFF})
+		_ = aPipe.Close()
+	}()
+
+	b := make([]byte, 3)
+	for _, expected := range [][]byte{
+		{0xAA, 0xBB},
+		{0x01, 0x02, 0x03},
+		{0x0A, 0x0B, 0x0C}, // Truncated to b
+		{0xFF},
+	} {
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(b[:n], expected) {
+			t.Fatalf("Read %x, expected %x", b[:n], expected)
+		}
+	}
+	if _, err := conn.Read(b); !errors.Is(err, io.EOF) {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionSRTPRemoveStream(t *testing.T) {
+	lim := test.TimeOut(time.Second * 5)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const testSSRC = 5000
+	aSession, bSession := buildSessionSRTPPair(t)
+
+	aWriteStream, err := aSession.OpenWriteStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 1}, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	bReadStream, _, err := bSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, 12, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sender left, the receiver forgets it while the sender keeps its
+	// ROC, which must not start over under the same key
+	aSession.localContext.SetROC(testSSRC, 1)
+	if err = aSession.RemoveStream(testSSRC); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.RemoveStream(testSSRC); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bSession.remoteContext.ROC(testSSRC); ok {
+		t.Fatal("Expected the state of the SSRC to be removed")
+	}
+	if roc, ok := aSession.localContext.ROC(testSSRC); !ok || roc != 1 {
+		t.Fatalf("Expected the sending state of the SSRC to be kept, got ROC %d", roc)
+	}
+	if len(bSession.ListStreams()) != 0 {
+		t.Fatal("Expected the read stream to be closed")
+	}
+
+	// A returning sender is learned afresh
+	bSession.remoteContext.SetROC(testSSRC, 1)
+	if _, err = aWriteStream.WriteRTP(&rtp.Header{SSRC: testSSRC, SequenceNumber: 2}, []byte{0x02}); err != nil {
+		t.Fatal(err)
+	}
+	if bReadStream, _, err = bSession.AcceptStream(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = assertPayloadSRTP(t, bReadStream, 12, []byte{0x02}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = aSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bSession.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,73 @@
+package srtp
+
+// SessionStats is a snapshot of the counters of a session, see
+// SessionSRTP.Stats
+type SessionStats struct {
+	// Streams is the number of read streams
+	Streams int
+
+	// PacketsSent and BytesSent count the protected packets written to the
+	// conn, PacketsReceived and BytesReceived those read from it
+	PacketsSent, BytesSent         uint64
+	PacketsReceived, BytesReceived uint64
+
+	// AuthFailures counts the received packets failing authentication,
+	// ReplayDrops those rejected by replay protection and DecryptErrors
+	// those dropped for any other reason, such as being malformed
+	AuthFailures, ReplayDrops, DecryptErrors uint64
+	// QueueDrops counts the packets dropped by full read stream queues, see
+	// Config.ReadStreamQueueSize
+	QueueDrops uint64
+	// Rejected counts the packets of SSRCs outside of Config.AcceptedSSRCs
+	// or refused by Config.StreamFilter, SRTCP ones once per such SSRC they
+	// are for
+	Rejected uint64
+	// StreamsLimited counts the packets of SSRCs without a read stream
+	// dropped by Config.MaxNewStreamsPerSecond, or while the keys of too
+	// many SSRCs are fetched, see Config.KeyingMaterialProvider
+	StreamsLimited uint64
+
+	// QueuedBytes is the size of the packets queued in read streams and
+	// BudgetDrops the number of those QueueDrops counts because it reached
+	// Config.ReadQueueBudget. Both stay zero without a budget.
+	QueuedBytes int
+	BudgetDrops uint64
+}
+
+// sent counts a packet written to the conn
+func (s *session) sent(n int) {
+	s.trafficMu.Lock()
+	s.packetsSent++
+	s.bytesSent += uint64(n)
+	s.trafficMu.Unlock()
+}
+
+// received counts a packet read from the conn
+func (s *session) received(n int) {
+	s.trafficMu.Lock()
+	s.packetsReceived++
+	s.bytesReceived += uint64(n)
+	s.trafficMu.Unlock()
+}
+
+func (s *session) stats() SessionStats {
+	s.readStreamsLock.Lock()
+	stats := SessionStats{Streams: len(s.readStreams)}
+	s.readStreamsLock.Unlock()
+
+	s.trafficMu.Lock()
+	stats.PacketsSent, stats.BytesSent = s.packetsSent, s.bytesSent
+	stats.PacketsReceived, stats.BytesReceived = s.packetsReceived, s.bytesReceived
+	s.trafficMu.Unlock()
+
+	s.decryptMutex.Lock()
+	stats.AuthFailures, stats.ReplayDrops = s.authFailures, s.replayDrops
+	stats.DecryptErrors, stats.QueueDrops = s.decryptErrors, s.queueDrops
+	stats.Rejected, stats.StreamsLimited = s.rejected, s.streamsLimited
+	s.decryptMutex.Unlock()
+
+	if s.queueBudget != nil {
+		stats.QueuedBytes, stats.BudgetDrops = s.queueBudget.stats()
+	}
+	return stats
+}
@@ -10,30 +10,60 @@ import (
 const maxSRTCPIndex = 0x7FFFFFFF
 
 func (c *Context) decryptRTCP(dst, encrypted []byte) ([]byte, error) {
+	if c.wiped {
+		return nil, errContextWiped
+	} else if len(encrypted) < 8 {
+		return nil, fmt.Errorf("%w: %d", errTooShortRTCP, len(encrypted))
+	}
+	ssrc := binary.BigEndian.Uint32(encrypted[4:])
+	cipher, encrypted, err := c.decryptionCipher(ssrc, dst, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
 	out := allocateIfMismatch(dst, encrypted)
 	tailOffset := len(encrypted) - (c.cipher.authTagLen() + srtcpIndexSize)
 
 	if tailOffset < 0 {
 		return nil, fmt.Errorf("%w: %d", errTooShortRTCP, len(encrypted))
-	} else if isEncrypted := encrypted[tailOffset] >> 7; isEncrypted == 0 {
-		return out, nil
 	}
 
 	index := c.cipher.getRTCPIndex(encrypted)
-	ssrc := binary.BigEndian.Uint32(encrypted[4:])
 
+	_, known := c.srtcpSSRCStates[ssrc]
+	if !known && c.maxSSRCStates > 0 {
+		if err = c.admitSSRC("srtcp", ssrc, len(c.srtcpSSRCStates)); err != nil {
+			return nil, err
+		}
+	}
 	s := c.getSRTCPSSRCState(ssrc)
+
+	out, err = c.decryptRTCPWithState(s, cipher, out, encrypted, index, ssrc)
+	switch {
+	case err != nil && !known:
+		c.forgetSRTCPSSRC(ssrc)
+	case err == nil && c.maxSSRCStates > 0:
+		c.trackSRTCPSSRC(ssrc)
+	}
+	return out, err
+}
+
+func (c *Context) decryptRTCPWithState(s *srtcpSSRCState, cipher srtpCipher, out, encrypted []byte, index, ssrc uint32) ([]byte, error) {
 	markAsValid, ok := s.replayDetector.Check(uint64(index))
 	if !ok {
-		return nil, &errorDuplicated{Proto: "srtcp", SSRC: ssrc, Index: index}
+		s.stats.ReplayDrops++
+		return nil, c.duplicated(&DuplicatedError{Proto: "srtcp", SSRC: ssrc, Index: index})
 	}
 
-	out, err := c.cipher.decryptRTCP(out, encrypted, index, ssrc)
+	out, err := cipher.decryptRTCP(out, encrypted, index, ssrc)
 	if err != nil {
+		s.stats.AuthFailures++
 		return nil, err
 	}
 
 	markAsValid()
+	s.srtcpIndex = index
+	s.stats.unprotected(len(encrypted))
 	return out, nil
 }
 
@@ -51,8 +81,20 @@ func (c *Context) DecryptRTCP(dst, encrypted []byte, header *rtcp.Header) ([]byt
 }
 
 func (c *Context) encryptRTCP(dst, decrypted []byte) ([]byte, error) {
+	if c.wiped {
+		return nil, errContextWiped
+	}
+
 	ssrc := binary.BigEndian.Uint32(decrypted[4:])
-	s := c.getSRTCPSSRCState(ssrc)
+	s, err := c.srtcpStateForEncryption(ssrc)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher := c.cipherFor(ssrc)
+	if err = c.countPacket(cipher, "srtcp", ssrc); err != nil {
+		return nil, err
+	}
 
 	// We roll over early because MSB is used for marking as encrypted
 	s.srtcpIndex++
@@ -60,7 +102,19 @@ func (c *Context) encryptRTCP(dst, decrypted []byte) ([]byte, error) {
 		s.srtcpIndex = 0
 	}
 
-	return c.cipher.encryptRTCP(dst, decrypted, s.srtcpIndex, ssrc)
+	encrypted, err := cipher.encryptRTCP(dst, decrypted, s.srtcpIndex, ssrc)
+	if err != nil {
+		return nil, err
+	}
+	encrypted = c.appendMKI(encrypted)
+	s.stats.protected(len(encrypted))
+	return encrypted, nil
+}
+
+// SRTCPOverhead returns how many bytes protecting a RTCP packet adds to it,
+// the SRTCP index and MKI included.
+func (c *Context) SRTCPOverhead() int {
+	return c.cipher.authTagLen() + c.cipher.aeadAuthTagLen() + srtcpIndexSize + len(c.sendMKI)
 }
 
 // EncryptRTCP Encrypts a RTCP packet
@@ -374,6 +374,57 @@ func TestRTCPInvalidAuthTag(t *testing.T) {
 	}
 }
 
+// unencryptedSRTCP protects decrypted with the E flag clear, like senders that
+// only authenticate SRTCP
+func unencryptedSRTCP(t *testing.T, c *Context, decrypted []byte, index, ssrc uint32) []byte {
+	esrtcpWord := make([]byte, srtcpIndexSize)
+	binary.BigEndian.PutUint32(esrtcpWord, index)
+	authenticated := append(append([]byte{}, decrypted...), esrtcpWord...)
+
+	switch cipher := c.cipher.(type) {
+	case *srtpCipherAesCmHmacSha1:
+		tag, err := cipher.generateSrtcpAuthTag(authenticated)
+		assert.NoError(t, err)
+		return append(authenticated, tag...)
+	case *srtpCipherAeadAesGcm:
+		tag := cipher.srtcpCipher.Seal(nil, cipher.rtcpInitializationVector(index, ssrc), nil, authenticated)
+		return append(append(append([]byte{}, decrypted...), tag...), esrtcpWord...)
+	default:
+		t.Fatalf("Unexpected cipher %T", c.cipher)
+		return nil
+	}
+}
+
+func TestRTCPUnencrypted(t *testing.T) {
+	for caseName, testCase := range rtcpTestCasesSingle() {
+		testCase := testCase
+		t.Run(caseName, func(t *testing.T) {
+			encryptContext, err := CreateContext(testCase.masterKey, testCase.masterSalt, testCase.algo)
+			assert.NoError(t, err)
+			decryptContext, err := CreateContext(testCase.masterKey, testCase.masterSalt, testCase.algo, SRTCPReplayProtection(64))
+			assert.NoError(t, err)
+
+			for _, pkt := range testCase.packets {
+				unencrypted := unencryptedSRTCP(t, encryptContext, pkt.decrypted, pkt.index, pkt.ssrc)
+				assert.Equal(t, pkt.decrypted, unencrypted[:len(pkt.decrypted)], "payload must be sent in the clear")
+
+				decrypted, err := decryptContext.DecryptRTCP(nil, append([]byte{}, unencrypted...), nil)
+				assert.NoError(t, err)
+				assert.Equal(t, pkt.decrypted, decrypted)
+
+				_, err = decryptContext.DecryptRTCP(nil, unencrypted, nil)
+				assert.ErrorIs(t, err, ErrReplayed)
+
+				// Unencrypted packets are still authenticated
+				tampered := unencryptedSRTCP(t, encryptContext, pkt.decrypted, pkt.index+1, pkt.ssrc)
+				tampered[len(pkt.decrypted)-1] ^= 0xff
+				_, err = decryptContext.DecryptRTCP(nil, tampered, nil)
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
 func TestRTCPReplayDetectorSeparation(t *testing.T) {
 	for caseName, testCase := range rtcpTestCasesSingle() {
 		testCase := testCase
@@ -398,7 +449,7 @@ func TestRTCPReplayDetectorSeparation(t *testing.T) {
 
 			for i, pkt := range testCase.packets {
 				rtcpPacket := append([]byte{}, pkt.encrypted...)
-				if _, err = decryptContext.DecryptRTCP(nil, rtcpPacket, nil); !errors.Is(err, errDuplicated) {
+				if _, err = decryptContext.DecryptRTCP(nil, rtcpPacket, nil); !errors.Is(err, ErrReplayed) {
 					t.Error("Was able to decrypt duplicated RTCP packet", i)
 				}
 			}
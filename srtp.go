@@ -2,36 +2,97 @@
 package srtp
 
 import (
+	"fmt"
+
 	"github.com/pion/rtp/v2"
 )
 
 func (c *Context) decryptRTP(dst, ciphertext []byte, header *rtp.Header, headerLen int) ([]byte, error) {
+	if c.wiped {
+		return nil, errContextWiped
+	}
+
+	_, known := c.srtpSSRCStates[header.SSRC]
+	if !known && c.maxSSRCStates > 0 {
+		if err := c.admitSSRC("srtp", header.SSRC, len(c.srtpSSRCStates)); err != nil {
+			return nil, err
+		}
+	}
 	s := c.getSRTPSSRCState(header.SSRC)
 
+	decrypted, err := c.decryptRTPWithState(s, dst, ciphertext, header, headerLen)
+	switch {
+	case err != nil && !known:
+		// Packets that fail authentication must not allocate state, nor take
+		// the place of known SSRCs
+		c.forgetSRTPSSRC(header.SSRC)
+	case err == nil && c.maxSSRCStates > 0:
+		c.trackSRTPSSRC(header.SSRC)
+	}
+	return decrypted, err
+}
+
+func (c *Context) decryptRTPWithState(s *srtpSSRCState, dst, ciphertext []byte, header *rtp.Header, headerLen int) ([]byte, error) {
 	markAsValid, ok := s.replayDetector.Check(uint64(header.SequenceNumber))
 	if !ok {
-		return nil, &errorDuplicated{
+		s.stats.ReplayDrops++
+		return nil, c.duplicated(&DuplicatedError{
 			Proto: "srtp", SSRC: header.SSRC, Index: uint32(header.SequenceNumber),
-		}
+		})
 	}
 
-	dst = growBufferSize(dst, len(ciphertext)-c.cipher.authTagLen())
-	roc, updateROC := s.nextRolloverCount(header.SequenceNumber)
+	cipher, ciphertext, err := c.decryptionCipher(header.SSRC, dst, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed AEAD open clears its output, which may be the ciphertext
+	var original []byte
+	if c.rocProbing {
+		original = append([]byte{}, ciphertext...)
+	}
 
-	dst, err := c.cipher.decryptRTP(dst, ciphertext, header, headerLen, roc)
+	dst = growBufferSize(dst, len(ciphertext)-cipher.authTagLen())
+	roc := s.nextRolloverCount(header.SequenceNumber)
+
+	decrypted, err := cipher.decryptRTP(dst, ciphertext, header, headerLen, roc)
+	if err != nil && c.rocProbing {
+		decrypted, err = c.probeRolloverCount(s, cipher, dst, original, header, headerLen, roc, err, markAsValid)
+	} else if err == nil {
+		markAsValid()
+		s.updateRolloverCount(header.SequenceNumber, roc)
+	}
 	if err != nil {
+		s.stats.AuthFailures++
 		return nil, err
 	}
 
-	markAsValid()
-	updateROC()
-	return dst, nil
+	s.stats.unprotected(len(ciphertext))
+	return decrypted, nil
+}
+
+// probeRolloverCount retries decryption with the rollover counters next to roc,
+// returning err if none of them authenticates the packet
+func (c *Context) probeRolloverCount(s *srtpSSRCState, cipher srtpCipher, dst, ciphertext []byte, header *rtp.Header, headerLen int, roc uint32, err error, markAsValid func()) ([]byte, error) {
+	probes := []uint32{roc + 1}
+	if roc > 0 {
+		probes = append(probes, roc-1)
+	}
+
+	for _, probe := range probes {
+		if decrypted, probeErr := cipher.decryptRTP(dst, ciphertext, header, headerLen, probe); probeErr == nil {
+			markAsValid()
+			s.updateRolloverCount(header.SequenceNumber, probe)
+			return decrypted, nil
+		}
+	}
+	return nil, err
 }
 
 // DecryptRTP decrypts a RTP packet with an encrypted payload
 func (c *Context) DecryptRTP(dst, encrypted []byte, header *rtp.Header) ([]byte, error) {
 	if header == nil {
-		header = &rtp.Header{}
+		header = &c.header
 	}
 
 	headerLen, err := header.Unmarshal(encrypted)
@@ -43,11 +104,11 @@ func (c *Context) DecryptRTP(dst, encrypted []byte, header *rtp.Header) ([]byte,
 }
 
 // EncryptRTP marshals and encrypts an RTP packet, writing to the dst buffer provided.
-// If the dst buffer does not have the capacity to hold `len(plaintext) + 10` bytes, a new one will be allocated and returned.
+// If the dst buffer does not have the capacity to hold `len(plaintext) + RTPOverhead()` bytes, a new one will be allocated and returned.
 // If a rtp.Header is provided, it will be Unmarshaled using the plaintext.
 func (c *Context) EncryptRTP(dst []byte, plaintext []byte, header *rtp.Header) ([]byte, error) {
 	if header == nil {
-		header = &rtp.Header{}
+		header = &c.header
 	}
 
 	headerLen, err := header.Unmarshal(plaintext)
@@ -58,13 +119,109 @@ func (c *Context) EncryptRTP(dst []byte, plaintext []byte, header *rtp.Header) (
 	return c.encryptRTP(dst, header, plaintext[headerLen:])
 }
 
+// SRTPOverhead returns how many bytes protecting a RTP packet adds to it at
+// most, MKI included. Subtract it from the MTU to get the largest RTP packet.
+func (c *Context) SRTPOverhead() int {
+	return c.cipher.rtpOverhead() + len(c.sendMKI)
+}
+
+// RTPOverhead is SRTPOverhead, the spare capacity EncryptRTPInPlace needs.
+func (c *Context) RTPOverhead() int {
+	return c.SRTPOverhead()
+}
+
+// EncryptRTPInPlace encrypts the RTP packet in buf, overwriting it. buf must
+// have a capacity of at least len(buf) + RTPOverhead(), the returned packet
+// then always shares its backing array and no output buffer is allocated.
+// If a rtp.Header is provided, it will be Unmarshaled using the plaintext.
+func (c *Context) EncryptRTPInPlace(buf []byte, header *rtp.Header) ([]byte, error) {
+	if header == nil {
+		header = &c.header
+	}
+
+	headerLen, err := header.Unmarshal(buf)
+	if err != nil {
+		return nil, err
+	}
+	if spare, overhead := cap(buf)-len(buf), c.RTPOverhead(); spare < overhead {
+		return nil, fmt.Errorf("%w: %d spare bytes, %d needed", ErrShortBuffer, spare, overhead)
+	}
+
+	encrypted, err := c.encryptRTPRaw(buf, buf[:headerLen], buf[headerLen:])
+	if err != nil {
+		return nil, err
+	}
+	return inPlace(buf, encrypted), nil
+}
+
+// DecryptRTPInPlace decrypts the SRTP packet in buf, overwriting it. The
+// returned packet always shares the backing array of buf.
+// If a rtp.Header is provided, it will be Unmarshaled using the ciphertext.
+func (c *Context) DecryptRTPInPlace(buf []byte, header *rtp.Header) ([]byte, error) {
+	decrypted, err := c.DecryptRTP(buf, buf, header)
+	if err != nil || decrypted == nil {
+		return decrypted, err
+	}
+	return inPlace(buf, decrypted), nil
+}
+
 // encryptRTP marshals and encrypts an RTP packet, writing to the dst buffer provided.
 // If the dst buffer does not have the capacity, a new one will be allocated and returned.
 // Similar to above but faster because it can avoid unmarshaling the header and marshaling the payload.
 func (c *Context) encryptRTP(dst []byte, header *rtp.Header, payload []byte) (ciphertext []byte, err error) {
-	s := c.getSRTPSSRCState(header.SSRC)
-	roc, updateROC := s.nextRolloverCount(header.SequenceNumber)
-	updateROC()
+	if c.wiped {
+		return nil, errContextWiped
+	}
+
+	s, err := c.srtpStateForEncryption(header.SSRC)
+	if err != nil {
+		return nil, err
+	}
+	roc := s.nextRolloverCount(header.SequenceNumber)
+	s.updateRolloverCount(header.SequenceNumber, roc)
+	c.switchMKI(uint64(roc)<<16 | uint64(header.SequenceNumber))
+
+	cipher := c.cipherFor(header.SSRC)
+	if err = c.countPacket(cipher, "srtp", header.SSRC); err != nil {
+		return nil, err
+	}
 
-	return c.cipher.encryptRTP(dst, header, payload, roc)
+	encrypted, err := cipher.encryptRTP(dst, header, payload, roc)
+	if err != nil {
+		return nil, err
+	}
+	encrypted = c.appendMKI(encrypted)
+	s.stats.protected(len(encrypted))
+	return encrypted, nil
+}
+
+// encryptRTPRaw is like encryptRTP for forwarders that only have the marshaled header.
+func (c *Context) encryptRTPRaw(dst, headerRaw, payload []byte) ([]byte, error) {
+	if c.wiped {
+		return nil, errContextWiped
+	} else if len(headerRaw) < rtpFixedHeaderSize {
+		return nil, fmt.Errorf("%w: %d", errTooShortRTPHeader, len(headerRaw))
+	}
+
+	ssrc, sequenceNumber := rawHeaderSSRC(headerRaw), rawHeaderSequenceNumber(headerRaw)
+	s, err := c.srtpStateForEncryption(ssrc)
+	if err != nil {
+		return nil, err
+	}
+	roc := s.nextRolloverCount(sequenceNumber)
+	s.updateRolloverCount(sequenceNumber, roc)
+	c.switchMKI(uint64(roc)<<16 | uint64(sequenceNumber))
+
+	cipher := c.cipherFor(ssrc)
+	if err = c.countPacket(cipher, "srtp", ssrc); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := cipher.encryptRTPRaw(dst, headerRaw, payload, roc)
+	if err != nil {
+		return nil, err
+	}
+	encrypted = c.appendMKI(encrypted)
+	s.stats.protected(len(encrypted))
+	return encrypted, nil
 }
@@ -12,12 +12,23 @@ type srtpCipher interface {
 	// See the note below.
 	aeadAuthTagLen() int
 	getRTCPIndex([]byte) uint32
+	// rtpOverhead returns how many bytes at most protecting a RTP packet
+	// adds to it.
+	rtpOverhead() int
 
 	encryptRTP([]byte, *rtp.Header, []byte, uint32) ([]byte, error)
+	// encryptRTPRaw is like encryptRTP with the header already marshaled,
+	// SSRC and sequence number are read from it.
+	encryptRTPRaw([]byte, []byte, []byte, uint32) ([]byte, error)
 	encryptRTCP([]byte, []byte, uint32, uint32) ([]byte, error)
 
 	decryptRTP([]byte, []byte, *rtp.Header, int, uint32) ([]byte, error)
 	decryptRTCP([]byte, []byte, uint32, uint32) ([]byte, error)
+
+	// wipe overwrites the session keys the cipher holds. Key schedules
+	// kept by crypto/aes and crypto/hmac are out of reach, they are only
+	// released once the cipher is dropped.
+	wipe()
 }
 
 /*
@@ -1,7 +1,6 @@
 package srtp
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"encoding/binary"
 
@@ -12,76 +11,107 @@ const (
 	rtcpEncryptionFlag = 0x80
 )
 
+// aeadFactory wraps the block cipher of a profile in an AEAD mode, such as
+// cipher.NewGCM
+type aeadFactory func(block cipher.Block) (cipher.AEAD, error)
+
 type srtpCipherAeadAesGcm struct {
 	srtpCipher, srtcpCipher cipher.AEAD
+	srtpBlock, srtcpBlock   cipher.Block // kept to be wiped
 
 	srtpSessionSalt, srtcpSessionSalt []byte
+
+	// Scratch space so protecting a packet does not allocate
+	iv, aad [12]byte
 }
 
-func newSrtpCipherAeadAesGcm(masterKey, masterSalt []byte) (*srtpCipherAeadAesGcm, error) {
+func newSrtpCipherAeadAesGcm(newBlock blockFactory, newAEAD aeadFactory, masterKey, masterSalt []byte) (*srtpCipherAeadAesGcm, error) {
 	s := &srtpCipherAeadAesGcm{}
 
-	srtpSessionKey, err := aesCmKeyDerivation(labelSRTPEncryption, masterKey, masterSalt, 0, len(masterKey))
+	srtpSessionKey, err := ctrKeyDerivation(newBlock, labelSRTPEncryption, masterKey, masterSalt, 0, len(masterKey))
 	if err != nil {
 		return nil, err
 	}
+	defer zeroBytes(srtpSessionKey)
 
-	srtpBlock, err := aes.NewCipher(srtpSessionKey)
-	if err != nil {
+	if s.srtpBlock, err = newBlock(srtpSessionKey); err != nil {
 		return nil, err
 	}
 
-	s.srtpCipher, err = cipher.NewGCM(srtpBlock)
+	s.srtpCipher, err = newAEAD(s.srtpBlock)
 	if err != nil {
 		return nil, err
 	}
 
-	srtcpSessionKey, err := aesCmKeyDerivation(labelSRTCPEncryption, masterKey, masterSalt, 0, len(masterKey))
+	srtcpSessionKey, err := ctrKeyDerivation(newBlock, labelSRTCPEncryption, masterKey, masterSalt, 0, len(masterKey))
 	if err != nil {
 		return nil, err
 	}
+	defer zeroBytes(srtcpSessionKey)
 
-	srtcpBlock, err := aes.NewCipher(srtcpSessionKey)
-	if err != nil {
+	if s.srtcpBlock, err = newBlock(srtcpSessionKey); err != nil {
 		return nil, err
 	}
 
-	s.srtcpCipher, err = cipher.NewGCM(srtcpBlock)
+	s.srtcpCipher, err = newAEAD(s.srtcpBlock)
 	if err != nil {
 		return nil, err
 	}
 
-	if s.srtpSessionSalt, err = aesCmKeyDerivation(labelSRTPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
+	if s.srtpSessionSalt, err = ctrKeyDerivation(newBlock, labelSRTPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
 		return nil, err
-	} else if s.srtcpSessionSalt, err = aesCmKeyDerivation(labelSRTCPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
+	} else if s.srtcpSessionSalt, err = ctrKeyDerivation(newBlock, labelSRTCPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
 		return nil, err
 	}
 
 	return s, nil
 }
 
+func (s *srtpCipherAeadAesGcm) wipe() {
+	zeroBytes(s.srtpSessionSalt)
+	zeroBytes(s.srtcpSessionSalt)
+	wipeBlock(s.srtpBlock)
+	wipeBlock(s.srtcpBlock)
+}
+
 func (s *srtpCipherAeadAesGcm) authTagLen() int {
 	return 0
 }
 
 func (s *srtpCipherAeadAesGcm) aeadAuthTagLen() int {
-	return 16
+	return s.srtpCipher.Overhead()
+}
+
+func (s *srtpCipherAeadAesGcm) rtpOverhead() int {
+	return s.aeadAuthTagLen()
 }
 
 func (s *srtpCipherAeadAesGcm) encryptRTP(dst []byte, header *rtp.Header, payload []byte, roc uint32) (ciphertext []byte, err error) {
 	// Grow the given buffer to fit the output.
 	dst = growBufferSize(dst, header.MarshalSize()+len(payload)+s.aeadAuthTagLen())
 
-	hdr, err := header.Marshal()
+	n, err := header.MarshalTo(dst)
 	if err != nil {
 		return nil, err
 	}
 
-	iv := s.rtpInitializationVector(header, roc)
+	return s.sealRTP(dst, dst[:n], header.SSRC, header.SequenceNumber, payload, roc), nil
+}
+
+func (s *srtpCipherAeadAesGcm) encryptRTPRaw(dst, headerRaw, payload []byte, roc uint32) ([]byte, error) {
+	// Grow the given buffer to fit the output.
+	dst = growBufferSize(dst, len(headerRaw)+len(payload)+s.aeadAuthTagLen())
+
+	return s.sealRTP(dst, headerRaw, rawHeaderSSRC(headerRaw), rawHeaderSequenceNumber(headerRaw), payload, roc), nil
+}
+
+// sealRTP writes hdr followed by the sealed payload to dst
+func (s *srtpCipherAeadAesGcm) sealRTP(dst, hdr []byte, ssrc uint32, sequenceNumber uint16, payload []byte, roc uint32) []byte {
+	iv := s.rtpInitializationVector(ssrc, sequenceNumber, roc)
 	nHdr := len(hdr)
 	s.srtpCipher.Seal(dst[nHdr:nHdr], iv, payload, hdr)
 	copy(dst[:nHdr], hdr)
-	return dst, nil
+	return dst
 }
 
 func (s *srtpCipherAeadAesGcm) decryptRTP(dst, ciphertext []byte, header *rtp.Header, headerLen int, roc uint32) ([]byte, error) {
@@ -89,16 +119,16 @@ func (s *srtpCipherAeadAesGcm) decryptRTP(dst, ciphertext []byte, header *rtp.He
 	nDst := len(ciphertext) - s.aeadAuthTagLen()
 	if nDst < 0 {
 		// Size of ciphertext is shorter than AEAD auth tag len.
-		return nil, errFailedToVerifyAuthTag
+		return nil, ErrAuthenticationFailure
 	}
 	dst = growBufferSize(dst, nDst)
 
-	iv := s.rtpInitializationVector(header, roc)
+	iv := s.rtpInitializationVector(header.SSRC, header.SequenceNumber, roc)
 
 	if _, err := s.srtpCipher.Open(
 		dst[headerLen:headerLen], iv, ciphertext[headerLen:], ciphertext[:headerLen],
 	); err != nil {
-		return nil, err
+		return nil, ErrAuthenticationFailure
 	}
 
 	copy(dst[:headerLen], ciphertext[:headerLen])
@@ -122,11 +152,14 @@ func (s *srtpCipherAeadAesGcm) encryptRTCP(dst, decrypted []byte, srtcpIndex uin
 
 func (s *srtpCipherAeadAesGcm) decryptRTCP(dst, encrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error) {
 	aadPos := len(encrypted) - srtcpIndexSize
+	if encrypted[aadPos]&rtcpEncryptionFlag == 0 {
+		return s.openUnencryptedRTCP(dst, encrypted, srtcpIndex, ssrc)
+	}
 	// Grow the given buffer to fit the output.
 	nDst := aadPos - s.aeadAuthTagLen()
 	if nDst < 0 {
 		// Size of ciphertext is shorter than AEAD auth tag len.
-		return nil, errFailedToVerifyAuthTag
+		return nil, ErrAuthenticationFailure
 	}
 	dst = growBufferSize(dst, nDst)
 
@@ -134,24 +167,50 @@ func (s *srtpCipherAeadAesGcm) decryptRTCP(dst, encrypted []byte, srtcpIndex, ss
 	aad := s.rtcpAdditionalAuthenticatedData(encrypted, srtcpIndex)
 
 	if _, err := s.srtcpCipher.Open(dst[8:8], iv, encrypted[8:aadPos], aad); err != nil {
-		return nil, err
+		return nil, ErrAuthenticationFailure
 	}
 
 	copy(dst[:8], encrypted[:8])
 	return dst, nil
 }
 
+// openUnencryptedRTCP authenticates a SRTCP packet sent with the E flag
+// clear. The whole packet followed by the ESRTCP word is the AAD and the
+// plaintext is empty.
+//
+// https://tools.ietf.org/html/rfc7714#section-9.3
+func (s *srtpCipherAeadAesGcm) openUnencryptedRTCP(dst, encrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error) {
+	tagPos := len(encrypted) - srtcpIndexSize - s.aeadAuthTagLen()
+	if tagPos < 8 {
+		return nil, ErrAuthenticationFailure
+	}
+
+	aad := make([]byte, tagPos+srtcpIndexSize)
+	copy(aad, encrypted[:tagPos])
+	copy(aad[tagPos:], encrypted[len(encrypted)-srtcpIndexSize:])
+
+	iv := s.rtcpInitializationVector(srtcpIndex, ssrc)
+	if _, err := s.srtcpCipher.Open(nil, iv, encrypted[tagPos:tagPos+s.aeadAuthTagLen()], aad); err != nil {
+		return nil, ErrAuthenticationFailure
+	}
+
+	dst = growBufferSize(dst, tagPos)
+	copy(dst, encrypted[:tagPos])
+	return dst, nil
+}
+
 // The 12-octet IV used by AES-GCM SRTP is formed by first concatenating
 // 2 octets of zeroes, the 4-octet SSRC, the 4-octet rollover counter
 // (ROC), and the 2-octet sequence number (SEQ).  The resulting 12-octet
 // value is then XORed to the 12-octet salt to form the 12-octet IV.
 //
 // https://tools.ietf.org/html/rfc7714#section-8.1
-func (s *srtpCipherAeadAesGcm) rtpInitializationVector(header *rtp.Header, roc uint32) []byte {
-	iv := make([]byte, 12)
-	binary.BigEndian.PutUint32(iv[2:], header.SSRC)
+func (s *srtpCipherAeadAesGcm) rtpInitializationVector(ssrc uint32, sequenceNumber uint16, roc uint32) []byte {
+	iv := s.iv[:]
+	iv[0], iv[1] = 0, 0
+	binary.BigEndian.PutUint32(iv[2:], ssrc)
 	binary.BigEndian.PutUint32(iv[6:], roc)
-	binary.BigEndian.PutUint16(iv[10:], header.SequenceNumber)
+	binary.BigEndian.PutUint16(iv[10:], sequenceNumber)
 
 	for i := range iv {
 		iv[i] ^= s.srtpSessionSalt[i]
@@ -167,8 +226,8 @@ func (s *srtpCipherAeadAesGcm) rtpInitializationVector(header *rtp.Header, roc u
 //
 // https://tools.ietf.org/html/rfc7714#section-9.1
 func (s *srtpCipherAeadAesGcm) rtcpInitializationVector(srtcpIndex uint32, ssrc uint32) []byte {
-	iv := make([]byte, 12)
-
+	iv := s.iv[:]
+	iv[0], iv[1], iv[6], iv[7] = 0, 0, 0, 0
 	binary.BigEndian.PutUint32(iv[2:], ssrc)
 	binary.BigEndian.PutUint32(iv[8:], srtcpIndex)
 
@@ -184,8 +243,7 @@ func (s *srtpCipherAeadAesGcm) rtcpInitializationVector(srtcpIndex uint32, ssrc
 //
 // https://tools.ietf.org/html/rfc7714#section-17
 func (s *srtpCipherAeadAesGcm) rtcpAdditionalAuthenticatedData(rtcpPacket []byte, srtcpIndex uint32) []byte {
-	aad := make([]byte, 12)
-
+	aad := s.aad[:]
 	copy(aad, rtcpPacket[:8])
 	binary.BigEndian.PutUint32(aad[8:], srtcpIndex)
 	aad[8] |= rtcpEncryptionFlag
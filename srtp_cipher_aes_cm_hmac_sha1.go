@@ -5,73 +5,130 @@ import ( //nolint:gci
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/sha1" //nolint:gosec
-	"crypto/subtle"
 	"encoding/binary"
 	"hash"
 
 	"github.com/pion/rtp/v2"
 )
 
+// payloadMode is how a HMAC-SHA1 cipher encrypts payloads
+type payloadMode int
+
+const (
+	payloadModeCounter payloadMode = iota
+	payloadModeNull                // authenticated only, see ProtectionProfileNullHmacSha1_80
+	payloadModeF8
+)
+
 type srtpCipherAesCmHmacSha1 struct {
+	tagLen int
+	mode   payloadMode
+
 	srtpSessionSalt []byte
 	srtpSessionAuth hash.Hash
 	srtpBlock       cipher.Block
+	srtpF8Block     cipher.Block // keyed with k_e XOR m, f8 only
 
 	srtcpSessionSalt []byte
 	srtcpSessionAuth hash.Hash
 	srtcpBlock       cipher.Block
+	srtcpF8Block     cipher.Block
+
+	// Scratch space so protecting a packet does not allocate
+	counter   [aes.BlockSize]byte
+	keystream [ctrKeystreamBlocks * aes.BlockSize]byte
+	roc       [4]byte
+	tag       [sha1.Size]byte
 }
 
-func newSrtpCipherAesCmHmacSha1(masterKey, masterSalt []byte) (*srtpCipherAesCmHmacSha1, error) {
-	s := &srtpCipherAesCmHmacSha1{}
-	srtpSessionKey, err := aesCmKeyDerivation(labelSRTPEncryption, masterKey, masterSalt, 0, len(masterKey))
+func newSrtpCipherAesCmHmacSha1(profile ProtectionProfile, newBlock blockFactory, masterKey, masterSalt []byte) (*srtpCipherAesCmHmacSha1, error) {
+	tagLen, err := profile.authTagLen()
 	if err != nil {
 		return nil, err
-	} else if s.srtpBlock, err = aes.NewCipher(srtpSessionKey); err != nil {
+	}
+
+	s := &srtpCipherAesCmHmacSha1{tagLen: tagLen}
+	switch {
+	case profile.isNull():
+		s.mode = payloadModeNull
+	case profile == ProtectionProfileAes128F8HmacSha1_80:
+		s.mode = payloadModeF8
+	}
+
+	srtpSessionKey, err := ctrKeyDerivation(newBlock, labelSRTPEncryption, masterKey, masterSalt, 0, len(masterKey))
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(srtpSessionKey)
+	if s.srtpBlock, err = newBlock(srtpSessionKey); err != nil {
 		return nil, err
 	}
 
-	srtcpSessionKey, err := aesCmKeyDerivation(labelSRTCPEncryption, masterKey, masterSalt, 0, len(masterKey))
+	srtcpSessionKey, err := ctrKeyDerivation(newBlock, labelSRTCPEncryption, masterKey, masterSalt, 0, len(masterKey))
 	if err != nil {
 		return nil, err
-	} else if s.srtcpBlock, err = aes.NewCipher(srtcpSessionKey); err != nil {
+	}
+	defer zeroBytes(srtcpSessionKey)
+	if s.srtcpBlock, err = newBlock(srtcpSessionKey); err != nil {
 		return nil, err
 	}
 
-	if s.srtpSessionSalt, err = aesCmKeyDerivation(labelSRTPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
+	if s.srtpSessionSalt, err = ctrKeyDerivation(newBlock, labelSRTPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
 		return nil, err
-	} else if s.srtcpSessionSalt, err = aesCmKeyDerivation(labelSRTCPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
+	} else if s.srtcpSessionSalt, err = ctrKeyDerivation(newBlock, labelSRTCPSalt, masterKey, masterSalt, 0, len(masterSalt)); err != nil {
 		return nil, err
 	}
 
-	authKeyLen, err := ProtectionProfileAes128CmHmacSha1_80.authKeyLen()
+	if s.mode == payloadModeF8 {
+		if s.srtpF8Block, err = newF8MaskedBlock(srtpSessionKey, s.srtpSessionSalt); err != nil {
+			return nil, err
+		} else if s.srtcpF8Block, err = newF8MaskedBlock(srtcpSessionKey, s.srtcpSessionSalt); err != nil {
+			return nil, err
+		}
+	}
+
+	authKeyLen, err := profile.authKeyLen()
 	if err != nil {
 		return nil, err
 	}
 
-	srtpSessionAuthTag, err := aesCmKeyDerivation(labelSRTPAuthenticationTag, masterKey, masterSalt, 0, authKeyLen)
+	srtpSessionAuthTag, err := ctrKeyDerivation(newBlock, labelSRTPAuthenticationTag, masterKey, masterSalt, 0, authKeyLen)
 	if err != nil {
 		return nil, err
 	}
+	defer zeroBytes(srtpSessionAuthTag)
 
-	srtcpSessionAuthTag, err := aesCmKeyDerivation(labelSRTCPAuthenticationTag, masterKey, masterSalt, 0, authKeyLen)
+	srtcpSessionAuthTag, err := ctrKeyDerivation(newBlock, labelSRTCPAuthenticationTag, masterKey, masterSalt, 0, authKeyLen)
 	if err != nil {
 		return nil, err
 	}
+	defer zeroBytes(srtcpSessionAuthTag)
 
 	s.srtcpSessionAuth = hmac.New(sha1.New, srtcpSessionAuthTag)
 	s.srtpSessionAuth = hmac.New(sha1.New, srtpSessionAuthTag)
 	return s, nil
 }
 
+func (s *srtpCipherAesCmHmacSha1) wipe() {
+	zeroBytes(s.srtpSessionSalt)
+	zeroBytes(s.srtcpSessionSalt)
+	for _, b := range []cipher.Block{s.srtpBlock, s.srtpF8Block, s.srtcpBlock, s.srtcpF8Block} {
+		wipeBlock(b)
+	}
+}
+
 func (s *srtpCipherAesCmHmacSha1) authTagLen() int {
-	return 10
+	return s.tagLen
 }
 
 func (s *srtpCipherAesCmHmacSha1) aeadAuthTagLen() int {
 	return 0
 }
 
+func (s *srtpCipherAesCmHmacSha1) rtpOverhead() int {
+	return s.authTagLen()
+}
+
 func (s *srtpCipherAesCmHmacSha1) encryptRTP(dst []byte, header *rtp.Header, payload []byte, roc uint32) (ciphertext []byte, err error) {
 	// Grow the given buffer to fit the output.
 	dst = growBufferSize(dst, header.MarshalSize()+len(payload)+s.authTagLen())
@@ -82,10 +139,23 @@ func (s *srtpCipherAesCmHmacSha1) encryptRTP(dst []byte, header *rtp.Header, pay
 		return nil, err
 	}
 
+	return s.encryptRTPPayload(dst, n, header.SSRC, header.SequenceNumber, payload, roc)
+}
+
+func (s *srtpCipherAesCmHmacSha1) encryptRTPRaw(dst, headerRaw, payload []byte, roc uint32) ([]byte, error) {
+	// Grow the given buffer to fit the output.
+	dst = growBufferSize(dst, len(headerRaw)+len(payload)+s.authTagLen())
+
+	// Copy the header unencrypted.
+	n := copy(dst, headerRaw)
+
+	return s.encryptRTPPayload(dst, n, rawHeaderSSRC(headerRaw), rawHeaderSequenceNumber(headerRaw), payload, roc)
+}
+
+// encryptRTPPayload encrypts payload into dst after the n header bytes and appends the auth tag
+func (s *srtpCipherAesCmHmacSha1) encryptRTPPayload(dst []byte, n int, ssrc uint32, sequenceNumber uint16, payload []byte, roc uint32) ([]byte, error) {
 	// Encrypt the payload
-	counter := generateCounter(header.SequenceNumber, roc, header.SSRC, s.srtpSessionSalt)
-	stream := cipher.NewCTR(s.srtpBlock, counter)
-	stream.XORKeyStream(dst[n:], payload)
+	s.xorRTPPayload(dst[n:], payload, dst[:n], ssrc, sequenceNumber, roc)
 	n += len(payload)
 
 	// Generate the auth tag.
@@ -112,18 +182,15 @@ func (s *srtpCipherAesCmHmacSha1) decryptRTP(dst, ciphertext []byte, header *rtp
 	}
 
 	// See if the auth tag actually matches.
-	// We use a constant time comparison to prevent timing attacks.
-	if subtle.ConstantTimeCompare(actualTag, expectedTag) != 1 {
-		return nil, errFailedToVerifyAuthTag
+	if !authTagsEqual(actualTag, expectedTag) {
+		return nil, ErrAuthenticationFailure
 	}
 
 	// Write the plaintext header to the destination buffer.
 	copy(dst, ciphertext[:headerLen])
 
 	// Decrypt the ciphertext for the payload.
-	counter := generateCounter(header.SequenceNumber, roc, header.SSRC, s.srtpSessionSalt)
-	stream := cipher.NewCTR(s.srtpBlock, counter)
-	stream.XORKeyStream(dst[headerLen:], ciphertext[headerLen:])
+	s.xorRTPPayload(dst[headerLen:], ciphertext[headerLen:], ciphertext[:headerLen], header.SSRC, header.SequenceNumber, roc)
 	return dst, nil
 }
 
@@ -131,13 +198,14 @@ func (s *srtpCipherAesCmHmacSha1) encryptRTCP(dst, decrypted []byte, srtcpIndex
 	dst = allocateIfMismatch(dst, decrypted)
 
 	// Encrypt everything after header
-	stream := cipher.NewCTR(s.srtcpBlock, generateCounter(uint16(srtcpIndex&0xffff), srtcpIndex>>16, ssrc, s.srtcpSessionSalt))
-	stream.XORKeyStream(dst[8:], dst[8:])
+	s.xorRTCPPayload(dst, srtcpIndex, ssrc)
 
-	// Add SRTCP Index and set Encryption bit
-	dst = append(dst, make([]byte, 4)...)
+	// Add SRTCP Index and set Encryption bit, unless payloads are in the clear
+	dst = growBufferSize(dst, len(dst)+srtcpIndexSize)
 	binary.BigEndian.PutUint32(dst[len(dst)-4:], srtcpIndex)
-	dst[len(dst)-4] |= 0x80
+	if s.mode != payloadModeNull {
+		dst[len(dst)-4] |= rtcpEncryptionFlag
+	}
 
 	authTag, err := s.generateSrtcpAuthTag(dst)
 	if err != nil {
@@ -156,16 +224,42 @@ func (s *srtpCipherAesCmHmacSha1) decryptRTCP(out, encrypted []byte, index, ssrc
 	}
 
 	actualTag := encrypted[len(encrypted)-s.authTagLen():]
-	if subtle.ConstantTimeCompare(actualTag, expectedTag) != 1 {
-		return nil, errFailedToVerifyAuthTag
+	if !authTagsEqual(actualTag, expectedTag) {
+		return nil, ErrAuthenticationFailure
 	}
 
-	stream := cipher.NewCTR(s.srtcpBlock, generateCounter(uint16(index&0xffff), index>>16, ssrc, s.srtcpSessionSalt))
-	stream.XORKeyStream(out[8:], out[8:])
-
+	// Packets sent with the E flag clear are only authenticated
+	if encrypted[tailOffset]&rtcpEncryptionFlag != 0 {
+		s.xorRTCPPayload(out, index, ssrc)
+	}
 	return out, nil
 }
 
+// xorRTPPayload encrypts or decrypts src into dst, header is the marshaled RTP header
+func (s *srtpCipherAesCmHmacSha1) xorRTPPayload(dst, src, header []byte, ssrc uint32, sequenceNumber uint16, roc uint32) {
+	switch s.mode {
+	case payloadModeNull:
+		copy(dst, src)
+	case payloadModeF8:
+		xorF8(s.srtpBlock, s.srtpF8Block, rtpF8IV(header, roc), dst, src)
+	default:
+		s.counter = generateCounter(sequenceNumber, roc, ssrc, s.srtpSessionSalt)
+		xorBytesCTR(s.srtpBlock, &s.counter, s.keystream[:], dst, src)
+	}
+}
+
+// xorRTCPPayload encrypts or decrypts everything after the first header of buf in place
+func (s *srtpCipherAesCmHmacSha1) xorRTCPPayload(buf []byte, index, ssrc uint32) {
+	switch s.mode {
+	case payloadModeNull:
+	case payloadModeF8:
+		xorF8(s.srtcpBlock, s.srtcpF8Block, rtcpF8IV(buf, index), buf[8:], buf[8:])
+	default:
+		s.counter = generateCounter(uint16(index&0xffff), index>>16, ssrc, s.srtcpSessionSalt)
+		xorBytesCTR(s.srtcpBlock, &s.counter, s.keystream[:], buf[8:], buf[8:])
+	}
+}
+
 func (s *srtpCipherAesCmHmacSha1) generateSrtpAuthTag(buf []byte, roc uint32) ([]byte, error) {
 	// https://tools.ietf.org/html/rfc3711#section-4.2
 	// In the case of SRTP, M SHALL consist of the Authenticated
@@ -188,16 +282,15 @@ func (s *srtpCipherAesCmHmacSha1) generateSrtpAuthTag(buf []byte, roc uint32) ([
 	}
 
 	// For SRTP only, we need to hash the rollover counter as well.
-	rocRaw := [4]byte{}
-	binary.BigEndian.PutUint32(rocRaw[:], roc)
+	binary.BigEndian.PutUint32(s.roc[:], roc)
 
-	_, err := s.srtpSessionAuth.Write(rocRaw[:])
+	_, err := s.srtpSessionAuth.Write(s.roc[:])
 	if err != nil {
 		return nil, err
 	}
 
-	// Truncate the hash to the first 10 bytes.
-	return s.srtpSessionAuth.Sum(nil)[0:s.authTagLen()], nil
+	// Truncate the hash to the first authTagLen bytes.
+	return s.srtpSessionAuth.Sum(s.tag[:0])[0:s.authTagLen()], nil
 }
 
 func (s *srtpCipherAesCmHmacSha1) generateSrtcpAuthTag(buf []byte) ([]byte, error) {
@@ -218,7 +311,7 @@ func (s *srtpCipherAesCmHmacSha1) generateSrtcpAuthTag(buf []byte) ([]byte, erro
 		return nil, err
 	}
 
-	return s.srtcpSessionAuth.Sum(nil)[0:s.authTagLen()], nil
+	return s.srtcpSessionAuth.Sum(s.tag[:0])[0:s.authTagLen()], nil
 }
 
 func (s *srtpCipherAesCmHmacSha1) getRTCPIndex(in []byte) uint32 {
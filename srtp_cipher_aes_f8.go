@@ -0,0 +1,61 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// newF8MaskedBlock returns the cipher keyed with k_e XOR m used to compute IV',
+// m being the session salt padded with 0x55 to the key length
+// https://tools.ietf.org/html/rfc3711#section-4.1.2.1
+func newF8MaskedBlock(sessionKey, sessionSalt []byte) (cipher.Block, error) {
+	masked := make([]byte, len(sessionKey))
+	defer zeroBytes(masked)
+	for i := range masked {
+		m := byte(0x55)
+		if i < len(sessionSalt) {
+			m = sessionSalt[i]
+		}
+		masked[i] = sessionKey[i] ^ m
+	}
+	return aes.NewCipher(masked)
+}
+
+// rtpF8IV is 0x00 || M || PT || SEQ || TS || SSRC || ROC
+// https://tools.ietf.org/html/rfc3711#section-4.1.2.2
+func rtpF8IV(header []byte, roc uint32) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv[1:rtpFixedHeaderSize], header[1:rtpFixedHeaderSize])
+	binary.BigEndian.PutUint32(iv[rtpFixedHeaderSize:], roc)
+	return iv
+}
+
+// rtcpF8IV is 0..0 || E || SRTCP index || V || P || RC || PT || length || SSRC
+// https://tools.ietf.org/html/rfc3711#section-4.1.2.3
+func rtcpF8IV(header []byte, index uint32) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv[4:], index|(1<<31))
+	copy(iv[8:], header[:8])
+	return iv
+}
+
+// xorF8 XORs src with the f8 keystream into dst, where
+// S(j) = E(k_e, IV' XOR j XOR S(j-1)) and IV' = E(k_e XOR m, IV)
+func xorF8(block, maskedBlock cipher.Block, iv, dst, src []byte) {
+	ivPrime := make([]byte, aes.BlockSize)
+	maskedBlock.Encrypt(ivPrime, iv)
+
+	s := make([]byte, aes.BlockSize) // S(-1) is zero
+	for j, offset := uint32(0), 0; offset < len(src); j, offset = j+1, offset+aes.BlockSize {
+		for i := range s {
+			s[i] ^= ivPrime[i]
+		}
+		binary.BigEndian.PutUint32(s[aes.BlockSize-4:], binary.BigEndian.Uint32(s[aes.BlockSize-4:])^j)
+		block.Encrypt(s, s)
+
+		for i := 0; i < aes.BlockSize && offset+i < len(src); i++ {
+			dst[offset+i] = src[offset+i] ^ s[i]
+		}
+	}
+}
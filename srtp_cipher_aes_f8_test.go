@@ -0,0 +1,76 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pion/rtp/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// https://tools.ietf.org/html/rfc3711#appendix-B.2
+func TestXORF8(t *testing.T) {
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		assert.NoError(t, err)
+		return b
+	}
+
+	sessionKey := decode("234829008467be186c3de14aae72d62c")
+	sessionSalt := decode("32f2870d")
+	header := decode("806e5cba50681de55c621599")
+	payload := decode("70736575646f72616e646f6d6e65737320697320746865206e6578742062657374207468696e67")
+	expected := decode("019ce7a26e7854014a6366aa95d4eefd1ad4172a14f9faf455b7f1d4b62bd08f562c0eef7c4802")
+
+	iv := rtpF8IV(header, 0xd462564a)
+	assert.Equal(t, decode("006e5cba50681de55c621599d462564a"), iv)
+
+	block, err := aes.NewCipher(sessionKey)
+	assert.NoError(t, err)
+	maskedBlock, err := newF8MaskedBlock(sessionKey, sessionSalt)
+	assert.NoError(t, err)
+
+	ivPrime := make([]byte, aes.BlockSize)
+	maskedBlock.Encrypt(ivPrime, iv)
+	assert.Equal(t, decode("595b699bbd3bc0df26062093c1ad8f73"), ivPrime)
+
+	encrypted := make([]byte, len(payload))
+	xorF8(block, maskedBlock, iv, encrypted, payload)
+	assert.Equal(t, expected, encrypted)
+
+	xorF8(block, maskedBlock, iv, encrypted, encrypted)
+	assert.Equal(t, payload, encrypted)
+}
+
+func TestRTPAesF8Profile(t *testing.T) {
+	profile := ProtectionProfileAes128F8HmacSha1_80
+	keys, err := generateLoopbackKeys(profile)
+	assert.NoError(t, err)
+
+	encryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+	assert.NoError(t, err)
+	decryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+	assert.NoError(t, err)
+
+	pkt := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 5000}, Payload: make([]byte, 40)}
+	raw, err := pkt.Marshal()
+	assert.NoError(t, err)
+
+	encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, raw, encrypted[:len(raw)])
+
+	decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, decrypted)
+
+	rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04}
+	encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, rtcpPacket[8:], encryptedRTCP[8:len(rtcpPacket)])
+
+	decryptedRTCP, err := decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, rtcpPacket, decryptedRTCP)
+}
@@ -0,0 +1,167 @@
+package srtp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pion/rtp/v2"
+)
+
+// Config byte of the OHB, the original header block of RFC 8723. It is the
+// last byte of the payload once the outer transform is stripped, preceded by
+// the original PT and SEQ when a media distributor changed them.
+// https://tools.ietf.org/html/rfc8723#section-4
+const (
+	ohbSequenceNumberPresent = 0x01 // Q
+	ohbPayloadTypePresent    = 0x02 // P
+	ohbMarkerPresent         = 0x04 // M
+	ohbMarker                = 0x08 // B
+	ohbReserved              = 0xf0
+)
+
+// srtpCipherDouble applies the inner, end-to-end transform of RFC 8723 to a
+// synthetic packet made of the original RTP header without CSRCs and
+// extensions, then the outer, hop-by-hop transform to the whole packet.
+// SRTCP only uses the outer transform.
+type srtpCipherDouble struct {
+	inner, outer srtpCipher
+}
+
+func newSrtpCipherDouble(half profileParams, masterKey, masterSalt []byte) (*srtpCipherDouble, error) {
+	inner, err := newSrtpCipher(masterKey[:half.keyLen], masterSalt[:half.saltLen], half)
+	if err != nil {
+		return nil, err
+	}
+	outer, err := newSrtpCipher(masterKey[half.keyLen:], masterSalt[half.saltLen:], half)
+	if err != nil {
+		return nil, err
+	}
+
+	return &srtpCipherDouble{inner: inner, outer: outer}, nil
+}
+
+func (s *srtpCipherDouble) wipe() {
+	s.inner.wipe()
+	s.outer.wipe()
+}
+
+func (s *srtpCipherDouble) authTagLen() int {
+	return 0
+}
+
+func (s *srtpCipherDouble) aeadAuthTagLen() int {
+	return s.outer.aeadAuthTagLen()
+}
+
+// rtpOverhead counts the OHB config byte, the only one this side sends
+func (s *srtpCipherDouble) rtpOverhead() int {
+	return s.inner.rtpOverhead() + 1 + s.outer.rtpOverhead()
+}
+
+func (s *srtpCipherDouble) getRTCPIndex(in []byte) uint32 {
+	return s.outer.getRTCPIndex(in)
+}
+
+func (s *srtpCipherDouble) encryptRTP(dst []byte, header *rtp.Header, payload []byte, roc uint32) ([]byte, error) {
+	synthetic := syntheticHeader(header)
+	inner, err := s.inner.encryptRTP(nil, synthetic, payload, roc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing was changed yet, the OHB is only its config byte
+	innerPayload := append(inner[synthetic.MarshalSize():], 0)
+	return s.outer.encryptRTP(dst, header, innerPayload, roc)
+}
+
+func (s *srtpCipherDouble) encryptRTPRaw(dst, headerRaw, payload []byte, roc uint32) ([]byte, error) {
+	header := &rtp.Header{}
+	if _, err := header.Unmarshal(headerRaw); err != nil {
+		return nil, err
+	}
+	return s.encryptRTP(dst, header, payload, roc)
+}
+
+func (s *srtpCipherDouble) decryptRTP(dst, ciphertext []byte, header *rtp.Header, headerLen int, roc uint32) ([]byte, error) {
+	outer, err := s.outer.decryptRTP(nil, ciphertext, header, headerLen, roc)
+	if err != nil {
+		return nil, err
+	}
+
+	synthetic, innerLen, err := parseOHB(header, outer[headerLen:])
+	if err != nil {
+		return nil, err
+	}
+
+	syntheticRaw, err := synthetic.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	syntheticLen := len(syntheticRaw)
+
+	inner, err := s.inner.decryptRTP(nil, append(syntheticRaw, outer[headerLen:headerLen+innerLen]...), synthetic, syntheticLen, roc)
+	if err != nil {
+		return nil, err
+	}
+
+	dst = growBufferSize(dst, headerLen+len(inner)-syntheticLen)
+	copy(dst, outer[:headerLen])
+	copy(dst[headerLen:], inner[syntheticLen:])
+	return dst, nil
+}
+
+func (s *srtpCipherDouble) encryptRTCP(dst, decrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error) {
+	return s.outer.encryptRTCP(dst, decrypted, srtcpIndex, ssrc)
+}
+
+func (s *srtpCipherDouble) decryptRTCP(dst, encrypted []byte, srtcpIndex, ssrc uint32) ([]byte, error) {
+	return s.outer.decryptRTCP(dst, encrypted, srtcpIndex, ssrc)
+}
+
+// syntheticHeader is the header the inner transform protects: the fixed
+// header only, without CSRCs, extensions nor padding
+func syntheticHeader(header *rtp.Header) *rtp.Header {
+	return &rtp.Header{
+		Version:        header.Version,
+		Marker:         header.Marker,
+		PayloadType:    header.PayloadType,
+		SequenceNumber: header.SequenceNumber,
+		Timestamp:      header.Timestamp,
+		SSRC:           header.SSRC,
+	}
+}
+
+// parseOHB reads the OHB at the end of payload and returns the synthetic
+// header with the original values it holds, and the length of the inner
+// ciphertext preceding it
+func parseOHB(header *rtp.Header, payload []byte) (*rtp.Header, int, error) {
+	if len(payload) == 0 {
+		return nil, 0, fmt.Errorf("%w: empty payload", errInvalidOHB)
+	}
+	config := payload[len(payload)-1]
+	if config&ohbReserved != 0 {
+		return nil, 0, fmt.Errorf("%w: reserved bits set in %#x", errInvalidOHB, config)
+	}
+
+	synthetic := syntheticHeader(header)
+	n := 1
+	if config&ohbSequenceNumberPresent != 0 {
+		n += 2
+		if len(payload) < n {
+			return nil, 0, fmt.Errorf("%w: too short", errInvalidOHB)
+		}
+		synthetic.SequenceNumber = binary.BigEndian.Uint16(payload[len(payload)-n:])
+	}
+	if config&ohbPayloadTypePresent != 0 {
+		n++
+		if len(payload) < n {
+			return nil, 0, fmt.Errorf("%w: too short", errInvalidOHB)
+		}
+		synthetic.PayloadType = payload[len(payload)-n] & 0x7f
+	}
+	if config&ohbMarkerPresent != 0 {
+		synthetic.Marker = config&ohbMarker != 0
+	}
+
+	return synthetic, len(payload) - n, nil
+}
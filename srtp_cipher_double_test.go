@@ -0,0 +1,108 @@
+package srtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/pion/rtp/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoubleEncryption(t *testing.T) {
+	for _, profile := range []ProtectionProfile{ProtectionProfileDoubleAeadAes128Gcm, ProtectionProfileDoubleAeadAes256Gcm} {
+		keys, err := generateLoopbackKeys(profile)
+		assert.NoError(t, err)
+		params, err := profile.params()
+		assert.NoError(t, err)
+		outerKey, outerSalt := keys.LocalMasterKey[params.keyLen/2:], keys.LocalMasterSalt[params.saltLen/2:]
+
+		sender, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+		receiver, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+		sfuIn, err := CreateContext(outerKey, outerSalt, profile, HopByHop())
+		assert.NoError(t, err)
+		sfuOut, err := CreateContext(outerKey, outerSalt, profile, HopByHop())
+		assert.NoError(t, err)
+
+		pkt := &rtp.Packet{
+			Header:  rtp.Header{Version: 2, SSRC: 1, SequenceNumber: 5000, PayloadType: 96, CSRC: []uint32{2}},
+			Payload: rtpTestCaseDecrypted(),
+		}
+		raw, err := pkt.Marshal()
+		assert.NoError(t, err)
+
+		encrypted, err := sender.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, err)
+		assert.Len(t, encrypted, len(raw)+params.aeadAuthTagLen+params.innerLen)
+
+		// The media distributor never sees the media
+		hop, err := sfuIn.DecryptRTP(nil, encrypted, nil)
+		assert.NoError(t, err)
+		assert.False(t, bytes.Contains(hop, pkt.Payload))
+
+		// It rewrites the sequence number and records the original in the OHB
+		forwarded := &rtp.Packet{}
+		assert.NoError(t, forwarded.Unmarshal(hop))
+		ohb := forwarded.Payload[len(forwarded.Payload)-1]
+		assert.Equal(t, byte(0), ohb)
+		forwarded.Payload = append(forwarded.Payload[:len(forwarded.Payload)-1], 0, 0, ohbSequenceNumberPresent)
+		binary.BigEndian.PutUint16(forwarded.Payload[len(forwarded.Payload)-3:], forwarded.SequenceNumber)
+		forwarded.SequenceNumber = 100
+		hop, err = forwarded.Marshal()
+		assert.NoError(t, err)
+
+		reencrypted, err := sfuOut.EncryptRTP(nil, hop, nil)
+		assert.NoError(t, err)
+
+		decrypted, err := receiver.DecryptRTP(nil, reencrypted, nil)
+		assert.NoError(t, err, profile)
+		received := &rtp.Packet{}
+		assert.NoError(t, received.Unmarshal(decrypted))
+		assert.Equal(t, uint16(100), received.SequenceNumber)
+		assert.Equal(t, pkt.Payload, received.Payload)
+
+		// RTCP is only protected hop by hop
+		rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+		encryptedRTCP, err := sender.EncryptRTCP(nil, rtcpPacket, nil)
+		assert.NoError(t, err)
+		decryptedRTCP, err := sfuIn.DecryptRTCP(nil, encryptedRTCP, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, rtcpPacket, decryptedRTCP)
+	}
+}
+
+func TestDoubleEncryptionTamperedHeader(t *testing.T) {
+	keys, err := generateLoopbackKeys(ProtectionProfileDoubleAeadAes128Gcm)
+	assert.NoError(t, err)
+
+	sender, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileDoubleAeadAes128Gcm)
+	assert.NoError(t, err)
+	receiver, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileDoubleAeadAes128Gcm)
+	assert.NoError(t, err)
+	sfuIn, err := CreateContext(keys.LocalMasterKey[16:], keys.LocalMasterSalt[12:], ProtectionProfileDoubleAeadAes128Gcm, HopByHop())
+	assert.NoError(t, err)
+	sfuOut, err := CreateContext(keys.LocalMasterKey[16:], keys.LocalMasterSalt[12:], ProtectionProfileDoubleAeadAes128Gcm, HopByHop())
+	assert.NoError(t, err)
+
+	pkt := &rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1, SequenceNumber: 5000}, Payload: rtpTestCaseDecrypted()}
+	raw, err := pkt.Marshal()
+	assert.NoError(t, err)
+	encrypted, err := sender.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+
+	// Changing the payload type without recording it in the OHB breaks the
+	// end-to-end authentication
+	hop, err := sfuIn.DecryptRTP(nil, encrypted, nil)
+	assert.NoError(t, err)
+	hop[1] = 97
+	reencrypted, err := sfuOut.EncryptRTP(nil, hop, nil)
+	assert.NoError(t, err)
+	_, err = receiver.DecryptRTP(nil, reencrypted, nil)
+	assert.Error(t, err)
+
+	_, err = CreateContext(keys.LocalMasterKey[:16], keys.LocalMasterSalt[:12], ProtectionProfileAeadAes128Gcm, HopByHop())
+	assert.True(t, errors.Is(err, errHopByHopNotDouble))
+}
@@ -49,7 +49,7 @@ func TestValidPacketCounter(t *testing.T) {
 	s := &srtpSSRCState{ssrc: 4160032510}
 	expectedCounter := []byte{0xcf, 0x90, 0x1e, 0xa5, 0xda, 0xd3, 0x2c, 0x15, 0x00, 0xa2, 0x24, 0xae, 0xae, 0xaf, 0x00, 0x00}
 	counter := generateCounter(32846, s.rolloverCounter, s.ssrc, srtpSessionSalt)
-	if !bytes.Equal(counter, expectedCounter) {
+	if !bytes.Equal(counter[:], expectedCounter) {
 		t.Errorf("Session Key % 02x does not match expected % 02x", counter, expectedCounter)
 	}
 }
@@ -58,65 +58,65 @@ func TestRolloverCount(t *testing.T) {
 	s := &srtpSSRCState{ssrc: defaultSsrc}
 
 	// Set initial seqnum
-	roc, update := s.nextRolloverCount(65530)
+	roc := s.nextRolloverCount(65530)
 	if roc != 0 {
 		t.Errorf("Initial rolloverCounter must be 0")
 	}
-	update()
+	s.updateRolloverCount(65530, roc)
 
 	// Invalid packets never update ROC
-	_, _ = s.nextRolloverCount(0)
-	_, _ = s.nextRolloverCount(0x4000)
-	_, _ = s.nextRolloverCount(0x8000)
-	_, _ = s.nextRolloverCount(0xFFFF)
-	_, _ = s.nextRolloverCount(0)
+	_ = s.nextRolloverCount(0)
+	_ = s.nextRolloverCount(0x4000)
+	_ = s.nextRolloverCount(0x8000)
+	_ = s.nextRolloverCount(0xFFFF)
+	_ = s.nextRolloverCount(0)
 
 	// We rolled over to 0
-	roc, update = s.nextRolloverCount(0)
+	roc = s.nextRolloverCount(0)
 	if roc != 1 {
 		t.Errorf("rolloverCounter was not updated after it crossed 0")
 	}
-	update()
+	s.updateRolloverCount(0, roc)
 
-	roc, update = s.nextRolloverCount(65530)
+	roc = s.nextRolloverCount(65530)
 	if roc != 0 {
 		t.Errorf("rolloverCounter was not updated when it rolled back, failed to handle out of order")
 	}
-	update()
+	s.updateRolloverCount(65530, roc)
 
-	roc, update = s.nextRolloverCount(5)
+	roc = s.nextRolloverCount(5)
 	if roc != 1 {
 		t.Errorf("rolloverCounter was not updated when it rolled over initial, to handle out of order")
 	}
-	update()
+	s.updateRolloverCount(5, roc)
 
-	_, update = s.nextRolloverCount(6)
-	update()
-	_, update = s.nextRolloverCount(7)
-	update()
-	roc, update = s.nextRolloverCount(8)
+	roc = s.nextRolloverCount(6)
+	s.updateRolloverCount(6, roc)
+	roc = s.nextRolloverCount(7)
+	s.updateRolloverCount(7, roc)
+	roc = s.nextRolloverCount(8)
 	if roc != 1 {
 		t.Errorf("rolloverCounter was improperly updated for non-significant packets")
 	}
-	update()
+	s.updateRolloverCount(8, roc)
 
 	// valid packets never update ROC
-	roc, update = s.nextRolloverCount(0x4000)
+	roc = s.nextRolloverCount(0x4000)
 	if roc != 1 {
 		t.Errorf("rolloverCounter was improperly updated for non-significant packets")
 	}
-	update()
-	roc, update = s.nextRolloverCount(0x8000)
+	s.updateRolloverCount(0x4000, roc)
+	roc = s.nextRolloverCount(0x8000)
 	if roc != 1 {
 		t.Errorf("rolloverCounter was improperly updated for non-significant packets")
 	}
-	update()
-	roc, update = s.nextRolloverCount(0xFFFF)
+	s.updateRolloverCount(0x8000, roc)
+	roc = s.nextRolloverCount(0xFFFF)
 	if roc != 1 {
 		t.Errorf("rolloverCounter was improperly updated for non-significant packets")
 	}
-	update()
-	roc, _ = s.nextRolloverCount(0)
+	s.updateRolloverCount(0xFFFF, roc)
+	roc = s.nextRolloverCount(0)
 	if roc != 2 {
 		t.Errorf("rolloverCounter must be incremented after wrapping, got %d", roc)
 	}
@@ -159,6 +159,11 @@ func TestRTPInvalidAuth(t *testing.T) {
 			t.Errorf("Managed to decrypt with incorrect salt for packet with SeqNum: %d", testCase.sequenceNumber)
 		}
 	}
+
+	// Packets failing authentication allocate no state for their SSRC
+	if states := invalidContext.SSRCStates(); len(states) != 0 {
+		t.Errorf("Expected no SSRC state, got %v", states)
+	}
 }
 
 func rtpTestCaseDecrypted() []byte { return []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05} }
@@ -357,8 +362,8 @@ func TestRTPReplayProtection(t *testing.T) {
 		assert.Equalf(actualDecrypted, decryptedRaw, "RTP packet with SeqNum invalid decryption: %d", testCase.sequenceNumber)
 
 		_, errReplay := decryptContext.DecryptRTP(decryptInput, decryptInput, decryptHeader)
-		if !errors.Is(errReplay, errDuplicated) {
-			t.Errorf("Replayed packet must be errored with %v, got %v", errDuplicated, errReplay)
+		if !errors.Is(errReplay, ErrReplayed) {
+			t.Errorf("Replayed packet must be errored with %v, got %v", ErrReplayed, errReplay)
 		}
 	}
 }
@@ -409,6 +414,117 @@ func BenchmarkEncryptRTPInPlace(b *testing.B) {
 	}
 }
 
+// zeroAllocContexts returns an encrypting and a decrypting context, created
+// with decryptOpts, for every setup that protects packets without allocating
+func zeroAllocContexts(tb testing.TB, decryptOpts ...ContextOption) map[string][2]*Context {
+	contexts := map[string][2]*Context{}
+	for profileName, profile := range map[string]ProtectionProfile{
+		"AES_128_CM_HMAC_SHA1_80": ProtectionProfileAes128CmHmacSha1_80,
+		"AEAD_AES_128_GCM":        ProtectionProfileAeadAes128Gcm,
+	} {
+		keyLen, err := profile.keyLen()
+		assert.NoError(tb, err)
+		saltLen, err := profile.saltLen()
+		assert.NoError(tb, err)
+
+		for name, opts := range map[string][]ContextOption{
+			profileName:          nil,
+			profileName + "/MKI": {MasterKeyIdentifier([]byte{0x01, 0x02, 0x03, 0x04})},
+		} {
+			encryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile, opts...)
+			assert.NoError(tb, err)
+			decryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile, append(opts, decryptOpts...)...)
+			assert.NoError(tb, err)
+			contexts[name] = [2]*Context{encryptContext, decryptContext}
+		}
+	}
+	return contexts
+}
+
+func TestContextZeroAllocs(t *testing.T) {
+	rtpPacket, err := (&rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1}, Payload: make([]byte, 1200)}).Marshal()
+	assert.NoError(t, err)
+	rtcpPacket := make([]byte, 1200)
+	rtcpPacket[0], rtcpPacket[1], rtcpPacket[7] = 0x80, 200, 1
+
+	for name, contexts := range zeroAllocContexts(t, SRTPReplayProtection(64), SRTCPReplayProtection(64)) {
+		encryptContext, decryptContext := contexts[0], contexts[1]
+		encrypted, decrypted := make([]byte, 0, 1500), make([]byte, 0, 1500)
+		rtpHeader := &rtp.Header{}
+
+		sequenceNumber := uint16(0)
+		allocs := testing.AllocsPerRun(100, func() {
+			sequenceNumber++
+			rtpPacket[2], rtpPacket[3] = byte(sequenceNumber>>8), byte(sequenceNumber)
+
+			out, err := encryptContext.EncryptRTP(encrypted, rtpPacket, rtpHeader)
+			assert.NoError(t, err)
+			_, err = decryptContext.DecryptRTP(decrypted, out, rtpHeader)
+			assert.NoError(t, err)
+		})
+		assert.Zero(t, allocs, "%s: SRTP", name)
+
+		allocs = testing.AllocsPerRun(100, func() {
+			out, err := encryptContext.EncryptRTCP(encrypted, rtcpPacket, nil)
+			assert.NoError(t, err)
+			_, err = decryptContext.DecryptRTCP(decrypted, out, nil)
+			assert.NoError(t, err)
+		})
+		assert.Zero(t, allocs, "%s: SRTCP", name)
+	}
+}
+
+func BenchmarkEncryptRTP1200(b *testing.B) {
+	pktRaw, err := (&rtp.Packet{Header: rtp.Header{Version: 2}, Payload: make([]byte, 1200)}).Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for name, contexts := range zeroAllocContexts(b) {
+		encryptContext := contexts[0]
+		b.Run(name, func(b *testing.B) {
+			buf, header := make([]byte, 0, 1500), &rtp.Header{}
+			b.SetBytes(int64(len(pktRaw)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := encryptContext.EncryptRTP(buf, pktRaw, header); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecryptRTP1200(b *testing.B) {
+	pktRaw, err := (&rtp.Packet{Header: rtp.Header{Version: 2}, Payload: make([]byte, 1200)}).Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Without replay protection the same packet can be decrypted again
+	for name, contexts := range zeroAllocContexts(b, SRTPNoReplayProtection()) {
+		encryptContext, decryptContext := contexts[0], contexts[1]
+		b.Run(name, func(b *testing.B) {
+			encrypted, err := encryptContext.EncryptRTP(nil, pktRaw, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf, header := make([]byte, 0, 1500), &rtp.Header{}
+			b.SetBytes(int64(len(encrypted)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := decryptContext.DecryptRTP(buf, encrypted, header); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkDecryptRTP(b *testing.B) {
 	sequenceNumber := uint16(5000)
 	encrypted := []byte{0x6d, 0xd3, 0x7e, 0xd5, 0x99, 0xb7, 0x2d, 0x28, 0xb1, 0xf3, 0xa1, 0xf0, 0xc, 0xfb, 0xfd, 0x8}
@@ -439,3 +555,569 @@ func BenchmarkDecryptRTP(b *testing.B) {
 		}
 	}
 }
+
+func TestEncryptRTPRawMatchesHeader(t *testing.T) {
+	for _, profile := range []ProtectionProfile{ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAeadAes128Gcm} {
+		keyLen, err := profile.keyLen()
+		assert.NoError(t, err)
+		saltLen, err := profile.saltLen()
+		assert.NoError(t, err)
+
+		headerContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile)
+		assert.NoError(t, err)
+		rawContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile)
+		assert.NoError(t, err)
+
+		header := &rtp.Header{Version: 2, SSRC: 0xcafebabe, SequenceNumber: 65535, CSRC: []uint32{1}}
+		headerRaw, err := header.Marshal()
+		assert.NoError(t, err)
+
+		// The second packet crosses a rollover
+		for i := 0; i < 2; i++ {
+			expected, err := headerContext.encryptRTP(nil, header, rtpTestCaseDecrypted())
+			assert.NoError(t, err)
+			actual, err := rawContext.encryptRTPRaw(nil, headerRaw, rtpTestCaseDecrypted())
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual, "profile %d", profile)
+
+			header.SequenceNumber++
+			headerRaw[2], headerRaw[3] = 0, 0
+		}
+	}
+}
+
+func TestRTPInPlace(t *testing.T) {
+	for _, profile := range []ProtectionProfile{ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAeadAes128Gcm} {
+		keyLen, err := profile.keyLen()
+		assert.NoError(t, err)
+		saltLen, err := profile.saltLen()
+		assert.NoError(t, err)
+
+		opts := []ContextOption{MasterKeyIdentifier([]byte{0x01, 0x02})}
+		encryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile, opts...)
+		assert.NoError(t, err)
+		decryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile, opts...)
+		assert.NoError(t, err)
+
+		plaintext, err := (&rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1, SequenceNumber: 1}, Payload: rtpTestCaseDecrypted()}).Marshal()
+		assert.NoError(t, err)
+
+		_, err = encryptContext.EncryptRTPInPlace(append([]byte{}, plaintext...), nil)
+		assert.ErrorIs(t, err, ErrShortBuffer, "profile %d", profile)
+
+		buf := make([]byte, len(plaintext), len(plaintext)+encryptContext.RTPOverhead())
+		copy(buf, plaintext)
+		encrypted, err := encryptContext.EncryptRTPInPlace(buf, nil)
+		assert.NoError(t, err)
+		assert.Same(t, &buf[0], &encrypted[0], "profile %d", profile)
+		assert.Equal(t, len(plaintext)+encryptContext.RTPOverhead(), len(encrypted))
+
+		decrypted, err := decryptContext.DecryptRTPInPlace(encrypted, nil)
+		assert.NoError(t, err)
+		assert.Same(t, &buf[0], &decrypted[0], "profile %d", profile)
+		assert.Equal(t, plaintext, decrypted, "profile %d", profile)
+	}
+}
+
+func TestContextOverhead(t *testing.T) {
+	for _, profile := range []ProtectionProfile{
+		ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAes256CmHmacSha1_32, ProtectionProfileAeadAes128Gcm,
+		ProtectionProfileAeadSeed128Ccm, ProtectionProfileDoubleAeadAes128Gcm,
+	} {
+		keyLen, err := profile.keyLen()
+		assert.NoError(t, err)
+		saltLen, err := profile.saltLen()
+		assert.NoError(t, err)
+		authTagLen, err := profile.AuthTagLen()
+		assert.NoError(t, err)
+		aeadOverhead, err := profile.AEADOverhead()
+		assert.NoError(t, err)
+
+		for _, mki := range [][]byte{nil, {0x01, 0x02, 0x03, 0x04}} {
+			opts := []ContextOption{}
+			if mki != nil {
+				opts = append(opts, MasterKeyIdentifier(mki))
+			}
+			c, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile, opts...)
+			assert.NoError(t, err)
+			assert.Equal(t, authTagLen+aeadOverhead+len(mki), c.SRTPOverhead(), "profile %d", profile)
+
+			plaintext, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 1}, Payload: rtpTestCaseDecrypted()}).Marshal()
+			assert.NoError(t, err)
+			encrypted, err := c.EncryptRTP(nil, plaintext, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, len(plaintext)+c.SRTPOverhead(), len(encrypted), "profile %d", profile)
+
+			rtcpPlaintext := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+			encrypted, err = c.EncryptRTCP(nil, rtcpPlaintext, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, len(rtcpPlaintext)+c.SRTCPOverhead(), len(encrypted), "profile %d", profile)
+		}
+	}
+
+	_, err := ProtectionProfile(0).AuthTagLen()
+	assert.ErrorIs(t, err, ErrUnsupportedProfile)
+	_, err = ProtectionProfile(0).AEADOverhead()
+	assert.ErrorIs(t, err, ErrUnsupportedProfile)
+}
+
+func TestErrorClasses(t *testing.T) {
+	_, err := CreateContext(make([]byte, 16), make([]byte, 14), ProtectionProfile(0))
+	assert.ErrorIs(t, err, ErrUnsupportedProfile)
+
+	for _, profile := range []ProtectionProfile{ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAeadAes128Gcm, ProtectionProfileAeadSeed128Ccm} {
+		keyLen, err := profile.keyLen()
+		assert.NoError(t, err)
+		saltLen, err := profile.saltLen()
+		assert.NoError(t, err)
+		encryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile)
+		assert.NoError(t, err)
+		decryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile, SRTPReplayProtection(64))
+		assert.NoError(t, err)
+
+		raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 1}, Payload: rtpTestCaseDecrypted()}).Marshal()
+		assert.NoError(t, err)
+		_, err = encryptContext.EncryptRTPInPlace(raw[:len(raw):len(raw)], nil)
+		assert.ErrorIs(t, err, ErrShortBuffer, "profile %d", profile)
+
+		encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, err)
+		tampered := append([]byte{}, encrypted...)
+		tampered[len(tampered)-1] ^= 0xff
+		_, err = decryptContext.DecryptRTP(nil, tampered, nil)
+		assert.ErrorIs(t, err, ErrAuthenticationFailure, "profile %d", profile)
+
+		_, err = decryptContext.DecryptRTP(nil, encrypted, nil)
+		assert.NoError(t, err)
+		_, err = decryptContext.DecryptRTP(nil, encrypted, nil)
+		assert.ErrorIs(t, err, ErrReplayed, "profile %d", profile)
+		var duplicated *DuplicatedError
+		assert.ErrorAs(t, err, &duplicated)
+	}
+}
+
+func TestParseProtected(t *testing.T) {
+	for _, profile := range []ProtectionProfile{ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAeadAes128Gcm} {
+		keyLen, err := profile.keyLen()
+		assert.NoError(t, err)
+		saltLen, err := profile.saltLen()
+		assert.NoError(t, err)
+		authTagLen, err := profile.authTagLen()
+		assert.NoError(t, err)
+		aeadAuthTagLen, err := profile.aeadAuthTagLen()
+		assert.NoError(t, err)
+
+		c, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile)
+		assert.NoError(t, err)
+
+		header := &rtp.Header{Version: 2, SSRC: 0xcafebabe, SequenceNumber: 1, CSRC: []uint32{1}}
+		headerRaw, err := header.Marshal()
+		assert.NoError(t, err)
+		encrypted, err := c.encryptRTP(nil, header, rtpTestCaseDecrypted())
+		assert.NoError(t, err)
+
+		p, err := ParseProtected(encrypted, profile, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, header.SSRC, p.Header.SSRC)
+		assert.Equal(t, headerRaw, p.HeaderRaw)
+		assert.Equal(t, len(rtpTestCaseDecrypted()), len(p.Ciphertext))
+		assert.Equal(t, authTagLen+aeadAuthTagLen, len(p.AuthTag))
+		assert.Equal(t, encrypted[len(encrypted)-len(p.AuthTag):], p.AuthTag)
+		assert.Empty(t, p.MKI)
+
+		// MKI sits between payload and HMAC tag, but after the AEAD tag
+		mki := []byte{0xAA, 0xBB, 0xCC, 0xDD}
+		withMKI := append([]byte{}, encrypted[:len(encrypted)-authTagLen]...)
+		withMKI = append(withMKI, mki...)
+		withMKI = append(withMKI, encrypted[len(encrypted)-authTagLen:]...)
+
+		p, err = ParseProtected(withMKI, profile, len(mki))
+		assert.NoError(t, err)
+		assert.Equal(t, mki, p.MKI)
+		assert.Equal(t, encrypted[len(headerRaw):len(headerRaw)+len(rtpTestCaseDecrypted())], p.Ciphertext)
+
+		_, err = ParseProtected(encrypted[:len(headerRaw)+authTagLen+aeadAuthTagLen-1], profile, 0)
+		assert.ErrorIs(t, err, errTooShortSRTP)
+	}
+
+	_, err := ParseProtected(nil, 0, 0)
+	assert.ErrorIs(t, err, ErrUnsupportedProfile)
+}
+
+func TestRTPDuplicateBehavior(t *testing.T) {
+	encryptContext, err := buildTestContext()
+	assert.NoError(t, err)
+
+	plaintext, err := (&rtp.Packet{Header: rtp.Header{SSRC: 5000, SequenceNumber: 1}, Payload: rtpTestCaseDecrypted()}).Marshal()
+	assert.NoError(t, err)
+	encrypted, err := encryptContext.EncryptRTP(nil, plaintext, nil)
+	assert.NoError(t, err)
+
+	var reported []*DuplicatedError
+	for name, tc := range map[string]struct {
+		opt        ContextOption
+		assertDupe func(decrypted []byte, err error)
+	}{
+		"Error": {
+			opt: SRTPReplayProtection(64),
+			assertDupe: func(decrypted []byte, err error) {
+				var dupErr *DuplicatedError
+				assert.True(t, errors.As(err, &dupErr))
+				assert.Equal(t, &DuplicatedError{Proto: "srtp", SSRC: 5000, Index: 1}, dupErr)
+			},
+		},
+		"Drop": {
+			opt: DropDuplicates(),
+			assertDupe: func(decrypted []byte, err error) {
+				assert.NoError(t, err)
+				assert.Nil(t, decrypted)
+			},
+		},
+		"Callback": {
+			opt: OnDuplicate(func(err *DuplicatedError) {
+				reported = append(reported, err)
+			}),
+			assertDupe: func(decrypted []byte, err error) {
+				assert.NoError(t, err)
+				assert.Nil(t, decrypted)
+				assert.Equal(t, []*DuplicatedError{{Proto: "srtp", SSRC: 5000, Index: 1}}, reported)
+			},
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			decryptContext, err := buildTestContext(SRTPReplayProtection(64), tc.opt)
+			assert.NoError(t, err)
+
+			decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+
+			tc.assertDupe(decryptContext.DecryptRTP(nil, encrypted, nil))
+		})
+	}
+}
+
+func TestRTPROCProbing(t *testing.T) {
+	for _, profile := range []ProtectionProfile{ProtectionProfileAes128CmHmacSha1_80, ProtectionProfileAeadAes128Gcm} {
+		keyLen, err := profile.keyLen()
+		assert.NoError(t, err)
+		saltLen, err := profile.saltLen()
+		assert.NoError(t, err)
+
+		encryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile)
+		assert.NoError(t, err)
+
+		// The receiver misses everything between 10 and 20, so it does not know 20 follows a rollover
+		var encrypted [][]byte
+		for _, seq := range []uint16{10, 30000, 65500, 20} {
+			pkt, perr := encryptSRTP(encryptContext, &rtp.Packet{Header: rtp.Header{SSRC: 5000, SequenceNumber: seq}, Payload: rtpTestCaseDecrypted()})
+			assert.NoError(t, perr)
+			encrypted = append(encrypted, pkt)
+		}
+
+		for _, probing := range []bool{false, true} {
+			opts := []ContextOption{}
+			if probing {
+				opts = append(opts, SRTPROCProbing())
+			}
+			decryptContext, err := CreateContext(make([]byte, keyLen), make([]byte, saltLen), profile, opts...)
+			assert.NoError(t, err)
+
+			_, err = decryptContext.DecryptRTP(nil, encrypted[0], nil)
+			assert.NoError(t, err)
+
+			// Decrypt in place, probing must not be fooled by a failed attempt clearing the buffer
+			in := append([]byte{}, encrypted[3]...)
+			decrypted, err := decryptContext.DecryptRTP(in, in, nil)
+			if !probing {
+				assert.Error(t, err, "profile %d", profile)
+				continue
+			}
+			assert.NoError(t, err, "profile %d", profile)
+			assert.Equal(t, rtpTestCaseDecrypted(), decrypted[12:])
+
+			roc := decryptContext.getSRTPSSRCState(5000).nextRolloverCount(21)
+			assert.Equal(t, uint32(1), roc)
+		}
+	}
+}
+
+func TestContextSetSSRCKeys(t *testing.T) {
+	newKey := []byte{0xE1, 0xF9, 0x7A, 0x0D, 0x3E, 0x01, 0x8B, 0xE0, 0xD6, 0x4F, 0xA3, 0x2C, 0x06, 0xDE, 0x41, 0x39}
+	newSalt := []byte{0x0E, 0xC6, 0x75, 0xAD, 0x49, 0x8A, 0xFE, 0xEB, 0xB6, 0x96, 0x0B, 0x3A, 0xAB, 0xE6}
+
+	encryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptContext, err := buildTestContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = encryptContext.SetSSRCKeys(1, newKey[:8], newSalt); !errors.Is(err, errShortSrtpMasterKey) {
+		t.Fatalf("Expected %v, got %v", errShortSrtpMasterKey, err)
+	}
+	if err = encryptContext.SetSSRCKeys(1, newKey, newSalt); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(ssrc uint32) []byte {
+		pkt := &rtp.Packet{Header: rtp.Header{SSRC: ssrc, SequenceNumber: 5000}, Payload: rtpTestCaseDecrypted()}
+		raw, marshalErr := pkt.Marshal()
+		assert.NoError(t, marshalErr)
+		encrypted, encryptErr := encryptContext.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, encryptErr)
+		return encrypted
+	}
+
+	// Other SSRCs keep using the context's keys
+	if _, err = decryptContext.DecryptRTP(nil, encrypt(2), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decryptContext.DecryptRTP(nil, encrypt(1), nil); err == nil {
+		t.Fatal("Packet protected with the SSRC's keys must not decrypt with the context's")
+	}
+
+	if err = decryptContext.SetSSRCKeys(1, newKey, newSalt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decryptContext.DecryptRTP(nil, encrypt(1), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+	encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptedRTCP, err := decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rtcpPacket, decryptedRTCP)
+}
+
+func TestContextUpdateKeys(t *testing.T) {
+	keys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+
+	encryptContext, err := buildTestContext()
+	assert.NoError(t, err)
+	decryptContext, err := buildTestContext()
+	assert.NoError(t, err)
+
+	roundTrip := func(seq uint16) error {
+		raw, marshalErr := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: seq}, Payload: rtpTestCaseDecrypted()}).Marshal()
+		assert.NoError(t, marshalErr)
+		encrypted, encryptErr := encryptContext.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, encryptErr)
+		_, decryptErr := decryptContext.DecryptRTP(nil, encrypted, nil)
+		return decryptErr
+	}
+	assert.NoError(t, roundTrip(65535))
+
+	assert.True(t, errors.Is(encryptContext.UpdateKeys(keys.LocalMasterKey[:8], keys.LocalMasterSalt), errShortSrtpMasterKey))
+	assert.NoError(t, encryptContext.UpdateKeys(keys.LocalMasterKey, keys.LocalMasterSalt))
+	assert.Error(t, roundTrip(0))
+
+	// The rollover counter survives the new keys
+	assert.NoError(t, decryptContext.UpdateKeys(keys.LocalMasterKey, keys.LocalMasterSalt))
+	assert.NoError(t, roundTrip(1))
+	roc, ok := decryptContext.ROC(1)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1), roc)
+}
+
+func TestContextWipe(t *testing.T) {
+	keys, err := generateLoopbackKeys(ProtectionProfileAeadAria128Gcm)
+	assert.NoError(t, err)
+
+	c, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAeadAria128Gcm)
+	assert.NoError(t, err)
+	assert.NoError(t, c.SetSSRCKeys(2, keys.RemoteMasterKey, keys.RemoteMasterSalt))
+
+	var ciphers []*srtpCipherAeadAesGcm
+	for _, cipher := range []srtpCipher{c.cipher, c.ssrcCiphers[2]} {
+		aead, ok := cipher.(*srtpCipherAeadAesGcm)
+		assert.True(t, ok)
+		ciphers = append(ciphers, aead)
+	}
+
+	raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 1}, Payload: rtpTestCaseDecrypted()}).Marshal()
+	assert.NoError(t, err)
+	encrypted, err := c.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+
+	c.Wipe()
+	for _, cipher := range ciphers {
+		assert.Equal(t, make([]byte, 12), cipher.srtpSessionSalt)
+		assert.Equal(t, make([]byte, 12), cipher.srtcpSessionSalt)
+		aria, ok := cipher.srtpBlock.(*ariaCipher)
+		assert.True(t, ok)
+		assert.Equal(t, [ariaMaxRounds + 1][ariaBlockSize]byte{}, aria.enc)
+	}
+
+	_, err = c.EncryptRTP(nil, raw, nil)
+	assert.True(t, errors.Is(err, errContextWiped))
+	_, err = c.DecryptRTP(nil, encrypted, nil)
+	assert.True(t, errors.Is(err, errContextWiped))
+	_, err = c.EncryptRTCP(nil, []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}, nil)
+	assert.True(t, errors.Is(err, errContextWiped))
+}
+
+func TestRTPAesCmProfiles(t *testing.T) {
+	for _, profile := range []ProtectionProfile{
+		ProtectionProfileAes192CmHmacSha1_80, ProtectionProfileAes192CmHmacSha1_32,
+		ProtectionProfileAes256CmHmacSha1_80, ProtectionProfileAes256CmHmacSha1_32,
+	} {
+		keys, err := generateLoopbackKeys(profile)
+		assert.NoError(t, err)
+		keyLen, err := profile.keyLen()
+		assert.NoError(t, err)
+		assert.Len(t, keys.LocalMasterKey, keyLen)
+
+		encryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+		decryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+
+		authTagLen, err := profile.authTagLen()
+		assert.NoError(t, err)
+
+		pkt := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 5000}, Payload: rtpTestCaseDecrypted()}
+		raw, err := pkt.Marshal()
+		assert.NoError(t, err)
+
+		encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, err)
+		assert.Len(t, encrypted, len(raw)+authTagLen)
+
+		tampered := append([]byte{}, encrypted...)
+		tampered[len(tampered)-1] ^= 0xFF
+		_, err = decryptContext.DecryptRTP(nil, tampered, nil)
+		assert.True(t, errors.Is(err, ErrAuthenticationFailure))
+
+		decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, raw, decrypted)
+
+		rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+		encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+		assert.NoError(t, err)
+		assert.Len(t, encryptedRTCP, len(rtcpPacket)+srtcpIndexSize+authTagLen)
+
+		decryptedRTCP, err := decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, rtcpPacket, decryptedRTCP)
+	}
+}
+
+func TestNullCipherProfiles(t *testing.T) {
+	for _, profile := range []ProtectionProfile{ProtectionProfileNullHmacSha1_80, ProtectionProfileNullHmacSha1_32, ProtectionProfileNull} {
+		keys, err := generateLoopbackKeys(profile)
+		assert.NoError(t, err)
+
+		_, err = NewSessionSRTP(newNoopConn(), &Config{Profile: profile, Keys: keys})
+		assert.True(t, errors.Is(err, errNullCipherNotAllowed))
+
+		encryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+		decryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, profile)
+		assert.NoError(t, err)
+
+		authTagLen, err := profile.authTagLen()
+		assert.NoError(t, err)
+
+		pkt := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 5000}, Payload: rtpTestCaseDecrypted()}
+		raw, err := pkt.Marshal()
+		assert.NoError(t, err)
+
+		encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, raw, encrypted[:len(raw)], "payload must be left in the clear")
+
+		if authTagLen > 0 {
+			tampered := append([]byte{}, encrypted...)
+			tampered[len(raw)-1] ^= 0xFF
+			_, err = decryptContext.DecryptRTP(nil, tampered, nil)
+			assert.True(t, errors.Is(err, ErrAuthenticationFailure))
+		}
+
+		decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, raw, decrypted)
+
+		rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+		encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, rtcpPacket, encryptedRTCP[:len(rtcpPacket)])
+		assert.Equal(t, byte(0), encryptedRTCP[len(rtcpPacket)]>>7, "E flag must not be set")
+
+		if authTagLen > 0 {
+			tampered := append([]byte{}, encryptedRTCP...)
+			tampered[len(rtcpPacket)-1] ^= 0xFF
+			_, err = decryptContext.DecryptRTCP(nil, tampered, nil)
+			assert.True(t, errors.Is(err, ErrAuthenticationFailure))
+		}
+
+		decryptedRTCP, err := decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, rtcpPacket, decryptedRTCP)
+	}
+}
+
+func TestAuthenticationOnly(t *testing.T) {
+	keys, err := generateLoopbackKeys(ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+
+	_, err = NewSessionSRTP(newNoopConn(), &Config{Profile: ProtectionProfileAes128CmHmacSha1_80, Keys: keys, AuthenticationOnly: true})
+	assert.True(t, errors.Is(err, errNullCipherNotAllowed))
+	_, err = CreateContext(make([]byte, 16), make([]byte, 12), ProtectionProfileAeadAes128Gcm, AuthenticationOnly())
+	assert.True(t, errors.Is(err, errAuthenticationOnlyNotHMAC))
+
+	encryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80, AuthenticationOnly())
+	assert.NoError(t, err)
+	decryptContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80,
+		AuthenticationOnly(), SRTPReplayProtection(64), SRTCPReplayProtection(64))
+	assert.NoError(t, err)
+	// The NULL cipher profile derives the same keys
+	nullContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileNullHmacSha1_80)
+	assert.NoError(t, err)
+
+	raw, err := (&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 5000}, Payload: rtpTestCaseDecrypted()}).Marshal()
+	assert.NoError(t, err)
+	encrypted, err := encryptContext.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, encrypted[:len(raw)], "payload must be left in the clear")
+	expected, err := nullContext.EncryptRTP(nil, raw, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, encrypted)
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(raw)-1] ^= 0xFF
+	_, err = decryptContext.DecryptRTP(nil, tampered, nil)
+	assert.True(t, errors.Is(err, ErrAuthenticationFailure))
+	decrypted, err := decryptContext.DecryptRTP(nil, encrypted, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, decrypted)
+	_, err = decryptContext.DecryptRTP(nil, encrypted, nil)
+	assert.True(t, errors.Is(err, ErrReplayed))
+
+	rtcpPacket := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+	encryptedRTCP, err := encryptContext.EncryptRTCP(nil, rtcpPacket, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, rtcpPacket, encryptedRTCP[:len(rtcpPacket)])
+	assert.Equal(t, byte(0), encryptedRTCP[len(rtcpPacket)]>>7, "E flag must not be set")
+
+	// Receivers that encrypt their own SRTCP accept it as well
+	encryptingContext, err := CreateContext(keys.LocalMasterKey, keys.LocalMasterSalt, ProtectionProfileAes128CmHmacSha1_80)
+	assert.NoError(t, err)
+	for _, c := range []*Context{decryptContext, encryptingContext} {
+		decryptedRTCP, err := c.DecryptRTCP(nil, encryptedRTCP, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, rtcpPacket, decryptedRTCP)
+	}
+	_, err = decryptContext.DecryptRTCP(nil, encryptedRTCP, nil)
+	assert.True(t, errors.Is(err, ErrReplayed))
+}
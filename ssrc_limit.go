@@ -0,0 +1,133 @@
+package srtp
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// SSRCLimitPolicy decides what happens to a new SSRC once a Context tracks
+// as many as MaxSSRCStates allows
+type SSRCLimitPolicy int
+
+const (
+	// SSRCLimitEvict forgets the state of the least recently used SSRC.
+	// Contexts used for encryption reject new SSRCs instead.
+	SSRCLimitEvict SSRCLimitPolicy = iota
+	// SSRCLimitReject fails the packets of new SSRCs
+	SSRCLimitReject
+)
+
+// ssrcLRU orders SSRCs from the most to the least recently used
+type ssrcLRU struct {
+	order    *list.List
+	elements map[uint32]*list.Element
+}
+
+func newSSRCLRU() *ssrcLRU {
+	return &ssrcLRU{order: list.New(), elements: map[uint32]*list.Element{}}
+}
+
+func (l *ssrcLRU) touch(ssrc uint32) {
+	if e, ok := l.elements[ssrc]; ok {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.elements[ssrc] = l.order.PushFront(ssrc)
+}
+
+func (l *ssrcLRU) remove(ssrc uint32) {
+	if e, ok := l.elements[ssrc]; ok {
+		l.order.Remove(e)
+		delete(l.elements, ssrc)
+	}
+}
+
+func (l *ssrcLRU) oldest() uint32 {
+	ssrc, _ := l.order.Back().Value.(uint32)
+	return ssrc
+}
+
+// admitSSRC fails if a new SSRC may not be tracked on top of the n ones
+func (c *Context) admitSSRC(proto string, ssrc uint32, n int) error {
+	if c.ssrcLimitPolicy == SSRCLimitReject && n >= c.maxSSRCStates {
+		return fmt.Errorf("%w: %s ssrc=%d", errTooManySSRCs, proto, ssrc)
+	}
+	return nil
+}
+
+// admitEncryptionSSRC fails if a new SSRC may not be protected on top of the
+// n ones. Encryption never evicts whatever the policy: the state of a sender
+// SSRC coming back would restart its ROC or SRTCP index under the same
+// session key, and reuse keystream.
+func (c *Context) admitEncryptionSSRC(proto string, ssrc uint32, n int) error {
+	if n >= c.maxSSRCStates {
+		return fmt.Errorf("%w: %s ssrc=%d", errTooManySSRCs, proto, ssrc)
+	}
+	return nil
+}
+
+// srtpStateForEncryption returns the state of ssrc, applying the SSRC limit
+func (c *Context) srtpStateForEncryption(ssrc uint32) (*srtpSSRCState, error) {
+	if c.maxSSRCStates == 0 {
+		return c.getSRTPSSRCState(ssrc), nil
+	}
+
+	if _, ok := c.srtpSSRCStates[ssrc]; !ok {
+		if err := c.admitEncryptionSSRC("srtp", ssrc, len(c.srtpSSRCStates)); err != nil {
+			return nil, err
+		}
+	}
+	s := c.getSRTPSSRCState(ssrc)
+	c.srtpLRU.touch(ssrc)
+	return s, nil
+}
+
+// srtcpStateForEncryption returns the state of ssrc, applying the SSRC limit
+func (c *Context) srtcpStateForEncryption(ssrc uint32) (*srtcpSSRCState, error) {
+	if c.maxSSRCStates == 0 {
+		return c.getSRTCPSSRCState(ssrc), nil
+	}
+
+	if _, ok := c.srtcpSSRCStates[ssrc]; !ok {
+		if err := c.admitEncryptionSSRC("srtcp", ssrc, len(c.srtcpSSRCStates)); err != nil {
+			return nil, err
+		}
+	}
+	s := c.getSRTCPSSRCState(ssrc)
+	c.srtcpLRU.touch(ssrc)
+	return s, nil
+}
+
+// trackSRTPSSRC marks ssrc as the most recently used, evicting the least
+// recently used states beyond the limit
+func (c *Context) trackSRTPSSRC(ssrc uint32) {
+	c.srtpLRU.touch(ssrc)
+	for c.ssrcLimitPolicy == SSRCLimitEvict && len(c.srtpSSRCStates) > c.maxSSRCStates {
+		oldest := c.srtpLRU.oldest()
+		c.forgetSRTPSSRC(oldest)
+		if c.onSRTPEvicted != nil {
+			c.onSRTPEvicted(oldest)
+		}
+	}
+}
+
+func (c *Context) trackSRTCPSSRC(ssrc uint32) {
+	c.srtcpLRU.touch(ssrc)
+	for c.ssrcLimitPolicy == SSRCLimitEvict && len(c.srtcpSSRCStates) > c.maxSSRCStates {
+		c.forgetSRTCPSSRC(c.srtcpLRU.oldest())
+	}
+}
+
+func (c *Context) forgetSRTPSSRC(ssrc uint32) {
+	delete(c.srtpSSRCStates, ssrc)
+	if c.srtpLRU != nil {
+		c.srtpLRU.remove(ssrc)
+	}
+}
+
+func (c *Context) forgetSRTCPSSRC(ssrc uint32) {
+	delete(c.srtcpSSRCStates, ssrc)
+	if c.srtcpLRU != nil {
+		c.srtcpLRU.remove(ssrc)
+	}
+}
@@ -1,8 +1,81 @@
 package srtp
 
+import (
+	"io"
+	"time"
+)
+
 type readStream interface {
 	init(child streamSession, ssrc uint32) error
+	createdAt() time.Time
+	bitrate() uint64
+	packetCount() uint64
+	droppedCount() uint64
 
 	Read(buf []byte) (int, error)
 	GetSSRC() uint32
+	close(reason StreamCloseReason) error
+}
+
+// setBufferReadDeadline sets the read deadline of the buffer of a read stream
+func setBufferReadDeadline(buffer io.ReadWriteCloser, t time.Time) error {
+	b, ok := buffer.(interface {
+		SetReadDeadline(time.Time) error
+	})
+	if !ok {
+		return errReadDeadlineNotSupported
+	}
+	return b.SetReadDeadline(t)
+}
+
+// StreamCloseReason describes why a read stream was closed
+type StreamCloseReason int
+
+// Reasons passed to Config.OnStreamClosed
+const (
+	// StreamClosedByApplication means Close was called on the read stream
+	StreamClosedByApplication StreamCloseReason = iota + 1
+	// StreamClosedByGoodbye means a RTCP BYE was received for the SSRC
+	StreamClosedByGoodbye
+	// StreamClosedBySession means the session or its inbound direction was closed
+	StreamClosedBySession
+	// StreamClosedByLimit means the SSRC state was evicted, see Config.MaxSSRCStates
+	StreamClosedByLimit
+)
+
+// ReadStreamStats are the counters of a read stream, see ReadStreamSRTP.Stats
+type ReadStreamStats struct {
+	// Packets and Bytes count the packets delivered to the stream, Bytes
+	// their size while still protected. LastPacket is when the last one was.
+	Packets, Bytes uint64
+	LastPacket     time.Time
+	// QueueDrops counts those dropped by the full queue of the stream
+	QueueDrops uint64
+
+	// Crypto counts the packets of the SSRC the session decrypted, and those
+	// failing authentication or replay protection
+	Crypto CryptoStats
+	// LastIndex is the highest authenticated SRTP index of SRTP streams, and
+	// the last SRTCP index of SRTCP streams
+	LastIndex uint64
+}
+
+// StreamInfo describes a read stream known to a session.
+// The stream itself can be retrieved with OpenReadStream.
+type StreamInfo struct {
+	SSRC    uint32
+	Created time.Time
+
+	// Bitrate is the inbound protected bits per second, see Config.BitrateWindow
+	Bitrate uint64
+	// Packets is the number of packets delivered to the stream
+	Packets uint64
+	// Dropped is the number of those its full queue dropped, see
+	// Config.ReadStreamQueueSize
+	Dropped uint64
+
+	// ROC is the rollover counter of SRTP streams. LastIndex is their highest
+	// authenticated SRTP index, and the last SRTCP index of SRTCP streams.
+	ROC       uint32
+	LastIndex uint64
 }
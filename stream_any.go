@@ -0,0 +1,89 @@
+package srtp
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/pion/transport/packetio"
+)
+
+// ReadStreamAny delivers the decrypted packets of every SSRC of a session in
+// a single queue, see SessionSRTP.OpenReadStreamAny
+type ReadStreamAny struct {
+	session *session
+	buffer  io.ReadWriteCloser
+}
+
+func newReadStreamAny(s *session, limitSize int) *ReadStreamAny {
+	buffer := packetio.NewBuffer()
+	buffer.SetLimitSize(limitSize)
+	if s.readQueueSize > 0 {
+		buffer.SetLimitCount(s.readQueueSize)
+	}
+	return &ReadStreamAny{session: s, buffer: newBudgetBuffer(buffer, s.queueBudget)}
+}
+
+// Read reads the next decrypted packet of any SSRC into buf, returning the
+// SSRC along. That is the sender SSRC of SRTCP packets.
+func (r *ReadStreamAny) Read(buf []byte) (int, uint32, error) {
+	n, err := r.buffer.Read(buf)
+	if err != nil {
+		return n, 0, err
+	}
+	ssrc, _ := r.session.child.packetSSRC(buf[:n])
+	return n, ssrc, nil
+}
+
+// SetReadDeadline sets the deadline for the Read operation.
+// Setting to zero means no deadline.
+func (r *ReadStreamAny) SetReadDeadline(t time.Time) error {
+	return setBufferReadDeadline(r.buffer, t)
+}
+
+// Close stops the delivery of packets to the stream
+func (r *ReadStreamAny) Close() error {
+	r.session.readStreamsLock.Lock()
+	if r.session.anyStream == r {
+		r.session.anyStream = nil
+	}
+	r.session.readStreamsLock.Unlock()
+
+	return r.buffer.Close()
+}
+
+// write queues buf, it is called with decryptMutex held
+func (r *ReadStreamAny) write(buf []byte) error {
+	_, err := r.buffer.Write(buf)
+	if errors.Is(err, packetio.ErrFull) {
+		r.session.queueDrops++
+		return nil
+	}
+	return err
+}
+
+// openReadStreamAny returns the stream of every SSRC, creating it if needed
+func (s *session) openReadStreamAny(limitSize int) (*ReadStreamAny, error) {
+	s.readStreamsLock.Lock()
+	defer s.readStreamsLock.Unlock()
+
+	if s.readStreamsClosed {
+		return nil, ErrSessionClosed
+	} else if s.anyStream == nil {
+		s.anyStream = newReadStreamAny(s, limitSize)
+	}
+	return s.anyStream, nil
+}
+
+// writeAny hands a decrypted packet to the stream of every SSRC, if open.
+// It must be called with decryptMutex held.
+func (s *session) writeAny(buf []byte) error {
+	s.readStreamsLock.Lock()
+	anyStream := s.anyStream
+	s.readStreamsLock.Unlock()
+
+	if anyStream == nil {
+		return nil
+	}
+	return anyStream.write(buf)
+}
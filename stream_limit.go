@@ -0,0 +1,39 @@
+package srtp
+
+import "time"
+
+// tokenBucket limits the rate of read streams created by received packets,
+// see Config.MaxNewStreamsPerSecond. It is guarded by decryptMutex.
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+// newTokenBucket returns a bucket refilled with rate tokens per second, up to
+// burst, or nil if rate is not positive
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	} else if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst)}
+}
+
+// take takes a token, returning false if none is left
+func (b *tokenBucket) take(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
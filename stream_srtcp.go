@@ -17,20 +17,50 @@ const srtcpBufferSize = 100 * 1000
 type ReadStreamSRTCP struct {
 	mu sync.Mutex
 
-	isInited bool
-	isClosed chan bool
+	isInited      bool
+	isClosed      chan bool
+	closeReported bool
 
 	session *SessionSRTCP
 	ssrc    uint32
+	created time.Time
+
+	readBitrate *bitrateEstimator
+	packets     uint64
+	bytes       uint64
+	dropped     uint64
+	lastPacket  time.Time
 
 	buffer io.ReadWriteCloser
+
+	// Compounds unmarshaled during decryption, in the order of the packets in
+	// the default buffer, see ReadStreamSRTP.keepHeaders
+	keepCompounds bool
+	compoundsMu   sync.Mutex
+	compounds     [][]rtcp.Packet
 }
 
-func (r *ReadStreamSRTCP) write(buf []byte) (n int, err error) {
+func (r *ReadStreamSRTCP) write(buf []byte, compound []rtcp.Packet) (n int, err error) {
+	if r.keepCompounds {
+		r.compoundsMu.Lock()
+		r.compounds = append(r.compounds, compound)
+		r.compoundsMu.Unlock()
+	}
+
 	n, err = r.buffer.Write(buf)
+	if err != nil && r.keepCompounds {
+		r.compoundsMu.Lock()
+		r.compounds[len(r.compounds)-1] = nil
+		r.compounds = r.compounds[:len(r.compounds)-1]
+		r.compoundsMu.Unlock()
+	}
 
 	if errors.Is(err, packetio.ErrFull) {
 		// Silently drop data when the buffer is full.
+		r.mu.Lock()
+		r.dropped++
+		r.mu.Unlock()
+		r.session.session.queueDrops++ // decryptMutex is held
 		return len(buf), nil
 	}
 
@@ -58,41 +88,97 @@ func (r *ReadStreamSRTCP) ReadRTCP(buf []byte) (int, *rtcp.Header, error) {
 	return n, header, nil
 }
 
+// ReadRTCPPackets reads and decrypts the next compound RTCP packet into buf,
+// returning the packets unmarshaled during decryption and the header of the
+// first one. The packets are shared with the other streams the compound was
+// delivered to and must not be modified.
+func (r *ReadStreamSRTCP) ReadRTCPPackets(buf []byte) ([]rtcp.Packet, *rtcp.Header, error) {
+	n, compound, err := r.read(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := &rtcp.Header{}
+	if err = header.Unmarshal(buf[:n]); err != nil {
+		return nil, nil, err
+	}
+
+	if compound == nil {
+		if compound, err = rtcp.Unmarshal(buf[:n]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return compound, header, nil
+}
+
 // Read reads and decrypts full RTCP packet from the nextConn
 func (r *ReadStreamSRTCP) Read(buf []byte) (int, error) {
-	return r.buffer.Read(buf)
+	n, _, err := r.read(buf)
+	return n, err
+}
+
+// read returns the next packet with the compound unmarshaled during its
+// decryption, if it was kept
+func (r *ReadStreamSRTCP) read(buf []byte) (int, []rtcp.Packet, error) {
+	n, err := r.buffer.Read(buf)
+	if !r.keepCompounds || (err != nil && !errors.Is(err, io.ErrShortBuffer)) {
+		return n, nil, err
+	}
+
+	// The packet was consumed, even if it did not fit in buf
+	r.compoundsMu.Lock()
+	defer r.compoundsMu.Unlock()
+	if len(r.compounds) == 0 {
+		return n, nil, err
+	}
+	compound := r.compounds[0]
+	r.compounds[0] = nil
+	r.compounds = r.compounds[1:]
+	return n, compound, err
 }
 
 // SetReadDeadline sets the deadline for the Read operation.
-// Setting to zero means no deadline.
+// Setting to zero means no deadline. It fails for buffers of
+// Config.BufferFactory without a SetReadDeadline method.
 func (r *ReadStreamSRTCP) SetReadDeadline(t time.Time) error {
-	if b, ok := r.buffer.(interface {
-		SetReadDeadline(time.Time) error
-	}); ok {
-		return b.SetReadDeadline(t)
-	}
-	return nil
+	return setBufferReadDeadline(r.buffer, t)
 }
 
-// Close removes the ReadStream from the session and cleans up any associated state
+// Close removes the ReadStream from the session and cleans up any associated state.
+// Packets received for the SSRC later create a new stream, unless the session
+// ignores it, see IgnoreSSRC.
 func (r *ReadStreamSRTCP) Close() error {
+	return r.close(StreamClosedByApplication)
+}
+
+func (r *ReadStreamSRTCP) close(reason StreamCloseReason) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
 
 	if !r.isInited {
+		r.mu.Unlock()
 		return errStreamNotInited
 	}
 
 	select {
 	case <-r.isClosed:
+		r.mu.Unlock()
 		return errStreamAlreadyClosed
 	default:
 		err := r.buffer.Close()
 		if err != nil {
+			r.mu.Unlock()
 			return err
 		}
 
 		r.session.removeReadStream(r.ssrc)
+
+		report := !r.closeReported
+		r.closeReported = true
+		r.mu.Unlock()
+
+		if report {
+			r.session.streamClosed(r.ssrc, reason)
+		}
 		return nil
 	}
 }
@@ -110,6 +196,8 @@ func (r *ReadStreamSRTCP) init(child streamSession, ssrc uint32) error {
 
 	r.session = sessionSRTCP
 	r.ssrc = ssrc
+	r.created = time.Now()
+	r.readBitrate = newBitrateEstimator(r.session.bitrateWindow, r.created)
 	r.isInited = true
 	r.isClosed = make(chan bool)
 
@@ -119,7 +207,11 @@ func (r *ReadStreamSRTCP) init(child streamSession, ssrc uint32) error {
 		// Create a buffer and limit it to 100KB
 		buff := packetio.NewBuffer()
 		buff.SetLimitSize(srtcpBufferSize)
-		r.buffer = buff
+		if r.session.readQueueSize > 0 {
+			buff.SetLimitCount(r.session.readQueueSize)
+		}
+		r.buffer = newBudgetBuffer(buff, r.session.queueBudget)
+		r.keepCompounds = true
 	}
 
 	return nil
@@ -130,6 +222,63 @@ func (r *ReadStreamSRTCP) GetSSRC() uint32 {
 	return r.ssrc
 }
 
+func (r *ReadStreamSRTCP) createdAt() time.Time {
+	return r.created
+}
+
+// Bitrate returns the protected bits per second received for the SSRC,
+// averaged over Config.BitrateWindow
+func (r *ReadStreamSRTCP) Bitrate() uint64 {
+	return r.bitrate()
+}
+
+func (r *ReadStreamSRTCP) bitrate() uint64 {
+	return r.readBitrate.bitrate(time.Now())
+}
+
+// received accounts for a protected packet of n bytes delivered to the stream
+func (r *ReadStreamSRTCP) received(n int) {
+	now := time.Now()
+
+	r.mu.Lock()
+	r.packets++
+	r.bytes += uint64(n)
+	r.lastPacket = now
+	r.mu.Unlock()
+
+	r.readBitrate.add(n, now)
+}
+
+// Stats returns the counters of the stream
+func (r *ReadStreamSRTCP) Stats() ReadStreamStats {
+	r.mu.Lock()
+	stats := ReadStreamStats{
+		Packets:    r.packets,
+		Bytes:      r.bytes,
+		LastPacket: r.lastPacket,
+		QueueDrops: r.dropped,
+	}
+	r.mu.Unlock()
+
+	crypto, index := r.session.session.remoteSRTCPStats(r.ssrc)
+	stats.Crypto, stats.LastIndex = crypto, uint64(index)
+	return stats
+}
+
+func (r *ReadStreamSRTCP) packetCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.packets
+}
+
+func (r *ReadStreamSRTCP) droppedCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.dropped
+}
+
 // WriteStreamSRTCP is stream for a single Session that is used to encrypt RTCP
 type WriteStreamSRTCP struct {
 	session *SessionSRTCP
@@ -150,6 +299,12 @@ func (w *WriteStreamSRTCP) Write(b []byte) (int, error) {
 	return w.session.write(b)
 }
 
+// Bitrate returns the protected bits per second written by the session,
+// averaged over Config.BitrateWindow
+func (w *WriteStreamSRTCP) Bitrate() uint64 {
+	return w.session.session.writeBitrate.bitrate(time.Now())
+}
+
 // SetWriteDeadline sets the deadline for the Write operation.
 // Setting to zero means no deadline.
 func (w *WriteStreamSRTCP) SetWriteDeadline(t time.Time) error {
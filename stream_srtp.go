@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp/v2"
 	"github.com/pion/transport/packetio"
 )
@@ -17,13 +18,40 @@ const srtpBufferSize = 1000 * 1000
 type ReadStreamSRTP struct {
 	mu sync.Mutex
 
-	isInited bool
-	isClosed chan bool
+	isInited      bool
+	isClosed      chan bool
+	closeReported bool
 
 	session *SessionSRTP
 	ssrc    uint32
+	created time.Time
+
+	readBitrate *bitrateEstimator
+	packets     uint64
+	bytes       uint64
+	dropped     uint64
+	lastPacket  time.Time
+
+	lastSenderReport   *rtcp.SenderReport
+	lastSenderReportAt time.Time
+
+	detachMu      sync.Mutex // serializes Detach and AttachReadStream
+	detached      bool
+	detachedState *srtpSSRCState
 
 	buffer io.ReadWriteCloser
+
+	// Headers parsed during decryption, in the order of the packets in the
+	// default buffer. Buffers of Config.BufferFactory may drop or reorder
+	// packets, so their headers are parsed again by the reader.
+	keepHeaders bool
+	headersMu   sync.Mutex
+	headers     []parsedHeader
+}
+
+type parsedHeader struct {
+	header *rtp.Header
+	len    int
 }
 
 // Used by getOrCreateReadStream
@@ -45,6 +73,8 @@ func (r *ReadStreamSRTP) init(child streamSession, ssrc uint32) error {
 
 	r.session = sessionSRTP
 	r.ssrc = ssrc
+	r.created = time.Now()
+	r.readBitrate = newBitrateEstimator(r.session.bitrateWindow, r.created)
 	r.isInited = true
 	r.isClosed = make(chan bool)
 
@@ -54,17 +84,39 @@ func (r *ReadStreamSRTP) init(child streamSession, ssrc uint32) error {
 	} else {
 		buff := packetio.NewBuffer()
 		buff.SetLimitSize(srtpBufferSize)
-		r.buffer = buff
+		if r.session.readQueueSize > 0 {
+			buff.SetLimitCount(r.session.readQueueSize)
+		}
+		r.buffer = newBudgetBuffer(buff, r.session.queueBudget)
+		r.keepHeaders = true
 	}
 
 	return nil
 }
 
-func (r *ReadStreamSRTP) write(buf []byte) (n int, err error) {
+func (r *ReadStreamSRTP) write(buf []byte, header *rtp.Header, headerLen int) (n int, err error) {
+	// The header is queued first, a reader may take the packet as soon as it
+	// is written
+	if r.keepHeaders {
+		r.headersMu.Lock()
+		r.headers = append(r.headers, parsedHeader{header, headerLen})
+		r.headersMu.Unlock()
+	}
+
 	n, err = r.buffer.Write(buf)
+	if err != nil && r.keepHeaders {
+		r.headersMu.Lock()
+		r.headers[len(r.headers)-1] = parsedHeader{}
+		r.headers = r.headers[:len(r.headers)-1]
+		r.headersMu.Unlock()
+	}
 
 	if errors.Is(err, packetio.ErrFull) {
 		// Silently drop data when the buffer is full.
+		r.mu.Lock()
+		r.dropped++
+		r.mu.Unlock()
+		r.session.session.queueDrops++ // decryptMutex is held
 		return len(buf), nil
 	}
 
@@ -73,65 +125,235 @@ func (r *ReadStreamSRTP) write(buf []byte) (n int, err error) {
 
 // Read reads and decrypts full RTP packet from the nextConn
 func (r *ReadStreamSRTP) Read(buf []byte) (int, error) {
-	return r.buffer.Read(buf)
+	n, _, err := r.read(buf)
+	return n, err
 }
 
-// ReadRTP reads and decrypts full RTP packet and its header from the nextConn
-func (r *ReadStreamSRTP) ReadRTP(buf []byte) (int, *rtp.Header, error) {
-	n, err := r.Read(buf)
+// read returns the next packet with the header parsed during its decryption,
+// if it was kept
+func (r *ReadStreamSRTP) read(buf []byte) (int, parsedHeader, error) {
+	n, err := r.buffer.Read(buf)
+	if !r.keepHeaders || (err != nil && !errors.Is(err, io.ErrShortBuffer)) {
+		return n, parsedHeader{}, err
+	}
+
+	// The packet was consumed, even if it did not fit in buf
+	r.headersMu.Lock()
+	defer r.headersMu.Unlock()
+	if len(r.headers) == 0 {
+		return n, parsedHeader{}, err
+	}
+	parsed := r.headers[0]
+	r.headers[0] = parsedHeader{}
+	r.headers = r.headers[1:]
+	return n, parsed, err
+}
+
+// readParsed reads the next packet and its header, parsing it again only if
+// decryption did not keep it
+func (r *ReadStreamSRTP) readParsed(buf []byte) (int, parsedHeader, error) {
+	n, parsed, err := r.read(buf)
 	if err != nil {
-		return 0, nil, err
+		return 0, parsedHeader{}, err
+	} else if parsed.header != nil {
+		return n, parsed, nil
 	}
 
-	header := &rtp.Header{}
+	parsed.header = &rtp.Header{}
+	parsed.len, err = parsed.header.Unmarshal(buf[:n])
+	if err != nil {
+		return 0, parsedHeader{}, err
+	}
+	return n, parsed, nil
+}
 
-	_, err = header.Unmarshal(buf[:n])
+// ReadRTP reads and decrypts full RTP packet and its header from the nextConn
+func (r *ReadStreamSRTP) ReadRTP(buf []byte) (int, *rtp.Header, error) {
+	n, parsed, err := r.readParsed(buf)
 	if err != nil {
 		return 0, nil, err
 	}
+	return n, parsed.header, nil
+}
 
-	return n, header, nil
+// ReadRTPPacket reads and decrypts the next RTP packet into buf, returning it
+// with the header parsed during decryption. The payload aliases buf.
+func (r *ReadStreamSRTP) ReadRTPPacket(buf []byte) (*rtp.Packet, error) {
+	n, parsed, err := r.readParsed(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &rtp.Packet{Header: *parsed.header, Payload: buf[parsed.len:n]}, nil
 }
 
 // SetReadDeadline sets the deadline for the Read operation.
-// Setting to zero means no deadline.
+// Setting to zero means no deadline. It fails for buffers of
+// Config.BufferFactory without a SetReadDeadline method.
 func (r *ReadStreamSRTP) SetReadDeadline(t time.Time) error {
-	if b, ok := r.buffer.(interface {
-		SetReadDeadline(time.Time) error
-	}); ok {
-		return b.SetReadDeadline(t)
-	}
-	return nil
+	return setBufferReadDeadline(r.buffer, t)
 }
 
-// Close removes the ReadStream from the session and cleans up any associated state
+// Close removes the ReadStream from the session and cleans up any associated state.
+// Packets received for the SSRC later create a new stream, unless the session
+// ignores it, see IgnoreSSRC.
 func (r *ReadStreamSRTP) Close() error {
+	return r.close(StreamClosedByApplication)
+}
+
+func (r *ReadStreamSRTP) close(reason StreamCloseReason) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
 
 	if !r.isInited {
+		r.mu.Unlock()
 		return errStreamNotInited
 	}
 
 	select {
 	case <-r.isClosed:
+		r.mu.Unlock()
 		return errStreamAlreadyClosed
 	default:
 		err := r.buffer.Close()
 		if err != nil {
+			r.mu.Unlock()
 			return err
 		}
 
 		r.session.removeReadStream(r.ssrc)
+
+		report := !r.closeReported
+		r.closeReported = true
+		r.mu.Unlock()
+
+		if report {
+			r.session.streamClosed(r.ssrc, reason)
+		}
 		return nil
 	}
 }
 
+// Detach removes the stream from its session without closing it, so it can be
+// attached to another session with SessionSRTP.AttachReadStream, e.g. when
+// migrating to a new transport. Buffered packets, stats and the rollover state
+// of the SSRC are kept. Reads block while the stream is detached.
+func (r *ReadStreamSRTP) Detach() error {
+	r.detachMu.Lock()
+	defer r.detachMu.Unlock()
+
+	r.mu.Lock()
+	switch {
+	case !r.isInited:
+		r.mu.Unlock()
+		return errStreamNotInited
+	case r.closeReported:
+		r.mu.Unlock()
+		return errStreamAlreadyClosed
+	case r.detached:
+		r.mu.Unlock()
+		return nil
+	}
+	session := r.session
+	r.detached = true
+	r.mu.Unlock()
+
+	// The read loop holds decryptMutex while delivering to r, so r.mu must not be held here
+	session.removeReadStream(r.ssrc)
+	r.detachedState = session.session.takeRemoteSRTPState(r.ssrc)
+	return nil
+}
+
+// LastSenderReport returns the latest RTCP sender report of the SSRC and when
+// it was received. It is only filled in by a SessionPair created with
+// Config.LinkSenderReports.
+func (r *ReadStreamSRTP) LastSenderReport() (*rtcp.SenderReport, time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastSenderReport, r.lastSenderReportAt, r.lastSenderReport != nil
+}
+
+func (r *ReadStreamSRTP) setSenderReport(sr *rtcp.SenderReport, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastSenderReport, r.lastSenderReportAt = sr, at
+}
+
+// ROC returns the rollover counter packets of the SSRC are decrypted with, it
+// is unknown until a packet is received or SetROC is called.
+func (r *ReadStreamSRTP) ROC() (uint32, bool) {
+	return r.session.session.remoteROC(r.ssrc)
+}
+
+// SetROC sets the rollover counter packets of the SSRC are decrypted with,
+// e.g. when joining a stream late and learning it out of band from the
+// forwarder that handed the stream off. The session must be started.
+func (r *ReadStreamSRTP) SetROC(roc uint32) error {
+	return r.session.session.setRemoteROC(r.ssrc, roc)
+}
+
 // GetSSRC returns the SSRC we are demuxing for
 func (r *ReadStreamSRTP) GetSSRC() uint32 {
 	return r.ssrc
 }
 
+func (r *ReadStreamSRTP) createdAt() time.Time {
+	return r.created
+}
+
+// Bitrate returns the protected bits per second received for the SSRC,
+// averaged over Config.BitrateWindow
+func (r *ReadStreamSRTP) Bitrate() uint64 {
+	return r.bitrate()
+}
+
+func (r *ReadStreamSRTP) bitrate() uint64 {
+	return r.readBitrate.bitrate(time.Now())
+}
+
+// received accounts for a protected packet of n bytes delivered to the stream
+func (r *ReadStreamSRTP) received(n int) {
+	now := time.Now()
+
+	r.mu.Lock()
+	r.packets++
+	r.bytes += uint64(n)
+	r.lastPacket = now
+	r.mu.Unlock()
+
+	r.readBitrate.add(n, now)
+}
+
+// Stats returns the counters of the stream
+func (r *ReadStreamSRTP) Stats() ReadStreamStats {
+	r.mu.Lock()
+	stats := ReadStreamStats{
+		Packets:    r.packets,
+		Bytes:      r.bytes,
+		LastPacket: r.lastPacket,
+		QueueDrops: r.dropped,
+	}
+	r.mu.Unlock()
+
+	crypto, index := r.session.session.remoteSRTPStats(r.ssrc)
+	stats.Crypto, stats.LastIndex = crypto, index
+	return stats
+}
+
+func (r *ReadStreamSRTP) packetCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.packets
+}
+
+func (r *ReadStreamSRTP) droppedCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.dropped
+}
+
 // WriteStreamSRTP is stream for a single Session that is used to encrypt RTP
 type WriteStreamSRTP struct {
 	session *SessionSRTP
@@ -142,13 +364,73 @@ func (w *WriteStreamSRTP) WriteRTP(header *rtp.Header, payload []byte) (int, err
 	return w.session.writeRTP(header, payload)
 }
 
+// WriteRawRTP encrypts a RTP packet given its marshaled header and payload and
+// writes to the connection. It lets forwarders skip building a rtp.Header, the
+// header bytes are sent as is.
+func (w *WriteStreamSRTP) WriteRawRTP(header, payload []byte) (int, error) {
+	return w.session.writeRawRTP(header, payload)
+}
+
+// Retransmit sends again the exact SRTP packet previously written for ssrc and
+// sequenceNumber, e.g. to answer a NACK. It needs Config.RetransmitCacheSize
+// and fails if the packet is no longer cached.
+func (w *WriteStreamSRTP) Retransmit(ssrc uint32, sequenceNumber uint16) (int, error) {
+	return w.session.retransmit(ssrc, sequenceNumber)
+}
+
 // Write encrypts and writes a full RTP packets to the nextConn
 func (w *WriteStreamSRTP) Write(b []byte) (int, error) {
 	return w.session.write(b)
 }
 
+// Bitrate returns the protected bits per second written by the session,
+// averaged over Config.BitrateWindow
+func (w *WriteStreamSRTP) Bitrate() uint64 {
+	return w.session.session.writeBitrate.bitrate(time.Now())
+}
+
 // SetWriteDeadline sets the deadline for the Write operation.
 // Setting to zero means no deadline.
 func (w *WriteStreamSRTP) SetWriteDeadline(t time.Time) error {
 	return w.session.setWriteDeadline(t)
 }
+
+// ManagedWriteStreamSRTP writes the RTP packets of a single SSRC, filling in
+// their SSRC and sequence numbers so they are never reused, which would
+// reuse keystream. See SessionSRTP.OpenManagedWriteStream.
+type ManagedWriteStreamSRTP struct {
+	session     *SessionSRTP
+	ssrc        uint32
+	payloadType uint8
+
+	mu             sync.Mutex
+	sequenceNumber uint16 // of the next packet
+}
+
+// SSRC returns the SSRC the stream writes packets of
+func (w *ManagedWriteStreamSRTP) SSRC() uint32 {
+	return w.ssrc
+}
+
+// WritePayload encrypts and writes a RTP packet carrying payload
+func (w *ManagedWriteStreamSRTP) WritePayload(payload []byte, timestamp uint32, marker bool) (int, error) {
+	return w.WriteRTP(&rtp.Header{
+		Version:     2,
+		PayloadType: w.payloadType,
+		Timestamp:   timestamp,
+		Marker:      marker,
+	}, payload)
+}
+
+// WriteRTP encrypts and writes a RTP packet, replacing the SSRC and sequence
+// number of header, which is left unchanged. A sequence number is used up
+// even if the write fails.
+func (w *ManagedWriteStreamSRTP) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	h := *header
+	h.SSRC, h.SequenceNumber = w.ssrc, w.sequenceNumber
+	w.sequenceNumber++
+	return w.session.writeRTP(&h, payload)
+}
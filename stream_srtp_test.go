@@ -61,6 +61,55 @@ func TestBufferFactory(t *testing.T) {
 	wg.Wait()
 }
 
+// noDeadlineBuffer hides the SetReadDeadline method of its buffer
+type noDeadlineBuffer struct{ io.ReadWriteCloser }
+
+func TestBufferFactoryReadDeadline(t *testing.T) {
+	for _, bf := range []func(packetio.BufferPacketType, uint32) io.ReadWriteCloser{
+		nil,
+		func(packetio.BufferPacketType, uint32) io.ReadWriteCloser {
+			return noDeadlineBuffer{packetio.NewBuffer()}
+		},
+	} {
+		config := &Config{
+			Keys: SessionKeys{
+				LocalMasterKey:   make([]byte, 16),
+				LocalMasterSalt:  make([]byte, 14),
+				RemoteMasterKey:  make([]byte, 16),
+				RemoteMasterSalt: make([]byte, 14),
+			},
+			BufferFactory: bf,
+			Profile:       ProtectionProfileAes128CmHmacSha1_80,
+		}
+		rtpSession, err := NewSessionSRTP(newNoopConn(), config)
+		assert.NoError(t, err)
+		rtcpSession, err := NewSessionSRTCP(newNoopConn(), config)
+		assert.NoError(t, err)
+
+		rtpStream, err := rtpSession.OpenReadStream(123)
+		assert.NoError(t, err)
+		rtcpStream, err := rtcpSession.OpenReadStream(123)
+		assert.NoError(t, err)
+
+		for _, setDeadline := range []func(time.Time) error{rtpStream.SetReadDeadline, rtcpStream.SetReadDeadline} {
+			if err = setDeadline(time.Now().Add(time.Millisecond)); bf != nil {
+				assert.ErrorIs(t, err, errReadDeadlineNotSupported)
+			} else {
+				assert.NoError(t, err)
+			}
+		}
+		if bf == nil {
+			_, err = rtpStream.Read(make([]byte, 1500))
+			var netErr net.Error
+			assert.ErrorAs(t, err, &netErr)
+			assert.True(t, netErr.Timeout())
+		}
+
+		assert.NoError(t, rtpSession.Close())
+		assert.NoError(t, rtcpSession.Close())
+	}
+}
+
 func BenchmarkWrite(b *testing.B) {
 	conn := newNoopConn()
 
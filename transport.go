@@ -0,0 +1,54 @@
+package srtp
+
+import (
+	"io"
+	"net"
+
+	"github.com/pion/srtp/v2/batchconn"
+)
+
+// conn returns the conn packets are currently read from and written to
+func (s *session) conn() net.Conn {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	return s.nextConn
+}
+
+// setTransport replaces the conn of the session, closing the previous one.
+// The contexts and the state of every SSRC are kept, the read loop carries
+// on with the new conn.
+func (s *session) setTransport(conn io.ReadWriter) error {
+	if conn == nil {
+		return errNoConn
+	}
+
+	prev, err := s.swapConn(batchconn.New(newReadWriterConn(conn), s.readBatchSize, s.packetSize))
+	if err != nil {
+		return err
+	}
+	return prev.Close()
+}
+
+func (s *session) swapConn(nextConn net.Conn) (net.Conn, error) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if s.connClosed {
+		return nil, ErrSessionClosed
+	}
+
+	switch prev := s.nextConn.(type) {
+	case *muxEndpoint:
+		return nil, errTransportShared
+	case *remoteAddrConn:
+		var err error
+		if nextConn, err = newRemoteAddrConn(nextConn, prev.RemoteAddr(), prev.acceptSource); err != nil {
+			return nil, err
+		}
+	}
+
+	prev := s.nextConn
+	s.nextConn = nextConn
+	return prev, nil
+}
@@ -1,6 +1,12 @@
 package srtp
 
-import "bytes"
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+)
 
 // Grow the buffer size to the given number of bytes.
 func growBufferSize(buf []byte, size int) []byte {
@@ -19,15 +25,92 @@ func allocateIfMismatch(dst, src []byte) []byte {
 		dst = make([]byte, len(src))
 		copy(dst, src)
 	} else if !bytes.Equal(dst, src) { // bytes.Equal returns on ref equality, no optimization needed
-		extraNeeded := len(src) - len(dst)
-		if extraNeeded > 0 {
-			dst = append(dst, make([]byte, extraNeeded)...)
-		} else if extraNeeded < 0 {
-			dst = dst[:len(dst)+extraNeeded]
-		}
-
+		dst = growBufferSize(dst, len(src))
 		copy(dst, src)
 	}
 
 	return dst
 }
+
+// authTagsEqual reports whether a received authentication tag matches the
+// expected one, in constant time to not tell how many leading bytes match
+func authTagsEqual(actual, expected []byte) bool {
+	return subtle.ConstantTimeCompare(actual, expected) == 1
+}
+
+// inPlace returns out within buf, copying it there if a cipher that does not
+// work in place, such as a custom one, wrote it elsewhere
+func inPlace(buf, out []byte) []byte {
+	if len(out) == 0 || &buf[:1][0] == &out[0] {
+		return out
+	}
+	return buf[:copy(buf[:cap(buf)], out)]
+}
+
+// ctrKeystreamBlocks is how many blocks of keystream xorBytesCTR generates at once
+const ctrKeystreamBlocks = 16
+
+// xorBytesCTR is cipher.NewCTR(block, counter[:]).XORKeyStream(dst, src) without
+// allocating a cipher.Stream, keystream is scratch space
+func xorBytesCTR(block cipher.Block, counter *[aes.BlockSize]byte, keystream, dst, src []byte) {
+	for len(src) > 0 {
+		n := len(keystream)
+		if len(src) < n {
+			n = (len(src) + aes.BlockSize - 1) / aes.BlockSize * aes.BlockSize
+		}
+		for i := 0; i < n; i += aes.BlockSize {
+			block.Encrypt(keystream[i:], counter[:])
+			// A packet is far from the 2^64 blocks a carry would take
+			binary.BigEndian.PutUint64(counter[8:], binary.BigEndian.Uint64(counter[8:])+1)
+		}
+
+		n = xorBytes(dst, src, keystream[:n])
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// xorBytes sets dst to a XOR b over the length of the shorter one, which it
+// returns
+func xorBytes(dst, a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	i := 0
+	for ; i+8 <= n; i += 8 {
+		binary.LittleEndian.PutUint64(dst[i:], binary.LittleEndian.Uint64(a[i:])^binary.LittleEndian.Uint64(b[i:]))
+	}
+	for ; i < n; i++ {
+		dst[i] = a[i] ^ b[i]
+	}
+	return n
+}
+
+// zeroBytes overwrites b, e.g. to wipe key material
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// wipeBlock overwrites the key schedule of the block ciphers implemented in
+// this package. Those of crypto/aes are out of reach.
+func wipeBlock(b cipher.Block) {
+	if w, ok := b.(interface{ wipe() }); ok {
+		w.wipe()
+	}
+}
+
+// rtpFixedHeaderSize is the size of a RTP header without CSRCs or extension
+const rtpFixedHeaderSize = 12
+
+// rawHeaderSequenceNumber reads the sequence number of a marshaled RTP header
+func rawHeaderSequenceNumber(headerRaw []byte) uint16 {
+	return binary.BigEndian.Uint16(headerRaw[2:])
+}
+
+// rawHeaderSSRC reads the SSRC of a marshaled RTP header
+func rawHeaderSSRC(headerRaw []byte) uint32 {
+	return binary.BigEndian.Uint32(headerRaw[8:])
+}
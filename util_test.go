@@ -0,0 +1,56 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXorBytesCTR(t *testing.T) {
+	block, err := aes.NewCipher([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+
+	// Lengths around the block and keystream sizes, the counter carries over a byte
+	for _, n := range []int{0, 1, 15, 16, 17, 255, 256, 257, 1200, 4099} {
+		src := make([]byte, n)
+		for i := range src {
+			src[i] = byte(i)
+		}
+		iv := [aes.BlockSize]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0xfe}
+
+		expected := make([]byte, n)
+		cipher.NewCTR(block, iv[:]).XORKeyStream(expected, src)
+
+		var keystream [ctrKeystreamBlocks * aes.BlockSize]byte
+		xorBytesCTR(block, &iv, keystream[:], src, src)
+		assert.Equal(t, expected, src, "length %d", n)
+	}
+}
+
+// BenchmarkAuthTagsEqual compares tags differing in their first or last
+// byte, both take the same time as the comparison is constant time
+func BenchmarkAuthTagsEqual(b *testing.B) {
+	// Tags this large make an early exit measurable
+	expected := make([]byte, 1<<16)
+	firstDiffers := make([]byte, len(expected))
+	firstDiffers[0] = 0xff
+	lastDiffers := make([]byte, len(expected))
+	lastDiffers[len(lastDiffers)-1] = 0xff
+
+	for _, c := range []struct {
+		name   string
+		actual []byte
+	}{{"FirstDiffers", firstDiffers}, {"LastDiffers", lastDiffers}} {
+		actual := c.actual
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(expected)))
+			for i := 0; i < b.N; i++ {
+				if authTagsEqual(actual, expected) {
+					b.Fatal("Expected the tags to differ")
+				}
+			}
+		})
+	}
+}